@@ -33,6 +33,7 @@
 #include <grpcpp/grpcpp.h>
 #include <grpcpp/health_check_service_interface.h>
 #include <atomic>
+#include <cmath>
 #include <signal.h>
 
 using grpc::Server;
@@ -153,12 +154,46 @@ static json probs_vector_to_json(const llama_context *ctx, const std::vector<com
         std::string tok_str = tokens_to_output_formatted_string(ctx, prob.tok);
         out.push_back(json{
             {"content", tok_str},
+            {"prob",    prob.prob},
             {"probs",   probs_for_token},
         });
     }
     return out;
 }
 
+static float to_logprob(float prob)
+{
+    // OpenAI reports the log probability of the impossible tokens as -9999
+    return prob > 0.0f ? std::log(prob) : -9999.0f;
+}
+
+// add the log probabilities of the completion probabilities of a result to the reply, with at most top_logprobs of
+// the most likely tokens at each position
+static void set_reply_logprobs(backend::Reply &reply, const json &result, int top_logprobs)
+{
+    if (!result.contains("completion_probabilities"))
+    {
+        return;
+    }
+    for (const auto &p : result["completion_probabilities"])
+    {
+        backend::Logprob *logprob = reply.add_logprobs();
+        logprob->set_token(p.value("content", ""));
+        logprob->set_logprob(to_logprob(p.value("prob", 0.0f)));
+        int n = 0;
+        for (const auto &top : p["probs"])
+        {
+            if (n++ >= top_logprobs)
+            {
+                break;
+            }
+            backend::TokenLogprob *t = logprob->add_top_logprobs();
+            t->set_token(top.value("tok_str", ""));
+            t->set_logprob(to_logprob(top.value("prob", 0.0f)));
+        }
+    }
+}
+
 struct llama_client_slot
 {
     int id;
@@ -172,6 +207,11 @@ struct llama_client_slot
     // used to determine the slot that has been used the longest
     int64_t t_last_used = -1;
 
+    // the hash and the length of the prompt of the last request, the next turns of its conversation start with it and
+    // are routed to this slot to reuse its KV cache
+    size_t prompt_prefix_hash = 0;
+    size_t prompt_prefix_len  = 0;
+
     // generation props
     int32_t n_ctx       = 0;  // context size per slot
     int32_t n_past      = 0;
@@ -639,9 +679,11 @@ struct llama_server_context
         return prompt_tokens;
     }
 
-    llama_client_slot* get_slot(int id) {
+    llama_client_slot* get_slot(int id, const json & prompt) {
         int64_t t_last = ggml_time_us();
         llama_client_slot *last_used = nullptr;
+        llama_client_slot *cached = nullptr;
+        const std::string prompt_str = prompt.is_string() ? prompt.get<std::string>() : "";
 
         for (llama_client_slot & slot : slots)
         {
@@ -650,14 +692,27 @@ struct llama_server_context
                 return &slot;
             }
 
-            if (slot.available() && slot.t_last_used < t_last)
+            if (!slot.available())
+            {
+                continue;
+            }
+
+            // prefer the slot with the longest prompt prefix, the one of the previous turn of the conversation
+            if (slot.prompt_prefix_len > 0 && prompt_str.size() >= slot.prompt_prefix_len &&
+                (cached == nullptr || slot.prompt_prefix_len > cached->prompt_prefix_len) &&
+                std::hash<std::string>{}(prompt_str.substr(0, slot.prompt_prefix_len)) == slot.prompt_prefix_hash)
+            {
+                cached = &slot;
+            }
+
+            if (slot.t_last_used < t_last)
             {
                 last_used = &slot;
                 t_last = slot.t_last_used;
             }
         }
 
-        return last_used;
+        return cached != nullptr ? cached : last_used;
     }
 
     bool launch_slot_with_data(llama_client_slot* &slot, json data) {
@@ -1280,6 +1335,7 @@ struct llama_server_context
             {"model",               params.model_alias},
             {"tokens_predicted",    slot.n_decoded},
             {"tokens_evaluated",    slot.num_prompt_tokens},
+            {"tokens_cached_prompt", slot.num_prompt_tokens - slot.num_prompt_tokens_processed},
             {"generation_settings", get_formated_generation(slot)},
             {"prompt",              slot.prompt},
             {"truncated",           slot.truncated},
@@ -1496,7 +1552,7 @@ struct llama_server_context
         switch (task.type)
         {
             case TASK_TYPE_COMPLETION: {
-                llama_client_slot *slot = get_slot(json_value(task.data, "slot_id", -1));
+                llama_client_slot *slot = get_slot(json_value(task.data, "slot_id", -1), task.data.contains("prompt") ? task.data.at("prompt") : json());
                 if (slot == nullptr)
                 {
                     // if no slot is available, we defer this task for processing later
@@ -1519,6 +1575,7 @@ struct llama_server_context
                         slot.cache_tokens.clear();
                         slot.n_past    = 0;
                         slot.n_past_se = 0;
+                        slot.prompt_prefix_len = 0;
                     }
                 }
 
@@ -1535,6 +1592,17 @@ struct llama_server_context
                     send_error(task, "internal_error");
                     break;
                 }
+
+                if (slot->prompt.is_string())
+                {
+                    const std::string prompt_str = slot->prompt.get<std::string>();
+                    slot->prompt_prefix_hash = std::hash<std::string>{}(prompt_str);
+                    slot->prompt_prefix_len  = prompt_str.size();
+                }
+                else
+                {
+                    slot->prompt_prefix_len = 0;
+                }
             } break;
             case TASK_TYPE_CANCEL: { // release slot linked with the task id
                 for (auto & slot : slots)
@@ -1992,6 +2060,19 @@ struct llama_server_context
                     });
                 }
 
+                // the sampled token may not be one of the most likely tokens
+                if (slot.sparams.n_probs > 0)
+                {
+                    for (size_t i = 0; i < cur_p->size; ++i)
+                    {
+                        if (cur_p->data[i].id == id)
+                        {
+                            result.prob = cur_p->data[i].p;
+                            break;
+                        }
+                    }
+                }
+
                 if (!process_token(result, slot))
                 {
                     slot.release();
@@ -2119,7 +2200,8 @@ json parse_options(bool streaming, const backend::PredictOptions* predict, llama
     //
     json data;
     data["stream"] = streaming;
-    data["cache_prompt"] = predict->promptcacheall();
+    // the KV cache of the prompt prefix of the previous request on the slot is reused, unless disabled
+    data["cache_prompt"] = predict->promptcacheall() || !predict->nopromptcachereuse();
     data["n_predict"] = predict->tokens() == 0 ? -1 : predict->tokens();
     data["top_k"] = predict->topk();
     data["top_p"] = predict->topp();
@@ -2153,7 +2235,8 @@ json parse_options(bool streaming, const backend::PredictOptions* predict, llama
     }
 
     data["stop"] = predict->stopprompts();
-    // data["n_probs"] = predict->nprobs();
+    // the probability of the sampled token is computed with the most likely tokens
+    data["n_probs"] = predict->logprobs() ? std::max(predict->toplogprobs(), 1) : 0;
     //TODO: images,
 
     return data;
@@ -2358,6 +2441,20 @@ static void params_parse(const backend::ModelOptions* request,
 
 
 // GRPC Server start
+// Waits for the next result of the task. The task is cancelled, releasing its slot, if the client cancels the
+// request or disconnects while waiting.
+static bool recv_or_cancel(grpc::ServerContext* context, int task_id, task_result & result) {
+    while (!llama.queue_results.recv_with_timeout(task_id, result, std::chrono::milliseconds(100))) {
+        if (context->IsCancelled()) {
+            LOG_INFO("request cancelled by the client", {{"task_id", task_id}});
+            llama.request_cancel(task_id);
+            llama.queue_results.remove_waiting_task_id(task_id);
+            return false;
+        }
+    }
+    return true;
+}
+
 class BackendServiceImpl final : public backend::Backend::Service {
 public:
   grpc::Status Health(ServerContext* context, const backend::HealthMessage* request, backend::Reply* reply) {
@@ -2394,7 +2491,10 @@ public:
         llama.request_completion(task_id, data, false, false, -1);
         while (true)
         {
-            task_result result = llama.queue_results.recv(task_id);
+            task_result result;
+            if (!recv_or_cancel(context, task_id, result)) {
+                return grpc::Status::CANCELLED;
+            }
             if (!result.error) {
                 const std::string str =
                 "data: " +
@@ -2413,14 +2513,23 @@ public:
                 reply.set_tokens(tokens_predicted);
                 int32_t tokens_evaluated = result.result_json.value("tokens_evaluated", 0);
                 reply.set_prompt_tokens(tokens_evaluated);
+                reply.set_cached_prompt_tokens(result.result_json.value("tokens_cached_prompt", 0));
+                // the final result repeats the probabilities of all the tokens
+                if (request->logprobs() && !result.stop) {
+                    set_reply_logprobs(reply, result.result_json, request->toplogprobs());
+                }
 
                 // Log Request Correlation Id
                 LOG_VERBOSE("correlation:", {
                     { "id", data["correlation_id"] }
                 });
 
-                // Send the reply
-                writer->Write(reply);
+                // Send the reply, the generation stops if the client is gone
+                if (!writer->Write(reply)) {
+                    llama.request_cancel(task_id);
+                    llama.queue_results.remove_waiting_task_id(task_id);
+                    return grpc::Status::CANCELLED;
+                }
 
                 if (result.stop) {
                     break;
@@ -2429,6 +2538,7 @@ public:
                 break;
             }
         }
+        llama.queue_results.remove_waiting_task_id(task_id);
 
         return grpc::Status::OK;
     }
@@ -2440,7 +2550,11 @@ public:
         llama.queue_results.add_waiting_task_id(task_id);
         llama.request_completion(task_id, data, false, false, -1);
         std::string completion_text;
-        task_result result = llama.queue_results.recv(task_id);
+        task_result result;
+        if (!recv_or_cancel(context, task_id, result)) {
+            return grpc::Status::CANCELLED;
+        }
+        llama.queue_results.remove_waiting_task_id(task_id);
         if (!result.error && result.stop) {
             
             // Log Request Correlation Id
@@ -2452,8 +2566,12 @@ public:
             int32_t tokens_predicted = result.result_json.value("tokens_predicted", 0);
             int32_t tokens_evaluated = result.result_json.value("tokens_evaluated", 0);
             reply->set_prompt_tokens(tokens_evaluated);
+            reply->set_cached_prompt_tokens(result.result_json.value("tokens_cached_prompt", 0));
             reply->set_tokens(tokens_predicted);
             reply->set_message(completion_text);
+            if (request->logprobs()) {
+                set_reply_logprobs(*reply, result.result_json, request->toplogprobs());
+            }
         }
         else
         {
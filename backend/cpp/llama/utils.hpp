@@ -7,6 +7,7 @@
 #include <set>
 #include <mutex>
 #include <condition_variable>
+#include <chrono>
 #include <unordered_map>
 
 #include "json.hpp"
@@ -131,6 +132,7 @@ struct completion_token_output
 
     std::vector<token_prob> probs;
     llama_token tok;
+    float prob = 0.0f; // probability of the sampled token, when n_probs > 0
     std::string text_to_send;
 };
 
@@ -378,6 +380,29 @@ struct llama_server_response {
         // should never reach here
     }
 
+    // Like recv, but returns false if there is no response for this task_id before the timeout
+    bool recv_with_timeout(int task_id, task_result & result, std::chrono::milliseconds timeout) {
+        const auto deadline = std::chrono::steady_clock::now() + timeout;
+        std::unique_lock<std::mutex> lock(mutex_results);
+        while (true)
+        {
+            for (int i = 0; i < (int) queue_results.size(); i++)
+            {
+                if (queue_results[i].id == task_id)
+                {
+                    assert(queue_results[i].multitask_id == -1);
+                    result = queue_results[i];
+                    queue_results.erase(queue_results.begin() + i);
+                    return true;
+                }
+            }
+            if (condition_results.wait_until(lock, deadline) == std::cv_status::timeout)
+            {
+                return false;
+            }
+        }
+    }
+
     // Register the function to update multitask
     void on_multitask_update(callback_multitask_t callback) {
         callback_update_multitask = callback;
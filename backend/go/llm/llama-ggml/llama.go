@@ -167,7 +167,11 @@ func buildPredictOptions(opts *pb.PredictOptions) []llama.PredictOption {
 }
 
 func (llm *LLM) Predict(opts *pb.PredictOptions) (string, error) {
-	return llm.llama.Predict(opts.Prompt, buildPredictOptions(opts)...)
+	// Stop generating when the client cancels the request
+	predictOptions := append(buildPredictOptions(opts), llama.SetTokenCallback(func(token string) bool {
+		return !llm.Canceled()
+	}))
+	return llm.llama.Predict(opts.Prompt, predictOptions...)
 }
 
 func (llm *LLM) PredictStream(opts *pb.PredictOptions, results chan string) error {
@@ -175,7 +179,8 @@ func (llm *LLM) PredictStream(opts *pb.PredictOptions, results chan string) erro
 
 	predictOptions = append(predictOptions, llama.SetTokenCallback(func(token string) bool {
 		results <- token
-		return true
+		// Stop generating when the client cancels the request
+		return !llm.Canceled()
 	}))
 
 	go func() {
@@ -202,7 +202,11 @@ func (llm *LLM) Predict(opts *pb.PredictOptions) (string, error) {
 	if llm.draftModel != nil {
 		return llm.llama.SpeculativeSampling(llm.draftModel, opts.Prompt, buildPredictOptions(opts)...)
 	}
-	return llm.llama.Predict(opts.Prompt, buildPredictOptions(opts)...)
+	// Stop generating when the client cancels the request
+	predictOptions := append(buildPredictOptions(opts), llama.SetTokenCallback(func(token string) bool {
+		return !llm.Canceled()
+	}))
+	return llm.llama.Predict(opts.Prompt, predictOptions...)
 }
 
 func (llm *LLM) PredictStream(opts *pb.PredictOptions, results chan string) error {
@@ -210,7 +214,8 @@ func (llm *LLM) PredictStream(opts *pb.PredictOptions, results chan string) erro
 
 	predictOptions = append(predictOptions, llama.SetTokenCallback(func(token string) bool {
 		results <- token
-		return true
+		// Stop generating when the client cancels the request
+		return !llm.Canceled()
 	}))
 
 	go func() {
@@ -0,0 +1,354 @@
+package main
+
+// A Hierarchical Navigable Small World graph for approximate nearest neighbour search.
+// See https://arxiv.org/abs/1603.09320
+//
+// The index only holds the keys, values are looked up in the store when the results are returned.
+// Vectors are normalized when inserted, so the similarity between two nodes is just their dot product,
+// which is the same cosine similarity the exact search returns.
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+)
+
+const (
+	defaultHNSWM              = 16
+	defaultHNSWEfConstruction = 200
+	defaultHNSWEf             = 64
+
+	// Fixed so the graph, and therefore the results, are the same for the same inserts
+	hnswSeed = 42
+)
+
+// hnswParams are the parameters with which the HNSW index of a store is built
+type hnswParams struct {
+	M              int `json:"m"`
+	EfConstruction int `json:"ef_construction"`
+}
+
+type hnswNode struct {
+	key []float32
+	vec []float32
+	// neighbors[l] are the neighbours of the node on layer l
+	neighbors [][]int
+	deleted   bool
+}
+
+type hnswIndex struct {
+	m, mMax0       int
+	efConstruction int
+	levelMult      float64
+	rng            *rand.Rand
+
+	nodes []*hnswNode
+	// Node ids by key, see hnswKey
+	ids        map[string]int
+	entryPoint int
+	maxLevel   int
+	deleted    int
+}
+
+func newHNSWIndex(m, efConstruction int) *hnswIndex {
+	if m < 2 {
+		m = defaultHNSWM
+	}
+	if efConstruction < 1 {
+		efConstruction = defaultHNSWEfConstruction
+	}
+
+	return &hnswIndex{
+		m:              m,
+		mMax0:          2 * m,
+		efConstruction: efConstruction,
+		levelMult:      1 / math.Log(float64(m)),
+		rng:            rand.New(rand.NewSource(hnswSeed)),
+		ids:            make(map[string]int),
+		entryPoint:     -1,
+	}
+}
+
+func normalize(k []float32) []float32 {
+	var mag float64
+	for _, v := range k {
+		mag += float64(v * v)
+	}
+	mag = math.Sqrt(mag)
+
+	n := make([]float32, len(k))
+	if mag == 0 {
+		return n
+	}
+	for i, v := range k {
+		n[i] = float32(float64(v) / mag)
+	}
+
+	return n
+}
+
+func dot(k1, k2 []float32) float32 {
+	assert(len(k1) == len(k2), fmt.Sprintf("dot: len(k1) = %d, len(k2) = %d", len(k1), len(k2)))
+
+	var d float32
+	for i := range k1 {
+		d += k1[i] * k2[i]
+	}
+
+	return d
+}
+
+func hnswKey(k []float32) string {
+	b := make([]byte, 0, len(k)*4)
+	for _, v := range k {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+
+	return string(b)
+}
+
+func (h *hnswIndex) randomLevel() int {
+	return int(math.Floor(-math.Log(1-h.rng.Float64()) * h.levelMult))
+}
+
+func (h *hnswIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return h.mMax0
+	}
+	return h.m
+}
+
+// Len is the number of live (not deleted) nodes
+func (h *hnswIndex) Len() int {
+	return len(h.nodes) - h.deleted
+}
+
+// Insert adds a key to the graph, inserting a key that is already present is a no-op
+func (h *hnswIndex) Insert(key []float32) {
+	if id, exists := h.ids[hnswKey(key)]; exists {
+		if h.nodes[id].deleted {
+			h.nodes[id].deleted = false
+			h.deleted--
+		}
+		return
+	}
+
+	level := h.randomLevel()
+	node := &hnswNode{
+		key:       key,
+		vec:       normalize(key),
+		neighbors: make([][]int, level+1),
+	}
+	id := len(h.nodes)
+	h.nodes = append(h.nodes, node)
+	h.ids[hnswKey(key)] = id
+
+	if h.entryPoint == -1 {
+		h.entryPoint = id
+		h.maxLevel = level
+		return
+	}
+
+	ep := h.entryPoint
+	for l := h.maxLevel; l > level; l-- {
+		ep = h.greedyClosest(node.vec, ep, l)
+	}
+
+	for l := min(level, h.maxLevel); l >= 0; l-- {
+		candidates := h.searchLayer(node.vec, []int{ep}, h.efConstruction, l)
+		neighbors := h.selectNeighbors(candidates, h.m)
+		node.neighbors[l] = neighbors
+
+		for _, n := range neighbors {
+			h.connect(n, id, l)
+		}
+
+		ep = candidates[0].id
+	}
+
+	if level > h.maxLevel {
+		h.maxLevel = level
+		h.entryPoint = id
+	}
+}
+
+// connect adds id to the neighbours of n on level l, pruning them if there are too many
+func (h *hnswIndex) connect(n, id, l int) {
+	node := h.nodes[n]
+	node.neighbors[l] = append(node.neighbors[l], id)
+
+	if len(node.neighbors[l]) <= h.maxNeighbors(l) {
+		return
+	}
+
+	candidates := make([]hnswCandidate, len(node.neighbors[l]))
+	for i, nb := range node.neighbors[l] {
+		candidates[i] = hnswCandidate{id: nb, sim: dot(node.vec, h.nodes[nb].vec)}
+	}
+	slices.SortFunc(candidates, compareCandidates)
+	node.neighbors[l] = h.selectNeighbors(candidates, h.maxNeighbors(l))
+}
+
+// selectNeighbors takes the m most similar candidates, which must be sorted by decreasing similarity
+func (h *hnswIndex) selectNeighbors(candidates []hnswCandidate, m int) []int {
+	n := min(m, len(candidates))
+	neighbors := make([]int, n)
+	for i := 0; i < n; i++ {
+		neighbors[i] = candidates[i].id
+	}
+
+	return neighbors
+}
+
+func (h *hnswIndex) greedyClosest(vec []float32, ep, l int) int {
+	best := dot(vec, h.nodes[ep].vec)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range h.nodes[ep].neighbors[l] {
+			if sim := dot(vec, h.nodes[n].vec); sim > best {
+				best = sim
+				ep = n
+				changed = true
+			}
+		}
+	}
+
+	return ep
+}
+
+// Delete marks the node with the given key as deleted.
+// Deleted nodes are still used to navigate the graph, but are never returned.
+func (h *hnswIndex) Delete(key []float32) {
+	id, exists := h.ids[hnswKey(key)]
+	if !exists || h.nodes[id].deleted {
+		return
+	}
+
+	h.nodes[id].deleted = true
+	h.deleted++
+}
+
+// Search returns up to topK live nodes that are the most similar to key, sorted by decreasing similarity.
+// Only the nodes for which accept returns true are returned.
+func (h *hnswIndex) Search(key []float32, topK, ef int, accept func(id int) bool) []hnswCandidate {
+	if h.entryPoint == -1 {
+		return nil
+	}
+
+	if ef < topK {
+		ef = topK
+	}
+
+	vec := normalize(key)
+	ep := h.entryPoint
+	for l := h.maxLevel; l > 0; l-- {
+		ep = h.greedyClosest(vec, ep, l)
+	}
+
+	candidates := h.searchLayer(vec, []int{ep}, ef, 0)
+
+	results := make([]hnswCandidate, 0, topK)
+	for _, c := range candidates {
+		if h.nodes[c.id].deleted || !accept(c.id) {
+			continue
+		}
+		results = append(results, c)
+		if len(results) == topK {
+			break
+		}
+	}
+
+	return results
+}
+
+// searchLayer returns the ef nodes closest to vec on layer l, sorted by decreasing similarity
+func (h *hnswIndex) searchLayer(vec []float32, entryPoints []int, ef, l int) []hnswCandidate {
+	visited := make(map[int]struct{}, ef*4)
+	candidates := &candidateHeap{max: true}
+	results := &candidateHeap{}
+
+	for _, ep := range entryPoints {
+		c := hnswCandidate{id: ep, sim: dot(vec, h.nodes[ep].vec)}
+		visited[ep] = struct{}{}
+		heap.Push(candidates, c)
+		heap.Push(results, c)
+	}
+
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && c.sim < results.items[0].sim {
+			break
+		}
+
+		for _, n := range h.nodes[c.id].neighbors[l] {
+			if _, ok := visited[n]; ok {
+				continue
+			}
+			visited[n] = struct{}{}
+
+			sim := dot(vec, h.nodes[n].vec)
+			if results.Len() < ef || sim > results.items[0].sim {
+				heap.Push(candidates, hnswCandidate{id: n, sim: sim})
+				heap.Push(results, hnswCandidate{id: n, sim: sim})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := results.items
+	slices.SortFunc(sorted, compareCandidates)
+
+	return sorted
+}
+
+type hnswCandidate struct {
+	id  int
+	sim float32
+}
+
+// compareCandidates sorts by decreasing similarity, then by id so the order is stable
+func compareCandidates(a, b hnswCandidate) int {
+	if a.sim > b.sim {
+		return -1
+	}
+	if a.sim < b.sim {
+		return 1
+	}
+	return a.id - b.id
+}
+
+// candidateHeap is a min-heap on similarity, or a max-heap when max is set
+type candidateHeap struct {
+	items []hnswCandidate
+	max   bool
+}
+
+func (ch candidateHeap) Len() int { return len(ch.items) }
+
+func (ch candidateHeap) Less(i, j int) bool {
+	if ch.max {
+		return ch.items[i].sim > ch.items[j].sim
+	}
+	return ch.items[i].sim < ch.items[j].sim
+}
+
+func (ch candidateHeap) Swap(i, j int) {
+	ch.items[i], ch.items[j] = ch.items[j], ch.items[i]
+}
+
+func (ch *candidateHeap) Push(x any) {
+	ch.items = append(ch.items, x.(hnswCandidate))
+}
+
+func (ch *candidateHeap) Pop() any {
+	old := ch.items
+	n := len(old)
+	item := old[n-1]
+	ch.items = old[0 : n-1]
+	return item
+}
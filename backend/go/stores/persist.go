@@ -0,0 +1,423 @@
+package main
+
+// Persistence for the local-store backend.
+//
+// Every mutation is appended to a write-ahead log (wal.log) before it is applied in memory.
+// Periodically the whole store is written to a snapshot (snapshot.bin) and the log is truncated.
+// On load the snapshot is read first, then the log is replayed on top of it.
+//
+// Both files are a sequence of records with the following layout (little endian):
+//
+//	op (1 byte) | payload length (uint32) | payload | crc32 of op and payload (uint32)
+//
+// A torn write at the end of the log (e.g. the process was killed) is detected via the length or checksum
+// and the log is truncated to the last good record.
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	walFileName      = "wal.log"
+	snapshotFileName = "snapshot.bin"
+	// The parameters of the HNSW index, in JSON
+	hnswFileName = "hnsw.json"
+
+	opSet    byte = 1
+	opDelete byte = 2
+	// Like opSet, but every entry also carries its metadata
+	opSetWithMetadata byte = 3
+
+	defaultSnapshotInterval = 5 * time.Minute
+)
+
+type persistence struct {
+	dir      string
+	wal      *os.File
+	interval time.Duration
+
+	// Number of records in the log since the last snapshot
+	pending int
+}
+
+// parsePersistenceOptions reads the store specific options passed by LocalAI in ModelOptions.Options
+// e.g. "persist_dir:/models/stores/default" and "snapshot_interval:5m"
+func parsePersistenceOptions(opts []string) (dir string, interval time.Duration, err error) {
+	interval = defaultSnapshotInterval
+	for _, o := range opts {
+		k, v, found := strings.Cut(o, ":")
+		if !found {
+			continue
+		}
+		switch k {
+		case "persist_dir":
+			dir = v
+		case "snapshot_interval":
+			interval, err = time.ParseDuration(v)
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid snapshot_interval %q: %w", v, err)
+			}
+		}
+	}
+
+	return dir, interval, nil
+}
+
+// openPersistence opens (or creates) the persistence directory and restores the store content
+func (s *Store) openPersistence(dir string, interval time.Duration) error {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return fmt.Errorf("failed creating store directory: %w", err)
+	}
+
+	if err := s.replayFile(filepath.Join(dir, snapshotFileName), false); err != nil {
+		return fmt.Errorf("failed loading snapshot: %w", err)
+	}
+
+	walPath := filepath.Join(dir, walFileName)
+	if err := s.replayFile(walPath, true); err != nil {
+		return fmt.Errorf("failed replaying write-ahead log: %w", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, hnswFileName))
+	if err == nil {
+		err = json.Unmarshal(data, &s.hnsw)
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed loading the HNSW parameters: %w", err)
+	}
+
+	wal, err := os.OpenFile(walPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return fmt.Errorf("failed opening write-ahead log: %w", err)
+	}
+
+	s.persist = &persistence{
+		dir:      dir,
+		wal:      wal,
+		interval: interval,
+	}
+
+	log.Info().Msgf("Store loaded from %s: %d keys", dir, len(s.keys))
+
+	// Compact what we have replayed straight away, so the log starts empty
+	if err := s.snapshot(); err != nil {
+		return err
+	}
+
+	if interval > 0 {
+		go s.snapshotLoop()
+	}
+
+	return nil
+}
+
+// persistHNSWParams writes the parameters of the HNSW index of the store, or removes them once they are reset
+func (s *Store) persistHNSWParams() error {
+	if s.persist == nil {
+		return nil
+	}
+	path := filepath.Join(s.persist.dir, hnswFileName)
+	if s.hnsw == (hnswParams{}) {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed removing the HNSW parameters: %w", err)
+		}
+		return nil
+	}
+	data, err := json.Marshal(s.hnsw)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0640); err != nil {
+		return fmt.Errorf("failed writing the HNSW parameters: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) snapshotLoop() {
+	ticker := time.NewTicker(s.persist.interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// The gRPC server serializes all the calls through the same lock
+		s.Lock()
+		if s.persist.pending > 0 {
+			if err := s.snapshot(); err != nil {
+				log.Error().Err(err).Msg("failed writing store snapshot")
+			}
+		}
+		s.Unlock()
+	}
+}
+
+// replayFile applies all the records in path to the store.
+// When truncate is true, a corrupted tail is cut off instead of returning an error.
+func (s *Store) replayFile(path string, truncate bool) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	var offset int64
+	for {
+		op, payload, n, err := readRecord(r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if !truncate {
+				return err
+			}
+			log.Warn().Err(err).Msgf("Store: truncating %s at offset %d", path, offset)
+			return os.Truncate(path, offset)
+		}
+
+		if err := s.applyRecord(op, payload); err != nil {
+			return err
+		}
+		offset += n
+	}
+}
+
+func (s *Store) applyRecord(op byte, payload []byte) error {
+	keys, values, metadata, err := decodePayload(payload, op == opSetWithMetadata)
+	if err != nil {
+		return err
+	}
+
+	switch op {
+	case opSet, opSetWithMetadata:
+		if len(keys) == 0 {
+			return nil
+		}
+		return s.StoresSet(&pb.StoresSetOptions{Keys: keys, Values: values, Metadata: metadata})
+	case opDelete:
+		if len(keys) == 0 {
+			return nil
+		}
+		return s.StoresDelete(&pb.StoresDeleteOptions{Keys: keys})
+	default:
+		return fmt.Errorf("unknown record type %d", op)
+	}
+}
+
+// logRecord appends a record to the write-ahead log and syncs it to disk.
+// It is a no-op when the store is not persistent or a replay is in progress.
+func (s *Store) logRecord(op byte, keys []*pb.StoresKey, values []*pb.StoresValue, metadata []string) error {
+	if s.persist == nil {
+		return nil
+	}
+
+	if _, err := s.persist.wal.Write(encodeRecord(op, encodePayload(keys, values, metadata, op == opSetWithMetadata))); err != nil {
+		return fmt.Errorf("failed writing to write-ahead log: %w", err)
+	}
+	if err := s.persist.wal.Sync(); err != nil {
+		return fmt.Errorf("failed syncing write-ahead log: %w", err)
+	}
+	s.persist.pending++
+
+	return nil
+}
+
+// snapshot writes the whole store to disk and truncates the write-ahead log
+func (s *Store) snapshot() error {
+	keys := make([]*pb.StoresKey, len(s.keys))
+	values := make([]*pb.StoresValue, len(s.values))
+	metadata := make([]string, len(s.metadata))
+	for i := range s.keys {
+		keys[i] = &pb.StoresKey{Floats: s.keys[i]}
+		values[i] = &pb.StoresValue{Bytes: s.values[i]}
+		metadata[i] = encodeMetadata(s.metadata[i])
+	}
+
+	tmp := filepath.Join(s.persist.dir, snapshotFileName+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0640)
+	if err != nil {
+		return fmt.Errorf("failed creating snapshot: %w", err)
+	}
+
+	if _, err := f.Write(encodeRecord(opSetWithMetadata, encodePayload(keys, values, metadata, true))); err != nil {
+		f.Close()
+		return fmt.Errorf("failed writing snapshot: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed syncing snapshot: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, filepath.Join(s.persist.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("failed replacing snapshot: %w", err)
+	}
+
+	// The snapshot now contains everything, the log can start over
+	if err := s.persist.wal.Truncate(0); err != nil {
+		return fmt.Errorf("failed truncating write-ahead log: %w", err)
+	}
+	s.persist.pending = 0
+
+	log.Debug().Msgf("Store snapshot written to %s: %d keys", s.persist.dir, len(keys))
+
+	return nil
+}
+
+func writeBytes(buf *bytes.Buffer, b []byte) {
+	binary.Write(buf, binary.LittleEndian, uint32(len(b)))
+	buf.Write(b)
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	var l uint32
+	if err := binary.Read(r, binary.LittleEndian, &l); err != nil {
+		return nil, err
+	}
+	b := make([]byte, l)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+func encodePayload(keys []*pb.StoresKey, values []*pb.StoresValue, metadata []string, withMetadata bool) []byte {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.LittleEndian, uint32(len(keys)))
+	for i, k := range keys {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(k.Floats)))
+		for _, f := range k.Floats {
+			binary.Write(&buf, binary.LittleEndian, math.Float32bits(f))
+		}
+
+		// Deletes only carry keys
+		if i < len(values) {
+			writeBytes(&buf, values[i].Bytes)
+		} else {
+			writeBytes(&buf, nil)
+		}
+
+		if withMetadata {
+			if i < len(metadata) {
+				writeBytes(&buf, []byte(metadata[i]))
+			} else {
+				writeBytes(&buf, nil)
+			}
+		}
+	}
+
+	return buf.Bytes()
+}
+
+func decodePayload(payload []byte, withMetadata bool) ([]*pb.StoresKey, []*pb.StoresValue, []string, error) {
+	r := bytes.NewReader(payload)
+
+	var n uint32
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, nil, nil, err
+	}
+
+	keys := make([]*pb.StoresKey, n)
+	values := make([]*pb.StoresValue, n)
+	var metadata []string
+	if withMetadata {
+		metadata = make([]string, n)
+	}
+	for i := range keys {
+		var kl uint32
+		if err := binary.Read(r, binary.LittleEndian, &kl); err != nil {
+			return nil, nil, nil, err
+		}
+		floats := make([]float32, kl)
+		for j := range floats {
+			var bits uint32
+			if err := binary.Read(r, binary.LittleEndian, &bits); err != nil {
+				return nil, nil, nil, err
+			}
+			floats[j] = math.Float32frombits(bits)
+		}
+
+		value, err := readBytes(r)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		if withMetadata {
+			m, err := readBytes(r)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			metadata[i] = string(m)
+		}
+
+		keys[i] = &pb.StoresKey{Floats: floats}
+		values[i] = &pb.StoresValue{Bytes: value}
+	}
+
+	return keys, values, metadata, nil
+}
+
+func encodeRecord(op byte, payload []byte) []byte {
+	record := make([]byte, 0, 1+4+len(payload)+4)
+	record = append(record, op)
+	record = binary.LittleEndian.AppendUint32(record, uint32(len(payload)))
+	record = append(record, payload...)
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte{op})
+	crc.Write(payload)
+
+	return binary.LittleEndian.AppendUint32(record, crc.Sum32())
+}
+
+// readRecord returns the record type, its payload and the number of bytes consumed
+func readRecord(r io.Reader) (byte, []byte, int64, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.EOF {
+			return 0, nil, 0, io.EOF
+		}
+		return 0, nil, 0, fmt.Errorf("truncated record header: %w", err)
+	}
+
+	op := header[0]
+	payload := make([]byte, binary.LittleEndian.Uint32(header[1:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, 0, fmt.Errorf("truncated record payload: %w", err)
+	}
+
+	var sum [4]byte
+	if _, err := io.ReadFull(r, sum[:]); err != nil {
+		return 0, nil, 0, fmt.Errorf("truncated record checksum: %w", err)
+	}
+
+	crc := crc32.NewIEEE()
+	crc.Write([]byte{op})
+	crc.Write(payload)
+	if crc.Sum32() != binary.LittleEndian.Uint32(sum[:]) {
+		return 0, nil, 0, fmt.Errorf("record checksum mismatch")
+	}
+
+	return op, payload, int64(len(header) + len(payload) + len(sum)), nil
+}
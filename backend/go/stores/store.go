@@ -4,16 +4,25 @@ package main
 // It is meant to be used by the main executable that is the server for the specific backend type (falcon, gpt3, etc)
 import (
 	"container/heap"
+	"encoding/json"
 	"fmt"
 	"math"
 	"slices"
 
 	"github.com/mudler/LocalAI/pkg/grpc/base"
 	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/store"
 
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	// IndexExact compares the key against every key in the store
+	IndexExact = "exact"
+	// IndexHNSW uses a Hierarchical Navigable Small World graph to do an approximate search
+	IndexHNSW = "hnsw"
+)
+
 type Store struct {
 	base.SingleThread
 
@@ -21,25 +30,37 @@ type Store struct {
 	keys [][]float32
 	// The sorted values
 	values [][]byte
+	// The metadata of each key, nil if it has none
+	metadata []map[string]any
 
 	// If for every K it holds that ||k||^2 = 1, then we can use the normalized distance functions
 	// TODO: Should we normalize incoming keys if they are not instead?
 	keysAreNormalized bool
 	// The first key decides the length of the keys
 	keyLen int
+
+	// Set when the store is backed by a directory on disk
+	persist *persistence
+
+	// Approximate nearest neighbour index, built on the first find that asks for it
+	index *hnswIndex
+	// The parameters of the index, set by the first find that asks for it and kept until the store is dropped
+	hnsw hnswParams
 }
 
 // TODO: Only used for sorting using Go's builtin implementation. The interfaces are columnar because
 // that's theoretically best for memory layout and cache locality, but this isn't optimized yet.
 type Pair struct {
-	Key   []float32
-	Value []byte
+	Key      []float32
+	Value    []byte
+	Metadata map[string]any
 }
 
 func NewStore() *Store {
 	return &Store{
 		keys:              make([][]float32, 0),
 		values:            make([][]byte, 0),
+		metadata:          make([]map[string]any, 0),
 		keysAreNormalized: true,
 		keyLen:            -1,
 	}
@@ -99,7 +120,17 @@ func sortIntoKeySlicese(keys []*pb.StoresKey) [][]float32 {
 }
 
 func (s *Store) Load(opts *pb.ModelOptions) error {
-	return nil
+	dir, interval, err := parsePersistenceOptions(opts.Options)
+	if err != nil {
+		return err
+	}
+
+	// Without a directory the store lives only in memory
+	if dir == "" {
+		return nil
+	}
+
+	return s.openPersistence(dir, interval)
 }
 
 // Sort the incoming kvs and merge them with the existing sorted kvs
@@ -112,6 +143,15 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		return fmt.Errorf("len(keys) = %d, len(values) = %d", len(opts.Keys), len(opts.Values))
 	}
 
+	if len(opts.Metadata) != 0 && len(opts.Keys) != len(opts.Metadata) {
+		return fmt.Errorf("len(keys) = %d, len(metadata) = %d", len(opts.Keys), len(opts.Metadata))
+	}
+
+	metadata, err := parseMetadata(opts.Metadata, len(opts.Keys))
+	if err != nil {
+		return err
+	}
+
 	if s.keyLen == -1 {
 		s.keyLen = len(opts.Keys[0].Floats)
 	} else {
@@ -120,6 +160,10 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		}
 	}
 
+	if err := s.logRecord(opSetWithMetadata, opts.Keys, opts.Values, opts.Metadata); err != nil {
+		return err
+	}
+
 	kvs := make([]Pair, len(opts.Keys))
 
 	for i, k := range opts.Keys {
@@ -135,8 +179,9 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		}
 
 		kvs[i] = Pair{
-			Key:   k.Floats,
-			Value: opts.Values[i].Bytes,
+			Key:      k.Floats,
+			Value:    opts.Values[i].Bytes,
+			Metadata: metadata[i],
 		}
 	}
 
@@ -150,6 +195,7 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 	l := len(kvs) + len(s.keys)
 	merge_ks := make([][]float32, 0, l)
 	merge_vs := make([][]byte, 0, l)
+	merge_ms := make([]map[string]any, 0, l)
 
 	i, j := 0, 0
 	for {
@@ -160,6 +206,7 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		if i >= len(kvs) {
 			merge_ks = append(merge_ks, s.keys[j])
 			merge_vs = append(merge_vs, s.values[j])
+			merge_ms = append(merge_ms, s.metadata[j])
 			j++
 			continue
 		}
@@ -167,6 +214,7 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		if j >= len(s.keys) {
 			merge_ks = append(merge_ks, kvs[i].Key)
 			merge_vs = append(merge_vs, kvs[i].Value)
+			merge_ms = append(merge_ms, kvs[i].Metadata)
 			i++
 			continue
 		}
@@ -175,14 +223,17 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 		if c < 0 {
 			merge_ks = append(merge_ks, kvs[i].Key)
 			merge_vs = append(merge_vs, kvs[i].Value)
+			merge_ms = append(merge_ms, kvs[i].Metadata)
 			i++
 		} else if c > 0 {
 			merge_ks = append(merge_ks, s.keys[j])
 			merge_vs = append(merge_vs, s.values[j])
+			merge_ms = append(merge_ms, s.metadata[j])
 			j++
 		} else {
 			merge_ks = append(merge_ks, kvs[i].Key)
 			merge_vs = append(merge_vs, kvs[i].Value)
+			merge_ms = append(merge_ms, kvs[i].Metadata)
 			i++
 			j++
 		}
@@ -193,6 +244,13 @@ func (s *Store) StoresSet(opts *pb.StoresSetOptions) error {
 
 	s.keys = merge_ks
 	s.values = merge_vs
+	s.metadata = merge_ms
+
+	if s.index != nil {
+		for _, kv := range kvs {
+			s.index.Insert(kv.Key)
+		}
+	}
 
 	return nil
 }
@@ -214,22 +272,30 @@ func (s *Store) StoresDelete(opts *pb.StoresDeleteOptions) error {
 		}
 	}
 
+	if err := s.logRecord(opDelete, opts.Keys, nil, nil); err != nil {
+		return err
+	}
+
 	ks := sortIntoKeySlicese(opts.Keys)
 
 	l := len(s.keys) - len(ks)
 	merge_ks := make([][]float32, 0, l)
 	merge_vs := make([][]byte, 0, l)
+	merge_ms := make([]map[string]any, 0, l)
 
 	tail_ks := s.keys
 	tail_vs := s.values
+	tail_ms := s.metadata
 	for _, k := range ks {
 		j, found := findInSortedSlice(tail_ks, k)
 
 		if found {
 			merge_ks = append(merge_ks, tail_ks[:j]...)
 			merge_vs = append(merge_vs, tail_vs[:j]...)
+			merge_ms = append(merge_ms, tail_ms[:j]...)
 			tail_ks = tail_ks[j+1:]
 			tail_vs = tail_vs[j+1:]
+			tail_ms = tail_ms[j+1:]
 		} else {
 			assert(!hasKey(s.keys, k), fmt.Sprintf("Key exists, but was not found: t=%d, %v", len(tail_ks), k))
 		}
@@ -239,11 +305,13 @@ func (s *Store) StoresDelete(opts *pb.StoresDeleteOptions) error {
 
 	merge_ks = append(merge_ks, tail_ks...)
 	merge_vs = append(merge_vs, tail_vs...)
+	merge_ms = append(merge_ms, tail_ms...)
 
 	assert(len(merge_ks) <= len(s.keys), fmt.Sprintf("len(merge_ks) = %d, len(s.keys) = %d", len(merge_ks), len(s.keys)))
 
 	s.keys = merge_ks
 	s.values = merge_vs
+	s.metadata = merge_ms
 
 	assert(len(s.keys) >= l, fmt.Sprintf("len(s.keys) = %d, l = %d", len(s.keys), l))
 	assert(isSortedKeys(s.keys), "keys are not sorted")
@@ -260,12 +328,25 @@ func (s *Store) StoresDelete(opts *pb.StoresDeleteOptions) error {
 		log.Debug().Msgf("Delete: Some keys not found: len(s.keys) = %d, l = %d", len(s.keys), l)
 	}
 
+	if s.index != nil {
+		for _, k := range ks {
+			s.index.Delete(k)
+		}
+
+		// Deleted nodes slow down the search, start over once they are the majority
+		if s.index.deleted > s.index.Len() {
+			log.Debug().Msgf("Delete: dropping the index, %d of %d nodes are deleted", s.index.deleted, len(s.index.nodes))
+			s.index = nil
+		}
+	}
+
 	return nil
 }
 
 func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error) {
 	pbKeys := make([]*pb.StoresKey, 0, len(opts.Keys))
 	pbValues := make([]*pb.StoresValue, 0, len(opts.Keys))
+	pbMetadata := make([]string, 0, len(opts.Keys))
 	ks := sortIntoKeySlicese(opts.Keys)
 
 	if len(s.keys) == 0 {
@@ -282,6 +363,7 @@ func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error)
 
 	tail_k := s.keys
 	tail_v := s.values
+	tail_m := s.metadata
 	for i, k := range ks {
 		j, found := findInSortedSlice(tail_k, k)
 
@@ -292,9 +374,11 @@ func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error)
 			pbValues = append(pbValues, &pb.StoresValue{
 				Bytes: tail_v[j],
 			})
+			pbMetadata = append(pbMetadata, encodeMetadata(tail_m[j]))
 
 			tail_k = tail_k[j+1:]
 			tail_v = tail_v[j+1:]
+			tail_m = tail_m[j+1:]
 		} else {
 			assert(!hasKey(s.keys, k), fmt.Sprintf("Key exists, but was not found: i=%d, %v", i, k))
 		}
@@ -305,8 +389,9 @@ func (s *Store) StoresGet(opts *pb.StoresGetOptions) (pb.StoresGetResult, error)
 	}
 
 	return pb.StoresGetResult{
-		Keys:   pbKeys,
-		Values: pbValues,
+		Keys:     pbKeys,
+		Values:   pbValues,
+		Metadata: pbMetadata,
 	}, nil
 }
 
@@ -338,6 +423,7 @@ type PriorityItem struct {
 	Similarity float32
 	Key        []float32
 	Value      []byte
+	Metadata   map[string]any
 }
 
 type PriorityQueue []*PriorityItem
@@ -366,17 +452,22 @@ func (pq *PriorityQueue) Pop() any {
 	return item
 }
 
-func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions) (pb.StoresFindResult, error) {
+func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions, filter *store.Filter) (pb.StoresFindResult, error) {
 	tk := opts.Key.Floats
 	top_ks := make(PriorityQueue, 0, int(opts.TopK))
 	heap.Init(&top_ks)
 
 	for i, k := range s.keys {
+		if !filter.Match(s.metadata[i]) {
+			continue
+		}
+
 		sim := normalizedCosineSimilarity(tk, k)
 		heap.Push(&top_ks, &PriorityItem{
 			Similarity: sim,
 			Key:        k,
 			Value:      s.values[i],
+			Metadata:   s.metadata[i],
 		})
 
 		if top_ks.Len() > int(opts.TopK) {
@@ -387,6 +478,7 @@ func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions) (pb.StoresFindR
 	similarities := make([]float32, top_ks.Len())
 	pbKeys := make([]*pb.StoresKey, top_ks.Len())
 	pbValues := make([]*pb.StoresValue, top_ks.Len())
+	pbMetadata := make([]string, top_ks.Len())
 
 	for i := top_ks.Len() - 1; i >= 0; i-- {
 		item := heap.Pop(&top_ks).(*PriorityItem)
@@ -398,12 +490,14 @@ func (s *Store) StoresFindNormalized(opts *pb.StoresFindOptions) (pb.StoresFindR
 		pbValues[i] = &pb.StoresValue{
 			Bytes: item.Value,
 		}
+		pbMetadata[i] = encodeMetadata(item.Metadata)
 	}
 
 	return pb.StoresFindResult{
 		Keys:         pbKeys,
 		Values:       pbValues,
 		Similarities: similarities,
+		Metadata:     pbMetadata,
 	}, nil
 }
 
@@ -423,7 +517,7 @@ func cosineSimilarity(k1, k2 []float32, mag1 float64) float32 {
 	return sim
 }
 
-func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindResult, error) {
+func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions, filter *store.Filter) (pb.StoresFindResult, error) {
 	tk := opts.Key.Floats
 	top_ks := make(PriorityQueue, 0, int(opts.TopK))
 	heap.Init(&top_ks)
@@ -435,11 +529,16 @@ func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindRes
 	mag1 = math.Sqrt(mag1)
 
 	for i, k := range s.keys {
+		if !filter.Match(s.metadata[i]) {
+			continue
+		}
+
 		dist := cosineSimilarity(tk, k, mag1)
 		heap.Push(&top_ks, &PriorityItem{
 			Similarity: dist,
 			Key:        k,
 			Value:      s.values[i],
+			Metadata:   s.metadata[i],
 		})
 
 		if top_ks.Len() > int(opts.TopK) {
@@ -450,6 +549,7 @@ func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindRes
 	similarities := make([]float32, top_ks.Len())
 	pbKeys := make([]*pb.StoresKey, top_ks.Len())
 	pbValues := make([]*pb.StoresValue, top_ks.Len())
+	pbMetadata := make([]string, top_ks.Len())
 
 	for i := top_ks.Len() - 1; i >= 0; i-- {
 		item := heap.Pop(&top_ks).(*PriorityItem)
@@ -461,12 +561,96 @@ func (s *Store) StoresFindFallback(opts *pb.StoresFindOptions) (pb.StoresFindRes
 		pbValues[i] = &pb.StoresValue{
 			Bytes: item.Value,
 		}
+		pbMetadata[i] = encodeMetadata(item.Metadata)
 	}
 
 	return pb.StoresFindResult{
 		Keys:         pbKeys,
 		Values:       pbValues,
 		Similarities: similarities,
+		Metadata:     pbMetadata,
+	}, nil
+}
+
+// StoresFindHNSW does an approximate search using the HNSW index, building it when needed.
+// M and EfConstruction are the ones of the store, set by its first approximate search: the searches with other
+// values are rejected, as the index would have to be rebuilt.
+func (s *Store) StoresFindHNSW(opts *pb.StoresFindOptions, filter *store.Filter) (pb.StoresFindResult, error) {
+	m, efConstruction, ef := int(opts.M), int(opts.EfConstruction), int(opts.Ef)
+	if s.hnsw == (hnswParams{}) {
+		s.hnsw = hnswParams{M: m, EfConstruction: efConstruction}
+		if s.hnsw.M < 2 {
+			s.hnsw.M = defaultHNSWM
+		}
+		if s.hnsw.EfConstruction < 1 {
+			s.hnsw.EfConstruction = defaultHNSWEfConstruction
+		}
+		if err := s.persistHNSWParams(); err != nil {
+			return pb.StoresFindResult{}, err
+		}
+	}
+	if (m != 0 && m != s.hnsw.M) || (efConstruction != 0 && efConstruction != s.hnsw.EfConstruction) {
+		return pb.StoresFindResult{}, fmt.Errorf("the HNSW index of the store has M = %d and ef_construction = %d, it can't be searched with M = %d and ef_construction = %d", s.hnsw.M, s.hnsw.EfConstruction, m, efConstruction)
+	}
+	if ef == 0 {
+		ef = defaultHNSWEf
+	}
+
+	if s.index == nil {
+		log.Debug().Msgf("Building HNSW index with M = %d, efConstruction = %d over %d keys", s.hnsw.M, s.hnsw.EfConstruction, len(s.keys))
+
+		s.index = newHNSWIndex(s.hnsw.M, s.hnsw.EfConstruction)
+		for _, k := range s.keys {
+			s.index.Insert(k)
+		}
+	}
+
+	// Position of the node in the store, -1 if it doesn't match the filter
+	lookup := func(id int) int {
+		k := s.index.nodes[id].key
+		j, found := findInSortedSlice(s.keys, k)
+		assert(found, fmt.Sprintf("Key is in the index, but not in the store: %v", k))
+		if !found || !filter.Match(s.metadata[j]) {
+			return -1
+		}
+		return j
+	}
+
+	results := s.index.Search(opts.Key.Floats, int(opts.TopK), ef, func(id int) bool {
+		return lookup(id) != -1
+	})
+
+	// A selective filter can discard most of the candidates, widen the search until we have enough
+	for filter != nil && len(results) < int(opts.TopK) && ef < len(s.index.nodes) {
+		ef *= 4
+		results = s.index.Search(opts.Key.Floats, int(opts.TopK), ef, func(id int) bool {
+			return lookup(id) != -1
+		})
+	}
+
+	similarities := make([]float32, 0, len(results))
+	pbKeys := make([]*pb.StoresKey, 0, len(results))
+	pbValues := make([]*pb.StoresValue, 0, len(results))
+	pbMetadata := make([]string, 0, len(results))
+
+	for _, r := range results {
+		j := lookup(r.id)
+
+		similarities = append(similarities, r.sim)
+		pbKeys = append(pbKeys, &pb.StoresKey{
+			Floats: s.keys[j],
+		})
+		pbValues = append(pbValues, &pb.StoresValue{
+			Bytes: s.values[j],
+		})
+		pbMetadata = append(pbMetadata, encodeMetadata(s.metadata[j]))
+	}
+
+	return pb.StoresFindResult{
+		Keys:         pbKeys,
+		Values:       pbValues,
+		Similarities: similarities,
+		Metadata:     pbMetadata,
 	}, nil
 }
 
@@ -489,8 +673,21 @@ func (s *Store) StoresFind(opts *pb.StoresFindOptions) (pb.StoresFindResult, err
 		}
 	}
 
+	filter, err := store.ParseFilter(opts.Filter)
+	if err != nil {
+		return pb.StoresFindResult{}, err
+	}
+
+	switch opts.Index {
+	case "", IndexExact:
+	case IndexHNSW:
+		return s.StoresFindHNSW(opts, filter)
+	default:
+		return pb.StoresFindResult{}, fmt.Errorf("unknown index %q, must be one of %q or %q", opts.Index, IndexExact, IndexHNSW)
+	}
+
 	if s.keysAreNormalized && isNormalized(tk) {
-		return s.StoresFindNormalized(opts)
+		return s.StoresFindNormalized(opts, filter)
 	} else {
 		if s.keysAreNormalized {
 			var sample []float32
@@ -502,6 +699,114 @@ func (s *Store) StoresFind(opts *pb.StoresFindOptions) (pb.StoresFindResult, err
 			log.Debug().Msgf("Trying to compare non-normalized key with normalized keys: %v", sample)
 		}
 
-		return s.StoresFindFallback(opts)
+		return s.StoresFindFallback(opts, filter)
+	}
+}
+
+// StoresList returns the entries matching the filter, in the order of the keys
+func (s *Store) StoresList(opts *pb.StoresListOptions) (pb.StoresListResult, error) {
+	filter, err := store.ParseFilter(opts.Filter)
+	if err != nil {
+		return pb.StoresListResult{}, err
+	}
+
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return pb.StoresListResult{}, fmt.Errorf("offset = %d and limit = %d must be >= 0", opts.Offset, opts.Limit)
+	}
+
+	var total int32
+	var pbKeys []*pb.StoresKey
+	var pbValues []*pb.StoresValue
+	var pbMetadata []string
+	for i, k := range s.keys {
+		if !filter.Match(s.metadata[i]) {
+			continue
+		}
+
+		total++
+		if total <= opts.Offset || (opts.Limit > 0 && len(pbKeys) >= int(opts.Limit)) {
+			continue
+		}
+
+		pbKeys = append(pbKeys, &pb.StoresKey{
+			Floats: k,
+		})
+		pbValues = append(pbValues, &pb.StoresValue{
+			Bytes: s.values[i],
+		})
+		pbMetadata = append(pbMetadata, encodeMetadata(s.metadata[i]))
+	}
+
+	return pb.StoresListResult{
+		Keys:     pbKeys,
+		Values:   pbValues,
+		Metadata: pbMetadata,
+		Total:    total,
+	}, nil
+}
+
+func (s *Store) StoresCount(opts *pb.StoresCountOptions) (pb.StoresCountResult, error) {
+	filter, err := store.ParseFilter(opts.Filter)
+	if err != nil {
+		return pb.StoresCountResult{}, err
+	}
+
+	if filter == nil {
+		return pb.StoresCountResult{Count: int32(len(s.keys))}, nil
+	}
+
+	var count int32
+	for _, m := range s.metadata {
+		if filter.Match(m) {
+			count++
+		}
+	}
+
+	return pb.StoresCountResult{Count: count}, nil
+}
+
+// StoresDrop removes all the entries, including the ones persisted on disk
+func (s *Store) StoresDrop(opts *pb.StoresDropOptions) error {
+	s.keys = make([][]float32, 0)
+	s.values = make([][]byte, 0)
+	s.metadata = make([]map[string]any, 0)
+	s.keysAreNormalized = true
+	s.keyLen = -1
+	s.index = nil
+	s.hnsw = hnswParams{}
+
+	if s.persist != nil {
+		if err := s.persistHNSWParams(); err != nil {
+			return err
+		}
+		return s.snapshot()
+	}
+
+	return nil
+}
+
+// parseMetadata decodes the JSON metadata of each key, the result has one (possibly nil) entry for each of the n keys
+func parseMetadata(metadata []string, n int) ([]map[string]any, error) {
+	res := make([]map[string]any, n)
+	for i, m := range metadata {
+		if m == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(m), &res[i]); err != nil {
+			return nil, fmt.Errorf("metadata %d must be a JSON object: %w", i, err)
+		}
+	}
+
+	return res, nil
+}
+
+func encodeMetadata(m map[string]any) string {
+	if m == nil {
+		return ""
 	}
+
+	b, err := json.Marshal(m)
+	assert(err == nil, fmt.Sprintf("failed encoding metadata: %v", err))
+
+	return string(b)
 }
@@ -2,6 +2,8 @@ package application
 
 import (
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/kvstore"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/templates"
 )
@@ -11,15 +13,28 @@ type Application struct {
 	modelLoader        *model.ModelLoader
 	applicationConfig  *config.ApplicationConfig
 	templatesEvaluator *templates.Evaluator
+
+	// The stores have their own loader, so they are not affected by the watchdog or single active backend
+	storeLoader        *model.ModelLoader
+	collectionsService *services.CollectionsService
+
+	// The assistants, files, threads... created through the API
+	metadataStore kvstore.Store
+	// The usage of the API keys, recorded in the metadata store
+	usageService *services.UsageService
 }
 
 func newApplication(appConfig *config.ApplicationConfig) *Application {
-	return &Application{
+	a := &Application{
 		backendLoader:      config.NewBackendConfigLoader(appConfig.ModelPath),
 		modelLoader:        model.NewModelLoader(appConfig.ModelPath),
 		applicationConfig:  appConfig,
 		templatesEvaluator: templates.NewEvaluator(appConfig.ModelPath),
+		storeLoader:        model.NewModelLoader(""),
 	}
+	a.collectionsService = services.NewCollectionsService(a.storeLoader, a.modelLoader, a.backendLoader, appConfig)
+
+	return a
 }
 
 func (a *Application) BackendLoader() *config.BackendConfigLoader {
@@ -37,3 +52,19 @@ func (a *Application) ApplicationConfig() *config.ApplicationConfig {
 func (a *Application) TemplatesEvaluator() *templates.Evaluator {
 	return a.templatesEvaluator
 }
+
+func (a *Application) StoreLoader() *model.ModelLoader {
+	return a.storeLoader
+}
+
+func (a *Application) CollectionsService() *services.CollectionsService {
+	return a.collectionsService
+}
+
+func (a *Application) MetadataStore() kvstore.Store {
+	return a.metadataStore
+}
+
+func (a *Application) UsageService() *services.UsageService {
+	return a.usageService
+}
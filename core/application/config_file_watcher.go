@@ -3,9 +3,11 @@ package application
 import (
 	"encoding/json"
 	"fmt"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"time"
 
 	"dario.cat/mergo"
@@ -35,6 +37,10 @@ func newConfigFileHandler(appConfig *config.ApplicationConfig) configFileHandler
 	if err != nil {
 		log.Error().Err(err).Str("file", "api_keys.json").Msg("unable to register config file handler")
 	}
+	err = c.Register("jwt_groups.json", readJWTGroupsJson(*appConfig), true)
+	if err != nil {
+		log.Error().Err(err).Str("file", "jwt_groups.json").Msg("unable to register config file handler")
+	}
 	err = c.Register("external_backends.json", readExternalBackendsJson(*appConfig), true)
 	if err != nil {
 		log.Error().Err(err).Str("file", "external_backends.json").Msg("unable to register config file handler")
@@ -133,8 +139,9 @@ func readApiKeysJson(startupAppConfig config.ApplicationConfig) fileHandler {
 		log.Trace().Int("numKeys", len(startupAppConfig.ApiKeys)).Msg("api keys provided at startup")
 
 		if len(fileContent) > 0 {
-			// Parse JSON content from the file
-			var fileKeys []string
+			// Parse JSON content from the file. The keys are strings, or objects with the identity and the limits of
+			// the key.
+			var fileKeys []config.APIKey
 			err := json.Unmarshal(fileContent, &fileKeys)
 			if err != nil {
 				return err
@@ -142,10 +149,19 @@ func readApiKeysJson(startupAppConfig config.ApplicationConfig) fileHandler {
 
 			log.Trace().Int("numKeys", len(fileKeys)).Msg("discovered API keys from api keys dynamic config dile")
 
-			appConfig.ApiKeys = append(startupAppConfig.ApiKeys, fileKeys...)
+			apiKeys := slices.Clone(startupAppConfig.ApiKeys)
+			identities := map[string]config.APIKey{}
+			maps.Copy(identities, startupAppConfig.ApiKeyIdentities)
+			for _, k := range fileKeys {
+				apiKeys = append(apiKeys, k.Key)
+				identities[k.Key] = k
+			}
+			appConfig.ApiKeys = apiKeys
+			appConfig.ApiKeyIdentities = identities
 		} else {
 			log.Trace().Msg("no API keys discovered from dynamic config file")
 			appConfig.ApiKeys = startupAppConfig.ApiKeys
+			appConfig.ApiKeyIdentities = startupAppConfig.ApiKeyIdentities
 		}
 		log.Trace().Int("numKeys", len(appConfig.ApiKeys)).Msg("total api keys after processing")
 		return nil
@@ -154,6 +170,37 @@ func readApiKeysJson(startupAppConfig config.ApplicationConfig) fileHandler {
 	return handler
 }
 
+func readJWTGroupsJson(startupAppConfig config.ApplicationConfig) fileHandler {
+	handler := func(fileContent []byte, appConfig *config.ApplicationConfig) error {
+		log.Debug().Msg("processing JWT groups runtime update")
+
+		if len(fileContent) > 0 {
+			// The access policies of the groups of the JWTs, by group name. The policy of "*" applies to all the users.
+			var fileGroups map[string]config.AccessPolicy
+			err := json.Unmarshal(fileContent, &fileGroups)
+			if err != nil {
+				return err
+			}
+			for name, policy := range fileGroups {
+				if err := policy.Validate(); err != nil {
+					return fmt.Errorf("JWT group %q %w", name, err)
+				}
+			}
+
+			groups := map[string]config.AccessPolicy{}
+			maps.Copy(groups, startupAppConfig.JWTGroups)
+			maps.Copy(groups, fileGroups)
+			appConfig.JWTGroups = groups
+		} else {
+			appConfig.JWTGroups = startupAppConfig.JWTGroups
+		}
+		log.Trace().Int("numGroups", len(appConfig.JWTGroups)).Msg("total JWT groups after processing")
+		return nil
+	}
+
+	return handler
+}
+
 func readExternalBackendsJson(startupAppConfig config.ApplicationConfig) fileHandler {
 	handler := func(fileContent []byte, appConfig *config.ApplicationConfig) error {
 		log.Debug().Msg("processing external_backends.json")
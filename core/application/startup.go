@@ -1,22 +1,29 @@
 package application
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"path/filepath"
 
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/internal"
 	"github.com/mudler/LocalAI/pkg/assets"
+	"github.com/mudler/LocalAI/pkg/kvstore"
 
 	"github.com/mudler/LocalAI/pkg/library"
 	"github.com/mudler/LocalAI/pkg/model"
 	pkgStartup "github.com/mudler/LocalAI/pkg/startup"
+	"github.com/mudler/LocalAI/pkg/tracing"
 	"github.com/mudler/LocalAI/pkg/xsysinfo"
 	"github.com/rs/zerolog/log"
 )
 
+// The metadata store is saved in this file of the ConfigsDir
+const MetadataStoreFile = "metadata.db"
+
 func New(opts ...config.AppOption) (*Application, error) {
 	options := config.NewApplicationConfig(opts...)
 	application := newApplication(options)
@@ -61,11 +68,31 @@ func New(opts ...config.AppOption) (*Application, error) {
 			return nil, fmt.Errorf("unable to create UploadDir: %q", err)
 		}
 	}
+	if options.ConfigsDir != "" {
+		err := os.MkdirAll(options.ConfigsDir, 0750)
+		if err != nil {
+			return nil, fmt.Errorf("unable to create ConfigsDir: %q", err)
+		}
+		application.metadataStore, err = kvstore.Open(filepath.Join(options.ConfigsDir, MetadataStoreFile))
+		if err != nil {
+			return nil, fmt.Errorf("unable to open the metadata store: %q", err)
+		}
+	} else {
+		application.metadataStore = kvstore.NewMemoryStore()
+	}
+	application.usageService, err = services.NewUsageService(application.metadataStore, options.UsageRetention)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the usage service: %w", err)
+	}
+	go application.usageService.Run(options.Context)
 
 	if err := pkgStartup.InstallModels(options.Galleries, options.ModelLibraryURL, options.ModelPath, options.EnforcePredownloadScans, nil, options.ModelsURL...); err != nil {
 		log.Error().Err(err).Msg("error installing models")
 	}
 
+	// The memory used by the models is only guessed for the memory budget
+	application.BackendLoader().EstimateMemory(options.MemoryBudgetRAM != 0 || options.MemoryBudgetVRAM != 0)
+
 	configLoaderOpts := options.ToConfigLoaderOptions()
 
 	if err := application.BackendLoader().LoadBackendConfigsFromPath(options.ModelPath, configLoaderOpts...); err != nil {
@@ -117,6 +144,24 @@ func New(opts ...config.AppOption) (*Application, error) {
 		}
 	}
 
+	if options.Tracing.Enabled() {
+		shutdown, err := tracing.Setup(options.Tracing, "LocalAI")
+		if err != nil {
+			return nil, fmt.Errorf("unable to set up the tracing: %w", err)
+		}
+		// The backends inherit the environment of LocalAI, and export their spans with the same exporter
+		if err := options.Tracing.Setenv(); err != nil {
+			return nil, fmt.Errorf("unable to set up the tracing of the backends: %w", err)
+		}
+		log.Info().Msgf("Tracing the requests with the %s exporter", options.Tracing.Exporter)
+		go func() {
+			<-options.Context.Done()
+			if err := shutdown(context.Background()); err != nil {
+				log.Error().Err(err).Msg("error while flushing the spans")
+			}
+		}()
+	}
+
 	// turn off any process that was started by GRPC if the context is canceled
 	go func() {
 		<-options.Context.Done()
@@ -125,8 +170,27 @@ func New(opts ...config.AppOption) (*Application, error) {
 		if err != nil {
 			log.Error().Err(err).Msg("error while stopping all grpc backends")
 		}
+		err = application.StoreLoader().StopAllGRPC()
+		if err != nil {
+			log.Error().Err(err).Msg("error while stopping the store backends")
+		}
+		// The usage recorded since the last flush is written before the metadata store is closed
+		err = application.UsageService().Flush()
+		if err != nil {
+			log.Error().Err(err).Msg("error while writing the usage of the requests")
+		}
+		err = application.MetadataStore().Close()
+		if err != nil {
+			log.Error().Err(err).Msg("error while closing the metadata store")
+		}
 	}()
 
+	if options.MemoryBudgetRAM != 0 || options.MemoryBudgetVRAM != 0 {
+		budget := model.MemoryEstimate{RAM: options.MemoryBudgetRAM, VRAM: options.MemoryBudgetVRAM}
+		log.Info().Msgf("Keeping the loaded models in a memory budget of %s", budget)
+		application.ModelLoader().SetMemoryBudget(budget)
+	}
+
 	if options.WatchDog {
 		wd := model.NewWatchDog(
 			application.ModelLoader(),
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/mudler/LocalAI/core/config"
@@ -9,20 +10,21 @@ import (
 	model "github.com/mudler/LocalAI/pkg/model"
 )
 
-func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (func() ([]float32, error), error) {
+func ModelEmbedding(ctx context.Context, s string, tokens []int, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (func() ([]float32, error), error) {
 
-	opts := ModelOptions(backendConfig, appConfig)
-
-	inferenceModel, err := loader.Load(opts...)
+	f := newFallbacks(backendConfig)
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		return ModelOptions(c, appConfig)
+	}
+	inferenceModel, backendConfig, err := f.load(ctx, loader, modelOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	var fn func() ([]float32, error)
-	switch model := inferenceModel.(type) {
-	case grpc.Backend:
-		fn = func() ([]float32, error) {
-			predictOptions := gRPCPredictOpts(backendConfig, loader.ModelPath)
+	embed := func(inferenceModel grpc.Backend, backendConfig config.BackendConfig) ([]float32, error) {
+		switch model := inferenceModel.(type) {
+		case grpc.Backend:
+			predictOptions := gRPCPredictOpts(ctx, backendConfig, loader.ModelPath)
 			if len(tokens) > 0 {
 				embeds := []int32{}
 
@@ -31,7 +33,7 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendCo
 				}
 				predictOptions.EmbeddingTokens = embeds
 
-				res, err := model.Embeddings(appConfig.Context, predictOptions)
+				res, err := model.Embeddings(ctx, predictOptions)
 				if err != nil {
 					return nil, err
 				}
@@ -40,19 +42,29 @@ func ModelEmbedding(s string, tokens []int, loader *model.ModelLoader, backendCo
 			}
 			predictOptions.Embeddings = s
 
-			res, err := model.Embeddings(appConfig.Context, predictOptions)
+			res, err := model.Embeddings(ctx, predictOptions)
 			if err != nil {
 				return nil, err
 			}
 
 			return res.Embeddings, nil
-		}
-	default:
-		fn = func() ([]float32, error) {
+		default:
 			return nil, fmt.Errorf("embeddings not supported by the backend")
 		}
 	}
 
+	fn := func() ([]float32, error) {
+		for {
+			embeds, err := embed(inferenceModel, backendConfig)
+			if !f.retry(err) {
+				return embeds, err
+			}
+			if inferenceModel, backendConfig, err = f.load(ctx, loader, modelOpts); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	return func() ([]float32, error) {
 		embeds, err := fn()
 		if err != nil {
@@ -0,0 +1,164 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/concurrency"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type servedModelKey struct{}
+
+type servedModel struct {
+	sync.Mutex
+	name string
+}
+
+// WithServedModel returns a copy of ctx in which the backend records the model serving the request, which is one of
+// the fallback models when the model failed
+func WithServedModel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, servedModelKey{}, &servedModel{})
+}
+
+// ServedModel returns the name of the model which served the request, empty if ctx has no record of it
+func ServedModel(ctx context.Context) string {
+	served, ok := ctx.Value(servedModelKey{}).(*servedModel)
+	if !ok {
+		return ""
+	}
+	served.Lock()
+	defer served.Unlock()
+	return served.name
+}
+
+func recordServedModel(ctx context.Context, c config.BackendConfig) {
+	served, ok := ctx.Value(servedModelKey{}).(*servedModel)
+	if !ok {
+		return
+	}
+	served.Lock()
+	defer served.Unlock()
+	served.name = c.Name
+	if served.name == "" {
+		served.name = c.Model
+	}
+}
+
+// backendCrashed returns true if err is returned by the gRPC client when the process of the backend is gone
+func backendCrashed(err error) bool {
+	return status.Code(err) == codes.Unavailable
+}
+
+// fallbacks iterates over the configuration of a model and the ones of its fallback models
+type fallbacks struct {
+	configs []config.BackendConfig
+	next    int
+}
+
+func newFallbacks(c config.BackendConfig) *fallbacks {
+	return &fallbacks{configs: append([]config.BackendConfig{c}, c.FallbackConfigs...)}
+}
+
+// forPrompt keeps the fallback models which can be sent the prompt built for the model, and gives them the grammar
+// built for the request. The prompt templated by LocalAI needs the same templates, the messages templated by the
+// backend need the tokenizer template.
+func (f *fallbacks) forPrompt(messages bool) {
+	c := f.configs[0]
+	configs := []config.BackendConfig{c}
+	for _, fallback := range f.configs[1:] {
+		compatible := fallback.TemplateConfig.UseTokenizerTemplate
+		if !messages {
+			compatible = sameTemplates(c.TemplateConfig, fallback.TemplateConfig)
+		}
+		if !compatible {
+			log.Warn().Msgf("the fallback model %s of %s builds its prompt with other templates, skipping it", fallback.Name, c.Name)
+			continue
+		}
+		fallback.Grammar = c.Grammar
+		configs = append(configs, fallback)
+	}
+	f.configs = configs
+}
+
+// sameTemplates returns true if the templates of a and b build the same prompt
+func sameTemplates(a, b config.TemplateConfig) bool {
+	join := func(t config.TemplateConfig) string {
+		if t.JoinChatMessagesByCharacter == nil {
+			return "\n"
+		}
+		return *t.JoinChatMessagesByCharacter
+	}
+	joinA, joinB := join(a), join(b)
+	a.JoinChatMessagesByCharacter, b.JoinChatMessagesByCharacter = nil, nil
+	return a == b && joinA == joinB
+}
+
+// load loads the next model which can be loaded, with the options returned by opts for its configuration, and
+// records it as the model serving the request. It returns the error of the last model if none can be loaded.
+func (f *fallbacks) load(ctx context.Context, loader *model.ModelLoader, opts func(config.BackendConfig) []model.Option) (grpc.Backend, config.BackendConfig, error) {
+	m, c, _, err := f.loadInSlot(ctx, loader, opts, nil)
+	return m, c, err
+}
+
+// loadInSlot is like load, but it first waits for a slot of each model in scheduler, so that the requests waiting in
+// the queue of a model, or rejected by it, don't load the model. It returns the function releasing the slot of the
+// loaded model.
+func (f *fallbacks) loadInSlot(ctx context.Context, loader *model.ModelLoader, opts func(config.BackendConfig) []model.Option, scheduler *concurrency.Scheduler) (grpc.Backend, config.BackendConfig, func(), error) {
+	err := fmt.Errorf("no model left to serve the request of %s", f.configs[0].Name)
+	for f.next < len(f.configs) {
+		c := f.configs[f.next]
+
+		release := func() {}
+		if scheduler != nil {
+			if release, err = scheduler.Acquire(ctx, c.Name, c.MaxConcurrency, c.MaxQueue); err != nil {
+				return nil, config.BackendConfig{}, nil, err
+			}
+		}
+		f.next++
+
+		var m grpc.Backend
+		m, err = loader.Load(append(opts(c), model.WithTraceContext(ctx))...)
+		if err == nil {
+			recordServedModel(ctx, c)
+			return m, c, release, nil
+		}
+		release()
+		if f.next < len(f.configs) {
+			log.Warn().Err(err).Msgf("cannot load the model %s, falling back to %s", c.Name, f.configs[f.next].Name)
+		}
+	}
+	return nil, config.BackendConfig{}, nil, err
+}
+
+// retry returns true if the request failed with err can be retried on the next model
+func (f *fallbacks) retry(err error) bool {
+	if err == nil || !backendCrashed(err) || f.next >= len(f.configs) {
+		return false
+	}
+	log.Warn().Err(err).Msgf("the backend of the model %s crashed, falling back to %s", f.configs[f.next-1].Name, f.configs[f.next].Name)
+	return true
+}
+
+// withFallbacks calls fn with the model of c, or with its fallback models if the model can't be loaded or its
+// backend crashes during the call
+func withFallbacks[T any](ctx context.Context, loader *model.ModelLoader, c config.BackendConfig, opts func(config.BackendConfig) []model.Option, fn func(grpc.Backend, config.BackendConfig) (T, error)) (T, error) {
+	f := newFallbacks(c)
+	for {
+		m, c, err := f.load(ctx, loader, opts)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		res, err := fn(m, c)
+		if !f.retry(err) {
+			return res, err
+		}
+	}
+}
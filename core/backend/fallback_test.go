@@ -0,0 +1,131 @@
+package backend_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	. "github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/base"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/model"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeEmbeddings is an embedded backend which fails to load the model "broken", crashes computing the embeddings
+// and the predictions of the model "crashing" and returns the length of the model name as embedding otherwise. It
+// predicts the model name with the prompt and the grammar.
+type fakeEmbeddings struct {
+	base.SingleThread
+	model string
+}
+
+func (f *fakeEmbeddings) Load(opts *pb.ModelOptions) error {
+	if opts.Model == "broken" {
+		return errors.New("out of memory")
+	}
+	f.model = opts.Model
+	return nil
+}
+
+func (f *fakeEmbeddings) Embeddings(opts *pb.PredictOptions) ([]float32, error) {
+	if f.model == "crashing" {
+		return nil, status.Error(codes.Unavailable, "connection refused")
+	}
+	return []float32{float32(len(f.model))}, nil
+}
+
+func (f *fakeEmbeddings) Predict(opts *pb.PredictOptions) (string, error) {
+	if f.model == "crashing" {
+		return "", status.Error(codes.Unavailable, "connection refused")
+	}
+	return fmt.Sprintf("%s: %s %s", f.model, opts.Prompt, opts.Grammar), nil
+}
+
+var _ = Describe("Fallback models", func() {
+	var (
+		loader    *model.ModelLoader
+		appConfig *config.ApplicationConfig
+	)
+
+	backendConfig := func(name string, fallbacks ...config.BackendConfig) config.BackendConfig {
+		c := config.BackendConfig{
+			Name:              name,
+			Backend:           name,
+			PredictionOptions: schema.PredictionOptions{Model: name},
+			FallbackConfigs:   fallbacks,
+		}
+		c.SetDefaults()
+		return c
+	}
+
+	BeforeEach(func() {
+		loader = model.NewModelLoader(GinkgoT().TempDir())
+		opts := []config.AppOption{config.WithContext(context.Background())}
+		// Each model has its own backend, as an embedded backend serves one model
+		for _, name := range []string{"broken", "crashing", "working"} {
+			addr := fmt.Sprintf("fallback-test-%s", name)
+			grpc.Provide(addr, &fakeEmbeddings{})
+			opts = append(opts, config.WithExternalBackend(name, addr))
+		}
+		appConfig = config.NewApplicationConfig(opts...)
+	})
+
+	It("serves the request with the fallback model when the model can't be loaded", func() {
+		ctx := WithServedModel(context.Background())
+		fn, err := ModelEmbedding(ctx, "hello", nil, loader, backendConfig("broken", backendConfig("working")), appConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fn()).To(Equal([]float32{7}))
+		Expect(ServedModel(ctx)).To(Equal("working"))
+	})
+
+	It("serves the request with the fallback model when the backend crashes", func() {
+		ctx := WithServedModel(context.Background())
+		fn, err := ModelEmbedding(ctx, "hello", nil, loader, backendConfig("crashing", backendConfig("working")), appConfig)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(fn()).To(Equal([]float32{7}))
+		Expect(ServedModel(ctx)).To(Equal("working"))
+	})
+
+	It("serves the prompt with the fallback models which have the same templates", func() {
+		crashing := backendConfig("crashing", backendConfig("working"))
+		crashing.TemplateConfig.Chat = "chatml"
+		crashing.Grammar = "root ::= \"yes\""
+		crashing.FallbackConfigs[0].TemplateConfig.Chat = "chatml"
+
+		ctx := WithServedModel(context.Background())
+		fn, err := ModelInference(ctx, "hello", nil, nil, nil, nil, loader, crashing, appConfig, nil)
+		Expect(err).ToNot(HaveOccurred())
+		res, err := fn()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(res.Response).To(Equal(`working: hello root ::= "yes"`))
+		Expect(ServedModel(ctx)).To(Equal("working"))
+
+		// The prompt built with the template of the model isn't sent to a model with another template
+		crashing.FallbackConfigs[0].TemplateConfig.Chat = "llama3"
+		fn, err = ModelInference(ctx, "hello", nil, nil, nil, nil, loader, crashing, appConfig, nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = fn()
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+	})
+
+	It("fails when no model can serve the request", func() {
+		ctx := WithServedModel(context.Background())
+		_, err := ModelEmbedding(ctx, "hello", nil, loader, backendConfig("broken", backendConfig("broken")), appConfig)
+		Expect(err).To(HaveOccurred())
+		Expect(ServedModel(ctx)).To(BeEmpty())
+
+		fn, err := ModelEmbedding(ctx, "hello", nil, loader, backendConfig("crashing"), appConfig)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = fn()
+		Expect(status.Code(err)).To(Equal(codes.Unavailable))
+		Expect(ServedModel(ctx)).To(Equal("crashing"))
+	})
+})
@@ -1,25 +1,29 @@
 package backend
 
 import (
+	"context"
+
 	"github.com/mudler/LocalAI/core/config"
 
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 )
 
-func ImageGeneration(height, width, mode, step, seed int, positive_prompt, negative_prompt, src, dst string, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (func() error, error) {
+func ImageGeneration(ctx context.Context, height, width, mode, step, seed int, positive_prompt, negative_prompt, src, dst string, loader *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (func() error, error) {
 
-	opts := ModelOptions(backendConfig, appConfig)
-	inferenceModel, err := loader.Load(
-		opts...,
-	)
+	f := newFallbacks(backendConfig)
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		return ModelOptions(c, appConfig)
+	}
+	inferenceModel, backendConfig, err := f.load(ctx, loader, modelOpts)
 	if err != nil {
 		return nil, err
 	}
 
-	fn := func() error {
+	generate := func(inferenceModel grpc.Backend, backendConfig config.BackendConfig) error {
 		_, err := inferenceModel.GenerateImage(
-			appConfig.Context,
+			ctx,
 			&proto.GenerateImageRequest{
 				Height:           int32(height),
 				Width:            int32(width),
@@ -36,5 +40,17 @@ func ImageGeneration(height, width, mode, step, seed int, positive_prompt, negat
 		return err
 	}
 
+	fn := func() error {
+		for {
+			err := generate(inferenceModel, backendConfig)
+			if !f.retry(err) {
+				return err
+			}
+			if inferenceModel, backendConfig, err = f.load(ctx, loader, modelOpts); err != nil {
+				return err
+			}
+		}
+	}
+
 	return fn, nil
 }
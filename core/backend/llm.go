@@ -3,11 +3,13 @@ package backend
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
 	"strings"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/rs/zerolog/log"
@@ -16,22 +18,67 @@ import (
 	"github.com/mudler/LocalAI/core/schema"
 
 	"github.com/mudler/LocalAI/core/gallery"
+	"github.com/mudler/LocalAI/pkg/concurrency"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/utils"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type LLMResponse struct {
 	Response string // should this be []byte?
 	Usage    TokenUsage
+	Logprobs []schema.LogprobContent // The log probabilities of the tokens of the response, if requested
 }
 
 type TokenUsage struct {
 	Prompt     int
 	Completion int
+	// CachedPrompt are the tokens of the prompt reused from the prompt cache of the backend
+	CachedPrompt int
 }
 
-func ModelInference(ctx context.Context, s string, messages []schema.Message, images, videos, audios []string, loader *model.ModelLoader, c config.BackendConfig, o *config.ApplicationConfig, tokenCallback func(string, TokenUsage) bool) (func() (LLMResponse, error), error) {
+// ErrLogprobsUnsupported is returned when the log probabilities of the tokens are requested from a backend which can't
+// return them
+var ErrLogprobsUnsupported = errors.New("the backend of the model can't return the log probabilities of the tokens")
+
+// CheckLogprobs returns ErrLogprobsUnsupported if the log probabilities of the tokens are requested from a model whose
+// backend can't return them. The backends of the models without one, and the external backends, are only known once
+// they reply.
+func CheckLogprobs(c config.BackendConfig, o *config.ApplicationConfig) error {
+	if !c.Logprobs || c.Backend == "" {
+		return nil
+	}
+	if _, external := o.ExternalGRPCBackends[c.Backend]; external || model.SupportsLogprobs(c.Backend) {
+		return nil
+	}
+	return ErrLogprobsUnsupported
+}
+
+// logprobsErr returns ErrLogprobsUnsupported if the backend returned err because it can't return the log
+// probabilities requested in opts
+func logprobsErr(opts *proto.PredictOptions, err error) error {
+	if opts.Logprobs && status.Code(err) == codes.Unimplemented {
+		return ErrLogprobsUnsupported
+	}
+	return err
+}
+
+// inferenceScheduler queues the inference requests of the models with a max_concurrency
+var inferenceScheduler = concurrency.NewScheduler()
+
+// CheckQueue returns a *concurrency.QueueFullError if the queue of the model is full, e.g. to reject a request before
+// starting to stream its response
+func CheckQueue(c config.BackendConfig) error {
+	return inferenceScheduler.Check(c.Name, c.MaxConcurrency, c.MaxQueue)
+}
+
+// ModelInference returns a function which computes the reply of the model to the prompt s, or to the messages when
+// the backend applies the template of the tokenizer. If tokenCallback is not nil, the reply is streamed to it as it is
+// generated, with the log probabilities of the tokens of the text if they were requested.
+func ModelInference(ctx context.Context, s string, messages []schema.Message, images, videos, audios []string, loader *model.ModelLoader, c config.BackendConfig, o *config.ApplicationConfig, tokenCallback func(string, TokenUsage, []schema.LogprobContent) bool) (func() (LLMResponse, error), error) {
 	modelFile := c.Model
 
 	// Check if the modelFile exists, if it doesn't try to load it from the gallery
@@ -46,12 +93,12 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 		}
 	}
 
-	opts := ModelOptions(c, o)
-	inferenceModel, err := loader.Load(opts...)
-	if err != nil {
-		return nil, err
+	f := newFallbacks(c)
+	// The prompt, or the messages, are built with the templates of the model
+	f.forPrompt(c.TemplateConfig.UseTokenizerTemplate && s == "")
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		return ModelOptions(c, o)
 	}
-
 	var protoMessages []*proto.Message
 	// if we are using the tokenizer template, we need to convert the messages to proto messages
 	// unless the prompt has already been tokenized (non-chat endpoints + functions)
@@ -81,8 +128,10 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 	}
 
 	// in GRPC, the backend is supposed to answer to 1 single token if stream is not supported
-	fn := func() (LLMResponse, error) {
-		opts := gRPCPredictOpts(c, loader.ModelPath)
+	predict := func(inferenceModel grpc.Backend, c config.BackendConfig, queued time.Time, streamed *bool) (LLMResponse, error) {
+		metrics := startInference(loader, c, queued)
+
+		opts := gRPCPredictOpts(ctx, c, loader.ModelPath)
 		opts.Prompt = s
 		opts.Messages = protoMessages
 		opts.UseTokenizerTemplate = c.TemplateConfig.UseTokenizerTemplate
@@ -92,12 +141,14 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 
 		tokenUsage := TokenUsage{}
 
+		tokenCallback := tokenCallback
+
 		// check the per-model feature flag for usage, since tokenCallback may have a cost.
 		// Defaults to off as for now it is still experimental
 		if c.FeatureFlag.Enabled("usage") {
 			userTokenCallback := tokenCallback
 			if userTokenCallback == nil {
-				userTokenCallback = func(token string, usage TokenUsage) bool {
+				userTokenCallback = func(token string, usage TokenUsage, logprobs []schema.LogprobContent) bool {
 					return true
 				}
 			}
@@ -107,9 +158,9 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 				tokenUsage.Prompt = int(promptInfo.Length)
 			}
 
-			tokenCallback = func(token string, usage TokenUsage) bool {
+			tokenCallback = func(token string, usage TokenUsage, logprobs []schema.LogprobContent) bool {
 				tokenUsage.Completion++
-				return userTokenCallback(token, tokenUsage)
+				return userTokenCallback(token, tokenUsage, logprobs)
 			}
 		}
 
@@ -117,12 +168,20 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 			ss := ""
 
 			var partialRune []byte
+			// The log probabilities are sent with the text of their tokens, once its characters are complete
+			var logprobs, pendingLogprobs []schema.LogprobContent
 			err := inferenceModel.PredictStream(ctx, opts, func(reply *proto.Reply) {
 				msg := reply.Message
 				partialRune = append(partialRune, msg...)
+				pendingLogprobs = append(pendingLogprobs, logprobsFromProto(reply.Logprobs)...)
 
 				tokenUsage.Prompt = int(reply.PromptTokens)
 				tokenUsage.Completion = int(reply.Tokens)
+				tokenUsage.CachedPrompt = int(reply.CachedPromptTokens)
+
+				if len(msg) > 0 {
+					metrics.token()
+				}
 
 				for len(partialRune) > 0 {
 					r, size := utf8.DecodeRune(partialRune)
@@ -131,25 +190,41 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 						break
 					}
 
-					tokenCallback(string(r), tokenUsage)
+					*streamed = true
+					tokenCallback(string(r), tokenUsage, pendingLogprobs)
+					logprobs = append(logprobs, pendingLogprobs...)
+					pendingLogprobs = nil
 					ss += string(r)
 
 					partialRune = partialRune[size:]
 				}
 
 				if len(msg) == 0 {
-					tokenCallback("", tokenUsage)
+					tokenCallback("", tokenUsage, pendingLogprobs)
+					logprobs = append(logprobs, pendingLogprobs...)
+					pendingLogprobs = nil
 				}
 			})
+			if err == nil {
+				metrics.done(tokenUsage)
+				if opts.Logprobs && ss != "" && len(logprobs) == 0 {
+					err = ErrLogprobsUnsupported
+				}
+			}
 			return LLMResponse{
 				Response: ss,
 				Usage:    tokenUsage,
-			}, err
+				Logprobs: logprobs,
+			}, logprobsErr(opts, err)
 		} else {
 			// TODO: Is the chicken bit the only way to get here? is that acceptable?
 			reply, err := inferenceModel.Predict(ctx, opts)
 			if err != nil {
-				return LLMResponse{}, err
+				return LLMResponse{}, logprobsErr(opts, err)
+			}
+			// The backends which ignore the request of the log probabilities reply without them
+			if opts.Logprobs && len(reply.Message) > 0 && len(reply.Logprobs) == 0 {
+				return LLMResponse{}, ErrLogprobsUnsupported
 			}
 			if tokenUsage.Prompt == 0 {
 				tokenUsage.Prompt = int(reply.PromptTokens)
@@ -157,16 +232,78 @@ func ModelInference(ctx context.Context, s string, messages []schema.Message, im
 			if tokenUsage.Completion == 0 {
 				tokenUsage.Completion = int(reply.Tokens)
 			}
+			tokenUsage.CachedPrompt = int(reply.CachedPromptTokens)
+			metrics.done(tokenUsage)
 			return LLMResponse{
 				Response: string(reply.Message),
 				Usage:    tokenUsage,
+				Logprobs: logprobsFromProto(reply.Logprobs),
 			}, err
 		}
 	}
 
+	// The model is loaded once the request has a slot, so that the requests waiting in the queue of the model, or
+	// rejected by it, don't load the model nor evict another one
+	var inferenceModel grpc.Backend
+	var loaded config.BackendConfig
+	fn := func() (LLMResponse, error) {
+		for {
+			queued := time.Now()
+			var release func()
+			var err error
+			if inferenceModel == nil {
+				inferenceModel, loaded, release, err = f.loadInSlot(ctx, loader, modelOpts, inferenceScheduler)
+			} else {
+				release, err = inferenceScheduler.Acquire(ctx, loaded.Name, loaded.MaxConcurrency, loaded.MaxQueue)
+			}
+			if err != nil {
+				return LLMResponse{}, err
+			}
+
+			// The tokens already streamed to the client can't be taken back
+			streamed := false
+			res, err := predict(inferenceModel, loaded, queued, &streamed)
+			release()
+			if streamed || !f.retry(err) {
+				return res, err
+			}
+			inferenceModel = nil
+		}
+	}
+
 	return fn, nil
 }
 
+// logprobsFromProto converts the log probabilities of a reply of a backend, with the UTF-8 bytes of the tokens
+func logprobsFromProto(logprobs []*proto.Logprob) []schema.LogprobContent {
+	var result []schema.LogprobContent
+	for _, l := range logprobs {
+		content := schema.LogprobContent{
+			Token:       l.Token,
+			Logprob:     float64(l.Logprob),
+			Bytes:       tokenBytes(l.Token),
+			TopLogprobs: []schema.TopLogprob{},
+		}
+		for _, t := range l.TopLogprobs {
+			content.TopLogprobs = append(content.TopLogprobs, schema.TopLogprob{
+				Token:   t.Token,
+				Logprob: float64(t.Logprob),
+				Bytes:   tokenBytes(t.Token),
+			})
+		}
+		result = append(result, content)
+	}
+	return result
+}
+
+func tokenBytes(token string) []int {
+	bytes := make([]int, len(token))
+	for i := 0; i < len(token); i++ {
+		bytes[i] = int(token[i])
+	}
+	return bytes
+}
+
 var cutstrings map[string]*regexp.Regexp = make(map[string]*regexp.Regexp)
 var mu sync.Mutex = sync.Mutex{}
 
@@ -0,0 +1,101 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/mudler/LocalAI/core/config"
+	model "github.com/mudler/LocalAI/pkg/model"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The metrics are recorded with the global meter provider, which exports them on /metrics once the metrics service
+// of the API is started, and discards them otherwise
+var meter = otel.Meter("github.com/mudler/LocalAI/core/backend")
+
+var (
+	queueDuration = instrument(meter.Float64Histogram("inference_queue_duration",
+		metric.WithDescription("Time waited by the inference requests in the queue of the model"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.001, 0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300)))
+	timeToFirstToken = instrument(meter.Float64Histogram("inference_time_to_first_token",
+		metric.WithDescription("Time from the start of the inference to the first streamed token"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.05, 0.1, 0.25, 0.5, 1, 2, 5, 10, 20, 30, 60, 120)))
+	tokensPerSecond = instrument(meter.Float64Histogram("inference_tokens_per_second",
+		metric.WithDescription("Completion tokens generated per second, from the first token for the streamed inferences"),
+		metric.WithExplicitBucketBoundaries(1, 2, 5, 10, 20, 30, 50, 75, 100, 150, 200, 300, 500, 1000)))
+	promptTokens = instrument(meter.Int64Histogram("inference_prompt_tokens",
+		metric.WithDescription("Tokens of the prompts of the inferences"),
+		metric.WithExplicitBucketBoundaries(16, 64, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768, 65536, 131072)))
+	completionTokens = instrument(meter.Int64Histogram("inference_completion_tokens",
+		metric.WithDescription("Tokens generated by the inferences"),
+		metric.WithExplicitBucketBoundaries(16, 64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 32768)))
+)
+
+func instrument[T any](i T, err error) T {
+	if err != nil {
+		log.Error().Err(err).Msg("unable to create the metric")
+	}
+	return i
+}
+
+// metricAttributes returns the labels of the metrics of the inferences of the model of c: its name and its backend,
+// the backend which loaded it when it is not configured
+func metricAttributes(loader *model.ModelLoader, c config.BackendConfig) metric.MeasurementOption {
+	name := c.Name
+	if name == "" {
+		name = c.Model
+	}
+	backend := c.Backend
+	if backend == "" {
+		backend = loader.Backend(name)
+	}
+	return metric.WithAttributes(attribute.String("model", name), attribute.String("backend", backend))
+}
+
+// inferenceMetrics records the metrics of an inference
+type inferenceMetrics struct {
+	attributes metric.MeasurementOption
+	start      time.Time
+	firstToken time.Time
+}
+
+// startInference records the time waited in the queue since queued, and starts to time the inference
+func startInference(loader *model.ModelLoader, c config.BackendConfig, queued time.Time) *inferenceMetrics {
+	m := &inferenceMetrics{attributes: metricAttributes(loader, c), start: time.Now()}
+	queueDuration.Record(context.Background(), m.start.Sub(queued).Seconds(), m.attributes)
+	return m
+}
+
+// token records the time to the first token when the inference streams its first token
+func (m *inferenceMetrics) token() {
+	if m.firstToken.IsZero() {
+		m.firstToken = time.Now()
+		timeToFirstToken.Record(context.Background(), m.firstToken.Sub(m.start).Seconds(), m.attributes)
+	}
+}
+
+// done records the tokens of the inference and its generation speed
+func (m *inferenceMetrics) done(usage TokenUsage) {
+	ctx := context.Background()
+	if usage.Prompt > 0 {
+		promptTokens.Record(ctx, int64(usage.Prompt), m.attributes)
+	}
+	if usage.Completion == 0 {
+		return
+	}
+	completionTokens.Record(ctx, int64(usage.Completion), m.attributes)
+
+	// The first token of a streamed inference is generated with the processing of the prompt
+	start, tokens := m.start, usage.Completion
+	if !m.firstToken.IsZero() && tokens > 1 {
+		start, tokens = m.firstToken, tokens-1
+	}
+	if elapsed := time.Since(start).Seconds(); elapsed > 0 {
+		tokensPerSecond.Record(ctx, float64(tokens)/elapsed, m.attributes)
+	}
+}
@@ -1,6 +1,7 @@
 package backend
 
 import (
+	"context"
 	"math/rand"
 	"os"
 	"path/filepath"
@@ -11,6 +12,12 @@ import (
 	"github.com/rs/zerolog/log"
 )
 
+type correlationIDKeyType string
+
+// CorrelationIDKey is the key of the correlation ID of the request in its context, which is passed to the backends
+// in the predict options to track the request across the process boundary
+const CorrelationIDKey correlationIDKeyType = "correlationID"
+
 func ModelOptions(c config.BackendConfig, so *config.ApplicationConfig, opts ...model.Option) []model.Option {
 	name := c.Name
 	if name == "" {
@@ -44,6 +51,10 @@ func ModelOptions(c config.BackendConfig, so *config.ApplicationConfig, opts ...
 		defOpts = append(defOpts, model.WithSingleActiveBackend())
 	}
 
+	if c.EstimatedRAM != 0 || c.EstimatedVRAM != 0 {
+		defOpts = append(defOpts, model.WithMemoryEstimate(model.MemoryEstimate{RAM: c.EstimatedRAM, VRAM: c.EstimatedVRAM}))
+	}
+
 	if so.ParallelBackendRequests {
 		defOpts = append(defOpts, model.EnableParallelRequests)
 	}
@@ -183,7 +194,7 @@ func grpcModelOpts(c config.BackendConfig) *pb.ModelOptions {
 	}
 }
 
-func gRPCPredictOpts(c config.BackendConfig, modelPath string) *pb.PredictOptions {
+func gRPCPredictOpts(ctx context.Context, c config.BackendConfig, modelPath string) *pb.PredictOptions {
 	promptCachePath := ""
 	if c.PromptCachePath != "" {
 		p := filepath.Join(modelPath, c.PromptCachePath)
@@ -195,6 +206,8 @@ func gRPCPredictOpts(c config.BackendConfig, modelPath string) *pb.PredictOption
 		}
 	}
 
+	correlationID, _ := ctx.Value(CorrelationIDKey).(string)
+
 	return &pb.PredictOptions{
 		Temperature:         float32(*c.Temperature),
 		TopP:                float32(*c.TopP),
@@ -209,6 +222,7 @@ func gRPCPredictOpts(c config.BackendConfig, modelPath string) *pb.PredictOption
 		DebugMode:           *c.Debug,
 		Grammar:             c.Grammar,
 		NegativePromptScale: c.NegativePromptScale,
+		CorrelationId:       correlationID,
 		RopeFreqBase:        c.RopeFreqBase,
 		RopeFreqScale:       c.RopeFreqScale,
 		NegativePrompt:      c.NegativePrompt,
@@ -231,5 +245,8 @@ func gRPCPredictOpts(c config.BackendConfig, modelPath string) *pb.PredictOption
 		TensorSplit:         c.TensorSplit,
 		TailFreeSamplingZ:   float32(*c.TFZ),
 		TypicalP:            float32(*c.TypicalP),
+		Logprobs:            c.Logprobs,
+		TopLogprobs:         int32(c.TopLogprobs),
+		NoPromptCacheReuse:  c.NoPromptCacheReuse,
 	}
 }
@@ -5,23 +5,23 @@ import (
 	"fmt"
 
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 )
 
-func Rerank(modelFile string, request *proto.RerankRequest, loader *model.ModelLoader, appConfig *config.ApplicationConfig, backendConfig config.BackendConfig) (*proto.RerankResult, error) {
+func Rerank(ctx context.Context, modelFile string, request *proto.RerankRequest, loader *model.ModelLoader, appConfig *config.ApplicationConfig, backendConfig config.BackendConfig) (*proto.RerankResult, error) {
 
-	opts := ModelOptions(backendConfig, appConfig, model.WithModel(modelFile))
-	rerankModel, err := loader.Load(opts...)
-	if err != nil {
-		return nil, err
+	backendConfig.Model = modelFile
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		return ModelOptions(c, appConfig)
 	}
 
-	if rerankModel == nil {
-		return nil, fmt.Errorf("could not load rerank model")
-	}
-
-	res, err := rerankModel.Rerank(context.Background(), request)
+	return withFallbacks(ctx, loader, backendConfig, modelOpts, func(rerankModel grpc.Backend, _ config.BackendConfig) (*proto.RerankResult, error) {
+		if rerankModel == nil {
+			return nil, fmt.Errorf("could not load rerank model")
+		}
 
-	return res, err
+		return rerankModel.Rerank(ctx, request)
+	})
 }
@@ -7,12 +7,14 @@ import (
 	"path/filepath"
 
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/utils"
 )
 
 func SoundGeneration(
+	ctx context.Context,
 	modelFile string,
 	text string,
 	duration *float32,
@@ -25,14 +27,9 @@ func SoundGeneration(
 	backendConfig config.BackendConfig,
 ) (string, *proto.Result, error) {
 
-	opts := ModelOptions(backendConfig, appConfig, model.WithModel(modelFile))
-	soundGenModel, err := loader.Load(opts...)
-	if err != nil {
-		return "", nil, err
-	}
-
-	if soundGenModel == nil {
-		return "", nil, fmt.Errorf("could not load sound generation model")
+	backendConfig.Model = modelFile
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		return ModelOptions(c, appConfig)
 	}
 
 	if err := os.MkdirAll(appConfig.AudioDir, 0750); err != nil {
@@ -42,16 +39,25 @@ func SoundGeneration(
 	fileName := utils.GenerateUniqueFileName(appConfig.AudioDir, "sound_generation", ".wav")
 	filePath := filepath.Join(appConfig.AudioDir, fileName)
 
-	res, err := soundGenModel.SoundGeneration(context.Background(), &proto.SoundGenerationRequest{
-		Text:        text,
-		Model:       modelFile,
-		Dst:         filePath,
-		Sample:      doSample,
-		Duration:    duration,
-		Temperature: temperature,
-		Src:         sourceFile,
-		SrcDivisor:  sourceDivisor,
+	res, err := withFallbacks(ctx, loader, backendConfig, modelOpts, func(soundGenModel grpc.Backend, backendConfig config.BackendConfig) (*proto.Result, error) {
+		if soundGenModel == nil {
+			return nil, fmt.Errorf("could not load sound generation model")
+		}
+
+		return soundGenModel.SoundGeneration(ctx, &proto.SoundGenerationRequest{
+			Text:        text,
+			Model:       backendConfig.Model,
+			Dst:         filePath,
+			Sample:      doSample,
+			Duration:    duration,
+			Temperature: temperature,
+			Src:         sourceFile,
+			SrcDivisor:  sourceDivisor,
+		})
 	})
+	if err != nil {
+		return "", nil, err
+	}
 
 	// return RPC error if any
 	if !res.Success {
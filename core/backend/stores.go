@@ -1,10 +1,15 @@
 package backend
 
 import (
+	"fmt"
+	"path/filepath"
+
 	"github.com/mudler/LocalAI/core/config"
 
 	"github.com/mudler/LocalAI/pkg/grpc"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/utils"
 )
 
 func StoreBackend(sl *model.ModelLoader, appConfig *config.ApplicationConfig, storeName string) (grpc.Backend, error) {
@@ -12,10 +17,27 @@ func StoreBackend(sl *model.ModelLoader, appConfig *config.ApplicationConfig, st
 		storeName = "default"
 	}
 
+	grpcOpts := &pb.ModelOptions{}
+
+	// Each store gets its own directory, the backend reloads it on start
+	if appConfig.StoresDir != "" {
+		if err := utils.VerifyPath(storeName, appConfig.StoresDir); err != nil {
+			return nil, fmt.Errorf("invalid store name %q: %w", storeName, err)
+		}
+		storeDir := filepath.Join(appConfig.StoresDir, storeName)
+
+		grpcOpts.Options = append(grpcOpts.Options, fmt.Sprintf("persist_dir:%s", storeDir))
+		if appConfig.StoresSnapshotInterval != 0 {
+			grpcOpts.Options = append(grpcOpts.Options, fmt.Sprintf("snapshot_interval:%s", appConfig.StoresSnapshotInterval))
+		}
+	}
+
 	sc := []model.Option{
 		model.WithBackendString(model.LocalStoreBackend),
 		model.WithAssetDir(appConfig.AssetsDestination),
 		model.WithModel(storeName),
+		model.WithModelID(storeName),
+		model.WithLoadGRPCLoadModelOpts(grpcOpts),
 	}
 
 	return sl.Load(sc...)
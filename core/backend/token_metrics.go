@@ -5,27 +5,28 @@ import (
 	"fmt"
 
 	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	model "github.com/mudler/LocalAI/pkg/model"
 )
 
 func TokenMetrics(
+	ctx context.Context,
 	modelFile string,
 	loader *model.ModelLoader,
 	appConfig *config.ApplicationConfig,
 	backendConfig config.BackendConfig) (*proto.MetricsResponse, error) {
 
-	opts := ModelOptions(backendConfig, appConfig, model.WithModel(modelFile))
-	model, err := loader.Load(opts...)
-	if err != nil {
-		return nil, err
+	backendConfig.Model = modelFile
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		return ModelOptions(c, appConfig)
 	}
 
-	if model == nil {
-		return nil, fmt.Errorf("could not loadmodel model")
-	}
-
-	res, err := model.GetTokenMetrics(context.Background(), &proto.MetricsRequest{})
+	return withFallbacks(ctx, loader, backendConfig, modelOpts, func(model grpc.Backend, _ config.BackendConfig) (*proto.MetricsResponse, error) {
+		if model == nil {
+			return nil, fmt.Errorf("could not loadmodel model")
+		}
 
-	return res, err
+		return model.GetTokenMetrics(ctx, &proto.MetricsRequest{})
+	})
 }
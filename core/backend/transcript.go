@@ -8,32 +8,31 @@ import (
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/schema"
 
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/mudler/LocalAI/pkg/model"
 )
 
-func ModelTranscription(audio, language string, translate bool, ml *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (*schema.TranscriptionResult, error) {
+func ModelTranscription(ctx context.Context, audio, language string, translate bool, ml *model.ModelLoader, backendConfig config.BackendConfig, appConfig *config.ApplicationConfig) (*schema.TranscriptionResult, error) {
 
-	if backendConfig.Backend == "" {
-		backendConfig.Backend = model.WhisperBackend
-	}
-
-	opts := ModelOptions(backendConfig, appConfig)
-
-	transcriptionModel, err := ml.Load(opts...)
-	if err != nil {
-		return nil, err
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		if c.Backend == "" {
+			c.Backend = model.WhisperBackend
+		}
+		return ModelOptions(c, appConfig)
 	}
 
-	if transcriptionModel == nil {
-		return nil, fmt.Errorf("could not load transcription model")
-	}
+	r, err := withFallbacks(ctx, ml, backendConfig, modelOpts, func(transcriptionModel grpc.Backend, backendConfig config.BackendConfig) (*proto.TranscriptResult, error) {
+		if transcriptionModel == nil {
+			return nil, fmt.Errorf("could not load transcription model")
+		}
 
-	r, err := transcriptionModel.AudioTranscription(context.Background(), &proto.TranscriptRequest{
-		Dst:       audio,
-		Language:  language,
-		Translate: translate,
-		Threads:   uint32(*backendConfig.Threads),
+		return transcriptionModel.AudioTranscription(ctx, &proto.TranscriptRequest{
+			Dst:       audio,
+			Language:  language,
+			Translate: translate,
+			Threads:   uint32(*backendConfig.Threads),
+		})
 	})
 	if err != nil {
 		return nil, err
@@ -8,12 +8,14 @@ import (
 
 	"github.com/mudler/LocalAI/core/config"
 
+	"github.com/mudler/LocalAI/pkg/grpc"
 	"github.com/mudler/LocalAI/pkg/grpc/proto"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/utils"
 )
 
 func ModelTTS(
+	ctx context.Context,
 	backend,
 	text,
 	modelFile,
@@ -23,19 +25,14 @@ func ModelTTS(
 	appConfig *config.ApplicationConfig,
 	backendConfig config.BackendConfig,
 ) (string, *proto.Result, error) {
-	bb := backend
-	if bb == "" {
-		bb = model.PiperBackend
-	}
-
-	opts := ModelOptions(backendConfig, appConfig, model.WithBackendString(bb), model.WithModel(modelFile))
-	ttsModel, err := loader.Load(opts...)
-	if err != nil {
-		return "", nil, err
-	}
-
-	if ttsModel == nil {
-		return "", nil, fmt.Errorf("could not load piper model")
+	backendConfig.Backend = backend
+	backendConfig.Model = modelFile
+	modelOpts := func(c config.BackendConfig) []model.Option {
+		bb := c.Backend
+		if bb == "" {
+			bb = model.PiperBackend
+		}
+		return ModelOptions(c, appConfig, model.WithBackendString(bb))
 	}
 
 	if err := os.MkdirAll(appConfig.AudioDir, 0750); err != nil {
@@ -45,30 +42,37 @@ func ModelTTS(
 	fileName := utils.GenerateUniqueFileName(appConfig.AudioDir, "tts", ".wav")
 	filePath := filepath.Join(appConfig.AudioDir, fileName)
 
-	// If the model file is not empty, we pass it joined with the model path
-	modelPath := ""
-	if modelFile != "" {
+	res, err := withFallbacks(ctx, loader, backendConfig, modelOpts, func(ttsModel grpc.Backend, backendConfig config.BackendConfig) (*proto.Result, error) {
+		if ttsModel == nil {
+			return nil, fmt.Errorf("could not load piper model")
+		}
+
 		// If the model file is not empty, we pass it joined with the model path
-		// Checking first that it exists and is not outside ModelPath
-		// TODO: we should actually first check if the modelFile is looking like
-		// a FS path
-		mp := filepath.Join(loader.ModelPath, modelFile)
-		if _, err := os.Stat(mp); err == nil {
-			if err := utils.VerifyPath(mp, appConfig.ModelPath); err != nil {
-				return "", nil, err
+		modelFile := backendConfig.Model
+		modelPath := ""
+		if modelFile != "" {
+			// If the model file is not empty, we pass it joined with the model path
+			// Checking first that it exists and is not outside ModelPath
+			// TODO: we should actually first check if the modelFile is looking like
+			// a FS path
+			mp := filepath.Join(loader.ModelPath, modelFile)
+			if _, err := os.Stat(mp); err == nil {
+				if err := utils.VerifyPath(mp, appConfig.ModelPath); err != nil {
+					return nil, err
+				}
+				modelPath = mp
+			} else {
+				modelPath = modelFile
 			}
-			modelPath = mp
-		} else {
-			modelPath = modelFile
 		}
-	}
 
-	res, err := ttsModel.TTS(context.Background(), &proto.TTSRequest{
-		Text:     text,
-		Model:    modelPath,
-		Voice:    voice,
-		Dst:      filePath,
-		Language: &language,
+		return ttsModel.TTS(ctx, &proto.TTSRequest{
+			Text:     text,
+			Model:    modelPath,
+			Voice:    voice,
+			Dst:      filePath,
+			Language: &language,
+		})
 	})
 	if err != nil {
 		return "", nil, err
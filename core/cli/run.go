@@ -12,6 +12,8 @@ import (
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/http"
 	"github.com/mudler/LocalAI/core/p2p"
+	"github.com/mudler/LocalAI/pkg/concurrency"
+	"github.com/mudler/LocalAI/pkg/tracing"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 )
@@ -25,7 +27,10 @@ type RunCMD struct {
 	AudioPath                    string        `env:"LOCALAI_AUDIO_PATH,AUDIO_PATH" type:"path" default:"/tmp/generated/audio" help:"Location for audio generated by backends (e.g. piper)" group:"storage"`
 	UploadPath                   string        `env:"LOCALAI_UPLOAD_PATH,UPLOAD_PATH" type:"path" default:"/tmp/localai/upload" help:"Path to store uploads from files api" group:"storage"`
 	ConfigPath                   string        `env:"LOCALAI_CONFIG_PATH,CONFIG_PATH" default:"/tmp/localai/config" group:"storage"`
-	LocalaiConfigDir             string        `env:"LOCALAI_CONFIG_DIR" type:"path" default:"${basepath}/configuration" help:"Directory for dynamic loading of certain configuration files (currently api_keys.json and external_backends.json)" group:"storage"`
+	StoresPath                   string        `env:"LOCALAI_STORES_PATH,STORES_PATH" type:"path" help:"Directory where the vector stores are persisted (e.g. ${basepath}/models/stores). If empty, stores are kept in memory only" group:"storage"`
+	StoresSnapshotInterval       time.Duration `env:"LOCALAI_STORES_SNAPSHOT_INTERVAL,STORES_SNAPSHOT_INTERVAL" default:"5m" help:"Interval between snapshots of the persisted vector stores. Writes in between are kept in a write-ahead log" group:"storage"`
+	UsageRetention               time.Duration `env:"LOCALAI_USAGE_RETENTION,USAGE_RETENTION" default:"2160h" help:"How long the usage of the API keys is kept, forever if 0" group:"storage"`
+	LocalaiConfigDir             string        `env:"LOCALAI_CONFIG_DIR" type:"path" default:"${basepath}/configuration" help:"Directory for dynamic loading of certain configuration files (currently api_keys.json, jwt_groups.json and external_backends.json)" group:"storage"`
 	LocalaiConfigDirPollInterval time.Duration `env:"LOCALAI_CONFIG_DIR_POLL_INTERVAL" help:"Typically the config path picks up changes automatically, but if your system has broken fsnotify events, set this to an interval to poll the LocalAI Config Dir (example: 1m)" group:"storage"`
 	// The alias on this option is there to preserve functionality with the old `--config-file` parameter
 	ModelsConfigFile string `env:"LOCALAI_MODELS_CONFIG_FILE,CONFIG_FILE" aliases:"config-file" help:"YAML file containing a list of model backend configs" group:"storage"`
@@ -37,6 +42,8 @@ type RunCMD struct {
 	Models              []string `env:"LOCALAI_MODELS,MODELS" help:"A List of model configuration URLs to load" group:"models"`
 	PreloadModelsConfig string   `env:"LOCALAI_PRELOAD_MODELS_CONFIG,PRELOAD_MODELS_CONFIG" help:"A List of models to apply at startup. Path to a YAML config file" group:"models"`
 
+	AssistantsEmbeddingModel string `env:"LOCALAI_ASSISTANTS_EMBEDDING_MODEL,ASSISTANTS_EMBEDDING_MODEL" help:"Embedding model used to index the files of the assistants with the retrieval tool" group:"models"`
+
 	F16         bool `name:"f16" env:"LOCALAI_F16,F16" help:"Enable GPU acceleration" group:"performance"`
 	Threads     int  `env:"LOCALAI_THREADS,THREADS" short:"t" help:"Number of threads used for parallel computation. Usage of the number of physical cores in the system is suggested" group:"performance"`
 	ContextSize int  `env:"LOCALAI_CONTEXT_SIZE,CONTEXT_SIZE" default:"512" help:"Default context size for models" group:"performance"`
@@ -48,12 +55,22 @@ type RunCMD struct {
 	CSRF                               bool     `env:"LOCALAI_CSRF" help:"Enables fiber CSRF middleware" group:"api"`
 	UploadLimit                        int      `env:"LOCALAI_UPLOAD_LIMIT,UPLOAD_LIMIT" default:"15" help:"Default upload-limit in MB" group:"api"`
 	APIKeys                            []string `env:"LOCALAI_API_KEY,API_KEY" help:"List of API Keys to enable API authentication. When this is set, all the requests must be authenticated with one of these API keys" group:"api"`
+	JWTIssuer                          string   `env:"LOCALAI_JWT_ISSUER" help:"OpenID Connect issuer whose JWTs are accepted as bearer tokens, in addition to the API keys. Its keys are discovered from /.well-known/openid-configuration" group:"api"`
+	JWTJWKSFile                        string   `env:"LOCALAI_JWT_JWKS_FILE" type:"path" help:"JWKS file with the keys of the JWTs accepted as bearer tokens, instead of the keys of the issuer. The file is read again when a token is signed by an unknown key" group:"api"`
+	JWTAudience                        string   `env:"LOCALAI_JWT_AUDIENCE" help:"Audience which the JWTs must have. Required with --jwt-issuer, not checked when empty with --jwt-jwks-file" group:"api"`
+	JWTNameClaim                       string   `env:"LOCALAI_JWT_NAME_CLAIM" default:"sub" help:"Claim of the JWTs with the name of the user, reported in the usage" group:"api"`
+	JWTGroupsClaim                     string   `env:"LOCALAI_JWT_GROUPS_CLAIM" default:"groups" help:"Claim of the JWTs with the groups of the user, mapped to access policies in jwt_groups.json. Nested claims are separated by dots, e.g. realm_access.roles" group:"api"`
+	APIKeyPriorities                   []string `env:"LOCALAI_API_KEY_PRIORITIES" help:"Priority of the requests of an API key in the queues of the models, as <api key>=<low|normal|high>. The other keys have the normal priority" group:"api"`
 	DisableWebUI                       bool     `env:"LOCALAI_DISABLE_WEBUI,DISABLE_WEBUI" default:"false" help:"Disable webui" group:"api"`
 	DisablePredownloadScan             bool     `env:"LOCALAI_DISABLE_PREDOWNLOAD_SCAN" help:"If true, disables the best-effort security scanner before downloading any files." group:"hardening" default:"false"`
 	OpaqueErrors                       bool     `env:"LOCALAI_OPAQUE_ERRORS" default:"false" help:"If true, all error responses are replaced with blank 500 errors. This is intended only for hardening against information leaks and is normally not recommended." group:"hardening"`
 	UseSubtleKeyComparison             bool     `env:"LOCALAI_SUBTLE_KEY_COMPARISON" default:"false" help:"If true, API Key validation comparisons will be performed using constant-time comparisons rather than simple equality. This trades off performance on each request for resiliancy against timing attacks." group:"hardening"`
 	DisableApiKeyRequirementForHttpGet bool     `env:"LOCALAI_DISABLE_API_KEY_REQUIREMENT_FOR_HTTP_GET" default:"false" help:"If true, a valid API key is not required to issue GET requests to portions of the web ui. This should only be enabled in secure testing environments" group:"hardening"`
 	DisableMetricsEndpoint             bool     `env:"LOCALAI_DISABLE_METRICS_ENDPOINT,DISABLE_METRICS_ENDPOINT" default:"false" help:"Disable the /metrics endpoint" group:"api"`
+	TracingExporter                    string   `env:"LOCALAI_TRACING_EXPORTER" help:"Exporter of the OpenTelemetry spans of the requests and of the backends: otlp, stdout or file. The tracing is disabled when empty" group:"tracing"`
+	TracingEndpoint                    string   `env:"LOCALAI_TRACING_ENDPOINT" help:"URL of the OTLP/HTTP collector of the otlp exporter. When empty, the OTEL_EXPORTER_OTLP_* variables are honored, and the spans are sent to http://localhost:4318" group:"tracing"`
+	TracingFile                        string   `env:"LOCALAI_TRACING_FILE" type:"path" help:"File to which the file exporter appends the spans, as JSON lines" group:"tracing"`
+	TracingSampleRatio                 float64  `env:"LOCALAI_TRACING_SAMPLE_RATIO" default:"1" help:"Ratio of the traces started by LocalAI which are recorded. The requests with a trace context are recorded if their caller recorded them" group:"tracing"`
 	HttpGetExemptedEndpoints           []string `env:"LOCALAI_HTTP_GET_EXEMPTED_ENDPOINTS" default:"^/$,^/browse/?$,^/talk/?$,^/p2p/?$,^/chat/?$,^/text2image/?$,^/tts/?$,^/static/.*$,^/swagger.*$" help:"If LOCALAI_DISABLE_API_KEY_REQUIREMENT_FOR_HTTP_GET is overriden to true, this is the list of endpoints to exempt. Only adjust this in case of a security incident or as a result of a personal security posture review" group:"hardening"`
 	Peer2Peer                          bool     `env:"LOCALAI_P2P,P2P" name:"p2p" default:"false" help:"Enable P2P mode" group:"p2p"`
 	Peer2PeerDHTInterval               int      `env:"LOCALAI_P2P_DHT_INTERVAL,P2P_DHT_INTERVAL" default:"360" name:"p2p-dht-interval" help:"Interval for DHT refresh (used during token generation)" group:"p2p"`
@@ -62,6 +79,8 @@ type RunCMD struct {
 	Peer2PeerNetworkID                 string   `env:"LOCALAI_P2P_NETWORK_ID,P2P_NETWORK_ID" help:"Network ID for P2P mode, can be set arbitrarly by the user for grouping a set of instances" group:"p2p"`
 	ParallelRequests                   bool     `env:"LOCALAI_PARALLEL_REQUESTS,PARALLEL_REQUESTS" help:"Enable backends to handle multiple requests in parallel if they support it (e.g.: llama.cpp or vllm)" group:"backends"`
 	SingleActiveBackend                bool     `env:"LOCALAI_SINGLE_ACTIVE_BACKEND,SINGLE_ACTIVE_BACKEND" help:"Allow only one backend to be run at a time" group:"backends"`
+	MemoryBudgetRAM                    uint64   `env:"LOCALAI_MEMORY_BUDGET_RAM" help:"RAM in MB for the loaded models. Before loading a model which would exceed it, the least recently used idle models are stopped" group:"backends"`
+	MemoryBudgetVRAM                   uint64   `env:"LOCALAI_MEMORY_BUDGET_VRAM" help:"VRAM in MB for the loaded models. Before loading a model which would exceed it, the least recently used idle models are stopped" group:"backends"`
 	PreloadBackendOnly                 bool     `env:"LOCALAI_PRELOAD_BACKEND_ONLY,PRELOAD_BACKEND_ONLY" default:"false" help:"Do not launch the API services, only the preloaded models / backends are started (useful for multi-node setups)" group:"backends"`
 	ExternalGRPCBackends               []string `env:"LOCALAI_EXTERNAL_GRPC_BACKENDS,EXTERNAL_GRPC_BACKENDS" help:"A list of external grpc backends" group:"backends"`
 	EnableWatchdogIdle                 bool     `env:"LOCALAI_WATCHDOG_IDLE,WATCHDOG_IDLE" default:"false" help:"Enable watchdog for stopping backends that are idle longer than the watchdog-idle-timeout" group:"backends"`
@@ -85,6 +104,10 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 		config.WithAudioDir(r.AudioPath),
 		config.WithUploadDir(r.UploadPath),
 		config.WithConfigsDir(r.ConfigPath),
+		config.WithStoresDir(r.StoresPath),
+		config.WithStoresSnapshotInterval(r.StoresSnapshotInterval),
+		config.WithUsageRetention(r.UsageRetention),
+		config.WithAssistantsEmbeddingModel(r.AssistantsEmbeddingModel),
 		config.WithDynamicConfigDir(r.LocalaiConfigDir),
 		config.WithDynamicConfigDirPollInterval(r.LocalaiConfigDirPollInterval),
 		config.WithF16(r.F16),
@@ -99,6 +122,10 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 		config.WithBackendAssetsOutput(r.BackendAssetsPath),
 		config.WithUploadLimitMB(r.UploadLimit),
 		config.WithApiKeys(r.APIKeys),
+		config.WithJWTIssuer(r.JWTIssuer),
+		config.WithJWTJWKSFile(r.JWTJWKSFile),
+		config.WithJWTAudience(r.JWTAudience),
+		config.WithJWTClaims(r.JWTNameClaim, r.JWTGroupsClaim),
 		config.WithModelsURL(append(r.Models, r.ModelArgs...)...),
 		config.WithOpaqueErrors(r.OpaqueErrors),
 		config.WithEnforcedPredownloadScans(!r.DisablePredownloadScan),
@@ -109,6 +136,15 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 		config.WithLoadToMemory(r.LoadToMemory),
 	}
 
+	if r.TracingExporter != "" {
+		opts = append(opts, config.WithTracing(tracing.Config{
+			Exporter:    r.TracingExporter,
+			Endpoint:    r.TracingEndpoint,
+			File:        r.TracingFile,
+			SampleRatio: r.TracingSampleRatio,
+		}))
+	}
+
 	if r.DisableMetricsEndpoint {
 		opts = append(opts, config.DisableMetricsEndpoint)
 	}
@@ -173,6 +209,22 @@ func (r *RunCMD) Run(ctx *cliContext.Context) error {
 	if r.SingleActiveBackend {
 		opts = append(opts, config.EnableSingleBackend)
 	}
+	if r.MemoryBudgetRAM != 0 || r.MemoryBudgetVRAM != 0 {
+		opts = append(opts, config.WithMemoryBudget(r.MemoryBudgetRAM<<20, r.MemoryBudgetVRAM<<20))
+	}
+
+	// split the last "=" to get the api key and the priority, as keys may end with "="
+	for _, v := range r.APIKeyPriorities {
+		i := strings.LastIndexByte(v, '=')
+		if i < 0 {
+			return fmt.Errorf("invalid api key priority %q, expected <api key>=<priority>", v)
+		}
+		priority, err := concurrency.ParsePriority(v[i+1:])
+		if err != nil {
+			return err
+		}
+		opts = append(opts, config.WithApiKeyPriority(v[:i], priority))
+	}
 
 	// split ":" to get backend name and the uri
 	for _, v := range r.ExternalGRPCBackends {
@@ -0,0 +1,133 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// APIKeyScope is a group of endpoints which an API key can call
+type APIKeyScope string
+
+const (
+	// APIKeyScopeInference are the endpoints which run the models: chat, completions, embeddings, images, audio...
+	APIKeyScopeInference APIKeyScope = "inference"
+	// APIKeyScopeAdmin are the endpoints which manage the instance: the backends, the galleries, the system and p2p
+	APIKeyScopeAdmin APIKeyScope = "admin"
+	// APIKeyScopeGallery are the endpoints which install and delete the models of the galleries
+	APIKeyScopeGallery APIKeyScope = "gallery"
+	// APIKeyScopeStores are the endpoints of the vector stores and of the collections
+	APIKeyScopeStores APIKeyScope = "stores"
+)
+
+var apiKeyScopes = []APIKeyScope{APIKeyScopeInference, APIKeyScopeAdmin, APIKeyScopeGallery, APIKeyScopeStores}
+
+// AccessPolicy are the endpoints and the models an API key, or the users of a JWT group, can use, and their limits. The
+// zero values don't restrict the access: all the scopes, all the models and no rate limits.
+type AccessPolicy struct {
+	Scopes []APIKeyScope `json:"scopes,omitempty"`
+	// Models are the models, or the model aliases, the key can use
+	Models            []string `json:"models,omitempty"`
+	RequestsPerMinute int      `json:"requests_per_minute,omitempty"`
+	// TokensPerDay are the prompt and completion tokens the key can use per day, the day starting at 00:00 UTC
+	TokensPerDay int `json:"tokens_per_day,omitempty"`
+}
+
+// APIKey is an API key of api_keys.json, with the identity of its owner, its access policy and its expiry. A key without
+// expiry doesn't expire. A key can also be given as a string, with no identity and no restriction.
+type APIKey struct {
+	Key  string `json:"key"`
+	Name string `json:"name,omitempty"`
+	AccessPolicy
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (k *APIKey) UnmarshalJSON(data []byte) error {
+	var key string
+	if err := json.Unmarshal(data, &key); err == nil {
+		*k = APIKey{Key: key}
+		return k.Validate()
+	}
+
+	type apiKey APIKey
+	if err := json.Unmarshal(data, (*apiKey)(k)); err != nil {
+		return err
+	}
+	return k.Validate()
+}
+
+func (k APIKey) Validate() error {
+	if k.Key == "" {
+		return fmt.Errorf("API key %q has no key", k.Name)
+	}
+	if err := k.AccessPolicy.Validate(); err != nil {
+		return fmt.Errorf("API key %q %w", k.Name, err)
+	}
+	return nil
+}
+
+func (p AccessPolicy) Validate() error {
+	for _, s := range p.Scopes {
+		if !slices.Contains(apiKeyScopes, s) {
+			return fmt.Errorf("has an unknown scope %q", s)
+		}
+	}
+	if p.RequestsPerMinute < 0 || p.TokensPerDay < 0 {
+		return fmt.Errorf("has a negative limit")
+	}
+	return nil
+}
+
+// HasScope returns true if the policy allows to call the endpoints of scope
+func (p AccessPolicy) HasScope(scope APIKeyScope) bool {
+	return len(p.Scopes) == 0 || slices.Contains(p.Scopes, scope)
+}
+
+// AllowsModel returns true if the policy allows to use model
+func (p AccessPolicy) AllowsModel(model string) bool {
+	return len(p.Models) == 0 || slices.Contains(p.Models, model)
+}
+
+// MergeAccessPolicies returns the policy which allows what any of policies allows, e.g. the policy of a user in
+// several JWT groups: the union of the scopes and of the models, and the highest limits
+func MergeAccessPolicies(policies ...AccessPolicy) AccessPolicy {
+	merged := AccessPolicy{}
+	allScopes, allModels, noRequestLimit, noTokenLimit := false, false, false, false
+	for _, p := range policies {
+		allScopes = allScopes || len(p.Scopes) == 0
+		allModels = allModels || len(p.Models) == 0
+		noRequestLimit = noRequestLimit || p.RequestsPerMinute == 0
+		noTokenLimit = noTokenLimit || p.TokensPerDay == 0
+		for _, s := range p.Scopes {
+			if !slices.Contains(merged.Scopes, s) {
+				merged.Scopes = append(merged.Scopes, s)
+			}
+		}
+		for _, m := range p.Models {
+			if !slices.Contains(merged.Models, m) {
+				merged.Models = append(merged.Models, m)
+			}
+		}
+		merged.RequestsPerMinute = max(merged.RequestsPerMinute, p.RequestsPerMinute)
+		merged.TokensPerDay = max(merged.TokensPerDay, p.TokensPerDay)
+	}
+	if allScopes {
+		merged.Scopes = nil
+	}
+	if allModels {
+		merged.Models = nil
+	}
+	if noRequestLimit {
+		merged.RequestsPerMinute = 0
+	}
+	if noTokenLimit {
+		merged.TokensPerDay = 0
+	}
+	return merged
+}
+
+// Expired returns true if the key is expired at t
+func (k APIKey) Expired(t time.Time) bool {
+	return k.ExpiresAt != nil && !t.Before(*k.ExpiresAt)
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"encoding/json"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("API keys", func() {
+	It("reads the keys as strings or with their identity", func() {
+		var keys []APIKey
+		Expect(json.Unmarshal([]byte(`["plain-key", {"key": "team-key", "name": "team", "scopes": ["inference"], "models": ["phi"], "requests_per_minute": 60, "tokens_per_day": 100000, "expires_at": "2030-01-01T00:00:00Z"}]`), &keys)).To(Succeed())
+		Expect(keys).To(HaveLen(2))
+
+		Expect(keys[0]).To(Equal(APIKey{Key: "plain-key"}))
+		Expect(keys[0].HasScope(APIKeyScopeAdmin)).To(BeTrue())
+		Expect(keys[0].AllowsModel("llama")).To(BeTrue())
+
+		Expect(keys[1].Name).To(Equal("team"))
+		Expect(keys[1].HasScope(APIKeyScopeInference)).To(BeTrue())
+		Expect(keys[1].HasScope(APIKeyScopeAdmin)).To(BeFalse())
+		Expect(keys[1].AllowsModel("phi")).To(BeTrue())
+		Expect(keys[1].AllowsModel("llama")).To(BeFalse())
+		Expect(keys[1].Expired(time.Date(2029, 12, 31, 0, 0, 0, 0, time.UTC))).To(BeFalse())
+		Expect(keys[1].Expired(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))).To(BeTrue())
+	})
+
+	It("rejects the invalid keys", func() {
+		for _, data := range []string{`[{"name": "no key"}]`, `[{"key": "k", "scopes": ["everything"]}]`, `[{"key": "k", "tokens_per_day": -1}]`} {
+			var keys []APIKey
+			Expect(json.Unmarshal([]byte(data), &keys)).ToNot(Succeed(), data)
+		}
+	})
+
+	It("merges the access policies of several groups", func() {
+		inference := AccessPolicy{Scopes: []APIKeyScope{APIKeyScopeInference}, Models: []string{"phi"}, RequestsPerMinute: 10, TokensPerDay: 1000}
+		gallery := AccessPolicy{Scopes: []APIKeyScope{APIKeyScopeInference, APIKeyScopeGallery}, Models: []string{"llama"}, RequestsPerMinute: 60, TokensPerDay: 500}
+		Expect(MergeAccessPolicies(inference, gallery)).To(Equal(AccessPolicy{
+			Scopes:            []APIKeyScope{APIKeyScopeInference, APIKeyScopeGallery},
+			Models:            []string{"phi", "llama"},
+			RequestsPerMinute: 60,
+			TokensPerDay:      1000,
+		}))
+
+		// An unrestricted group lifts the restrictions of the others
+		Expect(MergeAccessPolicies(inference, AccessPolicy{})).To(Equal(AccessPolicy{}))
+	})
+})
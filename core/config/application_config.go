@@ -7,6 +7,8 @@ import (
 	"regexp"
 	"time"
 
+	"github.com/mudler/LocalAI/pkg/concurrency"
+	"github.com/mudler/LocalAI/pkg/tracing"
 	"github.com/mudler/LocalAI/pkg/xsysinfo"
 	"github.com/rs/zerolog/log"
 )
@@ -23,6 +25,9 @@ type ApplicationConfig struct {
 	AudioDir                            string
 	UploadDir                           string
 	ConfigsDir                          string
+	StoresDir                           string
+	StoresSnapshotInterval              time.Duration
+	UsageRetention                      time.Duration
 	DynamicConfigsDir                   string
 	DynamicConfigsDirPollInterval       time.Duration
 	CORS                                bool
@@ -31,6 +36,14 @@ type ApplicationConfig struct {
 	PreloadModelsFromPath               string
 	CORSAllowOrigins                    string
 	ApiKeys                             []string
+	ApiKeyPriorities                    map[string]concurrency.Priority
+	ApiKeyIdentities                    map[string]APIKey // The keys of api_keys.json with their identity and limits
+	JWTIssuer                           string            // The OpenID Connect issuer of the JWTs, whose keys are discovered
+	JWTJWKSFile                         string            // The JWKS file of the keys of the JWTs, instead of the keys of the issuer
+	JWTAudience                         string
+	JWTNameClaim                        string
+	JWTGroupsClaim                      string
+	JWTGroups                           map[string]AccessPolicy // The access policies of the JWT groups of jwt_groups.json
 	P2PToken                            string
 	P2PNetworkID                        string
 
@@ -40,9 +53,11 @@ type ApplicationConfig struct {
 	UseSubtleKeyComparison             bool
 	DisableApiKeyRequirementForHttpGet bool
 	DisableMetrics                     bool
+	Tracing                            tracing.Config
 	HttpGetExemptedEndpoints           []*regexp.Regexp
 	DisableGalleryEndpoint             bool
 	LoadToMemory                       []string
+	AssistantsEmbeddingModel           string
 
 	ModelLibraryURL string
 
@@ -58,6 +73,9 @@ type ApplicationConfig struct {
 	SingleBackend           bool
 	ParallelBackendRequests bool
 
+	// MemoryBudgetRAM and MemoryBudgetVRAM limit the memory of the loaded models, in bytes
+	MemoryBudgetRAM, MemoryBudgetVRAM uint64
+
 	WatchDogIdle bool
 	WatchDogBusy bool
 	WatchDog     bool
@@ -168,6 +186,13 @@ var EnableSingleBackend = func(o *ApplicationConfig) {
 	o.SingleBackend = true
 }
 
+func WithMemoryBudget(ram, vram uint64) AppOption {
+	return func(o *ApplicationConfig) {
+		o.MemoryBudgetRAM = ram
+		o.MemoryBudgetVRAM = vram
+	}
+}
+
 var EnableParallelBackendRequests = func(o *ApplicationConfig) {
 	o.ParallelBackendRequests = true
 }
@@ -303,6 +328,35 @@ func WithConfigsDir(configsDir string) AppOption {
 	}
 }
 
+// WithStoresDir sets the directory where the local-store backends persist their data.
+// When empty, stores are kept in memory only.
+func WithStoresDir(storesDir string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.StoresDir = storesDir
+	}
+}
+
+func WithStoresSnapshotInterval(interval time.Duration) AppOption {
+	return func(o *ApplicationConfig) {
+		o.StoresSnapshotInterval = interval
+	}
+}
+
+// WithUsageRetention sets how long the usage of the API keys is kept, forever if it is 0
+func WithUsageRetention(retention time.Duration) AppOption {
+	return func(o *ApplicationConfig) {
+		o.UsageRetention = retention
+	}
+}
+
+// WithAssistantsEmbeddingModel sets the embedding model used to index the files of the assistants
+// that have the retrieval tool enabled.
+func WithAssistantsEmbeddingModel(model string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.AssistantsEmbeddingModel = model
+	}
+}
+
 func WithDynamicConfigDir(dynamicConfigsDir string) AppOption {
 	return func(o *ApplicationConfig) {
 		o.DynamicConfigsDir = dynamicConfigsDir
@@ -321,6 +375,69 @@ func WithApiKeys(apiKeys []string) AppOption {
 	}
 }
 
+func WithApiKeyPriority(apiKey string, priority concurrency.Priority) AppOption {
+	return func(o *ApplicationConfig) {
+		if o.ApiKeyPriorities == nil {
+			o.ApiKeyPriorities = map[string]concurrency.Priority{}
+		}
+		o.ApiKeyPriorities[apiKey] = priority
+	}
+}
+
+// WithApiKeyIdentity adds an API key with its identity and limits, like the keys of api_keys.json
+func WithApiKeyIdentity(apiKey APIKey) AppOption {
+	return func(o *ApplicationConfig) {
+		if o.ApiKeyIdentities == nil {
+			o.ApiKeyIdentities = map[string]APIKey{}
+		}
+		o.ApiKeys = append(o.ApiKeys, apiKey.Key)
+		o.ApiKeyIdentities[apiKey.Key] = apiKey
+	}
+}
+
+// WithJWTIssuer accepts the JWTs of the OpenID Connect issuer as bearer tokens, in addition to the API keys
+func WithJWTIssuer(issuer string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.JWTIssuer = issuer
+	}
+}
+
+// WithJWTJWKSFile accepts the JWTs signed by the keys of the JWKS file as bearer tokens, in addition to the API keys
+func WithJWTJWKSFile(path string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.JWTJWKSFile = path
+	}
+}
+
+func WithJWTAudience(audience string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.JWTAudience = audience
+	}
+}
+
+// WithJWTClaims sets the claims of the JWTs with the name of the user and with their groups
+func WithJWTClaims(nameClaim, groupsClaim string) AppOption {
+	return func(o *ApplicationConfig) {
+		o.JWTNameClaim = nameClaim
+		o.JWTGroupsClaim = groupsClaim
+	}
+}
+
+// WithJWTGroup sets the access policy of the users of a JWT group, "*" being the policy of all the users
+func WithJWTGroup(group string, policy AccessPolicy) AppOption {
+	return func(o *ApplicationConfig) {
+		if o.JWTGroups == nil {
+			o.JWTGroups = map[string]AccessPolicy{}
+		}
+		o.JWTGroups[group] = policy
+	}
+}
+
+// JWTEnabled returns true if the JWTs are accepted as bearer tokens
+func (o *ApplicationConfig) JWTEnabled() bool {
+	return o.JWTIssuer != "" || o.JWTJWKSFile != ""
+}
+
 func WithEnforcedPredownloadScans(enforced bool) AppOption {
 	return func(o *ApplicationConfig) {
 		o.EnforcePredownloadScans = enforced
@@ -355,6 +472,13 @@ var DisableMetricsEndpoint AppOption = func(o *ApplicationConfig) {
 	o.DisableMetrics = true
 }
 
+// WithTracing exports the spans of the requests and of the backends with the exporter of the tracing configuration
+func WithTracing(c tracing.Config) AppOption {
+	return func(o *ApplicationConfig) {
+		o.Tracing = c
+	}
+}
+
 func WithHttpGetExemptedEndpoints(endpoints []string) AppOption {
 	return func(o *ApplicationConfig) {
 		o.HttpGetExemptedEndpoints = []*regexp.Regexp{}
@@ -14,6 +14,12 @@ import (
 
 const (
 	RAND_SEED = -1
+
+	// DefaultMaxQueue is the length of the queue of the models with a max_concurrency, when max_queue is not set
+	DefaultMaxQueue = 100
+	// DefaultJSONSchemaRetries is the number of times a reply which doesn't match the JSON schema of the response
+	// format is generated again, when json_schema_retries is not set
+	DefaultJSONSchemaRetries = 2
 )
 
 type TTSConfig struct {
@@ -39,11 +45,13 @@ type BackendConfig struct {
 	KnownUsecaseStrings []string               `yaml:"known_usecases"`
 	KnownUsecases       *BackendConfigUsecases `yaml:"-"`
 
-	PromptStrings, InputStrings                []string               `yaml:"-"`
-	InputToken                                 [][]int                `yaml:"-"`
-	functionCallString, functionCallNameString string                 `yaml:"-"`
-	ResponseFormat                             string                 `yaml:"-"`
-	ResponseFormatMap                          map[string]interface{} `yaml:"-"`
+	PromptStrings, InputStrings []string               `yaml:"-"`
+	InputToken                  [][]int                `yaml:"-"`
+	toolChoice                  functions.ToolChoice   `yaml:"-"`
+	ResponseFormat              string                 `yaml:"-"`
+	ResponseFormatMap           map[string]interface{} `yaml:"-"`
+	Logprobs                    bool                   `yaml:"-"`
+	TopLogprobs                 int                    `yaml:"-"`
 
 	FunctionsConfig functions.FunctionsConfig `yaml:"function"`
 
@@ -74,6 +82,20 @@ type BackendConfig struct {
 	Usage       string `yaml:"usage"`
 
 	Options []string `yaml:"options"`
+
+	// MaxConcurrency is the number of inference requests executed at the same time on the model, 0 for no limit.
+	// MaxQueue is the number of requests waiting for a slot, the next ones are rejected.
+	MaxConcurrency int `yaml:"max_concurrency"`
+	MaxQueue       int `yaml:"max_queue"`
+
+	// EstimatedRAM and EstimatedVRAM are the memory used by the model once loaded, in bytes, guessed from GGUF files
+	EstimatedRAM  uint64 `yaml:"-"`
+	EstimatedVRAM uint64 `yaml:"-"`
+
+	// FallbackModels are the models serving the requests, in order, when the model can't be loaded or its backend
+	// crashes. FallbackConfigs are their configurations, resolved when the configuration is loaded for a request.
+	FallbackModels  []string        `yaml:"fallback_models"`
+	FallbackConfigs []BackendConfig `yaml:"-" json:"-"`
 }
 
 type File struct {
@@ -135,6 +157,14 @@ type LLMConfig struct {
 	TrimSpace       []string `yaml:"trimspace"`
 	TrimSuffix      []string `yaml:"trimsuffix"`
 
+	// JSONSchemaRetries is the number of times a reply which doesn't match the JSON schema of the response format
+	// is generated again
+	JSONSchemaRetries *int `yaml:"json_schema_retries"`
+
+	// NoPromptCacheReuse disables the reuse of the KV cache of the prompt prefix of the previous requests, e.g. the
+	// history of a conversation
+	NoPromptCacheReuse bool `yaml:"no_prompt_cache_reuse"`
+
 	ContextSize          *int      `yaml:"context_size"`
 	NUMA                 bool      `yaml:"numa"`
 	LoraAdapter          string    `yaml:"lora_adapter"`
@@ -221,20 +251,25 @@ func (c *BackendConfig) UnmarshalYAML(value *yaml.Node) error {
 	return nil
 }
 
-func (c *BackendConfig) SetFunctionCallString(s string) {
-	c.functionCallString = s
+// SetToolChoice sets how the model uses the functions of the request
+func (c *BackendConfig) SetToolChoice(t functions.ToolChoice) {
+	c.toolChoice = t
 }
 
-func (c *BackendConfig) SetFunctionCallNameString(s string) {
-	c.functionCallNameString = s
+// ToolChoice returns how the model uses the functions of the request
+func (c *BackendConfig) ToolChoice() functions.ToolChoice {
+	if c.toolChoice.Mode == "" {
+		return functions.ToolChoice{Mode: functions.ToolChoiceAuto}
+	}
+	return c.toolChoice
 }
 
 func (c *BackendConfig) ShouldUseFunctions() bool {
-	return ((c.functionCallString != "none" || c.functionCallString == "") || c.ShouldCallSpecificFunction())
+	return c.ToolChoice().Enabled()
 }
 
 func (c *BackendConfig) ShouldCallSpecificFunction() bool {
-	return len(c.functionCallNameString) > 0
+	return c.toolChoice.Function != ""
 }
 
 // MMProjFileName returns the filename of the MMProj file
@@ -272,12 +307,7 @@ func (c *BackendConfig) ModelFileName() string {
 }
 
 func (c *BackendConfig) FunctionToCall() string {
-	if c.functionCallNameString != "" &&
-		c.functionCallNameString != "none" && c.functionCallNameString != "auto" {
-		return c.functionCallNameString
-	}
-
-	return c.functionCallString
+	return c.toolChoice.Function
 }
 
 func (cfg *BackendConfig) SetDefaults(opts ...ConfigLoaderOption) {
@@ -305,6 +335,15 @@ func (cfg *BackendConfig) SetDefaults(opts ...ConfigLoaderOption) {
 	trueV := true
 	falseV := false
 
+	if cfg.MaxQueue == 0 {
+		cfg.MaxQueue = DefaultMaxQueue
+	}
+
+	if cfg.JSONSchemaRetries == nil {
+		retries := DefaultJSONSchemaRetries
+		cfg.JSONSchemaRetries = &retries
+	}
+
 	if cfg.Seed == nil {
 		//  random number generator seed
 		defaultSeed := RAND_SEED
@@ -404,7 +443,7 @@ func (cfg *BackendConfig) SetDefaults(opts ...ConfigLoaderOption) {
 		cfg.Debug = &trueV
 	}
 
-	guessDefaultsFromFile(cfg, lo.modelPath)
+	guessDefaultsFromFile(cfg, lo.modelPath, lo.estimateMemory)
 }
 
 func (c *BackendConfig) Validate() bool {
@@ -425,6 +464,10 @@ func (c *BackendConfig) Validate() bool {
 		}
 	}
 
+	if c.FunctionsConfig.Format != "" && !functions.IsToolCallFormat(c.FunctionsConfig.Format) {
+		return false
+	}
+
 	if c.Backend != "" {
 		// a regex that checks that is a string name with no special characters, except '-' and '_'
 		re := regexp.MustCompile(`^[a-zA-Z0-9-_]+$`)
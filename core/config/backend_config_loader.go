@@ -6,6 +6,7 @@ import (
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -20,13 +21,17 @@ import (
 
 type BackendConfigLoader struct {
 	configs   map[string]BackendConfig
+	aliases   map[string]ModelAlias
 	modelPath string
+	// estimateMemory guesses the memory used by the models from their files, for the memory budget
+	estimateMemory bool
 	sync.Mutex
 }
 
 func NewBackendConfigLoader(modelPath string) *BackendConfigLoader {
 	return &BackendConfigLoader{
 		configs:   make(map[string]BackendConfig),
+		aliases:   make(map[string]ModelAlias),
 		modelPath: modelPath,
 	}
 }
@@ -36,6 +41,7 @@ type LoadOptions struct {
 	debug            bool
 	threads, ctxSize int
 	f16              bool
+	estimateMemory   bool
 }
 
 func LoadOptionDebug(debug bool) ConfigLoaderOption {
@@ -68,6 +74,14 @@ func LoadOptionF16(f16 bool) ConfigLoaderOption {
 	}
 }
 
+// LoadOptionEstimateMemory guesses the memory used by the model from its file, which is only needed by the memory
+// budget
+func LoadOptionEstimateMemory(estimate bool) ConfigLoaderOption {
+	return func(o *LoadOptions) {
+		o.estimateMemory = estimate
+	}
+}
+
 type ConfigLoaderOption func(*LoadOptions)
 
 func (lo *LoadOptions) Apply(options ...ConfigLoaderOption) {
@@ -111,8 +125,47 @@ func readBackendConfigFromFile(file string, opts ...ConfigLoaderOption) (*Backen
 	return c, nil
 }
 
-// Load a config file for a model
+// EstimateMemory sets whether the memory used by the models is guessed from their files when their configurations are
+// loaded
+func (bcl *BackendConfigLoader) EstimateMemory(estimate bool) {
+	bcl.Lock()
+	defer bcl.Unlock()
+	bcl.estimateMemory = estimate
+}
+
+// withLoaderOptions appends the options of the loader to opts
+func (bcl *BackendConfigLoader) withLoaderOptions(opts []ConfigLoaderOption) []ConfigLoaderOption {
+	return append(slices.Clip(opts), LoadOptionEstimateMemory(bcl.estimateMemory))
+}
+
+// Load a config file for a model, with the configurations of its fallback models
 func (bcl *BackendConfigLoader) LoadBackendConfigFileByName(modelName, modelPath string, opts ...ConfigLoaderOption) (*BackendConfig, error) {
+	cfg, err := bcl.loadBackendConfigFileByName(modelName, modelPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.FallbackConfigs = nil
+	seen := map[string]bool{modelName: true, cfg.Name: true}
+	for _, m := range cfg.FallbackModels {
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		fallback, err := bcl.loadBackendConfigFileByName(m, modelPath, opts...)
+		if err != nil {
+			log.Warn().Err(err).Msgf("cannot load the fallback model %s of %s", m, modelName)
+			continue
+		}
+		// The fallback models of the fallback models are not used
+		fallback.FallbackConfigs = nil
+		cfg.FallbackConfigs = append(cfg.FallbackConfigs, *fallback)
+	}
+
+	return cfg, nil
+}
+
+func (bcl *BackendConfigLoader) loadBackendConfigFileByName(modelName, modelPath string, opts ...ConfigLoaderOption) (*BackendConfig, error) {
 
 	// Load a config file if present after the model name
 	cfg := &BackendConfig{
@@ -140,7 +193,10 @@ func (bcl *BackendConfigLoader) LoadBackendConfigFileByName(modelName, modelPath
 		}
 	}
 
-	cfg.SetDefaults(append(opts, ModelPath(modelPath))...)
+	bcl.Lock()
+	opts = append(bcl.withLoaderOptions(opts), ModelPath(modelPath))
+	bcl.Unlock()
+	cfg.SetDefaults(opts...)
 
 	return cfg, nil
 }
@@ -149,7 +205,7 @@ func (bcl *BackendConfigLoader) LoadBackendConfigFileByName(modelName, modelPath
 func (bcl *BackendConfigLoader) LoadMultipleBackendConfigsSingleFile(file string, opts ...ConfigLoaderOption) error {
 	bcl.Lock()
 	defer bcl.Unlock()
-	c, err := readMultipleBackendConfigsFromFile(file, opts...)
+	c, err := readMultipleBackendConfigsFromFile(file, bcl.withLoaderOptions(opts)...)
 	if err != nil {
 		return fmt.Errorf("cannot load config file: %w", err)
 	}
@@ -165,7 +221,7 @@ func (bcl *BackendConfigLoader) LoadMultipleBackendConfigsSingleFile(file string
 func (bcl *BackendConfigLoader) LoadBackendConfig(file string, opts ...ConfigLoaderOption) error {
 	bcl.Lock()
 	defer bcl.Unlock()
-	c, err := readBackendConfigFromFile(file, opts...)
+	c, err := readBackendConfigFromFile(file, bcl.withLoaderOptions(opts)...)
 	if err != nil {
 		return fmt.Errorf("cannot read config file: %w", err)
 	}
@@ -225,6 +281,7 @@ func (bcl *BackendConfigLoader) RemoveBackendConfig(m string) {
 	bcl.Lock()
 	defer bcl.Unlock()
 	delete(bcl.configs, m)
+	delete(bcl.aliases, m)
 }
 
 // Preload prepare models if they are not local but url or huggingface repositories
@@ -342,7 +399,16 @@ func (bcl *BackendConfigLoader) LoadBackendConfigsFromPath(path string, opts ...
 			strings.HasPrefix(file.Name(), ".") {
 			continue
 		}
-		c, err := readBackendConfigFromFile(filepath.Join(path, file.Name()), opts...)
+		alias, err := readModelAliasFromFile(filepath.Join(path, file.Name()))
+		if err != nil {
+			log.Error().Err(err).Msgf("cannot read model alias: %s", file.Name())
+			continue
+		}
+		if alias != nil {
+			bcl.aliases[alias.Name] = *alias
+			continue
+		}
+		c, err := readBackendConfigFromFile(filepath.Join(path, file.Name()), bcl.withLoaderOptions(opts)...)
 		if err != nil {
 			log.Error().Err(err).Msgf("cannot read config file: %s", file.Name())
 			continue
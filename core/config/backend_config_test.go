@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -162,3 +163,25 @@ parameters:
 
 	})
 })
+
+var _ = Describe("Fallback models", func() {
+	It("loads the configurations of the fallback models", func() {
+		modelPath := GinkgoT().TempDir()
+		for name, content := range map[string]string{
+			"big.yaml":   "name: big\nparameters:\n  model: big.gguf\nfallback_models:\n- big\n- small\n- tiny.gguf\n- small\n",
+			"small.yaml": "name: small\nparameters:\n  model: small.gguf\nfallback_models:\n- big\n",
+		} {
+			Expect(os.WriteFile(filepath.Join(modelPath, name), []byte(content), 0600)).To(Succeed())
+		}
+		bcl := NewBackendConfigLoader(modelPath)
+
+		cfg, err := bcl.LoadBackendConfigFileByName("big", modelPath)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(cfg.FallbackConfigs).To(HaveLen(2))
+		Expect(cfg.FallbackConfigs[0].Name).To(Equal("small"))
+		Expect(cfg.FallbackConfigs[0].Model).To(Equal("small.gguf"))
+		// The fallback models of the fallback models are not used
+		Expect(cfg.FallbackConfigs[0].FallbackConfigs).To(BeEmpty())
+		Expect(cfg.FallbackConfigs[1].Model).To(Equal("tiny.gguf"))
+	})
+})
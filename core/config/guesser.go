@@ -5,6 +5,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/mudler/LocalAI/pkg/functions"
 	"github.com/rs/zerolog/log"
 
 	gguf "github.com/thxcode/gguf-parser-go"
@@ -21,6 +22,7 @@ const (
 	Mistral03
 	Gemma
 	DeepSeek2
+	Qwen2
 )
 
 type settingsConfig struct {
@@ -136,13 +138,31 @@ Function response:
 	},
 }
 
+// the format of the function calls of the model families
+var defaultToolCallFormats = map[familyType]string{
+	LLaMa3:    functions.FormatLLama31,
+	Mistral03: functions.FormatMistral,
+	Qwen2:     functions.FormatQwen,
+}
+
+// the tags of the function calls in the chat templates, which identify their format
+var toolCallTemplateTags = []struct {
+	tag    string
+	format string
+}{
+	{"✿FUNCTION✿", functions.FormatQwen},
+	{"<tool_call>", functions.FormatHermes},
+	{"<|python_tag|>", functions.FormatLLama31},
+	{"[TOOL_CALLS]", functions.FormatMistral},
+}
+
 // this maps well known template used in HF to model families defined above
 var knownTemplates = map[string]familyType{
 	`{% if messages[0]['role'] == 'system' %}{% set system_message = messages[0]['content'] %}{% endif %}{% if system_message is defined %}{{ system_message }}{% endif %}{% for message in messages %}{% set content = message['content'] %}{% if message['role'] == 'user' %}{{ '<|im_start|>user\n' + content + '<|im_end|>\n<|im_start|>assistant\n' }}{% elif message['role'] == 'assistant' %}{{ content + '<|im_end|>' + '\n' }}{% endif %}{% endfor %}`:                              ChatML,
 	`{{ bos_token }}{% for message in messages %}{% if (message['role'] == 'user') != (loop.index0 % 2 == 0) %}{{ raise_exception('Conversation roles must alternate user/assistant/user/assistant/...') }}{% endif %}{% if message['role'] == 'user' %}{{ '[INST] ' + message['content'] + ' [/INST]' }}{% elif message['role'] == 'assistant' %}{{ message['content'] + eos_token}}{% else %}{{ raise_exception('Only user and assistant roles are supported!') }}{% endif %}{% endfor %}`: Mistral03,
 }
 
-func guessDefaultsFromFile(cfg *BackendConfig, modelPath string) {
+func guessDefaultsFromFile(cfg *BackendConfig, modelPath string, estimateMemory bool) {
 
 	if os.Getenv("LOCALAI_DISABLE_GUESSING") == "true" {
 		log.Debug().Msgf("guessDefaultsFromFile: %s", "guessing disabled with LOCALAI_DISABLE_GUESSING")
@@ -154,13 +174,14 @@ func guessDefaultsFromFile(cfg *BackendConfig, modelPath string) {
 		return
 	}
 
-	if cfg.HasTemplate() {
+	// The memory is guessed once, when the configuration is first loaded
+	estimateMemory = estimateMemory && cfg.EstimatedRAM == 0 && cfg.EstimatedVRAM == 0
+	if !estimateMemory && cfg.HasTemplate() {
 		// nothing to guess here
 		log.Debug().Any("name", cfg.Name).Msgf("guessDefaultsFromFile: %s", "template already set")
 		return
 	}
 
-	// We try to guess only if we don't have a template defined already
 	f, err := gguf.ParseGGUFFile(filepath.Join(modelPath, cfg.ModelFileName()))
 	if err != nil {
 		// Only valid for gguf files
@@ -168,6 +189,18 @@ func guessDefaultsFromFile(cfg *BackendConfig, modelPath string) {
 		return
 	}
 
+	if estimateMemory {
+		guessMemoryFromFile(cfg, f)
+	}
+
+	if cfg.HasTemplate() {
+		// nothing to guess here
+		log.Debug().Any("name", cfg.Name).Msgf("guessDefaultsFromFile: %s", "template already set")
+		return
+	}
+
+	guessToolCallFormatFromFile(cfg, f)
+
 	log.Debug().
 		Any("eosTokenID", f.Tokenizer().EOSTokenID).
 		Any("bosTokenID", f.Tokenizer().BOSTokenID).
@@ -214,6 +247,64 @@ func guessDefaultsFromFile(cfg *BackendConfig, modelPath string) {
 	}
 }
 
+// guessMemoryFromFile estimates the memory used by llama.cpp to load the model with its settings
+func guessMemoryFromFile(cfg *BackendConfig, f *gguf.GGUFFile) {
+	opts := []gguf.LLaMACppUsageEstimateOption{}
+	if cfg.ContextSize != nil {
+		opts = append(opts, gguf.WithContextSize(int32(*cfg.ContextSize)))
+	}
+	if cfg.NGPULayers != nil {
+		opts = append(opts, gguf.WithOffloadLayers(uint64(*cfg.NGPULayers)))
+	}
+	if cfg.FlashAttention {
+		opts = append(opts, gguf.WithFlashAttention())
+	}
+
+	mmap := cfg.MMap == nil || *cfg.MMap
+	memory := f.EstimateLLaMACppUsage(opts...).SummarizeMemory(mmap, 0, 0)
+	cfg.EstimatedRAM = uint64(memory.NonUMA.RAM)
+	cfg.EstimatedVRAM = uint64(memory.NonUMA.VRAM)
+
+	log.Debug().
+		Any("ram", memory.NonUMA.RAM).
+		Any("vram", memory.NonUMA.VRAM).Msgf("guessDefaultsFromFile: estimated memory of %s", cfg.ModelFileName())
+}
+
+// guessToolCallFormatFromFile sets the format of the function calls from the chat template or from the family of the
+// model, when the function calls are not configured. Only the formats whose calls can be parsed while they are
+// streamed are guessed, so that guessing a format doesn't turn off the streaming of the function calls.
+func guessToolCallFormatFromFile(cfg *BackendConfig, f *gguf.GGUFFile) {
+	fc := cfg.FunctionsConfig
+	if fc.Format != "" || fc.GrammarConfig != (functions.GrammarConfig{}) || fc.FunctionNameKey != "" || fc.FunctionArgumentsKey != "" ||
+		len(fc.CaptureLLMResult) > 0 || !fc.CanStreamFunctionCalls() {
+		return
+	}
+
+	format, source := "", ""
+	chatTemplate, found := f.Header.MetadataKV.Get("tokenizer.chat_template")
+	if found {
+		for _, t := range toolCallTemplateTags {
+			if strings.Contains(chatTemplate.ValueString(), t.tag) {
+				format, source = t.format, "chat template"
+				break
+			}
+		}
+	}
+	if format == "" {
+		format, source = defaultToolCallFormats[identifyFamily(f)], "model family"
+	}
+	if format == "" {
+		return
+	}
+
+	if !(functions.FunctionsConfig{Format: format}).CanStreamFunctionCalls() {
+		log.Debug().Msgf("guessDefaultsFromFile: the %s format of the function calls of the %s can't be streamed, not using it", format, source)
+		return
+	}
+	cfg.FunctionsConfig.Format = format
+	log.Debug().Msgf("guessDefaultsFromFile: guessed the %s format of the function calls from the %s", format, source)
+}
+
 func identifyFamily(f *gguf.GGUFFile) familyType {
 
 	// identify from well known templates first
@@ -250,7 +341,9 @@ func identifyFamily(f *gguf.GGUFFile) familyType {
 		return CommandR
 	case phi3:
 		return Phi3
-	case qwen2, isYI:
+	case qwen2:
+		return Qwen2
+	case isYI:
 		return ChatML
 	default:
 		return Unknown
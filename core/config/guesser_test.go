@@ -0,0 +1,40 @@
+package config
+
+import (
+	"github.com/mudler/LocalAI/pkg/functions"
+	gguf "github.com/thxcode/gguf-parser-go"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Tool call format guessing", func() {
+	ggufFile := func(chatTemplate string) *gguf.GGUFFile {
+		return &gguf.GGUFFile{Header: gguf.GGUFHeader{MetadataKV: gguf.GGUFMetadataKVs{
+			{Key: "tokenizer.chat_template", ValueType: gguf.GGUFMetadataValueTypeString, Value: chatTemplate},
+		}}}
+	}
+
+	It("guesses the formats of the function calls which can be streamed", func() {
+		cfg := &BackendConfig{}
+		guessToolCallFormatFromFile(cfg, ggufFile("{{- '<tool_call>' }}"))
+		Expect(cfg.FunctionsConfig.Format).To(Equal(functions.FormatHermes))
+		Expect(cfg.FunctionsConfig.CanStreamFunctionCalls()).To(BeTrue())
+
+		cfg = &BackendConfig{}
+		guessToolCallFormatFromFile(cfg, ggufFile("{{- '<|python_tag|>' }}"))
+		Expect(cfg.FunctionsConfig.Format).To(BeEmpty())
+	})
+
+	It("doesn't guess the format of the function calls which are configured", func() {
+		for _, fc := range []functions.FunctionsConfig{
+			{GrammarConfig: functions.GrammarConfig{ParallelCalls: true}},
+			{FunctionNameKey: "function"},
+			{ResponseRegex: []string{`(?P<name>\w+)`}},
+		} {
+			cfg := &BackendConfig{FunctionsConfig: fc}
+			guessToolCallFormatFromFile(cfg, ggufFile("{{- '<tool_call>' }}"))
+			Expect(cfg.FunctionsConfig.Format).To(BeEmpty())
+		}
+	})
+})
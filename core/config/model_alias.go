@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"slices"
+	"sort"
+
+	"github.com/mudler/LocalAI/pkg/utils"
+	"gopkg.in/yaml.v3"
+)
+
+// ModelAlias is a public model name, e.g. gpt-4o, which routes the requests to other models by weight. This allows
+// to swap the models behind the name without changing the clients, or to send part of the traffic to a new model.
+type ModelAlias struct {
+	Name   string       `yaml:"name" json:"name"`
+	Routes []ModelRoute `yaml:"routes" json:"routes"`
+	// Fallbacks are the models used when none of the routes is available
+	Fallbacks []string `yaml:"fallbacks" json:"fallbacks,omitempty"`
+}
+
+type ModelRoute struct {
+	Model string `yaml:"model" json:"model"`
+	// Weight is the share of the requests of the route, relative to the other routes. It defaults to 1, and a route
+	// with a weight of 0 only serves the requests when the other routes are not available.
+	Weight *int `yaml:"weight" json:"weight,omitempty"`
+}
+
+func (r ModelRoute) weight() int {
+	if r.Weight == nil {
+		return 1
+	}
+	return *r.Weight
+}
+
+func (a ModelAlias) Validate() error {
+	if a.Name == "" {
+		return fmt.Errorf("model alias has no name")
+	}
+	for _, r := range a.Routes {
+		if r.Model == "" {
+			return fmt.Errorf("route of model alias %s has no model", a.Name)
+		}
+		if r.weight() < 0 {
+			return fmt.Errorf("route of model alias %s to %s has a negative weight", a.Name, r.Model)
+		}
+	}
+	return nil
+}
+
+// candidates returns the models of the alias in the order they are tried: one of the routes picked by weight, the
+// other routes by decreasing weight, and the fallbacks
+func (a ModelAlias) candidates() []string {
+	routes := slices.Clone(a.Routes)
+	slices.SortStableFunc(routes, func(r1, r2 ModelRoute) int {
+		return r2.weight() - r1.weight()
+	})
+
+	total := 0
+	for _, r := range routes {
+		total += r.weight()
+	}
+	if total > 0 {
+		n := rand.Intn(total)
+		for i, r := range routes {
+			if n < r.weight() {
+				routes = append(append([]ModelRoute{r}, routes[:i]...), routes[i+1:]...)
+				break
+			}
+			n -= r.weight()
+		}
+	}
+
+	models := []string{}
+	for _, r := range routes {
+		models = append(models, r.Model)
+	}
+	return append(models, a.Fallbacks...)
+}
+
+// readModelAliasFromFile returns the model alias defined in file, or nil if it is not a model alias but e.g. the
+// configuration of a model
+func readModelAliasFromFile(file string) (*ModelAlias, error) {
+	f, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file: %w", err)
+	}
+	a := &ModelAlias{}
+	if err := yaml.Unmarshal(f, a); err != nil {
+		return nil, fmt.Errorf("cannot unmarshal config file: %w", err)
+	}
+	if len(a.Routes) == 0 {
+		return nil, nil
+	}
+	return a, a.Validate()
+}
+
+func (bcl *BackendConfigLoader) GetModelAlias(name string) (ModelAlias, bool) {
+	bcl.Lock()
+	defer bcl.Unlock()
+	a, exists := bcl.aliases[name]
+	return a, exists
+}
+
+func (bcl *BackendConfigLoader) GetAllModelAliases() []ModelAlias {
+	bcl.Lock()
+	defer bcl.Unlock()
+	var res []ModelAlias
+	for _, a := range bcl.aliases {
+		res = append(res, a)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// ResolveModelAlias returns the model serving a request for name: if name is a model alias, the first available
+// model of the alias, otherwise name itself
+func (bcl *BackendConfigLoader) ResolveModelAlias(name string) (string, error) {
+	bcl.Lock()
+	defer bcl.Unlock()
+
+	a, exists := bcl.aliases[name]
+	if !exists {
+		return name, nil
+	}
+	for _, m := range a.candidates() {
+		if _, exists := bcl.configs[m]; exists || utils.ExistsInPath(bcl.modelPath, m) {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("no model available for the model alias %s", name)
+}
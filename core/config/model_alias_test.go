@@ -0,0 +1,99 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Model aliases", func() {
+	var (
+		modelPath string
+		bcl       *BackendConfigLoader
+	)
+
+	writeFile := func(name, content string) {
+		Expect(os.WriteFile(filepath.Join(modelPath, name), []byte(content), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		modelPath = GinkgoT().TempDir()
+		bcl = NewBackendConfigLoader(modelPath)
+
+		writeFile("q4.yaml", "name: llama-q4\nparameters:\n  model: llama-q4.gguf\n")
+		writeFile("q8.yaml", "name: llama-q8\nparameters:\n  model: llama-q8.gguf\n")
+		writeFile("phi.gguf", "")
+		writeFile("gpt-4o.yaml", `name: gpt-4o
+routes:
+- model: llama-q4
+  weight: 9
+- model: llama-q8
+  weight: 1
+`)
+		writeFile("canary.yaml", `name: canary
+routes:
+- model: llama-q8
+- model: missing
+  weight: 0
+`)
+		writeFile("fallback.yaml", `name: fallback
+routes:
+- model: missing
+fallbacks:
+- other-missing
+- phi.gguf
+`)
+		writeFile("invalid.yaml", `name: invalid
+routes:
+- model: llama-q4
+  weight: -1
+`)
+		Expect(bcl.LoadBackendConfigsFromPath(modelPath)).To(Succeed())
+	})
+
+	It("loads the aliases apart from the models", func() {
+		names := []string{}
+		for _, a := range bcl.GetAllModelAliases() {
+			names = append(names, a.Name)
+		}
+		Expect(names).To(Equal([]string{"canary", "fallback", "gpt-4o"}))
+
+		_, exists := bcl.GetBackendConfig("gpt-4o")
+		Expect(exists).To(BeFalse())
+		_, exists = bcl.GetBackendConfig("llama-q4")
+		Expect(exists).To(BeTrue())
+	})
+
+	It("routes the requests by weight", func() {
+		routed := map[string]int{}
+		for i := 0; i < 1000; i++ {
+			m, err := bcl.ResolveModelAlias("gpt-4o")
+			Expect(err).ToNot(HaveOccurred())
+			routed[m]++
+		}
+		Expect(routed).To(HaveLen(2))
+		Expect(routed["llama-q4"]).To(BeNumerically(">", routed["llama-q8"]))
+
+		m, err := bcl.ResolveModelAlias("canary")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m).To(Equal("llama-q8"))
+	})
+
+	It("uses the fallbacks when the routes are not available", func() {
+		m, err := bcl.ResolveModelAlias("fallback")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m).To(Equal("phi.gguf"))
+
+		bcl.RemoveBackendConfig("llama-q8")
+		_, err = bcl.ResolveModelAlias("canary")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("doesn't route the other models", func() {
+		m, err := bcl.ResolveModelAlias("llama-q4")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(m).To(Equal("llama-q4"))
+	})
+})
@@ -5,9 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/dave-gray101/v2keyauth"
-	"github.com/mudler/LocalAI/pkg/utils"
 
 	"github.com/mudler/LocalAI/core/http/endpoints/localai"
 	"github.com/mudler/LocalAI/core/http/endpoints/openai"
@@ -17,6 +17,7 @@ import (
 	"github.com/mudler/LocalAI/core/application"
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/concurrency"
 
 	"github.com/gofiber/contrib/fiberzerolog"
 	"github.com/gofiber/fiber/v2"
@@ -71,6 +72,13 @@ func API(application *application.Application) (*fiber.App, error) {
 				code = e.Code
 			}
 
+			// The queue of the model is full, tell the client when to retry
+			var queueFull *concurrency.QueueFullError
+			if errors.As(err, &queueFull) {
+				code = fiber.StatusTooManyRequests
+				ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(queueFull.RetryAfter.Seconds())))
+			}
+
 			// Send custom error page
 			return ctx.Status(code).JSON(
 				schema.ErrorResponse{
@@ -102,6 +110,8 @@ func API(application *application.Application) (*fiber.App, error) {
 		Logger: &logger,
 	}))
 
+	router.Use(middleware.Tracing())
+
 	// Default middleware config
 
 	if !application.ApplicationConfig().Debug {
@@ -133,6 +143,8 @@ func API(application *application.Application) (*fiber.App, error) {
 	// Auth is applied to _all_ endpoints. No exceptions. Filtering out endpoints to bypass is the role of the Filter property of the KeyAuth Configuration
 	router.Use(v2keyauth.New(*kaConfig))
 
+	router.Use(middleware.Usage(application.UsageService()))
+
 	if application.ApplicationConfig().CORS {
 		var c func(ctx *fiber.Ctx) error
 		if application.ApplicationConfig().CORSAllowOrigins == "" {
@@ -149,16 +161,21 @@ func API(application *application.Application) (*fiber.App, error) {
 		router.Use(csrf.New())
 	}
 
-	// Load config jsons
-	utils.LoadConfig(application.ApplicationConfig().UploadDir, openai.UploadedFilesFile, &openai.UploadedFiles)
-	utils.LoadConfig(application.ApplicationConfig().ConfigsDir, openai.AssistantsConfigFile, &openai.Assistants)
-	utils.LoadConfig(application.ApplicationConfig().ConfigsDir, openai.AssistantsFileConfigFile, &openai.AssistantFiles)
+	if err := openai.MigrateLegacyConfig(application.MetadataStore(), application.ApplicationConfig()); err != nil {
+		log.Error().Err(err).Msg("unable to migrate the assistants and files to the metadata store")
+	}
+	if err := openai.InterruptRuns(application.MetadataStore()); err != nil {
+		log.Error().Err(err).Msg("unable to update the interrupted runs")
+	}
+	if err := openai.InterruptBatches(application.MetadataStore()); err != nil {
+		log.Error().Err(err).Msg("unable to update the interrupted batches")
+	}
 
 	galleryService := services.NewGalleryService(application.ApplicationConfig())
 	galleryService.Start(application.ApplicationConfig().Context, application.BackendLoader())
 
 	routes.RegisterElevenLabsRoutes(router, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig())
-	routes.RegisterLocalAIRoutes(router, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig(), galleryService)
+	routes.RegisterLocalAIRoutes(router, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig(), galleryService, application.StoreLoader(), application.CollectionsService(), application.UsageService())
 	routes.RegisterOpenAIRoutes(router, application)
 	if !application.ApplicationConfig().DisableWebUI {
 		routes.RegisterUIRoutes(router, application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig(), galleryService)
@@ -0,0 +1,73 @@
+//go:build unix
+
+package fiberContext
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// connectionCheckInterval is how often the connection of a request is checked
+const connectionCheckInterval = time.Second
+
+// WatchConnection calls cancel when the client closes the connection of the request, until the returned function is
+// called. The connections which can't be checked without reading the request, such as the TLS ones, are not watched.
+func WatchConnection(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(connectionCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if connectionClosed(raw) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+		<-stopped
+	}
+}
+
+// connectionClosed peeks at the connection without consuming its data: reading nothing means the client closed it
+func connectionClosed(raw syscall.RawConn) bool {
+	var n int
+	var readErr error
+	buf := make([]byte, 1)
+	err := raw.Read(func(fd uintptr) bool {
+		n, _, readErr = syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		return true
+	})
+	switch {
+	case err != nil:
+		// The connection was closed by the server
+		return false
+	case errors.Is(readErr, syscall.EAGAIN), errors.Is(readErr, syscall.EWOULDBLOCK), errors.Is(readErr, syscall.EINTR):
+		return false
+	case readErr != nil:
+		return true
+	}
+	return n == 0
+}
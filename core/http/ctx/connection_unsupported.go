@@ -0,0 +1,14 @@
+//go:build !unix
+
+package fiberContext
+
+import (
+	"context"
+	"net"
+)
+
+// WatchConnection doesn't watch the connections on this platform, the requests are cancelled when their replies can't
+// be written
+func WatchConnection(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	return func() {}
+}
@@ -2,11 +2,14 @@ package fiberContext
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
+	"github.com/dave-gray101/v2keyauth"
 	"github.com/gofiber/fiber/v2"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/concurrency"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/rs/zerolog/log"
 )
@@ -25,10 +28,14 @@ func ModelFromContext(ctx *fiber.Ctx, cl *config.BackendConfigLoader, loader *mo
 	// Set model from bearer token, if available
 	bearer := strings.TrimLeft(ctx.Get("authorization"), "Bear ") // Reduced duplicate characters of Bearer
 	bearerExists := bearer != "" && loader.ExistsInModelPath(bearer)
+	identity := IdentityFromContext(ctx)
 
 	// If no model was specified, take the first available
 	if modelInput == "" && !bearerExists && firstModel {
 		models, _ := services.ListModels(cl, loader, config.NoFilterFn, services.SKIP_IF_CONFIGURED)
+		if identity != nil {
+			models = slices.DeleteFunc(models, func(m string) bool { return !identity.AllowsModel(m) })
+		}
 		if len(models) > 0 {
 			modelInput = models[0]
 			log.Debug().Msgf("No model specified, using: %s", modelInput)
@@ -43,5 +50,47 @@ func ModelFromContext(ctx *fiber.Ctx, cl *config.BackendConfigLoader, loader *mo
 		log.Debug().Msgf("Using model from bearer token: %s", bearer)
 		modelInput = bearer
 	}
-	return modelInput, nil
+
+	if identity != nil && !identity.AllowsModel(modelInput) {
+		return "", fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("the API key is not allowed to use the model %s", modelInput))
+	}
+
+	// Route the model aliases to one of their models
+	routed, err := cl.ResolveModelAlias(modelInput)
+	if err != nil {
+		return "", err
+	}
+	if routed != modelInput {
+		log.Debug().Msgf("Model alias %s routed to: %s", modelInput, routed)
+	}
+	SetModel(ctx, routed)
+	return routed, nil
+}
+
+// PriorityHeader is the header with which a client sets the priority of its requests in the queues of the models
+const PriorityHeader = "X-LocalAI-Priority"
+
+// ServedModelHeader is the header with which the responses report the model which served the request, which is one
+// of its fallback models when the requested model failed
+const ServedModelHeader = "X-LocalAI-Model"
+
+// PriorityFromContext returns the priority of the request in the queues of the models, from the API key or the
+// PriorityHeader. When the API keys have priorities, the header can only lower the one of the key.
+func PriorityFromContext(ctx *fiber.Ctx, appConfig *config.ApplicationConfig) (concurrency.Priority, error) {
+	priority, limit := concurrency.PriorityNormal, concurrency.PriorityHigh
+	if len(appConfig.ApiKeyPriorities) > 0 {
+		if p, exists := appConfig.ApiKeyPriorities[v2keyauth.TokenFromContext(ctx)]; exists {
+			priority = p
+		}
+		limit = priority
+	}
+
+	if header := ctx.Get(PriorityHeader); header != "" {
+		p, err := concurrency.ParsePriority(header)
+		if err != nil {
+			return priority, fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		priority = min(p, limit)
+	}
+	return priority, nil
 }
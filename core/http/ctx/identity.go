@@ -0,0 +1,56 @@
+package fiberContext
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+)
+
+// Identity is the API key which authenticated a request, with the identity of its owner and its limits
+type Identity struct {
+	config.APIKey
+	recordTokens func(int)
+}
+
+// NewIdentity returns the identity of key, which counts the tokens used by the requests with recordTokens
+func NewIdentity(key config.APIKey, recordTokens func(int)) *Identity {
+	return &Identity{APIKey: key, recordTokens: recordTokens}
+}
+
+// Label returns the name of the API key in the usage accounting: its name, or a fingerprint of the key when it has no
+// name. The requests which are not authenticated have no label.
+func (i *Identity) Label() string {
+	if i == nil {
+		return ""
+	}
+	if i.Name != "" {
+		return i.Name
+	}
+	sum := sha256.Sum256([]byte(i.Key))
+	return "sha256:" + hex.EncodeToString(sum[:4])
+}
+
+// ID returns the unique ID of the API key in the usage accounting, a fingerprint of the key, since several keys can
+// have the same name. The requests which are not authenticated have no ID.
+func (i *Identity) ID() string {
+	if i == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(i.Key))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
+
+type identityKey struct{}
+
+// SetIdentity sets the identity of the request
+func SetIdentity(ctx *fiber.Ctx, identity *Identity) {
+	ctx.Locals(identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the request, nil if the request was not authenticated with an API key
+func IdentityFromContext(ctx *fiber.Ctx) *Identity {
+	identity, _ := ctx.Locals(identityKey{}).(*Identity)
+	return identity
+}
@@ -0,0 +1,36 @@
+package fiberContext
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// WithTrace returns a copy of ctx with the span and the baggage of the request, so that the spans of its handling are
+// children of the span of the request. The endpoints derive the context of the requests from the context of the
+// application, not from the context of fiber, which is reused once the request is handled.
+func WithTrace(ctx context.Context, c *fiber.Ctx) context.Context {
+	requestCtx := c.UserContext()
+	ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(requestCtx))
+	return baggage.ContextWithBaggage(ctx, baggage.FromContext(requestCtx))
+}
+
+type streamedSpanKey struct{}
+
+// StreamSpan hands the end of the span of the request to the stream writer of a streamed response, which sends the
+// body once the handler returns. The stream writer calls the returned function once the body is sent.
+func StreamSpan(c *fiber.Ctx) func() {
+	c.Locals(streamedSpanKey{}, true)
+	span := trace.SpanFromContext(c.UserContext())
+	return func() {
+		span.End()
+	}
+}
+
+// SpanStreamed returns whether the span of the request is ended by the stream writer of the response
+func SpanStreamed(c *fiber.Ctx) bool {
+	streamed, _ := c.Locals(streamedSpanKey{}).(bool)
+	return streamed
+}
@@ -0,0 +1,85 @@
+package fiberContext
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// UsageRecorder records the resources used by the requests of an API key, with its ID and its name, on a model and an
+// endpoint
+type UsageRecorder interface {
+	Record(keyID, key, model, endpoint string, usage services.Usage)
+}
+
+type usageRecorderKey struct{}
+
+type modelKey struct{}
+
+// SetUsageRecorder sets the recorder of the usage of the request
+func SetUsageRecorder(ctx *fiber.Ctx, recorder UsageRecorder) {
+	ctx.Locals(usageRecorderKey{}, recorder)
+}
+
+// SetModel sets the model of the request, in which its usage is recorded
+func SetModel(ctx *fiber.Ctx, model string) {
+	ctx.Locals(modelKey{}, model)
+}
+
+// RequestUsage is the accounting of a request, in which the inference records the resources used by the request
+type RequestUsage struct {
+	identity *Identity
+	endpoint string
+	recorder UsageRecorder
+}
+
+type requestUsageKey struct{}
+
+// UsageFromContext returns the accounting of the request
+func UsageFromContext(ctx *fiber.Ctx) *RequestUsage {
+	recorder, _ := ctx.Locals(usageRecorderKey{}).(UsageRecorder)
+	return &RequestUsage{identity: IdentityFromContext(ctx), endpoint: ctx.Route().Path, recorder: recorder}
+}
+
+// Apply sets the identity and the usage recorder of the accounting to ctx, to handle a request on behalf of the
+// request of the accounting, e.g. the requests of a batch
+func (u *RequestUsage) Apply(ctx *fiber.Ctx) {
+	if u.identity != nil {
+		SetIdentity(ctx, u.identity)
+	}
+	if u.recorder != nil {
+		SetUsageRecorder(ctx, u.recorder)
+	}
+}
+
+// RecordRequest records the request in the usage of its model, if it has one
+func RecordRequest(ctx *fiber.Ctx) {
+	recorder, _ := ctx.Locals(usageRecorderKey{}).(UsageRecorder)
+	model, _ := ctx.Locals(modelKey{}).(string)
+	if recorder == nil || model == "" {
+		return
+	}
+	identity := IdentityFromContext(ctx)
+	recorder.Record(identity.ID(), identity.Label(), model, ctx.Route().Path, services.Usage{Requests: 1})
+}
+
+// WithUsage returns a copy of ctx with the accounting of the request
+func WithUsage(ctx context.Context, usage *RequestUsage) context.Context {
+	return context.WithValue(ctx, requestUsageKey{}, usage)
+}
+
+// RecordUsage records the resources used on model by the request of ctx, and counts its tokens in the limits of its API
+// key, if ctx has the accounting of the request
+func RecordUsage(ctx context.Context, model string, usage services.Usage) {
+	u, ok := ctx.Value(requestUsageKey{}).(*RequestUsage)
+	if !ok {
+		return
+	}
+	if u.identity != nil && u.identity.recordTokens != nil && usage.PromptTokens+usage.CompletionTokens > 0 {
+		u.identity.recordTokens(usage.PromptTokens + usage.CompletionTokens)
+	}
+	if u.recorder != nil {
+		u.recorder.Record(u.identity.ID(), u.identity.Label(), model, u.endpoint, usage)
+	}
+}
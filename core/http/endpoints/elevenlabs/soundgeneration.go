@@ -55,10 +55,12 @@ func SoundGenerationEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoad
 		}
 
 		// TODO: Support uploading files?
-		filePath, _, err := backend.SoundGeneration(modelFile, input.Text, input.Duration, input.Temperature, input.DoSample, nil, nil, ml, appConfig, *cfg)
+		ctx := backend.WithServedModel(fiberContext.WithTrace(appConfig.Context, c))
+		filePath, _, err := backend.SoundGeneration(ctx, modelFile, input.Text, input.Duration, input.Temperature, input.DoSample, nil, nil, ml, appConfig, *cfg)
 		if err != nil {
 			return err
 		}
+		c.Set(fiberContext.ServedModelHeader, backend.ServedModel(ctx))
 		return c.Download(filePath)
 
 	}
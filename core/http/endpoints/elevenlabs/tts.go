@@ -4,7 +4,9 @@ import (
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/utils"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mudler/LocalAI/core/schema"
@@ -52,10 +54,15 @@ func TTSEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfi
 		}
 		log.Debug().Msgf("Request for model: %s", modelFile)
 
-		filePath, _, err := backend.ModelTTS(cfg.Backend, input.Text, modelFile, "", voiceID, ml, appConfig, *cfg)
+		ctx := backend.WithServedModel(fiberContext.WithUsage(fiberContext.WithTrace(appConfig.Context, c), fiberContext.UsageFromContext(c)))
+		filePath, _, err := backend.ModelTTS(ctx, cfg.Backend, input.Text, modelFile, "", voiceID, ml, appConfig, *cfg)
 		if err != nil {
 			return err
 		}
+		c.Set(fiberContext.ServedModelHeader, backend.ServedModel(ctx))
+		if duration, err := utils.WavDuration(filePath); err == nil {
+			fiberContext.RecordUsage(ctx, backend.ServedModel(ctx), services.Usage{AudioSeconds: duration.Seconds()})
+		}
 		return c.Download(filePath)
 	}
 }
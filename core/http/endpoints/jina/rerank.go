@@ -64,14 +64,21 @@ func JINARerankEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 			Documents: req.Documents,
 		}
 
-		results, err := backend.Rerank(modelFile, request, ml, appConfig, *cfg)
+		ctx := backend.WithServedModel(fiberContext.WithTrace(appConfig.Context, c))
+		results, err := backend.Rerank(ctx, modelFile, request, ml, appConfig, *cfg)
 		if err != nil {
 			return err
 		}
+		served := backend.ServedModel(ctx)
+		c.Set(fiberContext.ServedModelHeader, served)
 
 		response := &schema.JINARerankResponse{
 			Model: req.Model,
 		}
+		// Report the fallback model when the model failed
+		if served != cfg.Name {
+			response.Model = served
+		}
 
 		for _, r := range results.Results {
 			response.Results = append(response.Results, schema.JINADocumentResult{
@@ -0,0 +1,148 @@
+package localai
+
+import (
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+// collectionError maps the errors of the collections service to the matching HTTP status
+func collectionError(err error) error {
+	switch {
+	case errors.Is(err, services.ErrCollectionNotFound):
+		return fiber.NewError(fiber.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrCollectionExists):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	}
+	return err
+}
+
+// CreateCollectionEndpoint creates a collection of documents embedded with the given model
+// @Summary Create a collection
+// @Param request body schema.Collection true "query params"
+// @Success 200 {object} schema.Collection "Response"
+// @Router /v1/collections [post]
+func CreateCollectionEndpoint(cs *services.CollectionsService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.Collection)
+
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		collection, err := cs.Create(*input)
+		if err != nil {
+			if errors.Is(err, services.ErrCollectionExists) {
+				return collectionError(err)
+			}
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		return c.JSON(collection)
+	}
+}
+
+// ListCollectionsEndpoint lists the collections
+// @Summary List collections
+// @Success 200 {object} schema.CollectionListResponse "Response"
+// @Router /v1/collections [get]
+func ListCollectionsEndpoint(cs *services.CollectionsService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return c.JSON(schema.CollectionListResponse{Collections: cs.List()})
+	}
+}
+
+// GetCollectionEndpoint returns a collection
+// @Summary Get a collection
+// @Success 200 {object} schema.Collection "Response"
+// @Router /v1/collections/{name} [get]
+func GetCollectionEndpoint(cs *services.CollectionsService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		collection, err := cs.Get(c.Params("name"))
+		if err != nil {
+			return collectionError(err)
+		}
+
+		return c.JSON(collection)
+	}
+}
+
+// DeleteCollectionEndpoint deletes a collection and all of its documents
+// @Summary Delete a collection
+// @Router /v1/collections/{name} [delete]
+func DeleteCollectionEndpoint(cs *services.CollectionsService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if err := cs.Delete(c.Context(), c.Params("name")); err != nil {
+			return collectionError(err)
+		}
+
+		return c.Send(nil)
+	}
+}
+
+// AddCollectionDocumentsEndpoint chunks, embeds and stores documents in a collection
+// @Summary Add documents to a collection
+// @Param request body schema.CollectionAddDocumentsRequest true "query params"
+// @Success 200 {object} schema.CollectionAddDocumentsResponse "Response"
+// @Router /v1/collections/{name}/documents [post]
+func AddCollectionDocumentsEndpoint(cs *services.CollectionsService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.CollectionAddDocumentsRequest)
+
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		ids, chunks, err := cs.AddDocuments(c.Context(), c.Params("name"), input.Documents)
+		if err != nil {
+			return collectionError(err)
+		}
+
+		return c.JSON(schema.CollectionAddDocumentsResponse{IDs: ids, Chunks: chunks})
+	}
+}
+
+// DeleteCollectionDocumentEndpoint removes all the chunks of a document from a collection
+// @Summary Delete a document from a collection
+// @Success 200 {object} schema.CollectionDeleteDocumentResponse "Response"
+// @Router /v1/collections/{name}/documents/{id} [delete]
+func DeleteCollectionDocumentEndpoint(cs *services.CollectionsService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("id")
+
+		chunks, err := cs.DeleteDocument(c.Context(), c.Params("name"), id)
+		if err != nil {
+			return collectionError(err)
+		}
+
+		return c.JSON(schema.CollectionDeleteDocumentResponse{ID: id, Chunks: chunks})
+	}
+}
+
+// QueryCollectionEndpoint returns the chunks of a collection that are the most relevant to a text query
+// @Summary Query a collection
+// @Param request body schema.CollectionQueryRequest true "query params"
+// @Success 200 {object} schema.CollectionQueryResponse "Response"
+// @Router /v1/collections/{name}/query [post]
+func QueryCollectionEndpoint(cs *services.CollectionsService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.CollectionQueryRequest)
+
+		if err := c.BodyParser(input); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+
+		if input.Query == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "query is required")
+		}
+
+		results, err := cs.Query(c.Context(), c.Params("name"), *input)
+		if err != nil {
+			return collectionError(err)
+		}
+
+		return c.JSON(schema.CollectionQueryResponse{Results: results})
+	}
+}
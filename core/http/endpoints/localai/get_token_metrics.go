@@ -51,10 +51,12 @@ func TokenMetricsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader,
 		}
 		log.Debug().Msgf("Token Metrics for model: %s", modelFile)
 
-		response, err := backend.TokenMetrics(modelFile, ml, appConfig, *cfg)
+		ctx := backend.WithServedModel(fiberContext.WithTrace(appConfig.Context, c))
+		response, err := backend.TokenMetrics(ctx, modelFile, ml, appConfig, *cfg)
 		if err != nil {
 			return err
 		}
+		c.Set(fiberContext.ServedModelHeader, backend.ServedModel(ctx))
 		return c.JSON(response)
 	}
 }
@@ -27,7 +27,7 @@ func StoresSetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfi
 			vals[i] = []byte(v)
 		}
 
-		err = store.SetCols(c.Context(), sb, input.Keys, vals)
+		err = store.SetColsWithMetadata(c.Context(), sb, input.Keys, vals, input.Metadata)
 		if err != nil {
 			return err
 		}
@@ -70,14 +70,15 @@ func StoresGetEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfi
 			return err
 		}
 
-		keys, vals, err := store.GetCols(c.Context(), sb, input.Keys)
+		keys, vals, metadata, err := store.GetColsWithMetadata(c.Context(), sb, input.Keys)
 		if err != nil {
 			return err
 		}
 
 		res := schema.StoresGetResponse{
-			Keys:   keys,
-			Values: make([]string, len(vals)),
+			Keys:     keys,
+			Values:   make([]string, len(vals)),
+			Metadata: metadata,
 		}
 
 		for i, v := range vals {
@@ -101,7 +102,13 @@ func StoresFindEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConf
 			return err
 		}
 
-		keys, vals, similarities, err := store.Find(c.Context(), sb, input.Key, input.Topk)
+		keys, vals, metadata, similarities, err := store.FindWithOptions(c.Context(), sb, input.Key, input.Topk, store.FindOptions{
+			Index:          input.Index,
+			M:              input.M,
+			EfConstruction: input.EfConstruction,
+			Ef:             input.Ef,
+			Filter:         input.Filter,
+		})
 		if err != nil {
 			return err
 		}
@@ -109,6 +116,7 @@ func StoresFindEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConf
 		res := schema.StoresFindResponse{
 			Keys:         keys,
 			Values:       make([]string, len(vals)),
+			Metadata:     metadata,
 			Similarities: similarities,
 		}
 
@@ -119,3 +127,79 @@ func StoresFindEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConf
 		return c.JSON(res)
 	}
 }
+
+func StoresListEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.StoresList)
+
+		if err := c.BodyParser(input); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, appConfig, input.Store)
+		if err != nil {
+			return err
+		}
+
+		keys, vals, metadata, total, err := store.List(c.Context(), sb, input.Filter, input.Offset, input.Limit)
+		if err != nil {
+			return err
+		}
+
+		res := schema.StoresListResponse{
+			Keys:     keys,
+			Values:   make([]string, len(vals)),
+			Metadata: metadata,
+			Total:    total,
+		}
+
+		for i, v := range vals {
+			res.Values[i] = string(v)
+		}
+
+		return c.JSON(res)
+	}
+}
+
+func StoresCountEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.StoresCount)
+
+		if err := c.BodyParser(input); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, appConfig, input.Store)
+		if err != nil {
+			return err
+		}
+
+		count, err := store.Count(c.Context(), sb, input.Filter)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(schema.StoresCountResponse{Count: count})
+	}
+}
+
+func StoresDropEndpoint(sl *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		input := new(schema.StoresDrop)
+
+		if err := c.BodyParser(input); err != nil {
+			return err
+		}
+
+		sb, err := backend.StoreBackend(sl, appConfig, input.Store)
+		if err != nil {
+			return err
+		}
+
+		if err := store.Drop(c.Context(), sb); err != nil {
+			return err
+		}
+
+		return c.Send(nil)
+	}
+}
@@ -46,10 +46,12 @@ func TokenizeEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, app
 		}
 		log.Debug().Msgf("Request for model: %s", modelFile)
 
-		tokenResponse, err := backend.ModelTokenize(input.Content, ml, *cfg, appConfig)
+		ctx := backend.WithServedModel(fiberContext.WithTrace(appConfig.Context, c))
+		tokenResponse, err := backend.ModelTokenize(ctx, input.Content, ml, *cfg, appConfig)
 		if err != nil {
 			return err
 		}
+		c.Set(fiberContext.ServedModelHeader, backend.ServedModel(ctx))
 
 		c.JSON(tokenResponse)
 		return nil
@@ -4,6 +4,7 @@ import (
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/pkg/model"
 
 	"github.com/gofiber/fiber/v2"
@@ -66,10 +67,15 @@ func TTSEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfi
 			cfg.Voice = input.Voice
 		}
 
-		filePath, _, err := backend.ModelTTS(cfg.Backend, input.Input, modelFile, cfg.Voice, cfg.Language, ml, appConfig, *cfg)
+		ctx := backend.WithServedModel(fiberContext.WithUsage(fiberContext.WithTrace(appConfig.Context, c), fiberContext.UsageFromContext(c)))
+		filePath, _, err := backend.ModelTTS(ctx, cfg.Backend, input.Input, modelFile, cfg.Voice, cfg.Language, ml, appConfig, *cfg)
 		if err != nil {
 			return err
 		}
+		c.Set(fiberContext.ServedModelHeader, backend.ServedModel(ctx))
+		if duration, err := utils.WavDuration(filePath); err == nil {
+			fiberContext.RecordUsage(ctx, backend.ServedModel(ctx), services.Usage{AudioSeconds: duration.Seconds()})
+		}
 
 		// Convert generated file to target format
 		filePath, err = utils.AudioConvert(filePath, input.Format)
@@ -0,0 +1,70 @@
+package localai
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/services"
+)
+
+type UsageResponse struct {
+	From    time.Time             `json:"from"`
+	To      time.Time             `json:"to"`
+	GroupBy []string              `json:"group_by"`
+	Data    []services.UsageGroup `json:"data"`
+}
+
+// usageTime parses a time of the usage query, in RFC 3339 or as a date
+func usageTime(c *fiber.Ctx, param string, defaultValue time.Time) (time.Time, error) {
+	value := c.Query(param)
+	if value == "" {
+		return defaultValue, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("%s must be a RFC 3339 time or a date", param))
+}
+
+// UsageEndpoint returns the usage of the API keys, the keys without the admin scope only get their own usage
+// @Summary Usage of the API keys: requests, tokens, images and audio seconds
+// @Param from query string false "Start of the period, as a RFC 3339 time or a date. 30 days before the end by default"
+// @Param to query string false "End of the period, excluded, as a RFC 3339 time or a date. Now by default"
+// @Param group_by query string false "Comma separated fields grouping the usage: hour or day, key, model, endpoint"
+// @Success 200 {object} UsageResponse "Response"
+// @Router /v1/usage [get]
+func UsageEndpoint(usage *services.UsageService) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		to, err := usageTime(c, "to", time.Now().UTC())
+		if err != nil {
+			return err
+		}
+		from, err := usageTime(c, "from", to.AddDate(0, 0, -30))
+		if err != nil {
+			return err
+		}
+
+		groupBy := []string{}
+		if c.Query("group_by") != "" {
+			groupBy = strings.Split(c.Query("group_by"), ",")
+		}
+
+		var keyID *string
+		if identity := fiberContext.IdentityFromContext(c); identity != nil && !identity.HasScope(config.APIKeyScopeAdmin) {
+			id := identity.ID()
+			keyID = &id
+		}
+
+		report, err := usage.Report(from, to, groupBy, keyID)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		return c.JSON(UsageResponse{From: from, To: to, GroupBy: groupBy, Data: report})
+	}
+}
@@ -1,12 +1,10 @@
 package openai
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	"sort"
-	"strconv"
-	"strings"
-	"sync/atomic"
+	"slices"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,8 +12,9 @@ import (
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/schema"
 	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/kvstore"
 	model "github.com/mudler/LocalAI/pkg/model"
-	"github.com/mudler/LocalAI/pkg/utils"
 	"github.com/rs/zerolog/log"
 )
 
@@ -38,6 +37,8 @@ const (
 
 type Tool struct {
 	Type ToolType `json:"type"`
+	// The definition of the function, for function tools
+	Function *functions.Function `json:"function,omitempty"`
 }
 
 // Assistant represents the structure of an assistant object from the OpenAI API.
@@ -54,10 +55,15 @@ type Assistant struct {
 	Metadata     map[string]string `json:"metadata,omitempty"`     // Set of key-value pairs attached to the assistant.
 }
 
-var (
-	Assistants           = []Assistant{} // better to return empty array instead of "null"
-	AssistantsConfigFile = "assistants.json"
-)
+// The assistants used to be saved in this file of the ConfigsDir, it is migrated to the metadata store
+const AssistantsConfigFile = "assistants.json"
+
+const assistantsBucket = "assistants"
+
+// The files of each assistant are in their own bucket
+func assistantFilesBucket(assistantID string) string {
+	return "assistant_files/" + assistantID
+}
 
 type AssistantRequest struct {
 	Model        string            `json:"model"`
@@ -74,7 +80,7 @@ type AssistantRequest struct {
 // @Param request body AssistantRequest true "query params"
 // @Success 200 {object} Assistant "Response"
 // @Router /v1/assistants [post]
-func CreateAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func CreateAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		request := new(AssistantRequest)
 		if err := c.BodyParser(request); err != nil {
@@ -99,10 +105,8 @@ func CreateAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoad
 			request.Metadata = make(map[string]string)
 		}
 
-		id := "asst_" + strconv.FormatInt(generateRandomID(), 10)
-
 		assistant := Assistant{
-			ID:           id,
+			ID:           kvstore.NewID("asst_"),
 			Object:       "assistant",
 			Created:      time.Now().Unix(),
 			Model:        request.Model,
@@ -114,114 +118,29 @@ func CreateAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoad
 			Metadata:     request.Metadata,
 		}
 
-		Assistants = append(Assistants, assistant)
-		utils.SaveConfig(appConfig.ConfigsDir, AssistantsConfigFile, Assistants)
+		err := store.Update(func(tx kvstore.Tx) error {
+			return kvstore.Put(tx, assistantsBucket, assistant.ID, assistant)
+		})
+		if err != nil {
+			return err
+		}
+
 		return c.Status(fiber.StatusOK).JSON(assistant)
 	}
 }
 
-var currentId int64 = 0
-
-func generateRandomID() int64 {
-	atomic.AddInt64(&currentId, 1)
-	return currentId
-}
-
 // ListAssistantsEndpoint is the OpenAI Assistant API endpoint to list assistents https://platform.openai.com/docs/api-reference/assistants/listAssistants
 // @Summary List available assistents
 // @Param limit query int false "Limit the number of assistants returned"
 // @Param order query string false "Order of assistants returned"
 // @Param after query string false "Return assistants created after the given ID"
 // @Param before query string false "Return assistants created before the given ID"
-// @Success 200 {object} []Assistant "Response"
+// @Success 200 {object} ListResponse[Assistant] "Response"
 // @Router /v1/assistants [get]
-func ListAssistantsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func ListAssistantsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
-		// Because we're altering the existing assistants list we should just duplicate it for now.
-		returnAssistants := Assistants
-		// Parse query parameters
-		limitQuery := c.Query("limit", "20")
-		orderQuery := c.Query("order", "desc")
-		afterQuery := c.Query("after")
-		beforeQuery := c.Query("before")
-
-		// Convert string limit to integer
-		limit, err := strconv.Atoi(limitQuery)
-		if err != nil {
-			return c.Status(http.StatusBadRequest).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Invalid limit query value: %s", limitQuery)))
-		}
-
-		// Sort assistants
-		sort.SliceStable(returnAssistants, func(i, j int) bool {
-			if orderQuery == "asc" {
-				return returnAssistants[i].Created < returnAssistants[j].Created
-			}
-			return returnAssistants[i].Created > returnAssistants[j].Created
-		})
-
-		// After and before cursors
-		if afterQuery != "" {
-			returnAssistants = filterAssistantsAfterID(returnAssistants, afterQuery)
-		}
-		if beforeQuery != "" {
-			returnAssistants = filterAssistantsBeforeID(returnAssistants, beforeQuery)
-		}
-
-		// Apply limit
-		if limit < len(returnAssistants) {
-			returnAssistants = returnAssistants[:limit]
-		}
-
-		return c.JSON(returnAssistants)
-	}
-}
-
-// FilterAssistantsBeforeID filters out those assistants whose ID comes before the given ID
-// We assume that the assistants are already sorted
-func filterAssistantsBeforeID(assistants []Assistant, id string) []Assistant {
-	idInt, err := strconv.Atoi(id)
-	if err != nil {
-		return assistants // Return original slice if invalid id format is provided
-	}
-
-	var filteredAssistants []Assistant
-
-	for _, assistant := range assistants {
-		aid, err := strconv.Atoi(strings.TrimPrefix(assistant.ID, "asst_"))
-		if err != nil {
-			continue // Skip if invalid id in assistant
-		}
-
-		if aid < idInt {
-			filteredAssistants = append(filteredAssistants, assistant)
-		}
-	}
-
-	return filteredAssistants
-}
-
-// FilterAssistantsAfterID filters out those assistants whose ID comes after the given ID
-// We assume that the assistants are already sorted
-func filterAssistantsAfterID(assistants []Assistant, id string) []Assistant {
-	idInt, err := strconv.Atoi(id)
-	if err != nil {
-		return assistants // Return original slice if invalid id format is provided
-	}
-
-	var filteredAssistants []Assistant
-
-	for _, assistant := range assistants {
-		aid, err := strconv.Atoi(strings.TrimPrefix(assistant.ID, "asst_"))
-		if err != nil {
-			continue // Skip if invalid id in assistant
-		}
-
-		if aid > idInt {
-			filteredAssistants = append(filteredAssistants, assistant)
-		}
+		return listObjects(c, store, assistantsBucket, func(a Assistant) string { return a.ID }, nil)
 	}
-
-	return filteredAssistants
 }
 
 func modelExists(cl *config.BackendConfigLoader, ml *model.ModelLoader, modelName string) (found bool) {
@@ -244,30 +163,35 @@ func modelExists(cl *config.BackendConfigLoader, ml *model.ModelLoader, modelNam
 // @Summary Delete assistents
 // @Success 200 {object} schema.DeleteAssistantResponse "Response"
 // @Router /v1/assistants/{assistant_id} [delete]
-func DeleteAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func DeleteAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		assistantID := c.Params("assistant_id")
 		if assistantID == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("parameter assistant_id is required")
 		}
 
-		for i, assistant := range Assistants {
-			if assistant.ID == assistantID {
-				Assistants = append(Assistants[:i], Assistants[i+1:]...)
-				utils.SaveConfig(appConfig.ConfigsDir, AssistantsConfigFile, Assistants)
-				return c.Status(fiber.StatusOK).JSON(schema.DeleteAssistantResponse{
-					ID:      assistantID,
-					Object:  "assistant.deleted",
-					Deleted: true,
-				})
+		err := store.Update(func(tx kvstore.Tx) error {
+			if err := tx.Delete(assistantsBucket, assistantID); err != nil {
+				return err
 			}
+			return tx.DeleteBucket(assistantFilesBucket(assistantID))
+		})
+		if errors.Is(err, kvstore.ErrNotFound) {
+			log.Warn().Msgf("Unable to find assistant %s for deletion", assistantID)
+			return c.Status(fiber.StatusNotFound).JSON(schema.DeleteAssistantResponse{
+				ID:      assistantID,
+				Object:  "assistant.deleted",
+				Deleted: false,
+			})
+		}
+		if err != nil {
+			return err
 		}
 
-		log.Warn().Msgf("Unable to find assistant %s for deletion", assistantID)
-		return c.Status(fiber.StatusNotFound).JSON(schema.DeleteAssistantResponse{
+		return c.Status(fiber.StatusOK).JSON(schema.DeleteAssistantResponse{
 			ID:      assistantID,
 			Object:  "assistant.deleted",
-			Deleted: false,
+			Deleted: true,
 		})
 	}
 }
@@ -276,20 +200,26 @@ func DeleteAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoad
 // @Summary Get assistent data
 // @Success 200 {object} Assistant "Response"
 // @Router /v1/assistants/{assistant_id} [get]
-func GetAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func GetAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		assistantID := c.Params("assistant_id")
 		if assistantID == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("parameter assistant_id is required")
 		}
 
-		for _, assistant := range Assistants {
-			if assistant.ID == assistantID {
-				return c.Status(fiber.StatusOK).JSON(assistant)
-			}
+		var assistant Assistant
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			assistant, err = getAssistant(tx, assistantID)
+			return
+		})
+		if errors.Is(err, kvstore.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find assistant with id: %s", assistantID)))
+		}
+		if err != nil {
+			return err
 		}
 
-		return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find assistant with id: %s", assistantID)))
+		return c.Status(fiber.StatusOK).JSON(assistant)
 	}
 }
 
@@ -300,12 +230,10 @@ type AssistantFile struct {
 	AssistantID string `json:"assistant_id"`
 }
 
-var (
-	AssistantFiles           []AssistantFile
-	AssistantsFileConfigFile = "assistantsFile.json"
-)
+// The assistant files used to be saved in this file of the ConfigsDir, it is migrated to the metadata store
+const AssistantsFileConfigFile = "assistantsFile.json"
 
-func CreateAssistantFileEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func CreateAssistantFileEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		request := new(schema.AssistantFileRequest)
 		if err := c.BodyParser(request); err != nil {
@@ -317,98 +245,63 @@ func CreateAssistantFileEndpoint(cl *config.BackendConfigLoader, ml *model.Model
 			return c.Status(fiber.StatusBadRequest).SendString("parameter assistant_id is required")
 		}
 
-		for _, assistant := range Assistants {
-			if assistant.ID == assistantID {
-				if len(assistant.FileIDs) > MaxFileIdSize {
-					return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Max files %d for assistant %s reached.", MaxFileIdSize, assistant.Name))
-				}
+		var assistantFile AssistantFile
+		err := store.Update(func(tx kvstore.Tx) error {
+			assistant, err := getAssistant(tx, assistantID)
+			if errors.Is(err, kvstore.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find %q", assistantID)))
+			}
+			if err != nil {
+				return err
+			}
+
+			if len(assistant.FileIDs) >= MaxFileIdSize {
+				return c.Status(fiber.StatusBadRequest).SendString(fmt.Sprintf("Max files %d for assistant %s reached.", MaxFileIdSize, assistant.Name))
+			}
 
-				for _, file := range UploadedFiles {
-					if file.ID == request.FileID {
-						assistant.FileIDs = append(assistant.FileIDs, request.FileID)
-						assistantFile := AssistantFile{
-							ID:          file.ID,
-							Object:      "assistant.file",
-							CreatedAt:   time.Now().Unix(),
-							AssistantID: assistant.ID,
-						}
-						AssistantFiles = append(AssistantFiles, assistantFile)
-						utils.SaveConfig(appConfig.ConfigsDir, AssistantsFileConfigFile, AssistantFiles)
-						return c.Status(fiber.StatusOK).JSON(assistantFile)
-					}
+			if _, err := getUploadedFile(tx, request.FileID); err != nil {
+				if errors.Is(err, kvstore.ErrNotFound) {
+					return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find file_id: %s", request.FileID)))
 				}
+				return err
+			}
 
-				return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find file_id: %s", request.FileID)))
+			if !slices.Contains(assistant.FileIDs, request.FileID) {
+				assistant.FileIDs = append(assistant.FileIDs, request.FileID)
+			}
+			if err := kvstore.Put(tx, assistantsBucket, assistant.ID, assistant); err != nil {
+				return err
 			}
-		}
 
-		return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find %q", assistantID)))
-	}
-}
+			assistantFile = AssistantFile{
+				ID:          request.FileID,
+				Object:      "assistant.file",
+				CreatedAt:   time.Now().Unix(),
+				AssistantID: assistant.ID,
+			}
+			if err := kvstore.Put(tx, assistantFilesBucket(assistant.ID), assistantFile.ID, assistantFile); err != nil {
+				return err
+			}
 
-func ListAssistantFilesEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
-	type ListAssistantFiles struct {
-		Data   []schema.File
-		Object string
+			return c.Status(fiber.StatusOK).JSON(assistantFile)
+		})
+
+		return err
 	}
+}
 
+func ListAssistantFilesEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		assistantID := c.Params("assistant_id")
 		if assistantID == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("parameter assistant_id is required")
 		}
 
-		limitQuery := c.Query("limit", "20")
-		order := c.Query("order", "desc")
-		limit, err := strconv.Atoi(limitQuery)
-		if err != nil || limit < 1 || limit > 100 {
-			limit = 20 // Default to 20 if there's an error or the limit is out of bounds
-		}
-
-		// Sort files by CreatedAt depending on the order query parameter
-		if order == "asc" {
-			sort.Slice(AssistantFiles, func(i, j int) bool {
-				return AssistantFiles[i].CreatedAt < AssistantFiles[j].CreatedAt
-			})
-		} else { // default to "desc"
-			sort.Slice(AssistantFiles, func(i, j int) bool {
-				return AssistantFiles[i].CreatedAt > AssistantFiles[j].CreatedAt
-			})
-		}
-
-		// Limit the number of files returned
-		var limitedFiles []AssistantFile
-		hasMore := false
-		if len(AssistantFiles) > limit {
-			hasMore = true
-			limitedFiles = AssistantFiles[:limit]
-		} else {
-			limitedFiles = AssistantFiles
-		}
-
-		response := map[string]interface{}{
-			"object": "list",
-			"data":   limitedFiles,
-			"first_id": func() string {
-				if len(limitedFiles) > 0 {
-					return limitedFiles[0].ID
-				}
-				return ""
-			}(),
-			"last_id": func() string {
-				if len(limitedFiles) > 0 {
-					return limitedFiles[len(limitedFiles)-1].ID
-				}
-				return ""
-			}(),
-			"has_more": hasMore,
-		}
-
-		return c.Status(fiber.StatusOK).JSON(response)
+		return listObjects(c, store, assistantFilesBucket(assistantID), func(f AssistantFile) string { return f.ID }, nil)
 	}
 }
 
-func ModifyAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func ModifyAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		request := new(AssistantRequest)
 		if err := c.BodyParser(request); err != nil {
@@ -421,102 +314,98 @@ func ModifyAssistantEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoad
 			return c.Status(fiber.StatusBadRequest).SendString("parameter assistant_id is required")
 		}
 
-		for i, assistant := range Assistants {
-			if assistant.ID == assistantID {
-				newAssistant := Assistant{
-					ID:           assistantID,
-					Object:       assistant.Object,
-					Created:      assistant.Created,
-					Model:        request.Model,
-					Name:         request.Name,
-					Description:  request.Description,
-					Instructions: request.Instructions,
-					Tools:        request.Tools,
-					FileIDs:      request.FileIDs, // todo: should probably verify fileids exist
-					Metadata:     request.Metadata,
-				}
+		return store.Update(func(tx kvstore.Tx) error {
+			assistant, err := getAssistant(tx, assistantID)
+			if errors.Is(err, kvstore.ErrNotFound) {
+				return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find assistant with id: %s", assistantID)))
+			}
+			if err != nil {
+				return err
+			}
 
-				// Remove old one and replace with new one
-				Assistants = append(Assistants[:i], Assistants[i+1:]...)
-				Assistants = append(Assistants, newAssistant)
-				utils.SaveConfig(appConfig.ConfigsDir, AssistantsConfigFile, Assistants)
-				return c.Status(fiber.StatusOK).JSON(newAssistant)
+			newAssistant := Assistant{
+				ID:           assistantID,
+				Object:       assistant.Object,
+				Created:      assistant.Created,
+				Model:        request.Model,
+				Name:         request.Name,
+				Description:  request.Description,
+				Instructions: request.Instructions,
+				Tools:        request.Tools,
+				FileIDs:      request.FileIDs, // todo: should probably verify fileids exist
+				Metadata:     request.Metadata,
 			}
-		}
-		return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find assistant with id: %s", assistantID)))
+
+			if err := kvstore.Put(tx, assistantsBucket, assistantID, newAssistant); err != nil {
+				return err
+			}
+
+			return c.Status(fiber.StatusOK).JSON(newAssistant)
+		})
 	}
 }
 
-func DeleteAssistantFileEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func DeleteAssistantFileEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		assistantID := c.Params("assistant_id")
 		fileId := c.Params("file_id")
-		if assistantID == "" {
+		if assistantID == "" || fileId == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("parameter assistant_id and file_id are required")
 		}
-		// First remove file from assistant
-		for i, assistant := range Assistants {
-			if assistant.ID == assistantID {
-				for j, fileId := range assistant.FileIDs {
-					Assistants[i].FileIDs = append(Assistants[i].FileIDs[:j], Assistants[i].FileIDs[j+1:]...)
-
-					// Check if the file exists in the assistantFiles slice
-					for i, assistantFile := range AssistantFiles {
-						if assistantFile.ID == fileId {
-							// Remove the file from the assistantFiles slice
-							AssistantFiles = append(AssistantFiles[:i], AssistantFiles[i+1:]...)
-							utils.SaveConfig(appConfig.ConfigsDir, AssistantsFileConfigFile, AssistantFiles)
-							return c.Status(fiber.StatusOK).JSON(schema.DeleteAssistantFileResponse{
-								ID:      fileId,
-								Object:  "assistant.file.deleted",
-								Deleted: true,
-							})
-						}
-					}
-				}
 
-				log.Warn().Msgf("Unable to locate file_id: %s in assistants: %s. Continuing to delete assistant file.", fileId, assistantID)
-				for i, assistantFile := range AssistantFiles {
-					if assistantFile.AssistantID == assistantID {
-
-						AssistantFiles = append(AssistantFiles[:i], AssistantFiles[i+1:]...)
-						utils.SaveConfig(appConfig.ConfigsDir, AssistantsFileConfigFile, AssistantFiles)
+		err := store.Update(func(tx kvstore.Tx) error {
+			assistant, err := getAssistant(tx, assistantID)
+			if err != nil {
+				return err
+			}
 
-						return c.Status(fiber.StatusNotFound).JSON(schema.DeleteAssistantFileResponse{
-							ID:      fileId,
-							Object:  "assistant.file.deleted",
-							Deleted: true,
-						})
-					}
-				}
+			assistant.FileIDs = slices.DeleteFunc(assistant.FileIDs, func(id string) bool { return id == fileId })
+			if err := kvstore.Put(tx, assistantsBucket, assistantID, assistant); err != nil {
+				return err
 			}
+
+			return tx.Delete(assistantFilesBucket(assistantID), fileId)
+		})
+		if errors.Is(err, kvstore.ErrNotFound) {
+			log.Warn().Msgf("Unable to find file %s of assistant %s", fileId, assistantID)
+			return c.Status(fiber.StatusNotFound).JSON(schema.DeleteAssistantFileResponse{
+				ID:      fileId,
+				Object:  "assistant.file.deleted",
+				Deleted: false,
+			})
+		}
+		if err != nil {
+			return err
 		}
-		log.Warn().Msgf("Unable to find assistant: %s", assistantID)
 
-		return c.Status(fiber.StatusNotFound).JSON(schema.DeleteAssistantFileResponse{
+		return c.Status(fiber.StatusOK).JSON(schema.DeleteAssistantFileResponse{
 			ID:      fileId,
 			Object:  "assistant.file.deleted",
-			Deleted: false,
+			Deleted: true,
 		})
 	}
 }
 
-func GetAssistantFileEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func GetAssistantFileEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		assistantID := c.Params("assistant_id")
 		fileId := c.Params("file_id")
-		if assistantID == "" {
+		if assistantID == "" || fileId == "" {
 			return c.Status(fiber.StatusBadRequest).SendString("parameter assistant_id and file_id are required")
 		}
 
-		for _, assistantFile := range AssistantFiles {
-			if assistantFile.AssistantID == assistantID {
-				if assistantFile.ID == fileId {
-					return c.Status(fiber.StatusOK).JSON(assistantFile)
-				}
-				return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find assistant file with file_id: %s", fileId)))
-			}
+		var assistantFile AssistantFile
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			assistantFile, err = kvstore.Get[AssistantFile](tx, assistantFilesBucket(assistantID), fileId)
+			return
+		})
+		if errors.Is(err, kvstore.ErrNotFound) {
+			return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find assistant file with file_id: %s", fileId)))
 		}
-		return c.Status(fiber.StatusNotFound).SendString(bluemonday.StrictPolicy().Sanitize(fmt.Sprintf("Unable to find assistant file with assistant_id: %s", assistantID)))
+		if err != nil {
+			return err
+		}
+
+		return c.Status(http.StatusOK).JSON(assistantFile)
 	}
 }
@@ -10,31 +10,44 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/kvstore"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/stretchr/testify/assert"
 )
 
 var configsDir string = "/tmp/localai/configs"
 
+var testStore = kvstore.NewMemoryStore()
+
 type MockLoader struct {
 	models []string
 }
 
 func tearDown() func() {
 	return func() {
-		UploadedFiles = []schema.File{}
-		Assistants = []Assistant{}
-		AssistantFiles = []AssistantFile{}
-		_ = os.Remove(filepath.Join(configsDir, AssistantsConfigFile))
-		_ = os.Remove(filepath.Join(configsDir, AssistantsFileConfigFile))
+		_ = testStore.Update(func(tx kvstore.Tx) error {
+			for _, id := range tx.Keys(assistantsBucket) {
+				_ = tx.DeleteBucket(assistantFilesBucket(id))
+			}
+			_ = tx.DeleteBucket(assistantsBucket)
+			return tx.DeleteBucket(filesBucket)
+		})
 	}
 }
 
+// countKeys returns the number of objects in the bucket of the test store
+func countKeys(bucket string) (n int) {
+	_ = testStore.View(func(tx kvstore.Tx) error {
+		n = len(tx.Keys(bucket))
+		return nil
+	})
+	return
+}
+
 func TestAssistantEndpoints(t *testing.T) {
 	// Preparing the mocked objects
 	cl := &config.BackendConfigLoader{}
@@ -59,17 +72,17 @@ func TestAssistantEndpoints(t *testing.T) {
 	})
 
 	// Create a Test Server
-	app.Get("/assistants", ListAssistantsEndpoint(cl, ml, appConfig))
-	app.Post("/assistants", CreateAssistantEndpoint(cl, ml, appConfig))
-	app.Delete("/assistants/:assistant_id", DeleteAssistantEndpoint(cl, ml, appConfig))
-	app.Get("/assistants/:assistant_id", GetAssistantEndpoint(cl, ml, appConfig))
-	app.Post("/assistants/:assistant_id", ModifyAssistantEndpoint(cl, ml, appConfig))
-
-	app.Post("/files", UploadFilesEndpoint(cl, appConfig))
-	app.Get("/assistants/:assistant_id/files", ListAssistantFilesEndpoint(cl, ml, appConfig))
-	app.Post("/assistants/:assistant_id/files", CreateAssistantFileEndpoint(cl, ml, appConfig))
-	app.Delete("/assistants/:assistant_id/files/:file_id", DeleteAssistantFileEndpoint(cl, ml, appConfig))
-	app.Get("/assistants/:assistant_id/files/:file_id", GetAssistantFileEndpoint(cl, ml, appConfig))
+	app.Get("/assistants", ListAssistantsEndpoint(cl, ml, testStore, appConfig))
+	app.Post("/assistants", CreateAssistantEndpoint(cl, ml, testStore, appConfig))
+	app.Delete("/assistants/:assistant_id", DeleteAssistantEndpoint(cl, ml, testStore, appConfig))
+	app.Get("/assistants/:assistant_id", GetAssistantEndpoint(cl, ml, testStore, appConfig))
+	app.Post("/assistants/:assistant_id", ModifyAssistantEndpoint(cl, ml, testStore, appConfig))
+
+	app.Post("/files", UploadFilesEndpoint(cl, testStore, appConfig))
+	app.Get("/assistants/:assistant_id/files", ListAssistantFilesEndpoint(cl, ml, testStore, appConfig))
+	app.Post("/assistants/:assistant_id/files", CreateAssistantFileEndpoint(cl, ml, testStore, appConfig))
+	app.Delete("/assistants/:assistant_id/files/:file_id", DeleteAssistantFileEndpoint(cl, ml, testStore, appConfig))
+	app.Get("/assistants/:assistant_id/files/:file_id", GetAssistantFileEndpoint(cl, ml, testStore, appConfig))
 
 	t.Run("CreateAssistantEndpoint", func(t *testing.T) {
 		t.Cleanup(tearDown())
@@ -87,7 +100,7 @@ func TestAssistantEndpoints(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, fiber.StatusOK, resp.StatusCode)
 
-		assert.Equal(t, 1, len(Assistants))
+		assert.Equal(t, 1, countKeys(assistantsBucket))
 		//t.Cleanup(cleanupAllAssistants(t, app, []string{resultAssistant.ID}))
 
 		assert.Equal(t, ar.Name, resultAssistant.Name)
@@ -115,8 +128,6 @@ func TestAssistantEndpoints(t *testing.T) {
 
 			//var err error
 			ra, _, err := createAssistant(app, *ar)
-			// Because we create the assistants so fast all end up with the same created time.
-			time.Sleep(time.Second)
 			resultAssistant = append(resultAssistant, ra)
 			assert.NoError(t, err)
 			ids = append(ids, resultAssistant[i].ID)
@@ -124,43 +135,53 @@ func TestAssistantEndpoints(t *testing.T) {
 
 		t.Cleanup(cleanupAllAssistants(t, app, ids))
 
+		ra := resultAssistant
 		tests := []struct {
 			name                 string
 			reqURL               string
 			expectedStatus       int
 			expectedResult       []Assistant
+			expectedHasMore      bool
 			expectedStringResult string
 		}{
 			{
-				name:           "Valid Usage - limit only",
-				reqURL:         "/assistants?limit=2",
-				expectedStatus: http.StatusOK,
-				expectedResult: Assistants[:2], // Expecting the first two assistants
+				name:            "Valid Usage - limit only",
+				reqURL:          "/assistants?limit=2",
+				expectedStatus:  http.StatusOK,
+				expectedResult:  []Assistant{ra[3], ra[2]}, // Expecting the last two assistants, in descending order by default
+				expectedHasMore: true,
 			},
 			{
 				name:           "Valid Usage - order asc",
 				reqURL:         "/assistants?order=asc",
 				expectedStatus: http.StatusOK,
-				expectedResult: Assistants, // Expecting all assistants in ascending order
+				expectedResult: ra, // Expecting all assistants in ascending order
 			},
 			{
 				name:           "Valid Usage - order desc",
 				reqURL:         "/assistants?order=desc",
 				expectedStatus: http.StatusOK,
-				expectedResult: []Assistant{Assistants[3], Assistants[2], Assistants[1], Assistants[0]}, // Expecting all assistants in descending order
+				expectedResult: []Assistant{ra[3], ra[2], ra[1], ra[0]}, // Expecting all assistants in descending order
 			},
 			{
 				name:           "Valid Usage - after specific ID",
-				reqURL:         "/assistants?after=2",
+				reqURL:         "/assistants?after=" + ra[2].ID,
 				expectedStatus: http.StatusOK,
-				// Note this is correct because it's put in descending order already
-				expectedResult: Assistants[:3], // Expecting assistants after (excluding) ID 2
+				expectedResult: []Assistant{ra[1], ra[0]}, // Expecting the assistants after (excluding) the third one, in descending order
+			},
+			{
+				name:           "Valid Usage - after specific ID, ascending",
+				reqURL:         "/assistants?order=asc&limit=1&after=" + ra[1].ID,
+				expectedStatus: http.StatusOK,
+				expectedResult: []Assistant{ra[2]},
+				// The fourth assistant is on the next page
+				expectedHasMore: true,
 			},
 			{
 				name:           "Valid Usage - before specific ID",
-				reqURL:         "/assistants?before=4",
+				reqURL:         "/assistants?before=" + ra[1].ID,
 				expectedStatus: http.StatusOK,
-				expectedResult: Assistants[2:], // Expecting assistants before (excluding) ID 3.
+				expectedResult: []Assistant{ra[3], ra[2]}, // Expecting the assistants before (excluding) the second one, in descending order
 			},
 			{
 				name:                 "Invalid Usage - non-integer limit",
@@ -168,11 +189,17 @@ func TestAssistantEndpoints(t *testing.T) {
 				expectedStatus:       http.StatusBadRequest,
 				expectedStringResult: "Invalid limit query value: two",
 			},
+			{
+				name:                 "Invalid Usage - unknown order",
+				reqURL:               "/assistants?order=random",
+				expectedStatus:       http.StatusBadRequest,
+				expectedStringResult: "Invalid order query value: random",
+			},
 			{
 				name:           "Invalid Usage - non-existing id in after",
-				reqURL:         "/assistants?after=100",
+				reqURL:         "/assistants?after=asst_100",
 				expectedStatus: http.StatusOK,
-				expectedResult: []Assistant(nil), // Expecting empty list as there are no IDs above 100
+				expectedResult: []Assistant{}, // Expecting empty list as the cursor is unknown
 			},
 		}
 
@@ -186,11 +213,17 @@ func TestAssistantEndpoints(t *testing.T) {
 					all, _ := io.ReadAll(response.Body)
 					assert.Equal(t, tt.expectedStringResult, string(all))
 				} else {
-					var result []Assistant
+					var result ListResponse[Assistant]
 					err = json.NewDecoder(response.Body).Decode(&result)
 					assert.NoError(t, err)
 
-					assert.Equal(t, tt.expectedResult, result)
+					assert.Equal(t, "list", result.Object)
+					assert.Equal(t, tt.expectedResult, result.Data)
+					assert.Equal(t, tt.expectedHasMore, result.HasMore)
+					if len(tt.expectedResult) > 0 {
+						assert.Equal(t, tt.expectedResult[0].ID, result.FirstID)
+						assert.Equal(t, tt.expectedResult[len(tt.expectedResult)-1].ID, result.LastID)
+					}
 				}
 			})
 		}
@@ -214,7 +247,7 @@ func TestAssistantEndpoints(t *testing.T) {
 		deleteReq := httptest.NewRequest(http.MethodDelete, target, nil)
 		_, err = app.Test(deleteReq)
 		assert.NoError(t, err)
-		assert.Equal(t, 0, len(Assistants))
+		assert.Equal(t, 0, countKeys(assistantsBucket))
 	})
 
 	t.Run("GetAssistantEndpoint", func(t *testing.T) {
@@ -345,7 +378,7 @@ func TestAssistantEndpoints(t *testing.T) {
 
 		cleanupAssistantFile(t, app, af.ID, af.AssistantID)()
 
-		assert.Empty(t, AssistantFiles)
+		assert.Equal(t, 0, countKeys(assistantFilesBucket(assistant.ID)))
 	})
 
 }
@@ -0,0 +1,569 @@
+package openai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/concurrency"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+type BatchStatus string
+
+const (
+	BatchValidating BatchStatus = "validating"
+	BatchFailed     BatchStatus = "failed"
+	BatchInProgress BatchStatus = "in_progress"
+	BatchFinalizing BatchStatus = "finalizing"
+	BatchCompleted  BatchStatus = "completed"
+	BatchExpired    BatchStatus = "expired"
+	BatchCancelling BatchStatus = "cancelling"
+	BatchCancelled  BatchStatus = "cancelled"
+)
+
+// The only completion window supported by the OpenAI API
+const BatchCompletionWindow = "24h"
+
+// MaxBatchRequests is the maximum number of requests in the input file of a batch
+const MaxBatchRequests = 50000
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+type BatchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Param   string `json:"param,omitempty"`
+	Line    int    `json:"line,omitempty"` // The line of the input file, starting at 1
+}
+
+type BatchErrors struct {
+	Object string       `json:"object"` // Always "list"
+	Data   []BatchError `json:"data"`
+}
+
+// Batch represents the structure of a batch object from the OpenAI API.
+type Batch struct {
+	ID               string             `json:"id"`                       // The unique identifier of the batch.
+	Object           string             `json:"object"`                   // Object type, which is "batch".
+	Endpoint         string             `json:"endpoint"`                 // The endpoint the requests are sent to.
+	Errors           *BatchErrors       `json:"errors,omitempty"`         // The errors of the input file, when the validation failed.
+	InputFileID      string             `json:"input_file_id"`            // The file with the requests.
+	CompletionWindow string             `json:"completion_window"`        // The time frame within which the batch should be processed.
+	Status           BatchStatus        `json:"status"`                   // The status of the batch.
+	OutputFileID     string             `json:"output_file_id,omitempty"` // The file with the successful responses.
+	ErrorFileID      string             `json:"error_file_id,omitempty"`  // The file with the failed requests.
+	CreatedAt        int64              `json:"created_at"`               // The time at which the batch was created.
+	InProgressAt     int64              `json:"in_progress_at,omitempty"` // The time at which the requests started to be processed.
+	ExpiresAt        int64              `json:"expires_at"`               // The time at which the batch expires.
+	FinalizingAt     int64              `json:"finalizing_at,omitempty"`  // The time at which the batch started finalizing.
+	CompletedAt      int64              `json:"completed_at,omitempty"`   // The time at which the batch was completed.
+	FailedAt         int64              `json:"failed_at,omitempty"`      // The time at which the batch failed.
+	ExpiredAt        int64              `json:"expired_at,omitempty"`     // The time at which the batch expired.
+	CancellingAt     int64              `json:"cancelling_at,omitempty"`  // The time at which the batch started cancelling.
+	CancelledAt      int64              `json:"cancelled_at,omitempty"`   // The time at which the batch was cancelled.
+	RequestCounts    BatchRequestCounts `json:"request_counts"`           // The progress of the batch.
+	Metadata         map[string]string  `json:"metadata"`                 // Set of key-value pairs attached to the batch.
+}
+
+type BatchRequest struct {
+	InputFileID      string            `json:"input_file_id"`
+	Endpoint         string            `json:"endpoint"`
+	CompletionWindow string            `json:"completion_window"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+// batchInputLine is a request of the input file of a batch
+type batchInputLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+type batchResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// batchOutputLine is a line of the output or error file of a batch
+type batchOutputLine struct {
+	ID       string         `json:"id"`
+	CustomID string         `json:"custom_id"`
+	Response *batchResponse `json:"response"`
+	Error    *BatchError    `json:"error"`
+}
+
+const batchesBucket = "batches"
+
+func getBatch(tx kvstore.Tx, id string) (Batch, error) {
+	batch, err := kvstore.Get[Batch](tx, batchesBucket, id)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return batch, fiber.NewError(fiber.StatusNotFound, "batch not found")
+	}
+	return batch, err
+}
+
+// updateBatch applies fn to the batch in a transaction
+func updateBatch(store kvstore.Store, id string, fn func(b *Batch) error) (Batch, error) {
+	var batch Batch
+	err := store.Update(func(tx kvstore.Tx) (err error) {
+		batch, err = getBatch(tx, id)
+		if err != nil {
+			return
+		}
+		if err = fn(&batch); err != nil {
+			return
+		}
+		return kvstore.Put(tx, batchesBucket, batch.ID, batch)
+	})
+	return batch, err
+}
+
+// InterruptBatches marks the batches that were being processed when LocalAI stopped as failed
+func InterruptBatches(store kvstore.Store) error {
+	return store.Update(func(tx kvstore.Tx) error {
+		batches, _, err := kvstore.List[Batch](tx, batchesBucket, kvstore.ListOptions{})
+		if err != nil {
+			return err
+		}
+
+		for _, b := range batches {
+			switch b.Status {
+			case BatchValidating, BatchInProgress, BatchFinalizing:
+				b.Status = BatchFailed
+				b.FailedAt = time.Now().Unix()
+				b.Errors = &BatchErrors{Object: "list", Data: []BatchError{{Code: "interrupted", Message: "the batch was interrupted by a restart"}}}
+			case BatchCancelling:
+				b.Status = BatchCancelled
+				b.CancelledAt = time.Now().Unix()
+			default:
+				continue
+			}
+			if err := kvstore.Put(tx, batchesBucket, b.ID, b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// readBatchInput parses and validates the requests of the input file
+func readBatchInput(path, endpoint string) ([]batchInputLine, []BatchError, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	requests := []batchInputLine{}
+	validationErrors := []BatchError{}
+	customIDs := map[string]bool{}
+
+	r := bufio.NewReader(f)
+	for n := 1; ; n++ {
+		data, err := r.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, nil, err
+		}
+
+		if data = bytes.TrimSpace(data); len(data) > 0 {
+			var line batchInputLine
+			var body struct {
+				Stream bool `json:"stream"`
+			}
+			switch {
+			case json.Unmarshal(data, &line) != nil:
+				validationErrors = append(validationErrors, BatchError{Code: "invalid_json_line", Message: "the line is not valid JSON", Line: n})
+			case line.CustomID == "":
+				validationErrors = append(validationErrors, BatchError{Code: "missing_required_parameter", Message: "custom_id is required", Param: "custom_id", Line: n})
+			case customIDs[line.CustomID]:
+				validationErrors = append(validationErrors, BatchError{Code: "duplicate_custom_id", Message: fmt.Sprintf("custom_id %s is not unique", line.CustomID), Param: "custom_id", Line: n})
+			case line.Method != fiber.MethodPost:
+				validationErrors = append(validationErrors, BatchError{Code: "invalid_method", Message: "only POST requests are supported", Param: "method", Line: n})
+			case line.URL != endpoint:
+				validationErrors = append(validationErrors, BatchError{Code: "mismatched_endpoint", Message: fmt.Sprintf("the url must be the endpoint of the batch, %s", endpoint), Param: "url", Line: n})
+			case json.Unmarshal(line.Body, &body) != nil:
+				validationErrors = append(validationErrors, BatchError{Code: "invalid_request", Message: "the body must be a JSON object", Param: "body", Line: n})
+			case body.Stream:
+				validationErrors = append(validationErrors, BatchError{Code: "invalid_request", Message: "streaming is not supported in batches", Param: "body.stream", Line: n})
+			default:
+				customIDs[line.CustomID] = true
+				requests = append(requests, line)
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+	}
+
+	if len(requests) == 0 && len(validationErrors) == 0 {
+		validationErrors = append(validationErrors, BatchError{Code: "empty_file", Message: "the input file has no requests"})
+	}
+	if len(requests) > MaxBatchRequests {
+		validationErrors = append(validationErrors, BatchError{Code: "too_many_requests", Message: fmt.Sprintf("a batch can have at most %d requests", MaxBatchRequests)})
+	}
+
+	return requests, validationErrors, nil
+}
+
+// callBatchHandler sends the request to the handler of the endpoint, as if it was received by the API on behalf of
+// the request of usage
+func callBatchHandler(ctx context.Context, app *fiber.App, handler fiber.Handler, usage *fiberContext.RequestUsage, line batchInputLine) *batchResponse {
+	fctx := &fasthttp.RequestCtx{}
+	fctx.Request.Header.SetMethod(line.Method)
+	fctx.Request.SetRequestURI(line.URL)
+	fctx.Request.Header.SetContentType(fiber.MIMEApplicationJSON)
+	// The batches are processed in the background, after the interactive requests
+	fctx.Request.Header.Set(fiberContext.PriorityHeader, concurrency.PriorityLow.String())
+	fctx.Request.SetBody(line.Body)
+
+	c := app.AcquireCtx(fctx)
+	defer app.ReleaseCtx(c)
+	c.SetUserContext(ctx)
+	usage.Apply(c)
+
+	if err := handler(c); err != nil {
+		code := fiber.StatusInternalServerError
+		var e *fiber.Error
+		if errors.As(err, &e) {
+			code = e.Code
+		}
+		var queueFull *concurrency.QueueFullError
+		if errors.As(err, &queueFull) {
+			code = fiber.StatusTooManyRequests
+		}
+		if err := c.Status(code).JSON(schema.ErrorResponse{Error: &schema.APIError{Message: err.Error(), Code: code}}); err != nil {
+			log.Error().Err(err).Msg("Unable to encode the error of a batch request")
+		}
+	}
+	fiberContext.RecordRequest(c)
+
+	body := append([]byte{}, fctx.Response.Body()...)
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(body))
+	}
+
+	return &batchResponse{
+		StatusCode: fctx.Response.StatusCode(),
+		RequestID:  kvstore.NewID("req_"),
+		Body:       body,
+	}
+}
+
+// batchResults writes the output and error files of a batch in the UploadDir, they are created on the first write
+type batchResults struct {
+	dir, batchID string
+	files        map[string]*os.File
+}
+
+func (r *batchResults) filename(kind string) string {
+	return fmt.Sprintf("%s_%s.jsonl", r.batchID, kind)
+}
+
+func (r *batchResults) write(kind string, line batchOutputLine) error {
+	f, exists := r.files[kind]
+	if !exists {
+		var err error
+		f, err = os.Create(filepath.Join(r.dir, r.filename(kind)))
+		if err != nil {
+			return err
+		}
+		r.files[kind] = f
+	}
+
+	data, err := json.Marshal(line)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// close closes the files and adds them to the uploaded files, it returns their IDs by kind
+func (r *batchResults) close(store kvstore.Store) (map[string]string, error) {
+	ids := map[string]string{}
+	err := store.Update(func(tx kvstore.Tx) error {
+		for kind, f := range r.files {
+			info, err := f.Stat()
+			if err != nil {
+				return err
+			}
+			if err := f.Close(); err != nil {
+				return err
+			}
+
+			file := schema.File{
+				ID:        kvstore.NewID("file-"),
+				Object:    "file",
+				Bytes:     int(info.Size()),
+				CreatedAt: time.Now(),
+				Filename:  r.filename(kind),
+				Purpose:   "batch_output",
+			}
+			if err := kvstore.Put(tx, filesBucket, file.ID, file); err != nil {
+				return err
+			}
+			ids[kind] = file.ID
+		}
+		return nil
+	})
+	return ids, err
+}
+
+// processBatch validates the input file of the batch and sends its requests to the handlers one at a time, on behalf
+// of the request which created the batch
+func processBatch(ctx context.Context, app *fiber.App, handlers map[string]fiber.Handler, store kvstore.Store, appConfig *config.ApplicationConfig, usage *fiberContext.RequestUsage, id string) error {
+	var batch Batch
+	var input schema.File
+	err := store.View(func(tx kvstore.Tx) (err error) {
+		if batch, err = getBatch(tx, id); err != nil {
+			return
+		}
+		input, err = getUploadedFile(tx, batch.InputFileID)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	requests, validationErrors, err := readBatchInput(uploadedFilePath(appConfig, input), batch.Endpoint)
+	if err != nil {
+		validationErrors = []BatchError{{Code: "invalid_file", Message: err.Error()}}
+	}
+
+	batch, err = updateBatch(store, id, func(b *Batch) error {
+		switch {
+		case b.Status == BatchCancelling:
+			b.Status = BatchCancelled
+			b.CancelledAt = time.Now().Unix()
+		case len(validationErrors) > 0:
+			b.Status = BatchFailed
+			b.FailedAt = time.Now().Unix()
+			b.Errors = &BatchErrors{Object: "list", Data: validationErrors}
+		default:
+			b.Status = BatchInProgress
+			b.InProgressAt = time.Now().Unix()
+			b.RequestCounts.Total = len(requests)
+		}
+		return nil
+	})
+	if err != nil || batch.Status != BatchInProgress {
+		return err
+	}
+
+	results := &batchResults{dir: appConfig.UploadDir, batchID: id, files: map[string]*os.File{}}
+	expired := false
+	for _, request := range requests {
+		if ctx.Err() != nil {
+			break
+		}
+		if time.Now().Unix() >= batch.ExpiresAt {
+			expired = true
+			break
+		}
+
+		line := batchOutputLine{
+			ID:       kvstore.NewID("batch_req_"),
+			CustomID: request.CustomID,
+			Response: callBatchHandler(ctx, app, handlers[request.URL], usage, request),
+		}
+
+		succeeded := line.Response.StatusCode < fiber.StatusBadRequest
+		kind := "output"
+		if !succeeded {
+			kind = "error"
+		}
+		if err := results.write(kind, line); err != nil {
+			return err
+		}
+
+		batch, err = updateBatch(store, id, func(b *Batch) error {
+			if succeeded {
+				b.RequestCounts.Completed++
+			} else {
+				b.RequestCounts.Failed++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	batch, err = updateBatch(store, id, func(b *Batch) error {
+		if b.Status == BatchInProgress {
+			b.Status = BatchFinalizing
+			b.FinalizingAt = time.Now().Unix()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// The responses received until the batch was cancelled or expired are available as well
+	ids, err := results.close(store)
+	if err != nil {
+		return err
+	}
+
+	_, err = updateBatch(store, id, func(b *Batch) error {
+		b.OutputFileID = ids["output"]
+		b.ErrorFileID = ids["error"]
+		switch {
+		case b.Status == BatchCancelling:
+			b.Status = BatchCancelled
+			b.CancelledAt = time.Now().Unix()
+		case expired:
+			b.Status = BatchExpired
+			b.ExpiredAt = time.Now().Unix()
+		case ctx.Err() != nil:
+			// LocalAI is shutting down, the batch is marked as failed on restart
+		default:
+			b.Status = BatchCompleted
+			b.CompletedAt = time.Now().Unix()
+		}
+		return nil
+	})
+	return err
+}
+
+// CreateBatchEndpoint is the OpenAI Batch API endpoint https://platform.openai.com/docs/api-reference/batch/create
+// @Summary Process the requests of an uploaded JSONL file in the background
+// @Param request body BatchRequest true "query params"
+// @Success 200 {object} Batch "Response"
+// @Router /v1/batches [post]
+func CreateBatchEndpoint(app *fiber.App, handlers map[string]fiber.Handler, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(BatchRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse BatchRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		if _, exists := handlers[request.Endpoint]; !exists {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unsupported endpoint: %s", request.Endpoint))
+		}
+		if request.CompletionWindow != BatchCompletionWindow {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("completion_window must be %s", BatchCompletionWindow))
+		}
+		if request.Metadata == nil {
+			request.Metadata = map[string]string{}
+		}
+
+		now := time.Now()
+		batch := Batch{
+			ID:               kvstore.NewID("batch_"),
+			Object:           "batch",
+			Endpoint:         request.Endpoint,
+			InputFileID:      request.InputFileID,
+			CompletionWindow: request.CompletionWindow,
+			Status:           BatchValidating,
+			CreatedAt:        now.Unix(),
+			ExpiresAt:        now.Add(24 * time.Hour).Unix(),
+			Metadata:         request.Metadata,
+		}
+
+		err := store.Update(func(tx kvstore.Tx) error {
+			input, err := getUploadedFile(tx, request.InputFileID)
+			if errors.Is(err, kvstore.ErrNotFound) {
+				return fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("unable to find file id %s", request.InputFileID))
+			}
+			if err != nil {
+				return err
+			}
+			if input.Purpose != "batch" {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("file %s must have the batch purpose", input.ID))
+			}
+
+			return kvstore.Put(tx, batchesBucket, batch.ID, batch)
+		})
+		if err != nil {
+			return err
+		}
+
+		usage := fiberContext.UsageFromContext(c)
+		backgroundJobs.start(appConfig.Context, batch.ID, func(ctx context.Context) {
+			if err := processBatch(ctx, app, handlers, store, appConfig, usage, batch.ID); err != nil {
+				log.Error().Err(err).Msgf("Unable to process batch %s", batch.ID)
+			}
+		})
+
+		return c.JSON(batch)
+	}
+}
+
+// GetBatchEndpoint is the OpenAI Batch API endpoint https://platform.openai.com/docs/api-reference/batch/retrieve
+// @Summary Get a batch, to poll its status and progress
+// @Success 200 {object} Batch "Response"
+// @Router /v1/batches/{batch_id} [get]
+func GetBatchEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		var batch Batch
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			batch, err = getBatch(tx, c.Params("batch_id"))
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(batch)
+	}
+}
+
+// ListBatchesEndpoint is the OpenAI Batch API endpoint https://platform.openai.com/docs/api-reference/batch/list
+// @Summary List the batches
+// @Param limit query int false "Limit the number of batches returned"
+// @Param after query string false "Return batches after the given ID"
+// @Success 200 {object} ListResponse[Batch] "Response"
+// @Router /v1/batches [get]
+func ListBatchesEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		return listObjects(c, store, batchesBucket, func(b Batch) string { return b.ID }, nil)
+	}
+}
+
+// CancelBatchEndpoint is the OpenAI Batch API endpoint https://platform.openai.com/docs/api-reference/batch/cancel
+// @Summary Cancel a batch, the request being processed is completed first
+// @Success 200 {object} Batch "Response"
+// @Router /v1/batches/{batch_id}/cancel [post]
+func CancelBatchEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		batch, err := updateBatch(store, c.Params("batch_id"), func(b *Batch) error {
+			if b.Status != BatchValidating && b.Status != BatchInProgress {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("batch %s is %s and can't be cancelled", b.ID, b.Status))
+			}
+			b.Status = BatchCancelling
+			b.CancellingAt = time.Now().Unix()
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		backgroundJobs.cancel(batch.ID)
+
+		return c.JSON(batch)
+	}
+}
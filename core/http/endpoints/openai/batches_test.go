@@ -0,0 +1,218 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// uploadBatchInput adds a file with the given lines to the store and the UploadDir, where it is saved under its
+// sanitized name as by the upload endpoint
+func uploadBatchInput(t *testing.T, store kvstore.Store, appConfig *config.ApplicationConfig, purpose string, lines ...string) schema.File {
+	f := schema.File{ID: kvstore.NewID("file-"), Object: "file", Filename: kvstore.NewID("input..") + ".jsonl", Purpose: purpose}
+	assert.NoError(t, os.WriteFile(filepath.Join(appConfig.UploadDir, utils.SanitizeFileName(f.Filename)), []byte(strings.Join(lines, "\n")), 0600))
+	putObjects(t, store, filesBucket, func(f schema.File) string { return f.ID }, f)
+	return f
+}
+
+// waitBatch polls the batch until it is not validating, in progress or finalizing anymore
+func waitBatch(t *testing.T, app *fiber.App, id string) Batch {
+	var batch Batch
+	assert.Eventually(t, func() bool {
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/batches/"+id, nil, &batch))
+		switch batch.Status {
+		case BatchValidating, BatchInProgress, BatchFinalizing, BatchCancelling:
+			return false
+		}
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+	return batch
+}
+
+// readBatchOutput returns the lines of an output or error file by custom_id
+func readBatchOutput(t *testing.T, store kvstore.Store, appConfig *config.ApplicationConfig, fileID string) map[string]batchOutputLine {
+	var f schema.File
+	assert.NoError(t, store.View(func(tx kvstore.Tx) (err error) {
+		f, err = getUploadedFile(tx, fileID)
+		return
+	}))
+	assert.Equal(t, "batch_output", f.Purpose)
+
+	file, err := os.Open(filepath.Join(appConfig.UploadDir, f.Filename))
+	assert.NoError(t, err)
+	defer file.Close()
+
+	lines := map[string]batchOutputLine{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var line batchOutputLine
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines[line.CustomID] = line
+	}
+	return lines
+}
+
+func TestBatchEndpoints(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	appConfig := &config.ApplicationConfig{UploadDir: t.TempDir(), Context: ctx}
+	store := kvstore.NewMemoryStore()
+	release := make(chan struct{})
+
+	app := fiber.New()
+	handlers := map[string]fiber.Handler{
+		"/v1/chat/completions": func(c *fiber.Ctx) error {
+			input := new(schema.OpenAIRequest)
+			if err := c.BodyParser(input); err != nil {
+				return err
+			}
+			if input.Model == "missing" {
+				return fiber.NewError(fiber.StatusNotFound, "model not found")
+			}
+			return c.JSON(schema.OpenAIResponse{Model: input.Model, Object: "chat.completion"})
+		},
+		"/v1/embeddings": func(c *fiber.Ctx) error {
+			// Blocks until the batch is cancelled
+			select {
+			case <-c.UserContext().Done():
+			case <-release:
+			}
+			return c.JSON(schema.OpenAIResponse{Object: "list"})
+		},
+	}
+	app.Post("/batches", CreateBatchEndpoint(app, handlers, store, appConfig))
+	app.Get("/batches", ListBatchesEndpoint(store))
+	app.Get("/batches/:batch_id", GetBatchEndpoint(store))
+	app.Post("/batches/:batch_id/cancel", CancelBatchEndpoint(store))
+
+	t.Run("ProcessRequests", func(t *testing.T) {
+		input := uploadBatchInput(t, store, appConfig, "batch",
+			`{"custom_id": "1", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "m1"}}`,
+			`{"custom_id": "2", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "missing"}}`,
+			`{"custom_id": "3", "method": "POST", "url": "/v1/chat/completions", "body": {"model": "m2"}}`,
+		)
+
+		var batch Batch
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/batches", BatchRequest{
+			InputFileID:      input.ID,
+			Endpoint:         "/v1/chat/completions",
+			CompletionWindow: "24h",
+			Metadata:         map[string]string{"job": "nightly"},
+		}, &batch))
+		assert.Equal(t, BatchValidating, batch.Status)
+		assert.Equal(t, "nightly", batch.Metadata["job"])
+
+		batch = waitBatch(t, app, batch.ID)
+		assert.Equal(t, BatchCompleted, batch.Status)
+		assert.Equal(t, BatchRequestCounts{Total: 3, Completed: 2, Failed: 1}, batch.RequestCounts)
+		assert.NotZero(t, batch.CompletedAt)
+
+		output := readBatchOutput(t, store, appConfig, batch.OutputFileID)
+		assert.Len(t, output, 2)
+		assert.Equal(t, http.StatusOK, output["1"].Response.StatusCode)
+		var response schema.OpenAIResponse
+		assert.NoError(t, json.Unmarshal(output["3"].Response.Body, &response))
+		assert.Equal(t, "m2", response.Model)
+
+		errors := readBatchOutput(t, store, appConfig, batch.ErrorFileID)
+		assert.Len(t, errors, 1)
+		assert.Equal(t, http.StatusNotFound, errors["2"].Response.StatusCode)
+		assert.Contains(t, string(errors["2"].Response.Body), "model not found")
+
+		var batches ListResponse[Batch]
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/batches", nil, &batches))
+		assert.Equal(t, batch.ID, batches.FirstID)
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		input := uploadBatchInput(t, store, appConfig, "fine-tune", `{}`)
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/batches", BatchRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"}, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodPost, "/batches", BatchRequest{InputFileID: "file-missing", Endpoint: "/v1/chat/completions", CompletionWindow: "24h"}, nil))
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/batches", BatchRequest{InputFileID: input.ID, Endpoint: "/v1/images/generations", CompletionWindow: "24h"}, nil))
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/batches", BatchRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "1h"}, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodGet, "/batches/batch_missing", nil, nil))
+	})
+
+	t.Run("ValidationFails", func(t *testing.T) {
+		input := uploadBatchInput(t, store, appConfig, "batch",
+			`{"custom_id": "1", "method": "POST", "url": "/v1/chat/completions", "body": {}}`,
+			`not json`,
+			`{"custom_id": "1", "method": "POST", "url": "/v1/chat/completions", "body": {}}`,
+			`{"custom_id": "2", "method": "POST", "url": "/v1/embeddings", "body": {}}`,
+			`{"custom_id": "3", "method": "POST", "url": "/v1/chat/completions", "body": {"stream": true}}`,
+		)
+
+		var batch Batch
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/batches", BatchRequest{InputFileID: input.ID, Endpoint: "/v1/chat/completions", CompletionWindow: "24h"}, &batch))
+
+		batch = waitBatch(t, app, batch.ID)
+		assert.Equal(t, BatchFailed, batch.Status)
+		codes := []string{}
+		for _, e := range batch.Errors.Data {
+			codes = append(codes, e.Code)
+		}
+		assert.Equal(t, []string{"invalid_json_line", "duplicate_custom_id", "mismatched_endpoint", "invalid_request"}, codes)
+		assert.Equal(t, 2, batch.Errors.Data[0].Line)
+	})
+
+	t.Run("Cancel", func(t *testing.T) {
+		input := uploadBatchInput(t, store, appConfig, "batch",
+			`{"custom_id": "1", "method": "POST", "url": "/v1/embeddings", "body": {"input": "a"}}`,
+			`{"custom_id": "2", "method": "POST", "url": "/v1/embeddings", "body": {"input": "b"}}`,
+		)
+
+		var batch Batch
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/batches", BatchRequest{InputFileID: input.ID, Endpoint: "/v1/embeddings", CompletionWindow: "24h"}, &batch))
+		assert.Eventually(t, func() bool {
+			doJSON(t, app, http.MethodGet, "/batches/"+batch.ID, nil, &batch)
+			return batch.Status == BatchInProgress
+		}, 5*time.Second, 10*time.Millisecond)
+
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/batches/"+batch.ID+"/cancel", nil, &batch))
+		assert.Equal(t, BatchCancelling, batch.Status)
+
+		batch = waitBatch(t, app, batch.ID)
+		assert.Equal(t, BatchCancelled, batch.Status)
+		// The request being processed is completed, the next ones are skipped
+		assert.Equal(t, 1, batch.RequestCounts.Completed)
+		assert.Len(t, readBatchOutput(t, store, appConfig, batch.OutputFileID), 1)
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/batches/"+batch.ID+"/cancel", nil, nil))
+	})
+
+	close(release)
+}
+
+func TestInterruptBatches(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+	putObjects(t, store, batchesBucket, func(b Batch) string { return b.ID },
+		Batch{ID: "batch_1", Status: BatchInProgress},
+		Batch{ID: "batch_2", Status: BatchCancelling},
+		Batch{ID: "batch_3", Status: BatchCompleted},
+	)
+
+	assert.NoError(t, InterruptBatches(store))
+
+	var batches []Batch
+	assert.NoError(t, store.View(func(tx kvstore.Tx) (err error) {
+		batches, _, err = kvstore.List[Batch](tx, batchesBucket, kvstore.ListOptions{})
+		return
+	}))
+	assert.Equal(t, BatchFailed, batches[0].Status)
+	assert.Equal(t, "interrupted", batches[0].Errors.Data[0].Code)
+	assert.Equal(t, BatchCancelled, batches[1].Status)
+	assert.Equal(t, BatchCompleted, batches[2].Status)
+}
@@ -0,0 +1,115 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/base"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEndless is an embedded backend which generates tokens until its request is cancelled
+type fakeEndless struct {
+	base.SingleThread
+	started, stopped chan struct{}
+}
+
+func (f *fakeEndless) Load(opts *pb.ModelOptions) error {
+	return nil
+}
+
+func (f *fakeEndless) generate(send func(string)) {
+	f.started <- struct{}{}
+	for !f.Canceled() {
+		send("token ")
+		time.Sleep(10 * time.Millisecond)
+	}
+	f.stopped <- struct{}{}
+}
+
+func (f *fakeEndless) Predict(opts *pb.PredictOptions) (string, error) {
+	f.generate(func(string) {})
+	return "cancelled", nil
+}
+
+func (f *fakeEndless) PredictStream(opts *pb.PredictOptions, results chan string) error {
+	defer close(results)
+	f.generate(func(token string) { results <- token })
+	return nil
+}
+
+func TestCancelOnDisconnect(t *testing.T) {
+	modelPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "fake.yaml"), []byte(`name: fake
+backend: fake-endless
+parameters:
+  model: fake
+template:
+  chat: "{{.Input}}"
+  chat_message: "{{.RoleName}}: {{.Content}}"
+`), 0600))
+
+	llm := &fakeEndless{started: make(chan struct{}, 1), stopped: make(chan struct{}, 1)}
+	grpc.Provide("fake-endless", llm)
+	cl := config.NewBackendConfigLoader(modelPath)
+	assert.NoError(t, cl.LoadBackendConfigsFromPath(modelPath))
+	ml := model.NewModelLoader(modelPath)
+	appConfig := config.NewApplicationConfig(config.WithContext(context.Background()), config.WithExternalBackend("fake-endless", "fake-endless"))
+	evaluator := templates.NewEvaluator(modelPath)
+	cs := services.NewCollectionsService(ml, ml, cl, appConfig)
+
+	// The connections are watched on a real listener only
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Post("/chat/completions", ChatEndpoint(cl, ml, evaluator, cs, kvstore.NewMemoryStore(), appConfig))
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go app.Listener(ln)
+	t.Cleanup(func() { app.ShutdownWithTimeout(time.Second) })
+
+	waitFor := func(t *testing.T, c chan struct{}, what string) {
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("the backend %s", what)
+		}
+	}
+
+	// Each request can only start once the previous one released the lock of the backend
+	t.Run("Request", func(t *testing.T) {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		assert.NoError(t, err)
+		body := `{"model": "fake", "messages": [{"role": "user", "content": "Hi"}]}`
+		fmt.Fprintf(conn, "POST /chat/completions HTTP/1.1\r\nHost: localhost\r\nContent-Type: application/json\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+		waitFor(t, llm.started, "didn't start")
+		conn.Close()
+		waitFor(t, llm.stopped, "didn't stop when the client disconnected")
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		body := `{"model": "fake", "messages": [{"role": "user", "content": "Hi"}], "stream": true}`
+		resp, err := http.Post("http://"+ln.Addr().String()+"/chat/completions", "application/json", strings.NewReader(body))
+		assert.NoError(t, err)
+		waitFor(t, llm.started, "didn't start")
+		line, err := bufio.NewReader(resp.Body).ReadString('\n')
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(line, "data: "), line)
+		resp.Body.Close()
+		waitFor(t, llm.stopped, "didn't stop when the client disconnected")
+	})
+}
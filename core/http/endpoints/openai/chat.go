@@ -12,13 +12,18 @@ import (
 	"github.com/google/uuid"
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/functions/grammars"
+	"github.com/mudler/LocalAI/pkg/kvstore"
 	"github.com/mudler/LocalAI/pkg/templates"
 
 	model "github.com/mudler/LocalAI/pkg/model"
 	"github.com/rs/zerolog/log"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ChatEndpoint is the OpenAI Completion API endpoint https://platform.openai.com/docs/api-reference/chat/create
@@ -26,7 +31,7 @@ import (
 // @Param request body schema.OpenAIRequest true "query params"
 // @Success 200 {object} schema.OpenAIResponse "Response"
 // @Router /v1/chat/completions [post]
-func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, startupOptions *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, collections *services.CollectionsService, store kvstore.Store, startupOptions *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	var id, textContentToReturn string
 	var created int
 
@@ -40,18 +45,18 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		}
 		responses <- initialMessage
 
-		ComputeChoices(req, s, config, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage) bool {
+		ComputeChoices(req, s, config, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage, logprobs []schema.LogprobContent) bool {
+			choice := schema.Choice{Delta: &schema.Message{Content: &s}, Index: 0}
+			if config.Logprobs && len(logprobs) > 0 {
+				choice.Logprobs = &schema.Logprobs{Content: logprobs}
+			}
 			resp := schema.OpenAIResponse{
 				ID:      id,
 				Created: created,
 				Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
-				Choices: []schema.Choice{{Delta: &schema.Message{Content: &s}, Index: 0}},
+				Choices: []schema.Choice{choice},
 				Object:  "chat.completion.chunk",
-				Usage: schema.OpenAIUsage{
-					PromptTokens:     usage.Prompt,
-					CompletionTokens: usage.Completion,
-					TotalTokens:      usage.Prompt + usage.Completion,
-				},
+				Usage:   openAIUsage(usage),
 			}
 
 			responses <- resp
@@ -61,10 +66,46 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 	}
 	processTools := func(noAction string, prompt string, req *schema.OpenAIRequest, config *config.BackendConfig, loader *model.ModelLoader, responses chan schema.OpenAIResponse) {
 		result := ""
-		_, tokenUsage, _ := ComputeChoices(req, prompt, config, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage) bool {
+		// The function calls are streamed as they are generated, unless the result has to be processed before
+		var stream *functions.FunctionCallStream
+		if config.FunctionsConfig.CanStreamFunctionCalls() {
+			stream = functions.NewFunctionCallStream(config.FunctionsConfig, noAction)
+		}
+		// Each call has its own ID, sent with its first delta
+		callIDs := map[int]string{}
+		_, tokenUsage, _ := ComputeChoices(req, prompt, config, startupOptions, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage, _ []schema.LogprobContent) bool {
 			result += s
-			// TODO: Change generated BNF grammar to be compliant with the schema so we can
-			// stream the result token by token here.
+			if stream == nil {
+				return true
+			}
+			for _, delta := range stream.Write(s) {
+				toolCall := schema.ToolCall{
+					Index: delta.Index,
+					FunctionCall: schema.FunctionCall{
+						Name:      delta.Name,
+						Arguments: delta.Arguments,
+					},
+				}
+				if delta.Name != "" {
+					if _, ok := callIDs[delta.Index]; !ok {
+						callIDs[delta.Index] = kvstore.NewID("call_")
+					}
+					toolCall.ID = callIDs[delta.Index]
+					toolCall.Type = "function"
+				}
+				responses <- schema.OpenAIResponse{
+					ID:      id,
+					Created: created,
+					Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
+					Choices: []schema.Choice{{
+						Delta: &schema.Message{
+							Role:      "assistant",
+							ToolCalls: []schema.ToolCall{toolCall},
+						}}},
+					Object: "chat.completion.chunk",
+					Usage:  openAIUsage(usage),
+				}
+			}
 			return true
 		})
 
@@ -75,6 +116,8 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		noActionToRun := len(functionResults) > 0 && functionResults[0].Name == noAction || len(functionResults) == 0
 
 		switch {
+		case stream != nil && stream.Calls() > 0:
+			// The function calls were already streamed
 		case noActionToRun:
 			initialMessage := schema.OpenAIResponse{
 				ID:      id,
@@ -97,11 +140,7 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
 				Choices: []schema.Choice{{Delta: &schema.Message{Content: &result}, Index: 0}},
 				Object:  "chat.completion.chunk",
-				Usage: schema.OpenAIUsage{
-					PromptTokens:     tokenUsage.Prompt,
-					CompletionTokens: tokenUsage.Completion,
-					TotalTokens:      tokenUsage.Prompt + tokenUsage.Completion,
-				},
+				Usage:   openAIUsage(tokenUsage),
 			}
 
 			responses <- resp
@@ -174,13 +213,30 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		// The request is cancelled once replied, the streamed replies cancel it once sent
+		cancel, streamed := input.Cancel, false
+		defer func() {
+			if !streamed {
+				cancel()
+			}
+		}()
 
 		config, input, err := mergeRequestWithConfig(modelFile, input, cl, ml, startupOptions.Debug, startupOptions.Threads, startupOptions.ContextSize, startupOptions.F16)
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		if err := backend.CheckLogprobs(*config, startupOptions); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 		log.Debug().Msgf("Configuration read: %+v", config)
 
+		if input.AssistantID != "" {
+			input.Messages, err = applyAssistant(c.Context(), collections, store, startupOptions, input.AssistantID, input.Messages)
+			if err != nil {
+				return fmt.Errorf("failed applying assistant: %w", err)
+			}
+		}
+
 		funcs := input.Functions
 		shouldUseFn := len(input.Functions) > 0 && config.ShouldUseFunctions()
 		strictMode := false
@@ -216,23 +272,25 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 			}
 			if d.Type == "json_object" {
 				input.Grammar = functions.JSONBNF
-			} else if d.Type == "json_schema" {
-				d := schema.JsonSchemaRequest{}
-				dat, err := json.Marshal(config.ResponseFormatMap)
-				if err != nil {
-					return err
-				}
-				err = json.Unmarshal(dat, &d)
-				if err != nil {
-					return err
-				}
-				fs := &functions.JSONFunctionStructure{
-					AnyOf: []functions.Item{d.JsonSchema.Schema},
-				}
-				g, err := fs.Grammar(config.FunctionsConfig.GrammarOptions()...)
-				if err == nil {
-					input.Grammar = g
-				}
+			}
+		}
+
+		jsonSchema, err := responseJSONSchema(config)
+		if err != nil {
+			return err
+		}
+		if jsonSchema != nil && jsonSchema.Strict && input.Stream && !shouldUseFn {
+			// The streamed tokens can't be taken back if the reply doesn't match the schema
+			return fiber.NewError(fiber.StatusBadRequest, "a strict json_schema response format can't be streamed, its reply is validated once complete")
+		}
+		if jsonSchema != nil {
+			span := startSpan(input.Context, "grammar.generate", attribute.String("model", config.Name), attribute.String("grammar.source", "response_format"))
+			g, err := grammars.NewJSONSchemaConverter(config.FunctionsConfig.GrammarConfig.PropOrder).Grammar(jsonSchema.Schema)
+			endSpan(span, err)
+			if err == nil {
+				input.Grammar = g
+			} else {
+				log.Debug().Err(err).Msg("cannot convert the JSON schema of the response format to a grammar")
 			}
 		}
 
@@ -240,6 +298,10 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 
 		if shouldUseFn {
 			log.Debug().Msgf("Response needs to process functions")
+
+			if config.ShouldCallSpecificFunction() && len(funcs.Select(config.FunctionToCall())) == 0 {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("the function %s of tool_choice is not in the tools of the request", config.FunctionToCall()))
+			}
 		}
 
 		switch {
@@ -256,24 +318,26 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				},
 			}
 
-			// Append the no action function
-			if !config.FunctionsConfig.DisableNoAction {
-				funcs = append(funcs, noActionGrammar)
-			}
-
-			// Force picking one of the functions by the request
-			if config.FunctionToCall() != "" {
-				funcs = funcs.Select(config.FunctionToCall())
+			// Append the no action function, unless the request requires to call functions, and force picking the
+			// function of the request if any
+			noAction := &noActionGrammar
+			if config.FunctionsConfig.DisableNoAction {
+				noAction = nil
 			}
+			funcs = config.ToolChoice().Functions(funcs, noAction)
 
 			// Update input grammar
-			jsStruct := funcs.ToJSONStructure(config.FunctionsConfig.FunctionNameKey, config.FunctionsConfig.FunctionNameKey)
+			jsStruct := funcs.ToJSONStructure(config.FunctionsConfig.FunctionNameKey, config.FunctionsConfig.FunctionArgumentsKey)
+			span := startSpan(input.Context, "grammar.generate", attribute.String("model", config.Name), attribute.String("grammar.source", "functions"))
 			g, err := jsStruct.Grammar(config.FunctionsConfig.GrammarOptions()...)
+			endSpan(span, err)
 			if err == nil {
 				config.Grammar = g
 			}
 		case input.JSONFunctionGrammarObject != nil:
+			span := startSpan(input.Context, "grammar.generate", attribute.String("model", config.Name), attribute.String("grammar.source", "grammar_json_functions"))
 			g, err := input.JSONFunctionGrammarObject.Grammar(config.FunctionsConfig.GrammarOptions()...)
+			endSpan(span, err)
 			if err == nil {
 				config.Grammar = g
 			}
@@ -296,7 +360,9 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		// If we are using the tokenizer template, we don't need to process the messages
 		// unless we are processing functions
 		if !config.TemplateConfig.UseTokenizerTemplate || shouldUseFn {
+			span := startSpan(input.Context, "template.evaluate", attribute.String("model", config.Name))
 			predInput = evaluator.TemplateMessages(input.Messages, config, funcs, shouldUseFn)
+			span.End()
 
 			log.Debug().Msgf("Prompt (after templating): %s", predInput)
 			if config.Grammar != "" {
@@ -306,6 +372,10 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 
 		switch {
 		case toStream:
+			// The status can't be changed once the response is streamed, reject the request now if the model is busy
+			if err := backend.CheckQueue(*config); err != nil {
+				return err
+			}
 
 			log.Debug().Msgf("Stream request received")
 			c.Context().SetContentType("text/event-stream")
@@ -324,10 +394,15 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				go processTools(noActionName, predInput, input, config, ml, responses)
 			}
 
+			streamed = true
+			endSpan := fiberContext.StreamSpan(c)
 			c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+				defer endSpan()
+				defer cancel()
 				usage := &schema.OpenAIUsage{}
 				toolsCalled := false
 				for ev := range responses {
+					ev.Model = responseModel(input, config)
 					usage = &ev.Usage // Copy a pointer to the latest usage chunk so that the stop message can reference it
 					if len(ev.Choices[0].Delta.ToolCalls) > 0 {
 						toolsCalled = true
@@ -337,11 +412,17 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 					enc.Encode(ev)
 					log.Debug().Msgf("Sending chunk: %s", buf.String())
 					_, err := fmt.Fprintf(w, "data: %v\n", buf.String())
+					if err == nil {
+						err = w.Flush()
+					}
 					if err != nil {
 						log.Debug().Msgf("Sending chunk failed: %v", err)
-						input.Cancel()
+						cancel()
+						// The client is gone, discard the replies generated until the inference stops
+						for range responses {
+						}
+						return
 					}
-					w.Flush()
 				}
 
 				finishReason := "stop"
@@ -354,7 +435,7 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				resp := &schema.OpenAIResponse{
 					ID:      id,
 					Created: created,
-					Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+					Model:   responseModel(input, config),
 					Choices: []schema.Choice{
 						{
 							FinishReason: finishReason,
@@ -450,17 +531,19 @@ func ChatEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 				return err
 			}
 
+			if jsonSchema != nil && !shouldUseFn {
+				if err := enforceJSONSchema(jsonSchema, input, config, evaluator, startupOptions, ml, result, &tokenUsage); err != nil {
+					return err
+				}
+			}
+
 			resp := &schema.OpenAIResponse{
 				ID:      id,
 				Created: created,
-				Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+				Model:   servedModel(c, input, config),
 				Choices: result,
 				Object:  "chat.completion",
-				Usage: schema.OpenAIUsage{
-					PromptTokens:     tokenUsage.Prompt,
-					CompletionTokens: tokenUsage.Completion,
-					TotalTokens:      tokenUsage.Prompt + tokenUsage.Completion,
-				},
+				Usage:   openAIUsage(tokenUsage),
 			}
 			respData, _ := json.Marshal(resp)
 			log.Debug().Msgf("Response: %s", respData)
@@ -531,5 +614,6 @@ func handleQuestion(config *config.BackendConfig, input *schema.OpenAIRequest, m
 		log.Error().Err(err).Msg("prediction failed")
 		return "", err
 	}
+	recordUsage(input.Context, config, prediction.Usage)
 	return backend.Finetune(*config, prompt, prediction.Response), nil
 }
@@ -0,0 +1,79 @@
+package openai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeToolCalls is an embedded backend which calls two functions
+type fakeToolCalls struct {
+	fakePlain
+}
+
+func (f *fakeToolCalls) PredictStream(opts *pb.PredictOptions, results chan string) error {
+	defer close(results)
+	for _, token := range strings.SplitAfter(`[{"name": "get_weather", "arguments": {"city": "Rome"}}, {"name": "get_weather", "arguments": {"city": "Paris"}}]`, " ") {
+		results <- token
+	}
+	return nil
+}
+
+func TestChatStreamToolCalls(t *testing.T) {
+	modelPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "tools.yaml"), []byte(`name: tools
+backend: fake-tool-calls
+parameters:
+  model: tools
+template:
+  chat: "{{.Input}}"
+  chat_message: "{{.RoleName}}: {{.Content}}"
+`), 0600))
+
+	grpc.Provide("fake-tool-calls", &fakeToolCalls{})
+	cl := config.NewBackendConfigLoader(modelPath)
+	assert.NoError(t, cl.LoadBackendConfigsFromPath(modelPath))
+	ml := model.NewModelLoader(modelPath)
+	appConfig := config.NewApplicationConfig(config.WithContext(context.Background()), config.WithExternalBackend("fake-tool-calls", "fake-tool-calls"))
+	cs := services.NewCollectionsService(ml, ml, cl, appConfig)
+
+	app := fiber.New()
+	app.Post("/chat/completions", ChatEndpoint(cl, ml, templates.NewEvaluator(modelPath), cs, kvstore.NewMemoryStore(), appConfig))
+
+	choices := streamChoices(t, app, "/chat/completions", map[string]any{
+		"model":    "tools",
+		"messages": []map[string]any{{"role": "user", "content": "Weather in Rome and Paris?"}},
+		"tools": []map[string]any{{"type": "function", "function": map[string]any{
+			"name":       "get_weather",
+			"parameters": map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}},
+		}}},
+		"stream": true,
+	})
+
+	// Each call has its own ID, in its first delta only
+	ids := map[int]string{}
+	for _, choice := range choices {
+		for _, call := range choice.Delta.ToolCalls {
+			if call.ID == "" {
+				continue
+			}
+			assert.NotContains(t, ids, call.Index)
+			assert.True(t, strings.HasPrefix(call.ID, "call_"), call.ID)
+			ids[call.Index] = call.ID
+		}
+	}
+	assert.Len(t, ids, 2)
+	assert.NotEqual(t, ids[0], ids[1])
+}
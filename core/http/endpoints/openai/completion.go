@@ -10,6 +10,7 @@ import (
 
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -19,6 +20,7 @@ import (
 	"github.com/mudler/LocalAI/pkg/templates"
 	"github.com/rs/zerolog/log"
 	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // CompletionEndpoint is the OpenAI Completion API endpoint https://platform.openai.com/docs/api-reference/completions
@@ -31,23 +33,23 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 	created := int(time.Now().Unix())
 
 	process := func(s string, req *schema.OpenAIRequest, config *config.BackendConfig, loader *model.ModelLoader, responses chan schema.OpenAIResponse) {
-		ComputeChoices(req, s, config, appConfig, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage) bool {
+		textOffset := 0
+		ComputeChoices(req, s, config, appConfig, loader, func(s string, c *[]schema.Choice) {}, func(s string, usage backend.TokenUsage, logprobs []schema.LogprobContent) bool {
+			choice := schema.Choice{
+				Index: 0,
+				Text:  s,
+			}
+			if config.Logprobs && len(logprobs) > 0 {
+				choice.Logprobs = completionLogprobs(logprobs, textOffset)
+			}
+			textOffset += len(s)
 			resp := schema.OpenAIResponse{
 				ID:      id,
 				Created: created,
 				Model:   req.Model, // we have to return what the user sent here, due to OpenAI spec.
-				Choices: []schema.Choice{
-					{
-						Index: 0,
-						Text:  s,
-					},
-				},
-				Object: "text_completion",
-				Usage: schema.OpenAIUsage{
-					PromptTokens:     usage.Prompt,
-					CompletionTokens: usage.Completion,
-					TotalTokens:      usage.Prompt + usage.Completion,
-				},
+				Choices: []schema.Choice{choice},
+				Object:  "text_completion",
+				Usage:   openAIUsage(usage),
 			}
 			log.Debug().Msgf("Sending goroutine: %s", s)
 
@@ -64,6 +66,13 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		// The request is cancelled once replied, the streamed replies cancel it once sent
+		cancel, streamed := input.Cancel, false
+		defer func() {
+			if !streamed {
+				cancel()
+			}
+		}()
 
 		log.Debug().Msgf("`input`: %+v", input)
 
@@ -71,6 +80,9 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		if err := backend.CheckLogprobs(*config, appConfig); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 
 		if config.ResponseFormatMap != nil {
 			d := schema.ChatCompletionResponseFormat{}
@@ -86,6 +98,11 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 		log.Debug().Msgf("Parameter Config: %+v", config)
 
 		if input.Stream {
+			// The status can't be changed once the response is streamed, reject the request now if the model is busy
+			if err := backend.CheckQueue(*config); err != nil {
+				return err
+			}
+
 			log.Debug().Msgf("Stream request received")
 			c.Context().SetContentType("text/event-stream")
 			//c.Response().Header.SetContentType(fiber.MIMETextHTMLCharsetUTF8)
@@ -102,10 +119,12 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 
 			predInput := config.PromptStrings[0]
 
+			span := startSpan(input.Context, "template.evaluate", attribute.String("model", config.Name))
 			templatedInput, err := evaluator.EvaluateTemplateForPrompt(templates.CompletionPromptTemplate, *config, templates.PromptTemplateData{
 				Input:        predInput,
 				SystemPrompt: config.SystemPrompt,
 			})
+			span.End()
 			if err == nil {
 				predInput = templatedInput
 				log.Debug().Msgf("Template found, input modified to: %s", predInput)
@@ -115,22 +134,36 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 
 			go process(predInput, input, config, ml, responses)
 
+			streamed = true
+			endSpan := fiberContext.StreamSpan(c)
 			c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
-
+				defer endSpan()
+				defer cancel()
 				for ev := range responses {
+					ev.Model = responseModel(input, config)
 					var buf bytes.Buffer
 					enc := json.NewEncoder(&buf)
 					enc.Encode(ev)
 
 					log.Debug().Msgf("Sending chunk: %s", buf.String())
-					fmt.Fprintf(w, "data: %v\n", buf.String())
-					w.Flush()
+					_, err := fmt.Fprintf(w, "data: %v\n", buf.String())
+					if err == nil {
+						err = w.Flush()
+					}
+					if err != nil {
+						log.Debug().Msgf("Sending chunk failed: %v", err)
+						cancel()
+						// The client is gone, discard the replies generated until the inference stops
+						for range responses {
+						}
+						return
+					}
 				}
 
 				resp := &schema.OpenAIResponse{
 					ID:      id,
 					Created: created,
-					Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+					Model:   responseModel(input, config),
 					Choices: []schema.Choice{
 						{
 							Index:        0,
@@ -153,10 +186,12 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 		totalTokenUsage := backend.TokenUsage{}
 
 		for k, i := range config.PromptStrings {
+			span := startSpan(input.Context, "template.evaluate", attribute.String("model", config.Name))
 			templatedInput, err := evaluator.EvaluateTemplateForPrompt(templates.CompletionPromptTemplate, *config, templates.PromptTemplateData{
 				SystemPrompt: config.SystemPrompt,
 				Input:        i,
 			})
+			span.End()
 			if err == nil {
 				i = templatedInput
 				log.Debug().Msgf("Template found, input modified to: %s", i)
@@ -169,9 +204,15 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 			if err != nil {
 				return err
 			}
+			for j := range r {
+				if r[j].Logprobs != nil {
+					r[j].Logprobs = completionLogprobs(r[j].Logprobs.Content, 0)
+				}
+			}
 
 			totalTokenUsage.Prompt += tokenUsage.Prompt
 			totalTokenUsage.Completion += tokenUsage.Completion
+			totalTokenUsage.CachedPrompt += tokenUsage.CachedPrompt
 
 			result = append(result, r...)
 		}
@@ -179,14 +220,10 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 		resp := &schema.OpenAIResponse{
 			ID:      id,
 			Created: created,
-			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Model:   servedModel(c, input, config),
 			Choices: result,
 			Object:  "text_completion",
-			Usage: schema.OpenAIUsage{
-				PromptTokens:     totalTokenUsage.Prompt,
-				CompletionTokens: totalTokenUsage.Completion,
-				TotalTokens:      totalTokenUsage.Prompt + totalTokenUsage.Completion,
-			},
+			Usage:   openAIUsage(totalTokenUsage),
 		}
 
 		jsonResult, _ := json.Marshal(resp)
@@ -196,3 +233,26 @@ func CompletionEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, e
 		return c.JSON(resp)
 	}
 }
+
+// completionLogprobs converts the log probabilities of the tokens to the format of the completions, with the offsets
+// of the tokens in the text starting at offset
+func completionLogprobs(content []schema.LogprobContent, offset int) *schema.Logprobs {
+	logprobs := &schema.Logprobs{
+		Tokens:        []string{},
+		TokenLogprobs: []float64{},
+		TopLogprobs:   []map[string]float64{},
+		TextOffset:    []int{},
+	}
+	for _, c := range content {
+		top := map[string]float64{}
+		for _, t := range c.TopLogprobs {
+			top[t.Token] = t.Logprob
+		}
+		logprobs.Tokens = append(logprobs.Tokens, c.Token)
+		logprobs.TokenLogprobs = append(logprobs.TokenLogprobs, c.Logprob)
+		logprobs.TopLogprobs = append(logprobs.TopLogprobs, top)
+		logprobs.TextOffset = append(logprobs.TextOffset, offset)
+		offset += len(c.Token)
+	}
+	return logprobs
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/mudler/LocalAI/pkg/templates"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // EditEndpoint is the OpenAI edit API endpoint
@@ -29,6 +30,7 @@ func EditEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		defer input.Cancel()
 
 		config, input, err := mergeRequestWithConfig(modelFile, input, cl, ml, appConfig.Debug, appConfig.Threads, appConfig.ContextSize, appConfig.F16)
 		if err != nil {
@@ -41,11 +43,13 @@ func EditEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		totalTokenUsage := backend.TokenUsage{}
 
 		for _, i := range config.InputStrings {
+			span := startSpan(input.Context, "template.evaluate", attribute.String("model", config.Name))
 			templatedInput, err := evaluator.EvaluateTemplateForPrompt(templates.EditPromptTemplate, *config, templates.PromptTemplateData{
 				Input:        i,
 				Instruction:  input.Instruction,
 				SystemPrompt: config.SystemPrompt,
 			})
+			span.End()
 			if err == nil {
 				i = templatedInput
 				log.Debug().Msgf("Template found, input modified to: %s", i)
@@ -60,6 +64,7 @@ func EditEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 
 			totalTokenUsage.Prompt += tokenUsage.Prompt
 			totalTokenUsage.Completion += tokenUsage.Completion
+			totalTokenUsage.CachedPrompt += tokenUsage.CachedPrompt
 
 			result = append(result, r...)
 		}
@@ -69,14 +74,10 @@ func EditEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluat
 		resp := &schema.OpenAIResponse{
 			ID:      id,
 			Created: created,
-			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Model:   servedModel(c, input, config),
 			Choices: result,
 			Object:  "edit",
-			Usage: schema.OpenAIUsage{
-				PromptTokens:     totalTokenUsage.Prompt,
-				CompletionTokens: totalTokenUsage.Completion,
-				TotalTokens:      totalTokenUsage.Prompt + totalTokenUsage.Completion,
-			},
+			Usage:   openAIUsage(totalTokenUsage),
 		}
 
 		jsonResult, _ := json.Marshal(resp)
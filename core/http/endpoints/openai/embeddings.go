@@ -27,6 +27,7 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		defer input.Cancel()
 
 		config, input, err := mergeRequestWithConfig(model, input, cl, ml, appConfig.Debug, appConfig.Threads, appConfig.ContextSize, appConfig.F16)
 		if err != nil {
@@ -38,7 +39,7 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 
 		for i, s := range config.InputToken {
 			// get the model function to call for the result
-			embedFn, err := backend.ModelEmbedding("", s, ml, *config, appConfig)
+			embedFn, err := backend.ModelEmbedding(input.Context, "", s, ml, *config, appConfig)
 			if err != nil {
 				return err
 			}
@@ -52,7 +53,7 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 
 		for i, s := range config.InputStrings {
 			// get the model function to call for the result
-			embedFn, err := backend.ModelEmbedding(s, []int{}, ml, *config, appConfig)
+			embedFn, err := backend.ModelEmbedding(input.Context, s, []int{}, ml, *config, appConfig)
 			if err != nil {
 				return err
 			}
@@ -69,7 +70,7 @@ func EmbeddingsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 		resp := &schema.OpenAIResponse{
 			ID:      id,
 			Created: created,
-			Model:   input.Model, // we have to return what the user sent here, due to OpenAI spec.
+			Model:   servedModel(c, input, config),
 			Data:    items,
 			Object:  "list",
 		}
@@ -5,23 +5,24 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-	"sync/atomic"
 	"time"
 
 	"github.com/microcosm-cc/bluemonday"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/kvstore"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/mudler/LocalAI/pkg/utils"
 )
 
-var UploadedFiles []schema.File
-
+// The uploaded files used to be saved in this file of the UploadDir, it is migrated to the metadata store
 const UploadedFilesFile = "uploadedFiles.json"
 
+const filesBucket = "files"
+
 // UploadFilesEndpoint https://platform.openai.com/docs/api-reference/files/create
-func UploadFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func UploadFilesEndpoint(cm *config.BackendConfigLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		file, err := c.FormFile("file")
 		if err != nil {
@@ -54,7 +55,7 @@ func UploadFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.Appli
 		}
 
 		f := schema.File{
-			ID:        fmt.Sprintf("file-%d", getNextFileId()),
+			ID:        kvstore.NewID("file-"),
 			Object:    "file",
 			Bytes:     int(file.Size),
 			CreatedAt: time.Now(),
@@ -62,65 +63,78 @@ func UploadFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.Appli
 			Purpose:   purpose,
 		}
 
-		UploadedFiles = append(UploadedFiles, f)
-		utils.SaveConfig(appConfig.UploadDir, UploadedFilesFile, UploadedFiles)
+		err = store.Update(func(tx kvstore.Tx) error {
+			return kvstore.Put(tx, filesBucket, f.ID, f)
+		})
+		if err != nil {
+			return err
+		}
+
 		return c.Status(fiber.StatusOK).JSON(f)
 	}
 }
 
-var currentFileId int64 = 0
-
-func getNextFileId() int64 {
-	atomic.AddInt64(&currentId, 1)
-	return currentId
-}
-
 // ListFilesEndpoint https://platform.openai.com/docs/api-reference/files/list
 // @Summary List files.
 // @Success 200 {object} schema.ListFiles "Response"
 // @Router /v1/files [get]
-func ListFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func ListFilesEndpoint(cm *config.BackendConfigLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 
 	return func(c *fiber.Ctx) error {
 		var listFiles schema.ListFiles
 
 		purpose := c.Query("purpose")
-		if purpose == "" {
-			listFiles.Data = UploadedFiles
-		} else {
-			for _, f := range UploadedFiles {
-				if purpose == f.Purpose {
-					listFiles.Data = append(listFiles.Data, f)
-				}
-			}
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			listFiles.Data, _, err = kvstore.ListFunc(tx, filesBucket, kvstore.ListOptions{}, func(f schema.File) bool {
+				return purpose == "" || purpose == f.Purpose
+			})
+			return
+		})
+		if err != nil {
+			return err
 		}
 		listFiles.Object = "list"
 		return c.Status(fiber.StatusOK).JSON(listFiles)
 	}
 }
 
-func getFileFromRequest(c *fiber.Ctx) (*schema.File, error) {
+func getUploadedFile(tx kvstore.Tx, id string) (schema.File, error) {
+	return kvstore.Get[schema.File](tx, filesBucket, id)
+}
+
+// uploadedFilePath returns the path of the content of an uploaded file, which is saved under its sanitized name
+func uploadedFilePath(appConfig *config.ApplicationConfig, f schema.File) string {
+	return filepath.Join(appConfig.UploadDir, utils.SanitizeFileName(f.Filename))
+}
+
+func getFileFromRequest(c *fiber.Ctx, store kvstore.Store) (*schema.File, error) {
 	id := c.Params("file_id")
 	if id == "" {
 		return nil, fmt.Errorf("file_id parameter is required")
 	}
 
-	for _, f := range UploadedFiles {
-		if id == f.ID {
-			return &f, nil
-		}
+	var f schema.File
+	err := store.View(func(tx kvstore.Tx) (err error) {
+		f, err = getUploadedFile(tx, id)
+		return
+	})
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return nil, fmt.Errorf("unable to find file id %s", id)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return nil, fmt.Errorf("unable to find file id %s", id)
+	return &f, nil
 }
 
 // GetFilesEndpoint is the OpenAI API endpoint to get files https://platform.openai.com/docs/api-reference/files/retrieve
 // @Summary Returns information about a specific file.
 // @Success 200 {object} schema.File "Response"
 // @Router /v1/files/{file_id} [get]
-func GetFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func GetFilesEndpoint(cm *config.BackendConfigLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
-		file, err := getFileFromRequest(c)
+		file, err := getFileFromRequest(c, store)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).SendString(bluemonday.StrictPolicy().Sanitize(err.Error()))
 		}
@@ -139,15 +153,15 @@ type DeleteStatus struct {
 // @Summary Delete a file.
 // @Success 200 {object} DeleteStatus "Response"
 // @Router /v1/files/{file_id} [delete]
-func DeleteFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func DeleteFilesEndpoint(cm *config.BackendConfigLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 
 	return func(c *fiber.Ctx) error {
-		file, err := getFileFromRequest(c)
+		file, err := getFileFromRequest(c, store)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).SendString(bluemonday.StrictPolicy().Sanitize(err.Error()))
 		}
 
-		err = os.Remove(filepath.Join(appConfig.UploadDir, file.Filename))
+		err = os.Remove(uploadedFilePath(appConfig, *file))
 		if err != nil {
 			// If the file doesn't exist then we should just continue to remove it
 			if !errors.Is(err, os.ErrNotExist) {
@@ -156,14 +170,17 @@ func DeleteFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.Appli
 		}
 
 		// Remove upload from list
-		for i, f := range UploadedFiles {
-			if f.ID == file.ID {
-				UploadedFiles = append(UploadedFiles[:i], UploadedFiles[i+1:]...)
-				break
+		err = store.Update(func(tx kvstore.Tx) error {
+			err := tx.Delete(filesBucket, file.ID)
+			if errors.Is(err, kvstore.ErrNotFound) {
+				return nil
 			}
+			return err
+		})
+		if err != nil {
+			return err
 		}
 
-		utils.SaveConfig(appConfig.UploadDir, UploadedFilesFile, UploadedFiles)
 		return c.JSON(DeleteStatus{
 			Id:      file.ID,
 			Object:  "file",
@@ -177,14 +194,14 @@ func DeleteFilesEndpoint(cm *config.BackendConfigLoader, appConfig *config.Appli
 // @Success	200		{string}	binary				"file"
 // @Router /v1/files/{file_id}/content [get]
 // GetFilesContentsEndpoint
-func GetFilesContentsEndpoint(cm *config.BackendConfigLoader, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+func GetFilesContentsEndpoint(cm *config.BackendConfigLoader, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
-		file, err := getFileFromRequest(c)
+		file, err := getFileFromRequest(c, store)
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).SendString(bluemonday.StrictPolicy().Sanitize(err.Error()))
 		}
 
-		fileContents, err := os.ReadFile(filepath.Join(appConfig.UploadDir, file.Filename))
+		fileContents, err := os.ReadFile(uploadedFilePath(appConfig, *file))
 		if err != nil {
 			return c.Status(fiber.StatusInternalServerError).SendString(bluemonday.StrictPolicy().Sanitize(err.Error()))
 		}
@@ -39,11 +39,11 @@ func startUpApp() (app *fiber.App, option *config.ApplicationConfig, loader *con
 	})
 
 	// Create a Test Server
-	app.Post("/files", UploadFilesEndpoint(loader, option))
-	app.Get("/files", ListFilesEndpoint(loader, option))
-	app.Get("/files/:file_id", GetFilesEndpoint(loader, option))
-	app.Delete("/files/:file_id", DeleteFilesEndpoint(loader, option))
-	app.Get("/files/:file_id/content", GetFilesContentsEndpoint(loader, option))
+	app.Post("/files", UploadFilesEndpoint(loader, testStore, option))
+	app.Get("/files", ListFilesEndpoint(loader, testStore, option))
+	app.Get("/files/:file_id", GetFilesEndpoint(loader, testStore, option))
+	app.Delete("/files/:file_id", DeleteFilesEndpoint(loader, testStore, option))
+	app.Get("/files/:file_id/content", GetFilesContentsEndpoint(loader, testStore, option))
 
 	return
 }
@@ -64,11 +64,11 @@ func TestUploadFileExceedSizeLimit(t *testing.T) {
 	})
 
 	// Create a Test Server
-	app.Post("/files", UploadFilesEndpoint(loader, option))
-	app.Get("/files", ListFilesEndpoint(loader, option))
-	app.Get("/files/:file_id", GetFilesEndpoint(loader, option))
-	app.Delete("/files/:file_id", DeleteFilesEndpoint(loader, option))
-	app.Get("/files/:file_id/content", GetFilesContentsEndpoint(loader, option))
+	app.Post("/files", UploadFilesEndpoint(loader, testStore, option))
+	app.Get("/files", ListFilesEndpoint(loader, testStore, option))
+	app.Get("/files/:file_id", GetFilesEndpoint(loader, testStore, option))
+	app.Delete("/files/:file_id", DeleteFilesEndpoint(loader, testStore, option))
+	app.Get("/files/:file_id/content", GetFilesContentsEndpoint(loader, testStore, option))
 
 	t.Run("UploadFilesEndpoint file size exceeds limit", func(t *testing.T) {
 		t.Cleanup(tearDown())
@@ -121,8 +121,8 @@ func TestUploadFileExceedSizeLimit(t *testing.T) {
 		assert.Equal(t, 200, resp.StatusCode)
 
 		listFiles := responseToListFile(t, resp)
-		if len(listFiles.Data) != len(UploadedFiles) {
-			t.Errorf("Expected %v files, got %v files", len(UploadedFiles), len(listFiles.Data))
+		if len(listFiles.Data) != countKeys(filesBucket) {
+			t.Errorf("Expected %v files, got %v files", countKeys(filesBucket), len(listFiles.Data))
 		}
 	})
 	t.Run("ListFilesEndpoint with valid purpose parameter", func(t *testing.T) {
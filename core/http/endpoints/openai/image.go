@@ -15,7 +15,9 @@ import (
 
 	"github.com/google/uuid"
 	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
 
 	"github.com/mudler/LocalAI/core/backend"
 
@@ -70,6 +72,7 @@ func ImageEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appCon
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		defer input.Cancel()
 
 		if m == "" {
 			m = model.StableDiffusionBackend
@@ -204,7 +207,7 @@ func ImageEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appCon
 
 				baseURL := c.BaseURL()
 
-				fn, err := backend.ImageGeneration(height, width, mode, step, *config.Seed, positive_prompt, negative_prompt, src, output, ml, *config, appConfig)
+				fn, err := backend.ImageGeneration(input.Context, height, width, mode, step, *config.Seed, positive_prompt, negative_prompt, src, output, ml, *config, appConfig)
 				if err != nil {
 					return err
 				}
@@ -237,6 +240,8 @@ func ImageEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, appCon
 			Created: created,
 			Data:    result,
 		}
+		servedModel(c, input, config)
+		fiberContext.RecordUsage(input.Context, usageModel(input.Context, config), services.Usage{Images: len(result)})
 
 		jsonResult, _ := json.Marshal(resp)
 		log.Debug().Msgf("Response: %s", jsonResult)
@@ -1,11 +1,23 @@
 package openai
 
 import (
+	"context"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/services"
 
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/functions/grammars"
+	"github.com/mudler/LocalAI/pkg/kvstore"
 	model "github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 func ComputeChoices(
@@ -15,7 +27,7 @@ func ComputeChoices(
 	o *config.ApplicationConfig,
 	loader *model.ModelLoader,
 	cb func(string, *[]schema.Choice),
-	tokenCallback func(string, backend.TokenUsage) bool) ([]schema.Choice, backend.TokenUsage, error) {
+	tokenCallback func(string, backend.TokenUsage, []schema.LogprobContent) bool) ([]schema.Choice, backend.TokenUsage, error) {
 	n := req.N // number of completions to return
 	result := []schema.Choice{}
 
@@ -46,18 +58,176 @@ func ComputeChoices(
 
 	for i := 0; i < n; i++ {
 		prediction, err := predFunc()
+		if errors.Is(err, backend.ErrLogprobsUnsupported) {
+			return result, backend.TokenUsage{}, fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 		if err != nil {
 			return result, backend.TokenUsage{}, err
 		}
 
 		tokenUsage.Prompt += prediction.Usage.Prompt
 		tokenUsage.Completion += prediction.Usage.Completion
+		tokenUsage.CachedPrompt += prediction.Usage.CachedPrompt
 
 		finetunedResponse := backend.Finetune(*config, predInput, prediction.Response)
+		choices := len(result)
 		cb(finetunedResponse, &result)
+		if config.Logprobs {
+			for j := choices; j < len(result); j++ {
+				result[j].Logprobs = &schema.Logprobs{Content: prediction.Logprobs}
+			}
+		}
 
 		//result = append(result, Choice{Text: prediction})
 
 	}
+	recordUsage(req.Context, config, tokenUsage)
 	return result, tokenUsage, err
 }
+
+// inferReply computes the reply of the model of input to its messages, or the functions it wants to call. If onToken
+// is not nil, it receives the tokens of the reply as they are generated, unless the model can call functions.
+func inferReply(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, appConfig *config.ApplicationConfig, input *schema.OpenAIRequest, onToken func(string)) (string, []schema.ToolCall, backend.TokenUsage, error) {
+	modelFile, err := cl.ResolveModelAlias(input.Model)
+	if err != nil {
+		return "", nil, backend.TokenUsage{}, err
+	}
+
+	cfg, input, err := mergeRequestWithConfig(modelFile, input, cl, ml, appConfig.Debug, appConfig.Threads, appConfig.ContextSize, appConfig.F16)
+	if err != nil {
+		return "", nil, backend.TokenUsage{}, err
+	}
+
+	funcs := input.Functions
+	shouldUseFn := len(input.Functions) > 0 && cfg.ShouldUseFunctions()
+
+	noActionName := "answer"
+	noActionDescription := "use this action to answer without performing any action"
+	if cfg.FunctionsConfig.NoActionFunctionName != "" {
+		noActionName = cfg.FunctionsConfig.NoActionFunctionName
+	}
+	if cfg.FunctionsConfig.NoActionDescriptionName != "" {
+		noActionDescription = cfg.FunctionsConfig.NoActionDescriptionName
+	}
+
+	cfg.Grammar = ""
+	if shouldUseFn && !cfg.FunctionsConfig.GrammarConfig.NoGrammar {
+		var noAction *functions.Function
+		if !cfg.FunctionsConfig.DisableNoAction {
+			noAction = &functions.Function{
+				Name:        noActionName,
+				Description: noActionDescription,
+				Parameters: map[string]interface{}{
+					"properties": map[string]interface{}{
+						"message": map[string]interface{}{
+							"type":        "string",
+							"description": "The message to reply the user with",
+						}},
+				},
+			}
+		}
+		funcs = cfg.ToolChoice().Functions(funcs, noAction)
+
+		jsStruct := funcs.ToJSONStructure(cfg.FunctionsConfig.FunctionNameKey, cfg.FunctionsConfig.FunctionArgumentsKey)
+		span := startSpan(input.Context, "grammar.generate", attribute.String("model", cfg.Name), attribute.String("grammar.source", "functions"))
+		g, err := jsStruct.Grammar(cfg.FunctionsConfig.GrammarOptions()...)
+		endSpan(span, err)
+		if err == nil {
+			cfg.Grammar = g
+		}
+	}
+
+	if !shouldUseFn {
+		if cfg.ResponseFormatMap != nil && cfg.ResponseFormatMap["type"] == "json_object" {
+			cfg.Grammar = functions.JSONBNF
+		}
+		jsonSchema, err := responseJSONSchema(cfg)
+		if err != nil {
+			return "", nil, backend.TokenUsage{}, err
+		}
+		if jsonSchema != nil {
+			span := startSpan(input.Context, "grammar.generate", attribute.String("model", cfg.Name), attribute.String("grammar.source", "response_format"))
+			g, err := grammars.NewJSONSchemaConverter(cfg.FunctionsConfig.GrammarConfig.PropOrder).Grammar(jsonSchema.Schema)
+			endSpan(span, err)
+			if err == nil {
+				cfg.Grammar = g
+			}
+		}
+	}
+
+	var predInput string
+	if !cfg.TemplateConfig.UseTokenizerTemplate || shouldUseFn {
+		span := startSpan(input.Context, "template.evaluate", attribute.String("model", cfg.Name))
+		predInput = evaluator.TemplateMessages(input.Messages, cfg, funcs, shouldUseFn)
+		span.End()
+		log.Debug().Msgf("Prompt (after templating): %s", predInput)
+	}
+
+	var tokenCallback func(string, backend.TokenUsage, []schema.LogprobContent) bool
+	if onToken != nil && !shouldUseFn {
+		tokenCallback = func(s string, _ backend.TokenUsage, _ []schema.LogprobContent) bool {
+			onToken(s)
+			return true
+		}
+	}
+
+	var reply string
+	var toolCalls []schema.ToolCall
+	var replyErr error
+	_, usage, err := ComputeChoices(input, predInput, cfg, appConfig, ml, func(s string, c *[]schema.Choice) {
+		if !shouldUseFn {
+			reply = s
+			return
+		}
+
+		s = functions.CleanupLLMResult(s, cfg.FunctionsConfig)
+		results := functions.ParseFunctionCall(s, cfg.FunctionsConfig)
+		if len(results) == 0 || results[0].Name == noActionName {
+			reply, replyErr = handleQuestion(cfg, input, ml, appConfig, results, s, predInput)
+			return
+		}
+
+		for i, r := range results {
+			toolCalls = append(toolCalls, schema.ToolCall{
+				Index: i,
+				ID:    kvstore.NewID("call_"),
+				Type:  "function",
+				FunctionCall: schema.FunctionCall{
+					Name:      r.Name,
+					Arguments: r.Arguments,
+				},
+			})
+		}
+	}, tokenCallback)
+	if err != nil {
+		return "", nil, usage, err
+	}
+
+	return reply, toolCalls, usage, replyErr
+}
+
+// openAIUsage returns the usage of the tokens of a reply, with the tokens of the prompt reused from the cache
+func openAIUsage(usage backend.TokenUsage) schema.OpenAIUsage {
+	u := schema.OpenAIUsage{
+		PromptTokens:     usage.Prompt,
+		CompletionTokens: usage.Completion,
+		TotalTokens:      usage.Prompt + usage.Completion,
+	}
+	if usage.CachedPrompt > 0 {
+		u.PromptTokensDetails = &schema.PromptTokensDetails{CachedTokens: usage.CachedPrompt}
+	}
+	return u
+}
+
+// usageModel returns the model in which the usage of the request of ctx is recorded, the model which served it
+func usageModel(ctx context.Context, config *config.BackendConfig) string {
+	if served := backend.ServedModel(ctx); served != "" {
+		return served
+	}
+	return config.Name
+}
+
+// recordUsage records the tokens of a reply in the usage of the request of ctx
+func recordUsage(ctx context.Context, config *config.BackendConfig, usage backend.TokenUsage) {
+	fiberContext.RecordUsage(ctx, usageModel(ctx, config), services.Usage{PromptTokens: usage.Prompt, CompletionTokens: usage.Completion})
+}
@@ -0,0 +1,52 @@
+package openai
+
+import (
+	"context"
+	"sync"
+)
+
+type jobHandle struct {
+	cancel context.CancelFunc
+}
+
+// jobs tracks the runs and batches executing in the background in this process, by ID, so that they can be cancelled
+type jobs struct {
+	sync.Mutex
+	handles map[string]*jobHandle
+}
+
+var backgroundJobs = &jobs{handles: map[string]*jobHandle{}}
+
+// start executes fn in a goroutine, with a context which is cancelled by cancel(id) or when parent is done
+func (j *jobs) start(parent context.Context, id string, fn func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(parent)
+	h := &jobHandle{cancel: cancel}
+
+	j.Lock()
+	j.handles[id] = h
+	j.Unlock()
+
+	go func() {
+		defer func() {
+			cancel()
+			j.Lock()
+			// The job may have been started again already, e.g. a run resumed by a new submission of tool outputs
+			if j.handles[id] == h {
+				delete(j.handles, id)
+			}
+			j.Unlock()
+		}()
+
+		fn(ctx)
+	}()
+}
+
+// cancel stops the job, if it is executing
+func (j *jobs) cancel(id string) {
+	j.Lock()
+	defer j.Unlock()
+
+	if h, exists := j.handles[id]; exists {
+		h.cancel()
+	}
+}
@@ -0,0 +1,214 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/base"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePlain is an embedded backend which replies "Hello world", without the log probabilities of its tokens
+type fakePlain struct {
+	base.SingleThread
+}
+
+func (f *fakePlain) Load(opts *pb.ModelOptions) error {
+	return nil
+}
+
+func (f *fakePlain) Predict(opts *pb.PredictOptions) (string, error) {
+	return "Hello world", nil
+}
+
+func (f *fakePlain) PredictStream(opts *pb.PredictOptions, results chan string) error {
+	defer close(results)
+	results <- "Hello"
+	results <- " world"
+	return nil
+}
+
+// fakeLogprobs is an embedded backend which replies "Hello world" with the log probabilities of its two tokens
+type fakeLogprobs struct {
+	fakePlain
+}
+
+func (f *fakeLogprobs) replies(opts *pb.PredictOptions) []*pb.Reply {
+	var replies []*pb.Reply
+	for _, token := range []*pb.Logprob{
+		{Token: "Hello", Logprob: -0.25, TopLogprobs: []*pb.TokenLogprob{{Token: "Hello", Logprob: -0.25}, {Token: "Hi", Logprob: -1.5}}},
+		{Token: " world", Logprob: -0.5, TopLogprobs: []*pb.TokenLogprob{{Token: " world", Logprob: -0.5}, {Token: " there", Logprob: -2}}},
+	} {
+		token.TopLogprobs = token.TopLogprobs[:opts.TopLogprobs]
+		replies = append(replies, &pb.Reply{Message: []byte(token.Token), Logprobs: []*pb.Logprob{token}})
+	}
+	return replies
+}
+
+func (f *fakeLogprobs) PredictLogprobs(opts *pb.PredictOptions) (*pb.Reply, error) {
+	reply := &pb.Reply{}
+	for _, r := range f.replies(opts) {
+		reply.Message = append(reply.Message, r.Message...)
+		reply.Logprobs = append(reply.Logprobs, r.Logprobs...)
+	}
+	return reply, nil
+}
+
+func (f *fakeLogprobs) PredictStreamLogprobs(opts *pb.PredictOptions, results chan *pb.Reply) error {
+	defer close(results)
+	for _, r := range f.replies(opts) {
+		results <- r
+	}
+	return nil
+}
+
+// streamChoices returns the choices of the chunks of a streamed response
+func streamChoices(t *testing.T, app *fiber.App, url string, body any) []schema.Choice {
+	data, err := json.Marshal(body)
+	assert.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, url, strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	var choices []schema.Choice
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line, found := strings.CutPrefix(scanner.Text(), "data: ")
+		if !found || line == "[DONE]" {
+			continue
+		}
+		var chunk schema.OpenAIResponse
+		assert.NoError(t, json.Unmarshal([]byte(line), &chunk))
+		choices = append(choices, chunk.Choices...)
+	}
+	return choices
+}
+
+func TestLogprobs(t *testing.T) {
+	modelPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "fake.yaml"), []byte(`name: fake
+backend: fake-logprobs
+parameters:
+  model: fake
+template:
+  chat: "{{.Input}}"
+  chat_message: "{{.RoleName}}: {{.Content}}"
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "plain.yaml"), []byte(`name: plain
+backend: fake-plain
+parameters:
+  model: plain
+template:
+  chat: "{{.Input}}"
+  chat_message: "{{.RoleName}}: {{.Content}}"
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "ggml.yaml"), []byte(`name: ggml
+backend: llama-ggml
+parameters:
+  model: ggml
+`), 0600))
+
+	grpc.Provide("fake-logprobs", &fakeLogprobs{})
+	grpc.Provide("fake-plain", &fakePlain{})
+	cl := config.NewBackendConfigLoader(modelPath)
+	assert.NoError(t, cl.LoadBackendConfigsFromPath(modelPath))
+	ml := model.NewModelLoader(modelPath)
+	appConfig := config.NewApplicationConfig(config.WithContext(context.Background()), config.WithExternalBackend("fake-logprobs", "fake-logprobs"), config.WithExternalBackend("fake-plain", "fake-plain"))
+	evaluator := templates.NewEvaluator(modelPath)
+	store := kvstore.NewMemoryStore()
+	cs := services.NewCollectionsService(ml, ml, cl, appConfig)
+
+	app := fiber.New()
+	app.Post("/chat/completions", ChatEndpoint(cl, ml, evaluator, cs, store, appConfig))
+	app.Post("/completions", CompletionEndpoint(cl, ml, evaluator, appConfig))
+
+	messages := []map[string]any{{"role": "user", "content": "Hi"}}
+	expected := []schema.LogprobContent{
+		{Token: "Hello", Logprob: -0.25, Bytes: []int{72, 101, 108, 108, 111}, TopLogprobs: []schema.TopLogprob{{Token: "Hello", Logprob: -0.25, Bytes: []int{72, 101, 108, 108, 111}}}},
+		{Token: " world", Logprob: -0.5, Bytes: []int{32, 119, 111, 114, 108, 100}, TopLogprobs: []schema.TopLogprob{{Token: " world", Logprob: -0.5, Bytes: []int{32, 119, 111, 114, 108, 100}}}},
+	}
+
+	t.Run("Chat", func(t *testing.T) {
+		var resp schema.OpenAIResponse
+		status := doJSON(t, app, http.MethodPost, "/chat/completions", map[string]any{"model": "fake", "messages": messages, "logprobs": true, "top_logprobs": 1}, &resp)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, &schema.Logprobs{Content: expected}, resp.Choices[0].Logprobs)
+
+		resp = schema.OpenAIResponse{}
+		status = doJSON(t, app, http.MethodPost, "/chat/completions", map[string]any{"model": "fake", "messages": messages}, &resp)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Nil(t, resp.Choices[0].Logprobs)
+	})
+
+	t.Run("ChatStream", func(t *testing.T) {
+		var logprobs []schema.LogprobContent
+		for _, choice := range streamChoices(t, app, "/chat/completions", map[string]any{"model": "fake", "messages": messages, "logprobs": true, "top_logprobs": 1, "stream": true}) {
+			if choice.Logprobs != nil {
+				logprobs = append(logprobs, choice.Logprobs.Content...)
+			}
+		}
+		assert.Equal(t, expected, logprobs)
+	})
+
+	t.Run("Completion", func(t *testing.T) {
+		var resp schema.OpenAIResponse
+		status := doJSON(t, app, http.MethodPost, "/completions", map[string]any{"model": "fake", "prompt": "Hi", "logprobs": 2}, &resp)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, &schema.Logprobs{
+			Tokens:        []string{"Hello", " world"},
+			TokenLogprobs: []float64{-0.25, -0.5},
+			TopLogprobs:   []map[string]float64{{"Hello": -0.25, "Hi": -1.5}, {" world": -0.5, " there": -2}},
+			TextOffset:    []int{0, 5},
+		}, resp.Choices[0].Logprobs)
+	})
+
+	t.Run("CompletionStream", func(t *testing.T) {
+		var offsets []int
+		for _, choice := range streamChoices(t, app, "/completions", map[string]any{"model": "fake", "prompt": "Hi", "logprobs": 0, "stream": true}) {
+			if choice.Logprobs != nil {
+				assert.Equal(t, []map[string]float64{{}}, choice.Logprobs.TopLogprobs)
+				offsets = append(offsets, choice.Logprobs.TextOffset...)
+			}
+		}
+		assert.Equal(t, []int{0, 5}, offsets)
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		for _, request := range []map[string]any{
+			{"model": "fake", "messages": messages, "top_logprobs": 1},
+			{"model": "fake", "messages": messages, "logprobs": true, "top_logprobs": 21},
+		} {
+			assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/chat/completions", request, nil), "%+v", request)
+		}
+	})
+	// The backends which can't return the log probabilities are rejected before the inference, or once they reply
+	// when they are not known
+	t.Run("UnsupportedBackends", func(t *testing.T) {
+		for _, request := range []map[string]any{
+			{"model": "ggml", "messages": messages, "logprobs": true},
+			{"model": "plain", "messages": messages, "logprobs": true},
+		} {
+			assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/chat/completions", request, nil), "%+v", request)
+		}
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/completions", map[string]any{"model": "ggml", "prompt": "Hi", "logprobs": 1}, nil))
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/chat/completions", map[string]any{"model": "plain", "messages": messages}, nil))
+	})
+}
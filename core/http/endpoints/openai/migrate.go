@@ -0,0 +1,124 @@
+package openai
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// The threads, their messages and runs used to be saved in these files of the ConfigsDir
+const (
+	legacyThreadsConfigFile        = "threads.json"
+	legacyThreadMessagesConfigFile = "threadMessages.json"
+	legacyRunsConfigFile           = "runs.json"
+)
+
+// loadLegacyConfig decodes a JSON file written by previous versions, it returns false if there is none
+func loadLegacyConfig(dir, file string, v any) (bool, error) {
+	if dir == "" {
+		return false, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, json.Unmarshal(data, v)
+}
+
+// MigrateLegacyConfig imports the assistants, files and threads saved as JSON files by previous versions
+// in the metadata store. The files are renamed with a .migrated suffix once imported, so this is a no-op
+// when there is nothing left to migrate.
+func MigrateLegacyConfig(store kvstore.Store, appConfig *config.ApplicationConfig) error {
+	var assistants []Assistant
+	var assistantFiles []AssistantFile
+	var files []schema.File
+	var threads []Thread
+	var messages []ThreadMessage
+	var runs []Run
+
+	legacy := []struct {
+		dir, file string
+		v         any
+	}{
+		{appConfig.ConfigsDir, AssistantsConfigFile, &assistants},
+		{appConfig.ConfigsDir, AssistantsFileConfigFile, &assistantFiles},
+		{appConfig.UploadDir, UploadedFilesFile, &files},
+		{appConfig.ConfigsDir, legacyThreadsConfigFile, &threads},
+		{appConfig.ConfigsDir, legacyThreadMessagesConfigFile, &messages},
+		{appConfig.ConfigsDir, legacyRunsConfigFile, &runs},
+	}
+
+	migrated := []string{}
+	for _, l := range legacy {
+		found, err := loadLegacyConfig(l.dir, l.file, l.v)
+		if err != nil {
+			return fmt.Errorf("unable to read %s: %w", l.file, err)
+		}
+		if found {
+			migrated = append(migrated, filepath.Join(l.dir, l.file))
+		}
+	}
+
+	if len(migrated) == 0 {
+		return nil
+	}
+
+	// The objects keep their IDs, as they may be referenced by clients
+	err := store.Update(func(tx kvstore.Tx) error {
+		for _, a := range assistants {
+			if err := kvstore.Put(tx, assistantsBucket, a.ID, a); err != nil {
+				return err
+			}
+		}
+		for _, f := range assistantFiles {
+			if err := kvstore.Put(tx, assistantFilesBucket(f.AssistantID), f.ID, f); err != nil {
+				return err
+			}
+		}
+		for _, f := range files {
+			if err := kvstore.Put(tx, filesBucket, f.ID, f); err != nil {
+				return err
+			}
+		}
+		for _, t := range threads {
+			if err := kvstore.Put(tx, threadsBucket, t.ID, t); err != nil {
+				return err
+			}
+		}
+		for _, m := range messages {
+			if err := kvstore.Put(tx, messagesBucket(m.ThreadID), m.ID, m); err != nil {
+				return err
+			}
+		}
+		for _, r := range runs {
+			if err := kvstore.Put(tx, runsBucket(r.ThreadID), r.ID, r); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, path := range migrated {
+		log.Info().Msgf("Migrated %s to the metadata store", path)
+		if err := os.Rename(path, path+".migrated"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,45 @@
+package openai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateLegacyConfig(t *testing.T) {
+	appConfig := &config.ApplicationConfig{ConfigsDir: t.TempDir(), UploadDir: t.TempDir()}
+	store := kvstore.NewMemoryStore()
+
+	legacy := map[string]string{
+		filepath.Join(appConfig.ConfigsDir, AssistantsConfigFile):     `[{"id":"asst_1","model":"m"},{"id":"asst_2","model":"m"}]`,
+		filepath.Join(appConfig.ConfigsDir, AssistantsFileConfigFile): `[{"id":"file-1","assistant_id":"asst_2"}]`,
+		filepath.Join(appConfig.UploadDir, UploadedFilesFile):         `[{"id":"file-1","filename":"a.txt","purpose":"assistants"}]`,
+	}
+	for path, content := range legacy {
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+
+	assert.NoError(t, MigrateLegacyConfig(store, appConfig))
+
+	assert.Equal(t, []string{"asst_1", "asst_2"}, bucketKeys(store, assistantsBucket))
+	assert.Equal(t, []string{"file-1"}, bucketKeys(store, assistantFilesBucket("asst_2")))
+	assert.NoError(t, store.View(func(tx kvstore.Tx) error {
+		f, err := kvstore.Get[schema.File](tx, filesBucket, "file-1")
+		assert.Equal(t, "a.txt", f.Filename)
+		return err
+	}))
+
+	for path := range legacy {
+		assert.NoFileExists(t, path)
+		assert.FileExists(t, path+".migrated")
+	}
+
+	// There is nothing left to migrate
+	assert.NoError(t, MigrateLegacyConfig(store, appConfig))
+	assert.Len(t, bucketKeys(store, assistantsBucket), 2)
+}
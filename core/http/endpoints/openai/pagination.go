@@ -0,0 +1,63 @@
+package openai
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+)
+
+// ListResponse is the cursor based list object returned by the Assistants API
+type ListResponse[T any] struct {
+	Object  string `json:"object"`
+	Data    []T    `json:"data"`
+	FirstID string `json:"first_id,omitempty"`
+	LastID  string `json:"last_id,omitempty"`
+	HasMore bool   `json:"has_more"`
+}
+
+// listOptions reads the limit, order, after and before query parameters of the list endpoints
+func listOptions(c *fiber.Ctx) (kvstore.ListOptions, error) {
+	limitQuery := c.Query("limit", "20")
+	limit, err := strconv.Atoi(limitQuery)
+	if err != nil || limit < 1 || limit > 100 {
+		return kvstore.ListOptions{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid limit query value: %s", limitQuery))
+	}
+
+	orderQuery := c.Query("order", "desc")
+	if orderQuery != "asc" && orderQuery != "desc" {
+		return kvstore.ListOptions{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("Invalid order query value: %s", orderQuery))
+	}
+
+	return kvstore.ListOptions{
+		Limit:      limit,
+		After:      c.Query("after"),
+		Before:     c.Query("before"),
+		Descending: orderQuery == "desc",
+	}, nil
+}
+
+// listObjects replies with a page of the objects of the bucket for which keep returns true, or all of them if keep is nil
+func listObjects[T any](c *fiber.Ctx, store kvstore.Store, bucket string, id func(T) string, keep func(T) bool) error {
+	opts, err := listOptions(c)
+	if err != nil {
+		return err
+	}
+
+	resp := ListResponse[T]{Object: "list"}
+	err = store.View(func(tx kvstore.Tx) (err error) {
+		resp.Data, resp.HasMore, err = kvstore.ListFunc(tx, bucket, opts, keep)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.Data) > 0 {
+		resp.FirstID = id(resp.Data[0])
+		resp.LastID = id(resp.Data[len(resp.Data)-1])
+	}
+
+	return c.JSON(resp)
+}
@@ -4,23 +4,25 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"slices"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
 	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/concurrency"
 	"github.com/mudler/LocalAI/pkg/functions"
 	"github.com/mudler/LocalAI/pkg/model"
 	"github.com/mudler/LocalAI/pkg/templates"
 	"github.com/mudler/LocalAI/pkg/utils"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-type correlationIDKeyType string
-
 // CorrelationIDKey to track request across process boundary
-const CorrelationIDKey correlationIDKeyType = "correlationID"
+const CorrelationIDKey = backend.CorrelationIDKey
 
 func readRequest(c *fiber.Ctx, cl *config.BackendConfigLoader, ml *model.ModelLoader, o *config.ApplicationConfig, firstModel bool) (string, *schema.OpenAIRequest, error) {
 	input := new(schema.OpenAIRequest)
@@ -34,20 +36,52 @@ func readRequest(c *fiber.Ctx, cl *config.BackendConfigLoader, ml *model.ModelLo
 	// Extract or generate the correlation ID
 	correlationID := c.Get("X-Correlation-ID", uuid.New().String())
 
-	ctx, cancel := context.WithCancel(o.Context)
-	// Add the correlation ID to the new context
-	ctxWithCorrelationID := context.WithValue(ctx, CorrelationIDKey, correlationID)
+	ctx, cancel := context.WithCancel(fiberContext.WithTrace(o.Context, c))
+	// Add the correlation ID to the new context, and to the trace propagated to the backends
+	ctxWithCorrelationID := withCorrelationID(ctx, correlationID)
 
-	input.Context = ctxWithCorrelationID
-	input.Cancel = cancel
+	priority, err := fiberContext.PriorityFromContext(c, o)
+	if err != nil {
+		cancel()
+		return "", nil, err
+	}
+
+	// The request is cancelled when the client disconnects. The endpoints cancel it once replied, which stops
+	// watching the connection.
+	stopWatching := fiberContext.WatchConnection(c.Context().Conn(), cancel)
+	input.Context = backend.WithServedModel(concurrency.WithPriority(fiberContext.WithUsage(ctxWithCorrelationID, fiberContext.UsageFromContext(c)), priority))
+	input.Cancel = func() {
+		stopWatching()
+		cancel()
+	}
 
 	log.Debug().Msgf("Request received: %s", string(received))
 
 	modelFile, err := fiberContext.ModelFromContext(c, cl, ml, input.Model, firstModel)
+	if err != nil {
+		input.Cancel()
+	}
 
 	return modelFile, input, err
 }
 
+// servedModel sets the header with the model which served the request, and returns the model of the response
+func servedModel(c *fiber.Ctx, input *schema.OpenAIRequest, config *config.BackendConfig) string {
+	if served := backend.ServedModel(input.Context); served != "" {
+		c.Set(fiberContext.ServedModelHeader, served)
+	}
+	return responseModel(input, config)
+}
+
+// responseModel returns the model of the response: the requested model, or the fallback model which served the
+// request when the model failed
+func responseModel(input *schema.OpenAIRequest, config *config.BackendConfig) string {
+	if served := backend.ServedModel(input.Context); served != "" && served != config.Name {
+		return served
+	}
+	return input.Model
+}
+
 func updateRequestConfig(config *config.BackendConfig, input *schema.OpenAIRequest) {
 	if input.Echo {
 		config.Echo = input.Echo
@@ -131,21 +165,6 @@ func updateRequestConfig(config *config.BackendConfig, input *schema.OpenAIReque
 		}
 	}
 
-	if input.ToolsChoice != nil {
-		var toolChoice functions.Tool
-
-		switch content := input.ToolsChoice.(type) {
-		case string:
-			_ = json.Unmarshal([]byte(content), &toolChoice)
-		case map[string]interface{}:
-			dat, _ := json.Marshal(content)
-			_ = json.Unmarshal(dat, &toolChoice)
-		}
-		input.FunctionCall = map[string]interface{}{
-			"name": toolChoice.Function.Name,
-		}
-	}
-
 	// Decode each request's message content
 	imgIndex, vidIndex, audioIndex := 0, 0, 0
 	for i, m := range input.Messages {
@@ -268,24 +287,21 @@ func updateRequestConfig(config *config.BackendConfig, input *schema.OpenAIReque
 		}
 	}
 
-	// Can be either a string or an object
-	switch fnc := input.FunctionCall.(type) {
-	case string:
-		if fnc != "" {
-			config.SetFunctionCallString(fnc)
-		}
-	case map[string]interface{}:
-		var name string
-		n, exists := fnc["name"]
-		if exists {
-			nn, e := n.(string)
-			if e {
-				name = nn
-			}
+	if input.Logprobs.Enabled {
+		config.Logprobs = true
+		config.TopLogprobs = input.Logprobs.Top
+		if input.TopLogprobs != nil {
+			config.TopLogprobs = *input.TopLogprobs
 		}
-		config.SetFunctionCallNameString(name)
 	}
 
+	// tool_choice supersedes the legacy function_call, both can be either a string or an object
+	toolChoice := input.FunctionCall
+	if input.ToolsChoice != nil {
+		toolChoice = input.ToolsChoice
+	}
+	config.SetToolChoice(functions.ParseToolChoice(toolChoice))
+
 	switch p := input.Prompt.(type) {
 	case string:
 		config.PromptStrings = append(config.PromptStrings, p)
@@ -298,7 +314,32 @@ func updateRequestConfig(config *config.BackendConfig, input *schema.OpenAIReque
 	}
 }
 
+// maxTopLogprobs is the maximum number of the most likely tokens returned at each position
+const maxTopLogprobs = 20
+
+// validateLogprobs rejects the numbers of top log probabilities out of range, or requested without the log
+// probabilities
+func validateLogprobs(input *schema.OpenAIRequest) error {
+	top := input.Logprobs.Top
+	if input.TopLogprobs != nil {
+		if !input.Logprobs.Enabled {
+			return fiber.NewError(fiber.StatusBadRequest, "top_logprobs requires logprobs to be enabled")
+		}
+		top = *input.TopLogprobs
+	}
+	if top < 0 || top > maxTopLogprobs {
+		return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("the number of top log probabilities must be between 0 and %d", maxTopLogprobs))
+	}
+	return nil
+}
+
 func mergeRequestWithConfig(modelFile string, input *schema.OpenAIRequest, cm *config.BackendConfigLoader, loader *model.ModelLoader, debug bool, threads, ctx int, f16 bool) (*config.BackendConfig, *schema.OpenAIRequest, error) {
+	if err := validateLogprobs(input); err != nil {
+		return nil, nil, err
+	}
+
+	span := startSpan(input.Context, "config.merge", attribute.String("model", modelFile))
+
 	cfg, err := cm.LoadBackendConfigFileByName(modelFile, loader.ModelPath,
 		config.LoadOptionDebug(debug),
 		config.LoadOptionThreads(threads),
@@ -308,10 +349,22 @@ func mergeRequestWithConfig(modelFile string, input *schema.OpenAIRequest, cm *c
 
 	// Set the parameters for the language model prediction
 	updateRequestConfig(cfg, input)
+	// The fallback models serve the request with its parameters too. They are set from a copy of the request, whose
+	// messages were decoded.
+	for i := range cfg.FallbackConfigs {
+		fallbackInput := *input
+		fallbackInput.Messages = slices.Clone(input.Messages)
+		fallbackInput.Functions = slices.Clone(input.Functions)
+		fallbackInput.Tools = nil
+		updateRequestConfig(&cfg.FallbackConfigs[i], &fallbackInput)
+	}
 
 	if !cfg.Validate() {
-		return nil, nil, fmt.Errorf("failed to validate config")
+		err := fmt.Errorf("failed to validate config")
+		endSpan(span, err)
+		return nil, nil, err
 	}
 
+	endSpan(span, err)
 	return cfg, input, err
 }
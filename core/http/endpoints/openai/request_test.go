@@ -0,0 +1,53 @@
+package openai
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeRequestWithFallbackConfigs(t *testing.T) {
+	modelPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "large.yaml"), []byte(`name: large
+parameters:
+  model: large
+  temperature: 0.7
+fallback_models:
+  - small
+`), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "small.yaml"), []byte(`name: small
+parameters:
+  model: small
+  temperature: 0.5
+`), 0600))
+	cl := config.NewBackendConfigLoader(modelPath)
+	assert.NoError(t, cl.LoadBackendConfigsFromPath(modelPath))
+
+	temperature, maxTokens := 0.1, 16
+	input := &schema.OpenAIRequest{
+		PredictionOptions: schema.PredictionOptions{Model: "large", Temperature: &temperature, Maxtokens: &maxTokens},
+		Context:           context.Background(),
+		Stop:              "END",
+		Tools:             []functions.Tool{{Type: "function", Function: functions.Function{Name: "search"}}},
+		Messages:          []schema.Message{{Role: "user", Content: "Hi"}},
+	}
+	cfg, input, err := mergeRequestWithConfig("large", input, cl, model.NewModelLoader(modelPath), false, 1, 512, false)
+	assert.NoError(t, err)
+
+	// The fallback models get the parameters of the request, without decoding it twice
+	assert.Len(t, cfg.FallbackConfigs, 1)
+	fallback := cfg.FallbackConfigs[0]
+	assert.Equal(t, "small", fallback.Name)
+	assert.Equal(t, temperature, *fallback.Temperature)
+	assert.Equal(t, maxTokens, *fallback.Maxtokens)
+	assert.Equal(t, []string{"END"}, fallback.StopWords)
+	assert.Len(t, input.Functions, 1)
+	assert.Equal(t, "Hi", input.Messages[0].StringContent)
+}
@@ -0,0 +1,644 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/concurrency"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	model "github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	ResponseInProgress = "in_progress"
+	ResponseCompleted  = "completed"
+	ResponseFailed     = "failed"
+)
+
+// responsesBucket holds the stored responses, with the conversation which led to them
+const responsesBucket = "responses"
+
+type ResponseRequest struct {
+	Model              string            `json:"model"`
+	Input              interface{}       `json:"input"` // A string, or a list of ResponseInputItem
+	Instructions       string            `json:"instructions,omitempty"`
+	PreviousResponseID string            `json:"previous_response_id,omitempty"`
+	Tools              []ResponseTool    `json:"tools,omitempty"`
+	ToolChoice         interface{}       `json:"tool_choice,omitempty"`
+	Text               *ResponseText     `json:"text,omitempty"`
+	Temperature        *float64          `json:"temperature,omitempty"`
+	TopP               *float64          `json:"top_p,omitempty"`
+	MaxOutputTokens    *int              `json:"max_output_tokens,omitempty"`
+	Stream             bool              `json:"stream,omitempty"`
+	Store              *bool             `json:"store,omitempty"` // Defaults to true
+	Metadata           map[string]string `json:"metadata,omitempty"`
+}
+
+// ResponseTool is a function the model can call, only the tools of type "function" are supported
+type ResponseTool struct {
+	Type        string                 `json:"type"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+	Strict      bool                   `json:"strict,omitempty"`
+}
+
+type ResponseText struct {
+	Format ResponseTextFormat `json:"format"`
+}
+
+// ResponseTextFormat is the format of the text output: "text", "json_object" or "json_schema"
+type ResponseTextFormat struct {
+	Type   string                 `json:"type"`
+	Name   string                 `json:"name,omitempty"`
+	Schema map[string]interface{} `json:"schema,omitempty"`
+	Strict bool                   `json:"strict,omitempty"`
+}
+
+// ResponseInputItem is a message, a function call of the model or the output of a function call
+type ResponseInputItem struct {
+	Type      string      `json:"type"` // "message", which may be omitted, "function_call" or "function_call_output"
+	Role      string      `json:"role,omitempty"`
+	Content   interface{} `json:"content,omitempty"` // A string, or a list of ResponseInputContent
+	CallID    string      `json:"call_id,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Arguments string      `json:"arguments,omitempty"`
+	Output    string      `json:"output,omitempty"`
+}
+
+type ResponseInputContent struct {
+	Type     string `json:"type"` // "input_text", "output_text" or "input_image"
+	Text     string `json:"text,omitempty"`
+	ImageURL string `json:"image_url,omitempty"`
+}
+
+// Response represents the structure of a response object from the OpenAI API.
+type Response struct {
+	ID                 string               `json:"id"`
+	Object             string               `json:"object"` // Always "response"
+	CreatedAt          int64                `json:"created_at"`
+	Status             string               `json:"status"`
+	Error              *ResponseError       `json:"error"` // Set when the status is "failed"
+	Model              string               `json:"model"`
+	Instructions       string               `json:"instructions"`
+	Output             []ResponseOutputItem `json:"output"`
+	PreviousResponseID string               `json:"previous_response_id"`
+	Tools              []ResponseTool       `json:"tools"`
+	ToolChoice         interface{}          `json:"tool_choice"`
+	Text               *ResponseText        `json:"text,omitempty"`
+	Temperature        *float64             `json:"temperature"`
+	TopP               *float64             `json:"top_p"`
+	MaxOutputTokens    *int                 `json:"max_output_tokens"`
+	Store              bool                 `json:"store"`
+	Metadata           map[string]string    `json:"metadata"`
+	Usage              *ResponseUsage       `json:"usage"` // Set when the response is complete
+}
+
+type ResponseError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type ResponseUsage struct {
+	InputTokens        int                        `json:"input_tokens"`
+	InputTokensDetails ResponseInputTokensDetails `json:"input_tokens_details"`
+	OutputTokens       int                        `json:"output_tokens"`
+	TotalTokens        int                        `json:"total_tokens"`
+}
+
+type ResponseInputTokensDetails struct {
+	CachedTokens int `json:"cached_tokens"` // The input tokens reused from the prompt cache of the backend
+}
+
+// ResponseOutputItem is a message of the model, or a function it wants to call
+type ResponseOutputItem struct {
+	Type      string                  `json:"type"` // "message" or "function_call"
+	ID        string                  `json:"id"`
+	Status    string                  `json:"status"`
+	Role      string                  `json:"role,omitempty"`
+	Content   []ResponseOutputContent `json:"content,omitempty"`
+	CallID    string                  `json:"call_id,omitempty"`
+	Name      string                  `json:"name,omitempty"`
+	Arguments *string                 `json:"arguments,omitempty"`
+}
+
+type ResponseOutputContent struct {
+	Type        string `json:"type"` // Always "output_text"
+	Text        string `json:"text"`
+	Annotations []any  `json:"annotations"`
+}
+
+// ResponseEvent is an event of a streamed response, its fields depend on its type
+type ResponseEvent struct {
+	Type           string                 `json:"type"`
+	SequenceNumber int                    `json:"sequence_number"`
+	Response       *Response              `json:"response,omitempty"`
+	OutputIndex    *int                   `json:"output_index,omitempty"`
+	ContentIndex   *int                   `json:"content_index,omitempty"`
+	ItemID         string                 `json:"item_id,omitempty"`
+	Item           *ResponseOutputItem    `json:"item,omitempty"`
+	Part           *ResponseOutputContent `json:"part,omitempty"`
+	Delta          *string                `json:"delta,omitempty"`
+	Text           *string                `json:"text,omitempty"`
+	Arguments      *string                `json:"arguments,omitempty"`
+}
+
+// storedResponse is a response with the conversation up to its output, which the next responses continue
+type storedResponse struct {
+	Response Response         `json:"response"`
+	Messages []schema.Message `json:"messages"`
+}
+
+// getStoredResponse returns the stored response, or a 404 error
+func getStoredResponse(tx kvstore.Tx, id string) (storedResponse, error) {
+	stored, err := kvstore.Get[storedResponse](tx, responsesBucket, id)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return stored, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("response %s not found", id))
+	}
+	return stored, err
+}
+
+// responseMessages converts the input of a request to chat messages. The outputs of the function calls are matched
+// with the calls of the input or of the history, which have the names of the functions.
+func responseMessages(input interface{}, history []schema.Message) ([]schema.Message, error) {
+	var items []ResponseInputItem
+	switch in := input.(type) {
+	case nil:
+		return nil, fiber.NewError(fiber.StatusBadRequest, "input is required")
+	case string:
+		return []schema.Message{{Role: "user", Content: in}}, nil
+	default:
+		dat, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(dat, &items); err != nil {
+			return nil, fiber.NewError(fiber.StatusBadRequest, "input must be a string or a list of input items")
+		}
+	}
+
+	names := map[string]string{}
+	for _, m := range history {
+		for _, tc := range m.ToolCalls {
+			names[tc.ID] = tc.FunctionCall.Name
+		}
+	}
+
+	var messages []schema.Message
+	for _, item := range items {
+		switch item.Type {
+		case "", "message":
+			role := item.Role
+			switch role {
+			case "developer":
+				role = "system"
+			case "user", "assistant", "system":
+			default:
+				return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unsupported message role %q", item.Role))
+			}
+			content, err := responseContent(item.Content)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages, schema.Message{Role: role, Content: content})
+		case "function_call":
+			names[item.CallID] = item.Name
+			call := schema.ToolCall{
+				ID:           item.CallID,
+				Type:         "function",
+				FunctionCall: schema.FunctionCall{Name: item.Name, Arguments: item.Arguments},
+			}
+			// The parallel calls are in the same assistant message
+			if n := len(messages); n > 0 && messages[n-1].Role == "assistant" && len(messages[n-1].ToolCalls) > 0 {
+				call.Index = len(messages[n-1].ToolCalls)
+				messages[n-1].ToolCalls = append(messages[n-1].ToolCalls, call)
+				continue
+			}
+			messages = append(messages, schema.Message{Role: "assistant", ToolCalls: []schema.ToolCall{call}})
+		case "function_call_output":
+			name, exists := names[item.CallID]
+			if !exists {
+				return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("no function call found for the output of %s", item.CallID))
+			}
+			messages = append(messages, schema.Message{Role: "tool", Name: name, Content: item.Output})
+		default:
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unsupported input item type %q", item.Type))
+		}
+	}
+	return messages, nil
+}
+
+// responseContent converts the content of an input message to the content of a chat message: a string, or the text
+// and image_url parts when it has images
+func responseContent(content interface{}) (interface{}, error) {
+	if s, ok := content.(string); ok {
+		return s, nil
+	}
+
+	var parts []ResponseInputContent
+	dat, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dat, &parts); err != nil {
+		return nil, fiber.NewError(fiber.StatusBadRequest, "message content must be a string or a list of content parts")
+	}
+
+	var text strings.Builder
+	chatParts := []interface{}{}
+	hasImages := false
+	for _, p := range parts {
+		switch p.Type {
+		case "input_text", "output_text":
+			text.WriteString(p.Text)
+			chatParts = append(chatParts, map[string]interface{}{"type": "text", "text": p.Text})
+		case "input_image":
+			hasImages = true
+			chatParts = append(chatParts, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": p.ImageURL}})
+		default:
+			return nil, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unsupported content type %q", p.Type))
+		}
+	}
+	if hasImages {
+		return chatParts, nil
+	}
+	return text.String(), nil
+}
+
+// responseFormat converts the text format of a request to the response_format of a chat request
+func responseFormat(text *ResponseText) interface{} {
+	if text == nil {
+		return nil
+	}
+	switch text.Format.Type {
+	case "json_object":
+		return map[string]interface{}{"type": "json_object"}
+	case "json_schema":
+		return map[string]interface{}{
+			"type": "json_schema",
+			"json_schema": map[string]interface{}{
+				"name":   text.Format.Name,
+				"schema": text.Format.Schema,
+				"strict": text.Format.Strict,
+			},
+		}
+	}
+	return nil
+}
+
+// responseEmitter numbers the events of a streamed response and sends them, it drops them if the response is not
+// streamed
+type responseEmitter struct {
+	send     func(ResponseEvent)
+	sequence int
+}
+
+func (e *responseEmitter) emit(event ResponseEvent) {
+	if e.send == nil {
+		return
+	}
+	event.SequenceNumber = e.sequence
+	e.sequence++
+	e.send(event)
+}
+
+// generateResponse runs the model on the messages and sets the output of the response. It returns the messages of
+// the output, which continue the conversation.
+func generateResponse(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, appConfig *config.ApplicationConfig, input *schema.OpenAIRequest, response *Response, e *responseEmitter) []schema.Message {
+	snapshot := func() *Response {
+		r := *response
+		r.Output = slices.Clone(response.Output)
+		return &r
+	}
+	e.emit(ResponseEvent{Type: "response.created", Response: snapshot()})
+	e.emit(ResponseEvent{Type: "response.in_progress", Response: snapshot()})
+
+	// The message is added once the model starts replying
+	messageIndex := -1
+	contentIndex := 0
+	startMessage := func() {
+		if messageIndex >= 0 {
+			return
+		}
+		response.Output = append(response.Output, ResponseOutputItem{
+			Type:    "message",
+			ID:      kvstore.NewID("msg_"),
+			Status:  ResponseInProgress,
+			Role:    "assistant",
+			Content: []ResponseOutputContent{},
+		})
+		messageIndex = len(response.Output) - 1
+		item := response.Output[messageIndex]
+		e.emit(ResponseEvent{Type: "response.output_item.added", OutputIndex: &messageIndex, Item: &item})
+		e.emit(ResponseEvent{Type: "response.content_part.added", OutputIndex: &messageIndex, ContentIndex: &contentIndex, ItemID: item.ID,
+			Part: &ResponseOutputContent{Type: "output_text", Annotations: []any{}}})
+	}
+	streamed := false
+	onToken := func(token string) {
+		startMessage()
+		streamed = true
+		e.emit(ResponseEvent{Type: "response.output_text.delta", OutputIndex: &messageIndex, ContentIndex: &contentIndex,
+			ItemID: response.Output[messageIndex].ID, Delta: &token})
+	}
+
+	reply, toolCalls, usage, err := inferReply(cl, ml, evaluator, appConfig, input, onToken)
+	response.Usage = &ResponseUsage{
+		InputTokens:        usage.Prompt,
+		InputTokensDetails: ResponseInputTokensDetails{CachedTokens: usage.CachedPrompt},
+		OutputTokens:       usage.Completion,
+		TotalTokens:        usage.Prompt + usage.Completion,
+	}
+	if err != nil {
+		log.Error().Err(err).Msgf("Response %s failed", response.ID)
+		response.Status = ResponseFailed
+		response.Error = &ResponseError{Code: "server_error", Message: err.Error()}
+		if messageIndex >= 0 {
+			response.Output[messageIndex].Status = "incomplete"
+		}
+		e.emit(ResponseEvent{Type: "response.failed", Response: snapshot()})
+		return nil
+	}
+
+	var messages []schema.Message
+	if len(toolCalls) == 0 {
+		startMessage()
+		if !streamed && reply != "" {
+			e.emit(ResponseEvent{Type: "response.output_text.delta", OutputIndex: &messageIndex, ContentIndex: &contentIndex,
+				ItemID: response.Output[messageIndex].ID, Delta: &reply})
+		}
+		part := ResponseOutputContent{Type: "output_text", Text: reply, Annotations: []any{}}
+		item := &response.Output[messageIndex]
+		item.Status = ResponseCompleted
+		item.Content = []ResponseOutputContent{part}
+		e.emit(ResponseEvent{Type: "response.output_text.done", OutputIndex: &messageIndex, ContentIndex: &contentIndex, ItemID: item.ID, Text: &reply})
+		e.emit(ResponseEvent{Type: "response.content_part.done", OutputIndex: &messageIndex, ContentIndex: &contentIndex, ItemID: item.ID, Part: &part})
+		done := *item
+		e.emit(ResponseEvent{Type: "response.output_item.done", OutputIndex: &messageIndex, Item: &done})
+		messages = append(messages, schema.Message{Role: "assistant", Content: reply})
+	} else {
+		for _, tc := range toolCalls {
+			arguments := tc.FunctionCall.Arguments
+			empty := ""
+			response.Output = append(response.Output, ResponseOutputItem{
+				Type:      "function_call",
+				ID:        kvstore.NewID("fc_"),
+				Status:    ResponseInProgress,
+				CallID:    tc.ID,
+				Name:      tc.FunctionCall.Name,
+				Arguments: &empty,
+			})
+			index := len(response.Output) - 1
+			item := &response.Output[index]
+			added := *item
+			e.emit(ResponseEvent{Type: "response.output_item.added", OutputIndex: &index, Item: &added})
+			e.emit(ResponseEvent{Type: "response.function_call_arguments.delta", OutputIndex: &index, ItemID: item.ID, Delta: &arguments})
+			e.emit(ResponseEvent{Type: "response.function_call_arguments.done", OutputIndex: &index, ItemID: item.ID, Arguments: &arguments})
+			item.Status = ResponseCompleted
+			item.Arguments = &arguments
+			done := *item
+			e.emit(ResponseEvent{Type: "response.output_item.done", OutputIndex: &index, Item: &done})
+		}
+		messages = append(messages, schema.Message{Role: "assistant", ToolCalls: toolCalls})
+	}
+
+	response.Status = ResponseCompleted
+	e.emit(ResponseEvent{Type: "response.completed", Response: snapshot()})
+	return messages
+}
+
+// CreateResponseEndpoint is the OpenAI Responses API endpoint https://platform.openai.com/docs/api-reference/responses/create
+// @Summary Generate a model response, which may continue a stored response.
+// @Param request body ResponseRequest true "query params"
+// @Success 200 {object} Response "Response"
+// @Router /v1/responses [post]
+func CreateResponseEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(ResponseRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse ResponseRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		if request.Model == "" {
+			return fiber.NewError(fiber.StatusBadRequest, "model is required")
+		}
+		if !modelExists(cl, ml, request.Model) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("model %q not found", request.Model))
+		}
+		fiberContext.SetModel(c, request.Model)
+
+		var history []schema.Message
+		if request.PreviousResponseID != "" {
+			err := store.View(func(tx kvstore.Tx) error {
+				previous, err := getStoredResponse(tx, request.PreviousResponseID)
+				history = previous.Messages
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		messages, err := responseMessages(request.Input, history)
+		if err != nil {
+			return err
+		}
+
+		tools := []functions.Tool{}
+		for _, t := range request.Tools {
+			if t.Type != "function" {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("unsupported tool type %q", t.Type))
+			}
+			if t.Name == "" {
+				return fiber.NewError(fiber.StatusBadRequest, "function tools require a name")
+			}
+			tools = append(tools, functions.Tool{
+				Type:     "function",
+				Function: functions.Function{Name: t.Name, Description: t.Description, Strict: t.Strict, Parameters: t.Parameters},
+			})
+		}
+		toolChoice := functions.ParseToolChoice(request.ToolChoice)
+		if toolChoice.Function != "" && !slices.ContainsFunc(tools, func(t functions.Tool) bool { return t.Function.Name == toolChoice.Function }) {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("the function %s of tool_choice is not in the tools of the request", toolChoice.Function))
+		}
+
+		priority, err := fiberContext.PriorityFromContext(c, appConfig)
+		if err != nil {
+			return err
+		}
+		ctx, cancelCtx := context.WithCancel(fiberContext.WithTrace(appConfig.Context, c))
+		// The response is cancelled when the client disconnects
+		stopWatching := fiberContext.WatchConnection(c.Context().Conn(), cancelCtx)
+		cancel := func() {
+			stopWatching()
+			cancelCtx()
+		}
+
+		conversation := append(slices.Clone(history), messages...)
+		if request.Instructions != "" {
+			// The instructions apply to this response only
+			conversation = append([]schema.Message{{Role: "system", Content: request.Instructions}}, conversation...)
+		}
+		input := &schema.OpenAIRequest{
+			PredictionOptions: schema.PredictionOptions{
+				Model:       request.Model,
+				Temperature: request.Temperature,
+				TopP:        request.TopP,
+				Maxtokens:   request.MaxOutputTokens,
+			},
+			Context:        backend.WithServedModel(concurrency.WithPriority(fiberContext.WithUsage(ctx, fiberContext.UsageFromContext(c)), priority)),
+			Cancel:         cancel,
+			Messages:       conversation,
+			Tools:          tools,
+			ToolsChoice:    request.ToolChoice,
+			ResponseFormat: responseFormat(request.Text),
+		}
+
+		response := Response{
+			ID:                 kvstore.NewID("resp_"),
+			Object:             "response",
+			CreatedAt:          time.Now().Unix(),
+			Status:             ResponseInProgress,
+			Model:              request.Model,
+			Instructions:       request.Instructions,
+			Output:             []ResponseOutputItem{},
+			PreviousResponseID: request.PreviousResponseID,
+			Tools:              request.Tools,
+			ToolChoice:         request.ToolChoice,
+			Text:               request.Text,
+			Temperature:        request.Temperature,
+			TopP:               request.TopP,
+			MaxOutputTokens:    request.MaxOutputTokens,
+			Store:              request.Store == nil || *request.Store,
+			Metadata:           request.Metadata,
+		}
+		if response.Tools == nil {
+			response.Tools = []ResponseTool{}
+		}
+		if response.ToolChoice == nil {
+			response.ToolChoice = functions.ToolChoiceAuto
+		}
+		if response.Metadata == nil {
+			response.Metadata = map[string]string{}
+		}
+
+		// The stored conversation is continued by the next responses, without the instructions
+		finish := func(output []schema.Message) {
+			if !response.Store || response.Status != ResponseCompleted {
+				return
+			}
+			stored := storedResponse{
+				Response: response,
+				Messages: append(append(slices.Clone(history), messages...), output...),
+			}
+			if err := store.Update(func(tx kvstore.Tx) error {
+				return kvstore.Put(tx, responsesBucket, response.ID, stored)
+			}); err != nil {
+				log.Error().Err(err).Msgf("Unable to store response %s", response.ID)
+			}
+		}
+
+		if !request.Stream {
+			defer cancel()
+			output := generateResponse(cl, ml, evaluator, appConfig, input, &response, &responseEmitter{})
+			finish(output)
+			if response.Status == ResponseFailed {
+				return fiber.NewError(fiber.StatusInternalServerError, response.Error.Message)
+			}
+			return c.JSON(response)
+		}
+
+		c.Context().SetContentType("text/event-stream")
+		c.Set("Cache-Control", "no-cache")
+		c.Set("Connection", "keep-alive")
+		c.Set("Transfer-Encoding", "chunked")
+
+		events := make(chan ResponseEvent)
+		go func() {
+			defer close(events)
+			output := generateResponse(cl, ml, evaluator, appConfig, input, &response, &responseEmitter{send: func(event ResponseEvent) {
+				events <- event
+			}})
+			finish(output)
+		}()
+
+		endSpan := fiberContext.StreamSpan(c)
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			defer endSpan()
+			defer cancel()
+			for event := range events {
+				data, err := json.Marshal(event)
+				if err != nil {
+					log.Error().Err(err).Msg("Unable to encode the response event")
+					continue
+				}
+				fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+				if err := w.Flush(); err != nil {
+					log.Debug().Msgf("Sending event failed: %v", err)
+					cancel()
+				}
+			}
+		}))
+		return nil
+	}
+}
+
+// GetResponseEndpoint is the OpenAI Responses API endpoint https://platform.openai.com/docs/api-reference/responses/get
+// @Summary Get a stored response
+// @Success 200 {object} Response "Response"
+// @Router /v1/responses/{response_id} [get]
+func GetResponseEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		var stored storedResponse
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			stored, err = getStoredResponse(tx, c.Params("response_id"))
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(stored.Response)
+	}
+}
+
+// DeleteResponseEndpoint is the OpenAI Responses API endpoint https://platform.openai.com/docs/api-reference/responses/delete
+// @Summary Delete a stored response
+// @Success 200 {object} schema.DeleteResponseResponse "Response"
+// @Router /v1/responses/{response_id} [delete]
+func DeleteResponseEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		id := c.Params("response_id")
+
+		err := store.Update(func(tx kvstore.Tx) error {
+			if _, err := getStoredResponse(tx, id); err != nil {
+				return err
+			}
+			return tx.Delete(responsesBucket, id)
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(schema.DeleteResponseResponse{
+			ID:      id,
+			Object:  "response",
+			Deleted: true,
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package openai
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/base"
+	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeChat is an embedded backend which calls get_weather when the last message asks for the weather, and repeats
+// the prompt otherwise
+type fakeChat struct {
+	base.SingleThread
+}
+
+func (f *fakeChat) Load(opts *pb.ModelOptions) error {
+	return nil
+}
+
+func (f *fakeChat) Predict(opts *pb.PredictOptions) (string, error) {
+	lines := strings.Split(opts.Prompt, "\n")
+	if strings.Contains(lines[len(lines)-1], "weather") {
+		return `{"name": "get_weather", "arguments": {"city": "Rome"}}`, nil
+	}
+	return "echo: " + opts.Prompt, nil
+}
+
+func (f *fakeChat) PredictStream(opts *pb.PredictOptions, results chan string) error {
+	defer close(results)
+	reply, _ := f.Predict(opts)
+	for _, word := range strings.SplitAfter(reply, " ") {
+		results <- word
+	}
+	return nil
+}
+
+func TestResponseEndpoints(t *testing.T) {
+	modelPath := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(modelPath, "fake.yaml"), []byte(`name: fake
+backend: fake-responses
+parameters:
+  model: fake
+template:
+  chat: "{{.Input}}"
+  chat_message: "{{.RoleName}}: {{.Content}}"
+`), 0600))
+
+	grpc.Provide("fake-responses", &fakeChat{})
+	cl := config.NewBackendConfigLoader(modelPath)
+	assert.NoError(t, cl.LoadBackendConfigsFromPath(modelPath))
+	ml := model.NewModelLoader(modelPath)
+	appConfig := config.NewApplicationConfig(config.WithContext(context.Background()), config.WithExternalBackend("fake-responses", "fake-responses"))
+	evaluator := templates.NewEvaluator(modelPath)
+	store := kvstore.NewMemoryStore()
+
+	app := fiber.New()
+	app.Post("/responses", CreateResponseEndpoint(cl, ml, evaluator, store, appConfig))
+	app.Get("/responses/:response_id", GetResponseEndpoint(store))
+	app.Delete("/responses/:response_id", DeleteResponseEndpoint(store))
+
+	weatherTool := ResponseTool{
+		Type:       "function",
+		Name:       "get_weather",
+		Parameters: map[string]interface{}{"type": "object", "properties": map[string]interface{}{"city": map[string]interface{}{"type": "string"}}},
+	}
+
+	t.Run("ContinueStoredResponse", func(t *testing.T) {
+		var first Response
+		status := doJSON(t, app, http.MethodPost, "/responses", ResponseRequest{
+			Model:        "fake",
+			Input:        "Hello",
+			Instructions: "Be brief",
+			Metadata:     map[string]string{"user": "1"},
+		}, &first)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "response", first.Object)
+		assert.Equal(t, ResponseCompleted, first.Status)
+		assert.Equal(t, "1", first.Metadata["user"])
+		assert.True(t, first.Store)
+		assert.Len(t, first.Output, 1)
+		assert.Equal(t, "message", first.Output[0].Type)
+		assert.Equal(t, "echo: system: Be brief\nuser: Hello", first.Output[0].Content[0].Text)
+
+		var got Response
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/responses/"+first.ID, nil, &got))
+		assert.Equal(t, first.ID, got.ID)
+		assert.Equal(t, first.Output, got.Output)
+
+		// The history is continued without the instructions of the previous response
+		var second Response
+		status = doJSON(t, app, http.MethodPost, "/responses", ResponseRequest{
+			Model:              "fake",
+			Input:              []ResponseInputItem{{Role: "user", Content: []ResponseInputContent{{Type: "input_text", Text: "Again"}}}},
+			PreviousResponseID: first.ID,
+		}, &second)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, first.ID, second.PreviousResponseID)
+		assert.Equal(t, "echo: user: Hello\nassistant: echo: system: Be brief\nuser: Hello\nuser: Again", second.Output[0].Content[0].Text)
+
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodDelete, "/responses/"+first.ID, nil, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodGet, "/responses/"+first.ID, nil, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodPost, "/responses", ResponseRequest{
+			Model:              "fake",
+			Input:              "Hello",
+			PreviousResponseID: first.ID,
+		}, nil))
+	})
+
+	t.Run("NotStored", func(t *testing.T) {
+		store := false
+		var response Response
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/responses", ResponseRequest{Model: "fake", Input: "Hello", Store: &store}, &response))
+		assert.Equal(t, ResponseCompleted, response.Status)
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodGet, "/responses/"+response.ID, nil, nil))
+	})
+
+	t.Run("FunctionCalls", func(t *testing.T) {
+		var call Response
+		status := doJSON(t, app, http.MethodPost, "/responses", ResponseRequest{
+			Model: "fake",
+			Input: "What is the weather in Rome?",
+			Tools: []ResponseTool{weatherTool},
+		}, &call)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Len(t, call.Output, 1)
+		assert.Equal(t, "function_call", call.Output[0].Type)
+		assert.Equal(t, "get_weather", call.Output[0].Name)
+		assert.JSONEq(t, `{"city": "Rome"}`, *call.Output[0].Arguments)
+
+		// The output of the call is matched with the call of the previous response
+		var reply Response
+		status = doJSON(t, app, http.MethodPost, "/responses", ResponseRequest{
+			Model:              "fake",
+			Input:              []ResponseInputItem{{Type: "function_call_output", CallID: call.Output[0].CallID, Output: "sunny"}},
+			PreviousResponseID: call.ID,
+		}, &reply)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "message", reply.Output[0].Type)
+		assert.True(t, strings.HasSuffix(reply.Output[0].Content[0].Text, "\ntool: sunny"), reply.Output[0].Content[0].Text)
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		for _, request := range []ResponseRequest{
+			{Input: "Hello"},
+			{Model: "missing", Input: "Hello"},
+			{Model: "fake"},
+			{Model: "fake", Input: "Hello", Tools: []ResponseTool{{Type: "web_search"}}},
+			{Model: "fake", Input: "Hello", Tools: []ResponseTool{weatherTool}, ToolChoice: map[string]interface{}{"type": "function", "name": "get_time"}},
+			{Model: "fake", Input: []ResponseInputItem{{Type: "function_call_output", CallID: "call_missing", Output: "sunny"}}},
+			{Model: "fake", Input: []ResponseInputItem{{Role: "tool", Content: "Hello"}}},
+		} {
+			assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/responses", request, nil), "%+v", request)
+		}
+	})
+
+	t.Run("Stream", func(t *testing.T) {
+		data, err := json.Marshal(ResponseRequest{Model: "fake", Input: "Hello", Stream: true})
+		assert.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/responses", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req, -1)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		var events []ResponseEvent
+		var text strings.Builder
+		sequence := 0
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line, found := strings.CutPrefix(scanner.Text(), "data: ")
+			if !found {
+				continue
+			}
+			var event ResponseEvent
+			assert.NoError(t, json.Unmarshal([]byte(line), &event))
+			assert.Equal(t, sequence, event.SequenceNumber)
+			sequence++
+			if event.Type == "response.output_text.delta" {
+				text.WriteString(*event.Delta)
+				continue
+			}
+			events = append(events, event)
+		}
+
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		assert.Equal(t, []string{
+			"response.created",
+			"response.in_progress",
+			"response.output_item.added",
+			"response.content_part.added",
+			"response.output_text.done",
+			"response.content_part.done",
+			"response.output_item.done",
+			"response.completed",
+		}, types)
+		assert.Equal(t, "echo: user: Hello", text.String())
+		completed := events[len(events)-1].Response
+		assert.Equal(t, ResponseCompleted, completed.Status)
+		assert.Equal(t, "echo: user: Hello", completed.Output[0].Content[0].Text)
+
+		var stored Response
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/responses/"+completed.ID, nil, &stored))
+		assert.Equal(t, completed.Output, stored.Output)
+	})
+}
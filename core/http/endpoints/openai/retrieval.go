@@ -0,0 +1,176 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+// Number of chunks of the assistant files injected in the prompt
+const retrievalTopK = 4
+
+func hasTool(a Assistant, t ToolType) bool {
+	for _, tool := range a.Tools {
+		if tool.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+func getAssistant(tx kvstore.Tx, id string) (Assistant, error) {
+	return kvstore.Get[Assistant](tx, assistantsBucket, id)
+}
+
+// The files of each assistant are indexed in their own collection
+func assistantCollection(assistantID string) string {
+	return "assistant-" + assistantID
+}
+
+// syncAssistantFiles indexes the files attached to the assistant that are not in its collection yet,
+// and removes the ones that were detached since the last sync.
+func syncAssistantFiles(ctx context.Context, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig, a Assistant) error {
+	name := assistantCollection(a.ID)
+
+	if _, err := cs.Get(name); errors.Is(err, services.ErrCollectionNotFound) {
+		if appConfig.AssistantsEmbeddingModel == "" {
+			return fmt.Errorf("the retrieval tool requires an embedding model, set it with --assistants-embedding-model")
+		}
+		if _, err := cs.Create(schema.Collection{Name: name, Model: appConfig.AssistantsEmbeddingModel}); err != nil && !errors.Is(err, services.ErrCollectionExists) {
+			return err
+		}
+	}
+
+	indexed, err := cs.DocumentIDs(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range indexed {
+		if slices.Contains(a.FileIDs, id) {
+			continue
+		}
+		if _, err := cs.DeleteDocument(ctx, name, id); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range a.FileIDs {
+		if slices.Contains(indexed, id) {
+			continue
+		}
+
+		var f schema.File
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			f, err = getUploadedFile(tx, id)
+			return
+		})
+		if errors.Is(err, kvstore.ErrNotFound) {
+			log.Warn().Msgf("File %s of assistant %s not found, skipping it", id, a.ID)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		text, err := utils.ExtractText(uploadedFilePath(appConfig, f))
+		if err != nil {
+			return fmt.Errorf("failed indexing file %s: %w", id, err)
+		}
+
+		_, chunks, err := cs.AddDocuments(ctx, name, []schema.CollectionDocument{{
+			ID:       f.ID,
+			Text:     text,
+			Metadata: map[string]any{"filename": f.Filename},
+		}})
+		if err != nil {
+			return fmt.Errorf("failed indexing file %s: %w", id, err)
+		}
+		log.Debug().Msgf("Indexed file %s of assistant %s in %d chunks", id, a.ID, chunks)
+	}
+
+	return nil
+}
+
+// applyAssistant adds the instructions of the assistant to the messages and, when the retrieval tool is enabled,
+// the chunks of its files that are the most relevant to the last user message.
+func applyAssistant(ctx context.Context, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig, assistantID string, messages []schema.Message) ([]schema.Message, error) {
+	var a Assistant
+	err := store.View(func(tx kvstore.Tx) (err error) {
+		a, err = getAssistant(tx, assistantID)
+		return
+	})
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return nil, fmt.Errorf("unable to find assistant with id: %s", assistantID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return withAssistantContext(ctx, cs, store, appConfig, a, a.Instructions, messages)
+}
+
+// withAssistantContext is like applyAssistant, with instructions overriding the ones of the assistant
+func withAssistantContext(ctx context.Context, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig, a Assistant, instructions string, messages []schema.Message) ([]schema.Message, error) {
+	system := instructions
+
+	if hasTool(a, Retrieval) && len(a.FileIDs) > 0 {
+		query := ""
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Role == "user" {
+				query = messages[i].StringContent
+				break
+			}
+		}
+
+		if query != "" {
+			if err := syncAssistantFiles(ctx, cs, store, appConfig, a); err != nil {
+				return nil, err
+			}
+
+			results, err := cs.Query(ctx, assistantCollection(a.ID), schema.CollectionQueryRequest{
+				Query: query,
+				TopK:  retrievalTopK,
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			if len(results) > 0 {
+				system = strings.TrimSpace(system + "\n\n" + retrievalPrompt(results))
+			}
+		}
+	}
+
+	if system == "" {
+		return messages, nil
+	}
+
+	// Keep a single system message at the start, some templates don't support more
+	if len(messages) > 0 && messages[0].Role == "system" {
+		system = strings.TrimSpace(system + "\n\n" + messages[0].StringContent)
+		messages = messages[1:]
+	}
+
+	return append([]schema.Message{{Role: "system", Content: system, StringContent: system}}, messages...), nil
+}
+
+func retrievalPrompt(results []schema.CollectionQueryResult) string {
+	var sb strings.Builder
+	sb.WriteString("Use the following excerpts of the files you have access to when they are relevant to answer the user:\n")
+	for _, r := range results {
+		filename, _ := r.Metadata["filename"].(string)
+		fmt.Fprintf(&sb, "\n[%s]\n%s\n", filename, r.Text)
+	}
+
+	return sb.String()
+}
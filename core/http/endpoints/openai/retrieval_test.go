@@ -0,0 +1,57 @@
+package openai
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyAssistant(t *testing.T) {
+	appConfig := &config.ApplicationConfig{}
+	cs := services.NewCollectionsService(model.NewModelLoader(""), model.NewModelLoader(""), &config.BackendConfigLoader{}, appConfig)
+
+	store := kvstore.NewMemoryStore()
+	putObjects(t, store, assistantsBucket, func(a Assistant) string { return a.ID },
+		Assistant{ID: "asst_1", Instructions: "You are a helpful assistant."},
+		Assistant{ID: "asst_2", Instructions: "Answer from the files.", Tools: []Tool{{Type: Retrieval}}, FileIDs: []string{"file-1"}},
+	)
+
+	t.Run("AddsTheInstructions", func(t *testing.T) {
+		messages, err := applyAssistant(context.Background(), cs, store, appConfig, "asst_1", []schema.Message{
+			{Role: "user", StringContent: "Hello"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, messages, 2)
+		assert.Equal(t, "system", messages[0].Role)
+		assert.Equal(t, "You are a helpful assistant.", messages[0].StringContent)
+		assert.Equal(t, "Hello", messages[1].StringContent)
+	})
+
+	t.Run("MergesTheSystemMessage", func(t *testing.T) {
+		messages, err := applyAssistant(context.Background(), cs, store, appConfig, "asst_1", []schema.Message{
+			{Role: "system", StringContent: "Be concise."},
+			{Role: "user", StringContent: "Hello"},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, messages, 2)
+		assert.Equal(t, "You are a helpful assistant.\n\nBe concise.", messages[0].StringContent)
+	})
+
+	t.Run("UnknownAssistant", func(t *testing.T) {
+		_, err := applyAssistant(context.Background(), cs, store, appConfig, "asst_3", []schema.Message{})
+		assert.Error(t, err)
+	})
+
+	t.Run("RetrievalRequiresAnEmbeddingModel", func(t *testing.T) {
+		_, err := applyAssistant(context.Background(), cs, store, appConfig, "asst_2", []schema.Message{
+			{Role: "user", StringContent: "What is in the file?"},
+		})
+		assert.ErrorContains(t, err, "embedding model")
+	})
+}
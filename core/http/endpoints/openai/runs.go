@@ -0,0 +1,578 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	model "github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/rs/zerolog/log"
+)
+
+type RunStatus string
+
+const (
+	RunQueued         RunStatus = "queued"
+	RunInProgress     RunStatus = "in_progress"
+	RunRequiresAction RunStatus = "requires_action"
+	RunCancelling     RunStatus = "cancelling"
+	RunCancelled      RunStatus = "cancelled"
+	RunFailed         RunStatus = "failed"
+	RunCompleted      RunStatus = "completed"
+)
+
+type SubmitToolOutputs struct {
+	ToolCalls []schema.ToolCall `json:"tool_calls"`
+}
+
+// RequiredAction holds the function calls the client has to run and submit the outputs of
+type RequiredAction struct {
+	Type              string            `json:"type"` // Always "submit_tool_outputs"
+	SubmitToolOutputs SubmitToolOutputs `json:"submit_tool_outputs"`
+}
+
+type RunError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Run represents the structure of a run object from the OpenAI API.
+type Run struct {
+	ID             string              `json:"id"`                     // The unique identifier of the run.
+	Object         string              `json:"object"`                 // Object type, which is "thread.run".
+	CreatedAt      int64               `json:"created_at"`             // The time at which the run was created.
+	ThreadID       string              `json:"thread_id"`              // The thread that was executed on.
+	AssistantID    string              `json:"assistant_id"`           // The assistant used for the run.
+	Status         RunStatus           `json:"status"`                 // The status of the run.
+	RequiredAction *RequiredAction     `json:"required_action"`        // Set when the status is "requires_action".
+	LastError      *RunError           `json:"last_error"`             // Set when the status is "failed".
+	StartedAt      int64               `json:"started_at,omitempty"`   // The last time at which the run was started.
+	CancelledAt    int64               `json:"cancelled_at,omitempty"` // The time at which the run was cancelled.
+	FailedAt       int64               `json:"failed_at,omitempty"`    // The time at which the run failed.
+	CompletedAt    int64               `json:"completed_at,omitempty"` // The time at which the run was completed.
+	Model          string              `json:"model"`                  // The model used for the run.
+	Instructions   string              `json:"instructions"`           // The instructions used for the run.
+	Tools          []Tool              `json:"tools"`                  // The tools used for the run.
+	FileIDs        []string            `json:"file_ids"`               // The file IDs of the assistant used for the run.
+	Metadata       map[string]string   `json:"metadata"`               // Set of key-value pairs attached to the run.
+	Usage          *schema.OpenAIUsage `json:"usage"`                  // Set when the run is in a terminal state.
+}
+
+type RunRequest struct {
+	AssistantID            string            `json:"assistant_id"`
+	Model                  string            `json:"model,omitempty"`
+	Instructions           string            `json:"instructions,omitempty"`
+	AdditionalInstructions string            `json:"additional_instructions,omitempty"`
+	Tools                  []Tool            `json:"tools,omitempty"`
+	Metadata               map[string]string `json:"metadata,omitempty"`
+}
+
+type ThreadAndRunRequest struct {
+	RunRequest
+	Thread ThreadRequest `json:"thread"`
+}
+
+type ToolOutput struct {
+	ToolCallID string `json:"tool_call_id"`
+	Output     string `json:"output"`
+}
+
+type SubmitToolOutputsRequest struct {
+	ToolOutputs []ToolOutput `json:"tool_outputs"`
+}
+
+const runStepsBucket = "run_steps"
+
+// The runs of each thread are in their own bucket, the tool calls of the runs and their outputs,
+// which are not part of the thread, are in runStepsBucket
+func runsBucket(threadID string) string {
+	return "runs/" + threadID
+}
+
+// InterruptRuns marks the runs that were executing when LocalAI stopped as failed
+func InterruptRuns(store kvstore.Store) error {
+	return store.Update(func(tx kvstore.Tx) error {
+		for _, threadID := range tx.Keys(threadsBucket) {
+			runs, _, err := kvstore.List[Run](tx, runsBucket(threadID), kvstore.ListOptions{})
+			if err != nil {
+				return err
+			}
+
+			for _, r := range runs {
+				switch r.Status {
+				case RunQueued, RunInProgress, RunCancelling:
+					r.Status = RunFailed
+					r.FailedAt = time.Now().Unix()
+					r.LastError = &RunError{Code: "server_error", Message: "the run was interrupted by a restart"}
+					if err := kvstore.Put(tx, runsBucket(threadID), r.ID, r); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (r *Run) active() bool {
+	switch r.Status {
+	case RunQueued, RunInProgress, RunRequiresAction, RunCancelling:
+		return true
+	}
+	return false
+}
+
+// hasActiveRun returns whether the thread has a run which is not in a terminal state.
+// A run can't be created while another one is active, so only the last one is checked.
+func hasActiveRun(tx kvstore.Tx, threadID string) (bool, error) {
+	runs, _, err := kvstore.List[Run](tx, runsBucket(threadID), kvstore.ListOptions{Limit: 1, Descending: true})
+	if err != nil {
+		return false, err
+	}
+	return len(runs) > 0 && runs[0].active(), nil
+}
+
+// getRun returns the run, or a 404 error
+func getRun(tx kvstore.Tx, threadID, runID string) (Run, error) {
+	run, err := kvstore.Get[Run](tx, runsBucket(threadID), runID)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return run, fiber.NewError(fiber.StatusNotFound, "run not found")
+	}
+	return run, err
+}
+
+// newRun validates the request and adds a queued run to the thread
+func newRun(tx kvstore.Tx, cl *config.BackendConfigLoader, ml *model.ModelLoader, identity *fiberContext.Identity, threadID string, request RunRequest) (Run, error) {
+	a, err := getAssistant(tx, request.AssistantID)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return Run{}, fiber.NewError(fiber.StatusNotFound, fmt.Sprintf("unable to find assistant with id: %s", request.AssistantID))
+	}
+	if err != nil {
+		return Run{}, err
+	}
+
+	active, err := hasActiveRun(tx, threadID)
+	if err != nil {
+		return Run{}, err
+	}
+	if active {
+		return Run{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("thread %s already has an active run", threadID))
+	}
+
+	run := Run{
+		ID:           kvstore.NewID("run_"),
+		Object:       "thread.run",
+		CreatedAt:    time.Now().Unix(),
+		ThreadID:     threadID,
+		AssistantID:  a.ID,
+		Status:       RunQueued,
+		Model:        a.Model,
+		Instructions: a.Instructions,
+		Tools:        a.Tools,
+		FileIDs:      a.FileIDs,
+		Metadata:     request.Metadata,
+	}
+
+	if request.Model != "" {
+		run.Model = request.Model
+	}
+	if request.Instructions != "" {
+		run.Instructions = request.Instructions
+	}
+	if request.AdditionalInstructions != "" {
+		run.Instructions = strings.TrimSpace(run.Instructions + "\n\n" + request.AdditionalInstructions)
+	}
+	if request.Tools != nil {
+		run.Tools = request.Tools
+	}
+	if run.Tools == nil {
+		run.Tools = []Tool{}
+	}
+	if run.FileIDs == nil {
+		run.FileIDs = []string{}
+	}
+	if run.Metadata == nil {
+		run.Metadata = map[string]string{}
+	}
+
+	for _, t := range run.Tools {
+		if t.Type == Function && (t.Function == nil || t.Function.Name == "") {
+			return Run{}, fiber.NewError(fiber.StatusBadRequest, "function tools require a function with a name")
+		}
+	}
+
+	if !modelExists(cl, ml, run.Model) {
+		return Run{}, fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("model %q not found", run.Model))
+	}
+	if identity != nil && !identity.AllowsModel(run.Model) {
+		return Run{}, fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("the API key is not allowed to use the model %s", run.Model))
+	}
+
+	return run, kvstore.Put(tx, runsBucket(threadID), run.ID, run)
+}
+
+// startRun executes the queued run in the background, recording its usage in the accounting of the request which
+// started it
+func startRun(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig, run Run, usage *fiberContext.RequestUsage) {
+	backgroundJobs.start(appConfig.Context, run.ID, func(ctx context.Context) {
+		if err := executeRun(fiberContext.WithUsage(ctx, usage), cl, ml, evaluator, cs, store, appConfig, run.ThreadID, run.ID); err != nil {
+			log.Error().Err(err).Msgf("Unable to update run %s", run.ID)
+		}
+	})
+}
+
+func executeRun(ctx context.Context, cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig, threadID, runID string) error {
+	var run Run
+	var a Assistant
+	var messages, history []schema.Message
+	started := false
+	err := store.Update(func(tx kvstore.Tx) (err error) {
+		run, err = getRun(tx, threadID, runID)
+		if err != nil {
+			return
+		}
+
+		if run.Status != RunQueued {
+			// The run was cancelled before starting
+			if run.Status == RunCancelling {
+				run.Status = RunCancelled
+				run.CancelledAt = time.Now().Unix()
+				return kvstore.Put(tx, runsBucket(threadID), run.ID, run)
+			}
+			return
+		}
+
+		a, err = getAssistant(tx, run.AssistantID)
+		if err != nil {
+			return fmt.Errorf("unable to find assistant with id %s: %w", run.AssistantID, err)
+		}
+
+		threadMessages, _, err := kvstore.List[ThreadMessage](tx, messagesBucket(threadID), kvstore.ListOptions{})
+		if err != nil {
+			return
+		}
+		for _, m := range threadMessages {
+			text := m.Text()
+			messages = append(messages, schema.Message{Role: m.Role, Content: text, StringContent: text})
+		}
+
+		history, err = kvstore.Get[[]schema.Message](tx, runStepsBucket, run.ID)
+		if err != nil && !errors.Is(err, kvstore.ErrNotFound) {
+			return
+		}
+
+		run.Status = RunInProgress
+		run.StartedAt = time.Now().Unix()
+		started = true
+		return kvstore.Put(tx, runsBucket(threadID), run.ID, run)
+	})
+	if err != nil || !started {
+		return err
+	}
+
+	reply, toolCalls, usage, inferenceErr := runInference(ctx, cl, ml, evaluator, cs, store, appConfig, run, a, messages, history)
+
+	return store.Update(func(tx kvstore.Tx) (err error) {
+		run, err = getRun(tx, threadID, runID)
+		if err != nil {
+			// The thread was deleted in the meantime
+			return nil
+		}
+
+		if run.Usage == nil {
+			run.Usage = &schema.OpenAIUsage{}
+		}
+		run.Usage.PromptTokens += usage.Prompt
+		run.Usage.CompletionTokens += usage.Completion
+		run.Usage.TotalTokens += usage.Prompt + usage.Completion
+		if usage.CachedPrompt > 0 {
+			if run.Usage.PromptTokensDetails == nil {
+				run.Usage.PromptTokensDetails = &schema.PromptTokensDetails{}
+			}
+			run.Usage.PromptTokensDetails.CachedTokens += usage.CachedPrompt
+		}
+
+		switch {
+		case run.Status == RunCancelling || ctx.Err() != nil:
+			run.Status = RunCancelled
+			run.CancelledAt = time.Now().Unix()
+		case inferenceErr != nil:
+			log.Error().Err(inferenceErr).Msgf("Run %s failed", run.ID)
+			run.Status = RunFailed
+			run.FailedAt = time.Now().Unix()
+			run.LastError = &RunError{Code: "server_error", Message: inferenceErr.Error()}
+		case len(toolCalls) > 0:
+			run.Status = RunRequiresAction
+			run.RequiredAction = &RequiredAction{
+				Type:              "submit_tool_outputs",
+				SubmitToolOutputs: SubmitToolOutputs{ToolCalls: toolCalls},
+			}
+		default:
+			message := ThreadMessage{
+				ID:          kvstore.NewID("msg_"),
+				Object:      "thread.message",
+				CreatedAt:   time.Now().Unix(),
+				ThreadID:    threadID,
+				Role:        "assistant",
+				Content:     []MessageContent{{Type: "text", Text: MessageText{Value: reply, Annotations: []any{}}}},
+				AssistantID: run.AssistantID,
+				RunID:       run.ID,
+				FileIDs:     []string{},
+				Metadata:    map[string]string{},
+			}
+			if err := kvstore.Put(tx, messagesBucket(threadID), message.ID, message); err != nil {
+				return err
+			}
+			run.Status = RunCompleted
+			run.CompletedAt = time.Now().Unix()
+		}
+
+		return kvstore.Put(tx, runsBucket(threadID), run.ID, run)
+	})
+}
+
+// runInference computes the reply of the assistant to the thread messages, or the functions it wants to call
+func runInference(ctx context.Context, cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig, run Run, a Assistant, messages, history []schema.Message) (string, []schema.ToolCall, backend.TokenUsage, error) {
+	// The run may override the tools of the assistant
+	a.Tools = run.Tools
+
+	messages, err := withAssistantContext(ctx, cs, store, appConfig, a, run.Instructions, messages)
+	if err != nil {
+		return "", nil, backend.TokenUsage{}, err
+	}
+
+	input := &schema.OpenAIRequest{
+		PredictionOptions: schema.PredictionOptions{Model: run.Model},
+		Messages:          append(messages, history...),
+		Context:           ctx,
+	}
+	for _, t := range run.Tools {
+		if t.Type == Function {
+			input.Tools = append(input.Tools, functions.Tool{Type: "function", Function: *t.Function})
+		}
+	}
+
+	return inferReply(cl, ml, evaluator, appConfig, input, nil)
+}
+
+// CreateRunEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/runs/createRun
+// @Summary Run an assistant on a thread
+// @Param request body RunRequest true "query params"
+// @Success 200 {object} Run "Response"
+// @Router /v1/threads/{thread_id}/runs [post]
+func CreateRunEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(RunRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse RunRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		threadID := c.Params("thread_id")
+
+		var run Run
+		err := store.Update(func(tx kvstore.Tx) (err error) {
+			if _, err = getThread(tx, threadID); err != nil {
+				return
+			}
+
+			run, err = newRun(tx, cl, ml, fiberContext.IdentityFromContext(c), threadID, *request)
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		startRun(cl, ml, evaluator, cs, store, appConfig, run, fiberContext.UsageFromContext(c))
+
+		return c.JSON(run)
+	}
+}
+
+// CreateThreadAndRunEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/runs/createThreadAndRun
+// @Summary Create a thread and run an assistant on it
+// @Param request body ThreadAndRunRequest true "query params"
+// @Success 200 {object} Run "Response"
+// @Router /v1/threads/runs [post]
+func CreateThreadAndRunEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(ThreadAndRunRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse ThreadAndRunRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		// The thread is not created if the run is rejected, as the transaction is discarded
+		var run Run
+		err := store.Update(func(tx kvstore.Tx) error {
+			thread, err := createThread(tx, request.Thread)
+			if err != nil {
+				return err
+			}
+
+			run, err = newRun(tx, cl, ml, fiberContext.IdentityFromContext(c), thread.ID, request.RunRequest)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		startRun(cl, ml, evaluator, cs, store, appConfig, run, fiberContext.UsageFromContext(c))
+
+		return c.JSON(run)
+	}
+}
+
+// ListRunsEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/runs/listRuns
+// @Summary List the runs of a thread
+// @Param limit query int false "Limit the number of runs returned"
+// @Param order query string false "Order of runs returned"
+// @Param after query string false "Return runs after the given ID"
+// @Param before query string false "Return runs before the given ID"
+// @Success 200 {object} ListResponse[Run] "Response"
+// @Router /v1/threads/{thread_id}/runs [get]
+func ListRunsEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		threadID := c.Params("thread_id")
+
+		err := store.View(func(tx kvstore.Tx) error {
+			_, err := getThread(tx, threadID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		return listObjects(c, store, runsBucket(threadID), func(r Run) string { return r.ID }, nil)
+	}
+}
+
+// GetRunEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/runs/getRun
+// @Summary Get a run, to poll its status
+// @Success 200 {object} Run "Response"
+// @Router /v1/threads/{thread_id}/runs/{run_id} [get]
+func GetRunEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		var run Run
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			run, err = getRun(tx, c.Params("thread_id"), c.Params("run_id"))
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(run)
+	}
+}
+
+// SubmitToolOutputsEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/runs/submitToolOutputs
+// @Summary Submit the outputs of the tool calls of a run that requires action, and resume it
+// @Param request body SubmitToolOutputsRequest true "query params"
+// @Success 200 {object} Run "Response"
+// @Router /v1/threads/{thread_id}/runs/{run_id}/submit_tool_outputs [post]
+func SubmitToolOutputsEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, evaluator *templates.Evaluator, cs *services.CollectionsService, store kvstore.Store, appConfig *config.ApplicationConfig) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(SubmitToolOutputsRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse SubmitToolOutputsRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		outputs := map[string]string{}
+		for _, o := range request.ToolOutputs {
+			outputs[o.ToolCallID] = o.Output
+		}
+
+		var run Run
+		err := store.Update(func(tx kvstore.Tx) (err error) {
+			run, err = getRun(tx, c.Params("thread_id"), c.Params("run_id"))
+			if err != nil {
+				return
+			}
+
+			if run.Status != RunRequiresAction || run.RequiredAction == nil {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("run %s is %s, tool outputs can only be submitted when it requires action", run.ID, run.Status))
+			}
+
+			toolCalls := run.RequiredAction.SubmitToolOutputs.ToolCalls
+			toolMessages := []schema.Message{{Role: "assistant", ToolCalls: toolCalls}}
+			for _, tc := range toolCalls {
+				output, exists := outputs[tc.ID]
+				if !exists {
+					return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("missing output for tool call %s", tc.ID))
+				}
+				toolMessages = append(toolMessages, schema.Message{Role: "tool", Name: tc.FunctionCall.Name, Content: output, StringContent: output})
+			}
+
+			history, err := kvstore.Get[[]schema.Message](tx, runStepsBucket, run.ID)
+			if err != nil && !errors.Is(err, kvstore.ErrNotFound) {
+				return
+			}
+			if err := kvstore.Put(tx, runStepsBucket, run.ID, append(history, toolMessages...)); err != nil {
+				return err
+			}
+
+			run.RequiredAction = nil
+			run.Status = RunQueued
+			return kvstore.Put(tx, runsBucket(run.ThreadID), run.ID, run)
+		})
+		if err != nil {
+			return err
+		}
+
+		startRun(cl, ml, evaluator, cs, store, appConfig, run, fiberContext.UsageFromContext(c))
+
+		return c.JSON(run)
+	}
+}
+
+// CancelRunEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/runs/cancelRun
+// @Summary Cancel a run
+// @Success 200 {object} Run "Response"
+// @Router /v1/threads/{thread_id}/runs/{run_id}/cancel [post]
+func CancelRunEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		var run Run
+		err := store.Update(func(tx kvstore.Tx) (err error) {
+			run, err = getRun(tx, c.Params("thread_id"), c.Params("run_id"))
+			if err != nil {
+				return
+			}
+
+			switch run.Status {
+			case RunQueued, RunInProgress:
+				// The run is marked as cancelled once the inference stops
+				run.Status = RunCancelling
+			case RunRequiresAction:
+				run.Status = RunCancelled
+				run.CancelledAt = time.Now().Unix()
+				run.RequiredAction = nil
+			default:
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("run %s is %s and can't be cancelled", run.ID, run.Status))
+			}
+
+			return kvstore.Put(tx, runsBucket(run.ThreadID), run.ID, run)
+		})
+		if err != nil {
+			return err
+		}
+
+		if run.Status == RunCancelling {
+			backgroundJobs.cancel(run.ID)
+		}
+
+		return c.JSON(run)
+	}
+}
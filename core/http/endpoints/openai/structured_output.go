@@ -0,0 +1,120 @@
+package openai
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/functions"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// responseJSONSchema returns the json_schema response format of the request, nil if the request has another response
+// format
+func responseJSONSchema(config *config.BackendConfig) (*schema.JsonSchema, error) {
+	if config.ResponseFormatMap == nil {
+		return nil, nil
+	}
+	d := schema.JsonSchemaRequest{}
+	dat, err := json.Marshal(config.ResponseFormatMap)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(dat, &d); err != nil {
+		return nil, err
+	}
+	if d.Type != "json_schema" {
+		return nil, nil
+	}
+	if d.JsonSchema.Schema == nil {
+		return nil, fmt.Errorf("the json_schema response format has no schema")
+	}
+	return &d.JsonSchema, nil
+}
+
+// enforceJSONSchema makes the content of the choices match the schema of jsonSchema. A reply which doesn't match it is
+// repaired if the JSON document is surrounded by text. If the schema is strict, a reply which still doesn't match it is
+// generated again up to json_schema_retries times with the validation errors, and it is eventually returned as a
+// refusal.
+func enforceJSONSchema(jsonSchema *schema.JsonSchema, input *schema.OpenAIRequest, cfg *config.BackendConfig, evaluator *templates.Evaluator, appConfig *config.ApplicationConfig, ml *model.ModelLoader, choices []schema.Choice, tokenUsage *backend.TokenUsage) error {
+	retries := config.DefaultJSONSchemaRetries
+	if cfg.JSONSchemaRetries != nil {
+		retries = *cfg.JSONSchemaRetries
+	}
+	if !jsonSchema.Strict {
+		retries = 0
+	}
+
+	for i := range choices {
+		message := choices[i].Message
+		if message == nil {
+			continue
+		}
+		content, ok := message.Content.(*string)
+		if !ok || content == nil {
+			continue
+		}
+
+		output := functions.RepairJSON(*content)
+		err := functions.ValidateJSONSchema(jsonSchema.Schema, output)
+		for retry := 0; err != nil && retry < retries; retry++ {
+			log.Debug().Err(err).Msgf("the reply doesn't match the JSON schema, generating it again (%d/%d)", retry+1, retries)
+
+			var usage backend.TokenUsage
+			output, usage, err = generateJSONAgain(input, cfg, evaluator, appConfig, ml, output, err)
+			tokenUsage.Prompt += usage.Prompt
+			tokenUsage.Completion += usage.Completion
+			tokenUsage.CachedPrompt += usage.CachedPrompt
+			if err != nil {
+				return err
+			}
+			output = functions.RepairJSON(output)
+			err = functions.ValidateJSONSchema(jsonSchema.Schema, output)
+		}
+
+		if err != nil && jsonSchema.Strict {
+			log.Debug().Err(err).Msg("the reply doesn't match the JSON schema, refusing")
+			message.Content = nil
+			message.Refusal = output
+			if json.Valid([]byte(output)) {
+				// The model replied with JSON, but with the wrong content
+				message.Refusal = err.Error()
+			}
+			continue
+		}
+		message.Content = &output
+	}
+	return nil
+}
+
+// generateJSONAgain generates a single reply to the conversation followed by the invalid output and the validation
+// error, asking the model to fix it
+func generateJSONAgain(input *schema.OpenAIRequest, config *config.BackendConfig, evaluator *templates.Evaluator, appConfig *config.ApplicationConfig, ml *model.ModelLoader, output string, validationErr error) (string, backend.TokenUsage, error) {
+	feedback := fmt.Sprintf("Your reply is invalid: %s. Reply again with only the JSON document matching the JSON schema.", validationErr)
+
+	retryInput := *input
+	retryInput.N = 1
+	retryInput.Messages = append(slices.Clone(input.Messages),
+		schema.Message{Role: "assistant", Content: output, StringContent: output},
+		schema.Message{Role: "user", Content: feedback, StringContent: feedback},
+	)
+
+	var predInput string
+	if !config.TemplateConfig.UseTokenizerTemplate {
+		span := startSpan(input.Context, "template.evaluate", attribute.String("model", config.Name))
+		predInput = evaluator.TemplateMessages(retryInput.Messages, config, nil, false)
+		span.End()
+	}
+
+	var reply string
+	_, usage, err := ComputeChoices(&retryInput, predInput, config, appConfig, ml, func(s string, c *[]schema.Choice) {
+		reply = s
+	}, nil)
+	return reply, usage, err
+}
@@ -0,0 +1,41 @@
+package openai
+
+import (
+	"testing"
+
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEnforceJSONSchema(t *testing.T) {
+	jsonSchema := map[string]interface{}{
+		"type":       "object",
+		"properties": map[string]interface{}{"date": map[string]interface{}{"type": "string"}},
+		"required":   []interface{}{"date"},
+	}
+	noRetries := 0
+	cfg := &config.BackendConfig{LLMConfig: config.LLMConfig{JSONSchemaRetries: &noRetries}}
+
+	enforce := func(strict bool, content string) *schema.Message {
+		message := &schema.Message{Role: "assistant", Content: &content}
+		err := enforceJSONSchema(&schema.JsonSchema{Strict: strict, Schema: jsonSchema}, &schema.OpenAIRequest{}, cfg, nil, nil, nil, []schema.Choice{{Message: message}}, &backend.TokenUsage{})
+		assert.NoError(t, err)
+		return message
+	}
+
+	// The JSON document is extracted from the text around it
+	message := enforce(true, "```json\n{\"date\": \"2024-05-03\"}\n```")
+	assert.Equal(t, `{"date": "2024-05-03"}`, *message.Content.(*string))
+
+	// A strict schema refuses the replies which don't match it
+	message = enforce(true, `{"day": "2024-05-03"}`)
+	assert.Nil(t, message.Content)
+	assert.NotEmpty(t, message.Refusal)
+
+	// The other schemas only guide the reply
+	message = enforce(false, "```json\n{\"day\": \"2024-05-03\"}\n```")
+	assert.Equal(t, `{"day": "2024-05-03"}`, *message.Content.(*string))
+	assert.Empty(t, message.Refusal)
+}
@@ -0,0 +1,356 @@
+package openai
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/rs/zerolog/log"
+)
+
+// Thread represents the structure of a thread object from the OpenAI API.
+type Thread struct {
+	ID        string            `json:"id"`         // The unique identifier of the thread.
+	Object    string            `json:"object"`     // Object type, which is "thread".
+	CreatedAt int64             `json:"created_at"` // The time at which the thread was created.
+	Metadata  map[string]string `json:"metadata"`   // Set of key-value pairs attached to the thread.
+}
+
+type MessageText struct {
+	Value       string `json:"value"`
+	Annotations []any  `json:"annotations"`
+}
+
+type MessageContent struct {
+	Type string      `json:"type"` // Always "text", images are not supported
+	Text MessageText `json:"text"`
+}
+
+// ThreadMessage represents the structure of a message object from the OpenAI API.
+type ThreadMessage struct {
+	ID          string            `json:"id"`           // The unique identifier of the message.
+	Object      string            `json:"object"`       // Object type, which is "thread.message".
+	CreatedAt   int64             `json:"created_at"`   // The time at which the message was created.
+	ThreadID    string            `json:"thread_id"`    // The thread the message belongs to.
+	Role        string            `json:"role"`         // Either "user" or "assistant".
+	Content     []MessageContent  `json:"content"`      // The content of the message.
+	AssistantID string            `json:"assistant_id"` // The assistant that authored the message, if any.
+	RunID       string            `json:"run_id"`       // The run that produced the message, if any.
+	FileIDs     []string          `json:"file_ids"`     // A list of file IDs attached to the message.
+	Metadata    map[string]string `json:"metadata"`     // Set of key-value pairs attached to the message.
+}
+
+// Text returns the text of all the content parts of the message
+func (m ThreadMessage) Text() string {
+	parts := []string{}
+	for _, c := range m.Content {
+		parts = append(parts, c.Text.Value)
+	}
+	return strings.Join(parts, "\n")
+}
+
+type ThreadMessageRequest struct {
+	Role     string            `json:"role"`
+	Content  string            `json:"content"`
+	FileIDs  []string          `json:"file_ids,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+type ThreadRequest struct {
+	Messages []ThreadMessageRequest `json:"messages,omitempty"`
+	Metadata map[string]string      `json:"metadata,omitempty"`
+}
+
+const threadsBucket = "threads"
+
+// The messages of each thread are in their own bucket
+func messagesBucket(threadID string) string {
+	return "messages/" + threadID
+}
+
+var errThreadNotFound = fiber.NewError(fiber.StatusNotFound, "thread not found")
+
+// getThread returns the thread, or a 404 error
+func getThread(tx kvstore.Tx, id string) (Thread, error) {
+	thread, err := kvstore.Get[Thread](tx, threadsBucket, id)
+	if errors.Is(err, kvstore.ErrNotFound) {
+		return thread, errThreadNotFound
+	}
+	return thread, err
+}
+
+func newThreadMessage(threadID string, request ThreadMessageRequest) (ThreadMessage, error) {
+	if request.Role != "user" && request.Role != "assistant" {
+		return ThreadMessage{}, fiber.NewError(fiber.StatusBadRequest, "role must be user or assistant")
+	}
+	if len(request.FileIDs) > MaxFileIdSize {
+		return ThreadMessage{}, fiber.NewError(fiber.StatusBadRequest, "too many file_ids")
+	}
+	if request.FileIDs == nil {
+		request.FileIDs = []string{}
+	}
+	if request.Metadata == nil {
+		request.Metadata = map[string]string{}
+	}
+
+	return ThreadMessage{
+		ID:        kvstore.NewID("msg_"),
+		Object:    "thread.message",
+		CreatedAt: time.Now().Unix(),
+		ThreadID:  threadID,
+		Role:      request.Role,
+		Content:   []MessageContent{{Type: "text", Text: MessageText{Value: request.Content, Annotations: []any{}}}},
+		FileIDs:   request.FileIDs,
+		Metadata:  request.Metadata,
+	}, nil
+}
+
+// createThread adds a thread with its initial messages
+func createThread(tx kvstore.Tx, request ThreadRequest) (Thread, error) {
+	if request.Metadata == nil {
+		request.Metadata = map[string]string{}
+	}
+
+	thread := Thread{
+		ID:        kvstore.NewID("thread_"),
+		Object:    "thread",
+		CreatedAt: time.Now().Unix(),
+		Metadata:  request.Metadata,
+	}
+
+	if err := kvstore.Put(tx, threadsBucket, thread.ID, thread); err != nil {
+		return Thread{}, err
+	}
+
+	for _, m := range request.Messages {
+		message, err := newThreadMessage(thread.ID, m)
+		if err != nil {
+			return Thread{}, err
+		}
+		if err := kvstore.Put(tx, messagesBucket(thread.ID), message.ID, message); err != nil {
+			return Thread{}, err
+		}
+	}
+
+	return thread, nil
+}
+
+// CreateThreadEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/threads/createThread
+// @Summary Create a thread, optionally with messages.
+// @Param request body ThreadRequest true "query params"
+// @Success 200 {object} Thread "Response"
+// @Router /v1/threads [post]
+func CreateThreadEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(ThreadRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse ThreadRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		var thread Thread
+		err := store.Update(func(tx kvstore.Tx) (err error) {
+			thread, err = createThread(tx, *request)
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(thread)
+	}
+}
+
+// GetThreadEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/threads/getThread
+// @Summary Get a thread
+// @Success 200 {object} Thread "Response"
+// @Router /v1/threads/{thread_id} [get]
+func GetThreadEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		var thread Thread
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			thread, err = getThread(tx, c.Params("thread_id"))
+			return
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(thread)
+	}
+}
+
+// ModifyThreadEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/threads/modifyThread
+// @Summary Modify the metadata of a thread
+// @Param request body ThreadRequest true "query params"
+// @Success 200 {object} Thread "Response"
+// @Router /v1/threads/{thread_id} [post]
+func ModifyThreadEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(ThreadRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse ThreadRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		var thread Thread
+		err := store.Update(func(tx kvstore.Tx) (err error) {
+			thread, err = getThread(tx, c.Params("thread_id"))
+			if err != nil || request.Metadata == nil {
+				return
+			}
+
+			thread.Metadata = request.Metadata
+			return kvstore.Put(tx, threadsBucket, thread.ID, thread)
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(thread)
+	}
+}
+
+// DeleteThreadEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/threads/deleteThread
+// @Summary Delete a thread with its messages and runs
+// @Success 200 {object} schema.DeleteThreadResponse "Response"
+// @Router /v1/threads/{thread_id} [delete]
+func DeleteThreadEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		threadID := c.Params("thread_id")
+
+		var runIDs []string
+		err := store.Update(func(tx kvstore.Tx) error {
+			if _, err := getThread(tx, threadID); err != nil {
+				return err
+			}
+
+			runIDs = tx.Keys(runsBucket(threadID))
+			for _, id := range runIDs {
+				if err := tx.Delete(runStepsBucket, id); err != nil && !errors.Is(err, kvstore.ErrNotFound) {
+					return err
+				}
+			}
+
+			for _, bucket := range []string{messagesBucket(threadID), runsBucket(threadID)} {
+				if err := tx.DeleteBucket(bucket); err != nil {
+					return err
+				}
+			}
+
+			return tx.Delete(threadsBucket, threadID)
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, id := range runIDs {
+			backgroundJobs.cancel(id)
+		}
+
+		return c.JSON(schema.DeleteThreadResponse{
+			ID:      threadID,
+			Object:  "thread.deleted",
+			Deleted: true,
+		})
+	}
+}
+
+// CreateMessageEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/messages/createMessage
+// @Summary Add a message to a thread
+// @Param request body ThreadMessageRequest true "query params"
+// @Success 200 {object} ThreadMessage "Response"
+// @Router /v1/threads/{thread_id}/messages [post]
+func CreateMessageEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		request := new(ThreadMessageRequest)
+		if err := c.BodyParser(request); err != nil {
+			log.Warn().AnErr("Unable to parse ThreadMessageRequest", err)
+			return fiber.NewError(fiber.StatusBadRequest, "Cannot parse JSON")
+		}
+
+		threadID := c.Params("thread_id")
+
+		var message ThreadMessage
+		err := store.Update(func(tx kvstore.Tx) error {
+			if _, err := getThread(tx, threadID); err != nil {
+				return err
+			}
+
+			active, err := hasActiveRun(tx, threadID)
+			if err != nil {
+				return err
+			}
+			if active {
+				return fiber.NewError(fiber.StatusBadRequest, "can't add messages to a thread while a run is active")
+			}
+
+			message, err = newThreadMessage(threadID, *request)
+			if err != nil {
+				return err
+			}
+
+			return kvstore.Put(tx, messagesBucket(threadID), message.ID, message)
+		})
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(message)
+	}
+}
+
+// ListMessagesEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/messages/listMessages
+// @Summary List the messages of a thread
+// @Param limit query int false "Limit the number of messages returned"
+// @Param order query string false "Order of messages returned"
+// @Param after query string false "Return messages after the given ID"
+// @Param before query string false "Return messages before the given ID"
+// @Param run_id query string false "Return only the messages generated by the given run"
+// @Success 200 {object} ListResponse[ThreadMessage] "Response"
+// @Router /v1/threads/{thread_id}/messages [get]
+func ListMessagesEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		threadID := c.Params("thread_id")
+
+		err := store.View(func(tx kvstore.Tx) error {
+			_, err := getThread(tx, threadID)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		var keep func(ThreadMessage) bool
+		if runID := c.Query("run_id"); runID != "" {
+			keep = func(m ThreadMessage) bool { return m.RunID == runID }
+		}
+
+		return listObjects(c, store, messagesBucket(threadID), func(m ThreadMessage) string { return m.ID }, keep)
+	}
+}
+
+// GetMessageEndpoint is the OpenAI Assistant API endpoint https://platform.openai.com/docs/api-reference/messages/getMessage
+// @Summary Get a message of a thread
+// @Success 200 {object} ThreadMessage "Response"
+// @Router /v1/threads/{thread_id}/messages/{message_id} [get]
+func GetMessageEndpoint(store kvstore.Store) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		var message ThreadMessage
+		err := store.View(func(tx kvstore.Tx) (err error) {
+			message, err = kvstore.Get[ThreadMessage](tx, messagesBucket(c.Params("thread_id")), c.Params("message_id"))
+			return
+		})
+		if errors.Is(err, kvstore.ErrNotFound) {
+			return fiber.NewError(fiber.StatusNotFound, "message not found")
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(message)
+	}
+}
@@ -0,0 +1,270 @@
+package openai
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/templates"
+	"github.com/stretchr/testify/assert"
+)
+
+func threadsTearDown(store kvstore.Store) func() {
+	return func() {
+		_ = store.Update(func(tx kvstore.Tx) error {
+			for _, id := range tx.Keys(threadsBucket) {
+				_ = tx.DeleteBucket(messagesBucket(id))
+				_ = tx.DeleteBucket(runsBucket(id))
+			}
+			_ = tx.DeleteBucket(runStepsBucket)
+			_ = tx.DeleteBucket(assistantsBucket)
+			return tx.DeleteBucket(threadsBucket)
+		})
+	}
+}
+
+// putObjects adds the objects to the bucket of the store
+func putObjects[T any](t *testing.T, store kvstore.Store, bucket string, id func(T) string, objects ...T) {
+	assert.NoError(t, store.Update(func(tx kvstore.Tx) error {
+		for _, o := range objects {
+			if err := kvstore.Put(tx, bucket, id(o), o); err != nil {
+				return err
+			}
+		}
+		return nil
+	}))
+}
+
+func bucketKeys(store kvstore.Store, bucket string) (keys []string) {
+	_ = store.View(func(tx kvstore.Tx) error {
+		keys = tx.Keys(bucket)
+		return nil
+	})
+	return
+}
+
+func doJSON(t *testing.T, app *fiber.App, method, url string, body any, out any) int {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		assert.NoError(t, err)
+		reader = bytes.NewReader(data)
+	}
+
+	req := httptest.NewRequest(method, url, reader)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	if out != nil && resp.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+	}
+	return resp.StatusCode
+}
+
+func TestThreadEndpoints(t *testing.T) {
+	cl := &config.BackendConfigLoader{}
+	ml := model.NewModelLoader(t.TempDir())
+	appConfig := &config.ApplicationConfig{ConfigsDir: t.TempDir()}
+	cs := services.NewCollectionsService(ml, ml, cl, appConfig)
+	evaluator := templates.NewEvaluator(t.TempDir())
+	store := kvstore.NewMemoryStore()
+
+	app := fiber.New()
+	app.Post("/threads", CreateThreadEndpoint(store))
+	app.Get("/threads/:thread_id", GetThreadEndpoint(store))
+	app.Post("/threads/:thread_id", ModifyThreadEndpoint(store))
+	app.Delete("/threads/:thread_id", DeleteThreadEndpoint(store))
+	app.Get("/threads/:thread_id/messages", ListMessagesEndpoint(store))
+	app.Post("/threads/:thread_id/messages", CreateMessageEndpoint(store))
+	app.Get("/threads/:thread_id/messages/:message_id", GetMessageEndpoint(store))
+	app.Get("/threads/:thread_id/runs", ListRunsEndpoint(store))
+	app.Post("/threads/:thread_id/runs", CreateRunEndpoint(cl, ml, evaluator, cs, store, appConfig))
+	app.Get("/threads/:thread_id/runs/:run_id", GetRunEndpoint(store))
+	app.Post("/threads/:thread_id/runs/:run_id/submit_tool_outputs", SubmitToolOutputsEndpoint(cl, ml, evaluator, cs, store, appConfig))
+	app.Post("/threads/:thread_id/runs/:run_id/cancel", CancelRunEndpoint(store))
+
+	t.Run("CreateThreadWithMessages", func(t *testing.T) {
+		t.Cleanup(threadsTearDown(store))
+
+		var thread Thread
+		status := doJSON(t, app, http.MethodPost, "/threads", ThreadRequest{
+			Messages: []ThreadMessageRequest{{Role: "user", Content: "Hello"}},
+			Metadata: map[string]string{"user": "1"},
+		}, &thread)
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "thread", thread.Object)
+		assert.Equal(t, "1", thread.Metadata["user"])
+
+		var got Thread
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID, nil, &got))
+		assert.Equal(t, thread, got)
+
+		var messages ListResponse[ThreadMessage]
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/messages", nil, &messages))
+		assert.Len(t, messages.Data, 1)
+		assert.Equal(t, "Hello", messages.Data[0].Content[0].Text.Value)
+		assert.Equal(t, thread.ID, messages.Data[0].ThreadID)
+
+		var message ThreadMessage
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/messages/"+messages.Data[0].ID, nil, &message))
+		assert.Equal(t, messages.Data[0], message)
+	})
+
+	t.Run("InvalidMessages", func(t *testing.T) {
+		t.Cleanup(threadsTearDown(store))
+
+		status := doJSON(t, app, http.MethodPost, "/threads", ThreadRequest{
+			Messages: []ThreadMessageRequest{{Role: "system", Content: "Hello"}},
+		}, nil)
+		assert.Equal(t, http.StatusBadRequest, status)
+		assert.Empty(t, bucketKeys(store, threadsBucket))
+
+		status = doJSON(t, app, http.MethodPost, "/threads/thread_missing/messages", ThreadMessageRequest{Role: "user", Content: "Hello"}, nil)
+		assert.Equal(t, http.StatusNotFound, status)
+	})
+
+	t.Run("ModifyAndDeleteThread", func(t *testing.T) {
+		t.Cleanup(threadsTearDown(store))
+
+		var thread Thread
+		doJSON(t, app, http.MethodPost, "/threads", ThreadRequest{Messages: []ThreadMessageRequest{{Role: "user", Content: "Hello"}}}, &thread)
+
+		var modified Thread
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID, ThreadRequest{Metadata: map[string]string{"a": "b"}}, &modified))
+		assert.Equal(t, map[string]string{"a": "b"}, modified.Metadata)
+
+		var deleted schema.DeleteThreadResponse
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodDelete, "/threads/"+thread.ID, nil, &deleted))
+		assert.True(t, deleted.Deleted)
+		assert.Empty(t, bucketKeys(store, threadsBucket))
+		assert.Empty(t, bucketKeys(store, messagesBucket(thread.ID)))
+
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID, nil, nil))
+	})
+
+	t.Run("PaginateMessages", func(t *testing.T) {
+		t.Cleanup(threadsTearDown(store))
+
+		var thread Thread
+		doJSON(t, app, http.MethodPost, "/threads", ThreadRequest{}, &thread)
+
+		ids := []string{}
+		for _, content := range []string{"one", "two", "three", "four"} {
+			var message ThreadMessage
+			assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/messages", ThreadMessageRequest{Role: "user", Content: content}, &message))
+			ids = append(ids, message.ID)
+		}
+
+		var page ListResponse[ThreadMessage]
+		doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/messages?limit=2", nil, &page)
+		assert.Len(t, page.Data, 2)
+		assert.Equal(t, ids[3], page.FirstID)
+		assert.Equal(t, ids[2], page.LastID)
+		assert.True(t, page.HasMore)
+
+		doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/messages?limit=2&after="+page.LastID, nil, &page)
+		assert.Equal(t, ids[1], page.FirstID)
+		assert.Equal(t, ids[0], page.LastID)
+		assert.False(t, page.HasMore)
+
+		doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/messages?order=asc&before="+ids[2], nil, &page)
+		assert.Len(t, page.Data, 2)
+		assert.Equal(t, ids[0], page.FirstID)
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/messages?limit=0", nil, nil))
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/messages?order=random", nil, nil))
+	})
+
+	t.Run("CreateRunValidation", func(t *testing.T) {
+		t.Cleanup(threadsTearDown(store))
+		putObjects(t, store, assistantsBucket, func(a Assistant) string { return a.ID }, Assistant{ID: "asst_1", Model: "missing-model"})
+
+		var thread Thread
+		doJSON(t, app, http.MethodPost, "/threads", ThreadRequest{}, &thread)
+
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodPost, "/threads/thread_missing/runs", RunRequest{AssistantID: "asst_1"}, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs", RunRequest{AssistantID: "asst_2"}, nil))
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs", RunRequest{AssistantID: "asst_1"}, nil))
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs", RunRequest{
+			AssistantID: "asst_1",
+			Tools:       []Tool{{Type: Function}},
+		}, nil))
+		assert.Empty(t, bucketKeys(store, runsBucket(thread.ID)))
+	})
+
+	t.Run("SubmitToolOutputsAndCancel", func(t *testing.T) {
+		t.Cleanup(threadsTearDown(store))
+
+		var thread Thread
+		doJSON(t, app, http.MethodPost, "/threads", ThreadRequest{Messages: []ThreadMessageRequest{{Role: "user", Content: "What's the weather?"}}}, &thread)
+
+		putObjects(t, store, runsBucket(thread.ID), func(r Run) string { return r.ID },
+			Run{ID: "run_1", Object: "thread.run", ThreadID: thread.ID, Status: RunCompleted},
+			Run{ID: "run_2", Object: "thread.run", ThreadID: thread.ID, Status: RunRequiresAction, RequiredAction: &RequiredAction{
+				Type: "submit_tool_outputs",
+				SubmitToolOutputs: SubmitToolOutputs{ToolCalls: []schema.ToolCall{
+					{ID: "call_1", Type: "function", FunctionCall: schema.FunctionCall{Name: "get_weather", Arguments: `{"city":"Rome"}`}},
+				}},
+			}},
+		)
+
+		var runs ListResponse[Run]
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/runs", nil, &runs))
+		assert.Len(t, runs.Data, 2)
+		assert.Equal(t, "run_2", runs.FirstID)
+
+		var run Run
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodGet, "/threads/"+thread.ID+"/runs/run_2", nil, &run))
+		assert.Equal(t, RunRequiresAction, run.Status)
+		assert.Equal(t, "get_weather", run.RequiredAction.SubmitToolOutputs.ToolCalls[0].FunctionCall.Name)
+
+		// Messages can't be added while the run waits for the tool outputs
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/messages", ThreadMessageRequest{Role: "user", Content: "Hello"}, nil))
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs/run_1/submit_tool_outputs", SubmitToolOutputsRequest{}, nil))
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs/run_2/submit_tool_outputs", SubmitToolOutputsRequest{
+			ToolOutputs: []ToolOutput{{ToolCallID: "call_2", Output: "sunny"}},
+		}, nil))
+		assert.Equal(t, http.StatusNotFound, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs/run_3/submit_tool_outputs", SubmitToolOutputsRequest{}, nil))
+
+		assert.Equal(t, http.StatusOK, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs/run_2/cancel", nil, &run))
+		assert.Equal(t, RunCancelled, run.Status)
+		assert.Nil(t, run.RequiredAction)
+
+		assert.Equal(t, http.StatusBadRequest, doJSON(t, app, http.MethodPost, "/threads/"+thread.ID+"/runs/run_2/cancel", nil, nil))
+	})
+}
+
+func TestInterruptRuns(t *testing.T) {
+	store := kvstore.NewMemoryStore()
+
+	putObjects(t, store, threadsBucket, func(th Thread) string { return th.ID }, Thread{ID: "thread_1"})
+	putObjects(t, store, runsBucket("thread_1"), func(r Run) string { return r.ID },
+		Run{ID: "run_1", ThreadID: "thread_1", Status: RunInProgress},
+		Run{ID: "run_2", ThreadID: "thread_1", Status: RunRequiresAction},
+		Run{ID: "run_3", ThreadID: "thread_1", Status: RunCompleted},
+	)
+
+	assert.NoError(t, InterruptRuns(store))
+
+	var runs []Run
+	assert.NoError(t, store.View(func(tx kvstore.Tx) (err error) {
+		runs, _, err = kvstore.List[Run](tx, runsBucket("thread_1"), kvstore.ListOptions{})
+		return
+	}))
+	assert.Equal(t, RunFailed, runs[0].Status)
+	assert.NotNil(t, runs[0].LastError)
+	assert.Equal(t, RunRequiresAction, runs[1].Status)
+	assert.Equal(t, RunCompleted, runs[2].Status)
+}
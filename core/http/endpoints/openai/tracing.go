@@ -0,0 +1,43 @@
+package openai
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/mudler/LocalAI/core/http/endpoints/openai")
+
+// withCorrelationID returns a copy of ctx with the correlation ID of the request. The ID is also set in the span of
+// the request and in the baggage propagated to the backends.
+func withCorrelationID(ctx context.Context, correlationID string) context.Context {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("localai.correlation_id", correlationID))
+	if member, err := baggage.NewMemberRaw("correlation_id", correlationID); err == nil {
+		if b, err := baggage.FromContext(ctx).SetMember(member); err == nil {
+			ctx = baggage.ContextWithBaggage(ctx, b)
+		}
+	}
+	return context.WithValue(ctx, CorrelationIDKey, correlationID)
+}
+
+// startSpan starts the span of a stage of the handling of the request of ctx, e.g. the evaluation of its template
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) trace.Span {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+	return span
+}
+
+// endSpan ends the span of a stage, which failed if err is not nil
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -10,6 +10,8 @@ import (
 
 	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/services"
 	model "github.com/mudler/LocalAI/pkg/model"
 
 	"github.com/gofiber/fiber/v2"
@@ -29,6 +31,7 @@ func TranscriptEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 		if err != nil {
 			return fmt.Errorf("failed reading parameters from request:%w", err)
 		}
+		defer input.Cancel()
 
 		config, input, err := mergeRequestWithConfig(m, input, cl, ml, appConfig.Debug, appConfig.Threads, appConfig.ContextSize, appConfig.F16)
 		if err != nil {
@@ -65,10 +68,14 @@ func TranscriptEndpoint(cl *config.BackendConfigLoader, ml *model.ModelLoader, a
 
 		log.Debug().Msgf("Audio file copied to: %+v", dst)
 
-		tr, err := backend.ModelTranscription(dst, input.Language, input.Translate, ml, *config, appConfig)
+		tr, err := backend.ModelTranscription(input.Context, dst, input.Language, input.Translate, ml, *config, appConfig)
 		if err != nil {
 			return err
 		}
+		servedModel(c, input, config)
+		if len(tr.Segments) > 0 {
+			fiberContext.RecordUsage(input.Context, usageModel(input.Context, config), services.Usage{AudioSeconds: tr.Segments[len(tr.Segments)-1].End.Seconds()})
+		}
 
 		log.Debug().Msgf("Trascribed: %+v", tr)
 		// TODO: handle different outputs here
@@ -0,0 +1,20 @@
+package openai
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOpenAIUsage(t *testing.T) {
+	data, err := json.Marshal(openAIUsage(backend.TokenUsage{Prompt: 10, Completion: 5, CachedPrompt: 8}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15, "prompt_tokens_details": {"cached_tokens": 8}}`, string(data))
+
+	// The backends which don't cache the prompt don't report the details
+	data, err = json.Marshal(openAIUsage(backend.TokenUsage{Prompt: 10, Completion: 5}))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"prompt_tokens": 10, "completion_tokens": 5, "total_tokens": 15}`, string(data))
+}
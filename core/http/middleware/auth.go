@@ -3,11 +3,16 @@ package middleware
 import (
 	"crypto/subtle"
 	"errors"
+	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/dave-gray101/v2keyauth"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/keyauth"
 	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/pkg/jwt"
 )
 
 // This file contains the configuration generators and handler functions that are used along with the fiber/keyauth middleware
@@ -19,11 +24,15 @@ func GetKeyAuthConfig(applicationConfig *config.ApplicationConfig) (*v2keyauth.C
 	if err != nil {
 		return nil, err
 	}
+	validator, err := getApiKeyValidationFunction(applicationConfig)
+	if err != nil {
+		return nil, err
+	}
 
 	return &v2keyauth.Config{
 		CustomKeyLookup: customLookup,
 		Next:            getApiKeyRequiredFilterFunction(applicationConfig),
-		Validator:       getApiKeyValidationFunction(applicationConfig),
+		Validator:       validator,
 		ErrorHandler:    getApiKeyErrorHandler(applicationConfig),
 		AuthScheme:      "Bearer",
 	}, nil
@@ -32,49 +41,155 @@ func GetKeyAuthConfig(applicationConfig *config.ApplicationConfig) (*v2keyauth.C
 func getApiKeyErrorHandler(applicationConfig *config.ApplicationConfig) fiber.ErrorHandler {
 	return func(ctx *fiber.Ctx, err error) error {
 		if errors.Is(err, v2keyauth.ErrMissingOrMalformedAPIKey) {
-			if len(applicationConfig.ApiKeys) == 0 {
+			if !authEnabled(applicationConfig) {
 				return ctx.Next() // if no keys are set up, any error we get here is not an error.
 			}
-			ctx.Set("WWW-Authenticate", "Bearer")
+			// The invalid JWTs have the reason of the rejection, e.g. an expired token
+			reason := ""
+			if err != v2keyauth.ErrMissingOrMalformedAPIKey {
+				reason = err.Error()
+				ctx.Set("WWW-Authenticate", fmt.Sprintf("Bearer error=\"invalid_token\", error_description=%q", reason))
+			} else {
+				ctx.Set("WWW-Authenticate", "Bearer")
+			}
 			if applicationConfig.OpaqueErrors {
 				return ctx.SendStatus(401)
 			}
-			return ctx.Status(401).Render("views/login", nil)
+			return ctx.Status(401).Render("views/login", fiber.Map{"Error": reason})
 		}
 		if applicationConfig.OpaqueErrors {
+			// The keys which are not allowed to call the endpoint or exceeded their limits get the status only
+			var e *fiber.Error
+			if errors.As(err, &e) {
+				return ctx.SendStatus(e.Code)
+			}
 			return ctx.SendStatus(500)
 		}
 		return err
 	}
 }
 
-func getApiKeyValidationFunction(applicationConfig *config.ApplicationConfig) func(*fiber.Ctx, string) (bool, error) {
-
+func getApiKeyValidationFunction(applicationConfig *config.ApplicationConfig) (func(*fiber.Ctx, string) (bool, error), error) {
+	equal := func(apiKey, validKey string) bool {
+		return apiKey == validKey
+	}
 	if applicationConfig.UseSubtleKeyComparison {
-		return func(ctx *fiber.Ctx, apiKey string) (bool, error) {
-			if len(applicationConfig.ApiKeys) == 0 {
-				return true, nil // If no keys are setup, accept everything
-			}
-			for _, validKey := range applicationConfig.ApiKeys {
-				if subtle.ConstantTimeCompare([]byte(apiKey), []byte(validKey)) == 1 {
-					return true, nil
-				}
-			}
-			return false, v2keyauth.ErrMissingOrMalformedAPIKey
+		equal = func(apiKey, validKey string) bool {
+			return subtle.ConstantTimeCompare([]byte(apiKey), []byte(validKey)) == 1
 		}
 	}
 
+	var verifier *jwt.Verifier
+	switch {
+	case applicationConfig.JWTJWKSFile != "":
+		verifier = jwt.NewFileVerifier(applicationConfig.JWTJWKSFile, applicationConfig.JWTIssuer, applicationConfig.JWTAudience)
+	case applicationConfig.JWTIssuer != "":
+		var err error
+		if verifier, err = jwt.NewIssuerVerifier(applicationConfig.JWTIssuer, applicationConfig.JWTAudience); err != nil {
+			return nil, err
+		}
+	}
+
+	limits := newAPIKeyLimits()
 	return func(ctx *fiber.Ctx, apiKey string) (bool, error) {
-		if len(applicationConfig.ApiKeys) == 0 {
+		if !authEnabled(applicationConfig) {
 			return true, nil // If no keys are setup, accept everything
 		}
 		for _, validKey := range applicationConfig.ApiKeys {
-			if apiKey == validKey {
+			if equal(apiKey, validKey) {
+				// The keys without an identity in api_keys.json have no restrictions
+				key, exists := applicationConfig.ApiKeyIdentities[validKey]
+				if !exists {
+					key = config.APIKey{Key: validKey}
+				}
+				if err := authorize(ctx, limits, key); err != nil {
+					return false, err
+				}
 				return true, nil
 			}
 		}
+		if verifier != nil && jwt.IsToken(apiKey) {
+			key, err := jwtIdentity(applicationConfig, verifier, apiKey)
+			if err != nil {
+				return false, err
+			}
+			if err := authorize(ctx, limits, key); err != nil {
+				return false, err
+			}
+			return true, nil
+		}
 		return false, v2keyauth.ErrMissingOrMalformedAPIKey
+	}, nil
+}
+
+// authEnabled returns true if the requests must be authenticated, with an API key or a JWT
+func authEnabled(applicationConfig *config.ApplicationConfig) bool {
+	return len(applicationConfig.ApiKeys) > 0 || applicationConfig.JWTEnabled()
+}
+
+// jwtIdentity verifies a JWT and returns the identity of its user as an API key, with the access policy of their
+// groups. The users who are not in any of the groups of jwt_groups.json, nor covered by the "*" group, are rejected:
+// the tokens have no scope until their groups are configured.
+func jwtIdentity(applicationConfig *config.ApplicationConfig, verifier *jwt.Verifier, token string) (config.APIKey, error) {
+	claims, err := verifier.Verify(token)
+	if err != nil {
+		return config.APIKey{}, fmt.Errorf("%w: %w", v2keyauth.ErrMissingOrMalformedAPIKey, err)
+	}
+
+	nameClaim, groupsClaim := applicationConfig.JWTNameClaim, applicationConfig.JWTGroupsClaim
+	if nameClaim == "" {
+		nameClaim = "sub"
+	}
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+	subject := claims.String("sub")
+	name := claims.String(nameClaim)
+	if name == "" {
+		name = subject
+	}
+	// The key expires when the token does, with the leeway of the validation of the token
+	expiresAt := claims.Time("exp").Add(jwt.Leeway)
+	key := config.APIKey{Key: "jwt:" + subject, Name: name, ExpiresAt: &expiresAt}
+
+	var policies []config.AccessPolicy
+	for _, group := range append([]string{"*"}, claims.Strings(groupsClaim)...) {
+		if policy, exists := applicationConfig.JWTGroups[group]; exists {
+			policies = append(policies, policy)
+		}
+	}
+	if len(policies) == 0 {
+		return config.APIKey{}, fiber.NewError(fiber.StatusForbidden, "the token is not in any group allowed to use LocalAI")
+	}
+	key.AccessPolicy = config.MergeAccessPolicies(policies...)
+	return key, nil
+}
+
+// authorize checks that the API key can call the endpoint of the request, with its model, within its limits. It sets
+// the identity of the request.
+func authorize(ctx *fiber.Ctx, limits *apiKeyLimits, key config.APIKey) error {
+	if key.Expired(time.Now()) {
+		return fiber.NewError(fiber.StatusUnauthorized, "the API key is expired")
+	}
+	if scope := endpointScope(ctx.Path()); !key.HasScope(scope) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("the API key doesn't have the %s scope", scope))
+	}
+	if model := requestModel(ctx); model != "" && !key.AllowsModel(model) {
+		return fiber.NewError(fiber.StatusForbidden, fmt.Sprintf("the API key is not allowed to use the model %s", model))
+	}
+	if retryAfter, err := limits.allow(key); err != nil {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(retryAfter.Seconds())+1))
+		return err
+	}
+
+	var recordTokens func(int)
+	if key.TokensPerDay > 0 {
+		recordTokens = func(tokens int) {
+			limits.addTokens(key.Key, tokens)
+		}
 	}
+	fiberContext.SetIdentity(ctx, fiberContext.NewIdentity(key, recordTokens))
+	return nil
 }
 
 func getApiKeyRequiredFilterFunction(applicationConfig *config.ApplicationConfig) func(*fiber.Ctx) bool {
@@ -0,0 +1,219 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dave-gray101/v2keyauth"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIKeyIdentities(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	// The opaque errors only have the status, the login view is not rendered
+	appConfig := config.NewApplicationConfig(
+		config.WithOpaqueErrors(true),
+		config.WithApiKeys([]string{"admin-key"}),
+		config.WithApiKeyIdentity(config.APIKey{Key: "team-key", Name: "team", AccessPolicy: config.AccessPolicy{Scopes: []config.APIKeyScope{config.APIKeyScopeInference}, Models: []string{"phi"}, TokensPerDay: 100}}),
+		config.WithApiKeyIdentity(config.APIKey{Key: "expired-key", Name: "old", ExpiresAt: &expired}),
+	)
+	kaConfig, err := GetKeyAuthConfig(appConfig)
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(v2keyauth.New(*kaConfig))
+	app.Post("/v1/chat/completions", func(c *fiber.Ctx) error {
+		fiberContext.RecordUsage(fiberContext.WithUsage(c.Context(), fiberContext.UsageFromContext(c)), "phi", services.Usage{PromptTokens: 40, CompletionTokens: 20})
+		return c.SendString(fiberContext.IdentityFromContext(c).Name)
+	})
+	app.Post("/models/apply", func(c *fiber.Ctx) error {
+		return c.SendString(fiberContext.IdentityFromContext(c).Name)
+	})
+
+	request := func(key, path, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode, resp.Header.Get(fiber.HeaderRetryAfter)
+	}
+
+	// The keys without an identity have no restrictions
+	status, _ := request("admin-key", "/models/apply", `{}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request("admin-key", "/v1/chat/completions", `{"model": "llama"}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	status, _ = request("team-key", "/models/apply", `{}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	// The routes are case-insensitive
+	for _, path := range []string{"/MODELS/apply", "/Models/Apply"} {
+		status, _ = request("team-key", path, `{}`)
+		assert.Equal(t, http.StatusForbidden, status, path)
+	}
+	status, _ = request("team-key", "/v1/chat/completions", `{"model": "llama"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = request("expired-key", "/v1/chat/completions", `{"model": "phi"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = request("unknown-key", "/v1/chat/completions", `{"model": "phi"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// The requests are rejected once the tokens of the day are used
+	status, _ = request("team-key", "/v1/chat/completions", `{"model": "phi"}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request("team-key", "/v1/chat/completions", `{"model": "phi"}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, retryAfter := request("team-key", "/v1/chat/completions", `{"model": "phi"}`)
+	assert.Equal(t, http.StatusTooManyRequests, status)
+	assert.NotEmpty(t, retryAfter)
+}
+
+func TestAPIKeyLimits(t *testing.T) {
+	now := time.Date(2025, 1, 1, 23, 59, 0, 0, time.UTC)
+	limits := newAPIKeyLimits()
+	limits.now = func() time.Time { return now }
+	key := config.APIKey{Key: "key", AccessPolicy: config.AccessPolicy{RequestsPerMinute: 2, TokensPerDay: 1000}}
+
+	for range 2 {
+		_, err := limits.allow(key)
+		assert.NoError(t, err)
+	}
+	retryAfter, err := limits.allow(key)
+	assert.Error(t, err)
+	assert.Equal(t, time.Minute, retryAfter)
+
+	now = now.Add(30 * time.Second)
+	limits.addTokens(key.Key, 1000)
+	retryAfter, err = limits.allow(key)
+	assert.Error(t, err)
+	assert.Equal(t, 30*time.Second, retryAfter)
+
+	// The requests and the tokens are counted again in the next minute and day
+	now = now.Add(30 * time.Second)
+	_, err = limits.allow(key)
+	assert.NoError(t, err)
+}
+
+func TestEndpointScope(t *testing.T) {
+	for path, scope := range map[string]config.APIKeyScope{
+		"/v1/chat/completions": config.APIKeyScopeInference,
+		"/models":              config.APIKeyScopeInference,
+		"/models/apply":        config.APIKeyScopeGallery,
+		"/models/delete/phi":   config.APIKeyScopeGallery,
+		"/models/galleries":    config.APIKeyScopeAdmin,
+		"/backend/shutdown":    config.APIKeyScopeAdmin,
+		"/BACKEND/shutdown":    config.APIKeyScopeAdmin,
+		"/Backend/Shutdown":    config.APIKeyScopeAdmin,
+		"/stores/set":          config.APIKeyScopeStores,
+		"/Stores/Set":          config.APIKeyScopeStores,
+		"/V1/Collections":      config.APIKeyScopeStores,
+		"/v1/collections/docs": config.APIKeyScopeStores,
+		"/systematic":          config.APIKeyScopeInference,
+	} {
+		assert.Equal(t, scope, endpointScope(path), path)
+	}
+}
+
+func TestJWTAuthentication(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	jwks := filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(jwks, []byte(fmt.Sprintf(`{"keys": [{"kty": "OKP", "crv": "Ed25519", "kid": "sso", "x": %q}]}`, base64.RawURLEncoding.EncodeToString(public))), 0600))
+
+	token := func(claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": "EdDSA", "kid": "sso"})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		return signed + "." + base64.RawURLEncoding.EncodeToString(ed25519.Sign(private, []byte(signed)))
+	}
+
+	appConfig := config.NewApplicationConfig(
+		config.WithOpaqueErrors(true),
+		config.WithApiKeys([]string{"admin-key"}),
+		config.WithJWTJWKSFile(jwks),
+		config.WithJWTIssuer("https://sso.example.com"),
+		config.WithJWTClaims("email", "realm_access.roles"),
+		config.WithJWTGroup("*", config.AccessPolicy{Scopes: []config.APIKeyScope{config.APIKeyScopeInference}, Models: []string{"phi"}}),
+		config.WithJWTGroup("ml", config.AccessPolicy{Scopes: []config.APIKeyScope{config.APIKeyScopeInference}, Models: []string{"llama"}}),
+		config.WithJWTGroup("ops", config.AccessPolicy{}),
+	)
+	kaConfig, err := GetKeyAuthConfig(appConfig)
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(v2keyauth.New(*kaConfig))
+	app.Post("/v1/chat/completions", func(c *fiber.Ctx) error {
+		return c.SendString(fiberContext.IdentityFromContext(c).Name)
+	})
+	app.Post("/models/apply", func(c *fiber.Ctx) error {
+		return c.SendString(fiberContext.IdentityFromContext(c).Name)
+	})
+
+	request := func(key, path, body string) (int, string) {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		name, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(name)
+	}
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	alice := token(map[string]any{"iss": "https://sso.example.com", "sub": "1", "email": "alice@example.com", "exp": exp, "realm_access": map[string]any{"roles": []string{"ml"}}})
+	bob := token(map[string]any{"iss": "https://sso.example.com", "sub": "2", "email": "bob@example.com", "exp": exp, "realm_access": map[string]any{"roles": []string{"ops"}}})
+
+	// The policies of the groups of the user are merged with the policy of all the users
+	status, name := request(alice, "/v1/chat/completions", `{"model": "llama"}`)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "alice@example.com", name)
+	status, _ = request(alice, "/v1/chat/completions", `{"model": "phi"}`)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = request(alice, "/v1/chat/completions", `{"model": "mistral"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = request(alice, "/models/apply", `{}`)
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = request(bob, "/models/apply", `{}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	// The static API keys are still accepted
+	status, _ = request("admin-key", "/models/apply", `{}`)
+	assert.Equal(t, http.StatusOK, status)
+
+	for _, invalid := range []string{
+		token(map[string]any{"iss": "https://sso.example.com", "sub": "1", "exp": float64(time.Now().Add(-time.Hour).Unix())}),
+		token(map[string]any{"iss": "https://other.example.com", "sub": "1", "exp": exp}),
+		token(map[string]any{"iss": "https://sso.example.com", "sub": "1"}),
+		alice[:len(alice)-4] + "AAAA",
+	} {
+		status, _ = request(invalid, "/v1/chat/completions", `{"model": "phi"}`)
+		assert.Equal(t, http.StatusUnauthorized, status)
+	}
+
+	// Without groups, the tokens have no scope
+	appConfig.JWTGroups = nil
+	status, _ = request(bob, "/v1/chat/completions", `{"model": "phi"}`)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// The tokens of an issuer must have an audience
+	_, err = GetKeyAuthConfig(config.NewApplicationConfig(config.WithJWTIssuer("https://sso.example.com")))
+	assert.Error(t, err)
+}
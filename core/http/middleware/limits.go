@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+)
+
+// scopePaths are the paths of the endpoints of the scopes, the other endpoints are in the inference scope
+var scopePaths = map[config.APIKeyScope][]string{
+	config.APIKeyScopeAdmin:   {"/models/galleries", "/backend", "/system", "/metrics", "/api/p2p", "/p2p"},
+	config.APIKeyScopeGallery: {"/models/apply", "/models/delete", "/models/available", "/models/jobs", "/browse"},
+	config.APIKeyScopeStores:  {"/stores", "/v1/collections"},
+}
+
+// endpointScope returns the scope of the endpoint of path. The routes are case-insensitive, so is the path.
+func endpointScope(path string) config.APIKeyScope {
+	path = strings.ToLower(path)
+	for scope, paths := range scopePaths {
+		for _, p := range paths {
+			if path == p || strings.HasPrefix(path, p+"/") {
+				return scope
+			}
+		}
+	}
+	return config.APIKeyScopeInference
+}
+
+// requestModel returns the model of the request, from the query or the body, empty if the request has none. The
+// models of the paths are only known once the request is routed, ModelFromContext checks them.
+func requestModel(c *fiber.Ctx) string {
+	if model := c.Query("model"); model != "" {
+		return model
+	}
+	if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) {
+		var body struct {
+			Model any `json:"model"`
+		}
+		if err := json.Unmarshal(c.Body(), &body); err == nil {
+			model, _ := body.Model.(string)
+			return model
+		}
+		return ""
+	}
+	return c.FormValue("model")
+}
+
+// apiKeyLimits counts the requests and the tokens of the API keys, in windows of a minute and of a day
+type apiKeyLimits struct {
+	sync.Mutex
+	usage map[string]*apiKeyUsage
+	now   func() time.Time
+}
+
+type apiKeyUsage struct {
+	minute   time.Time
+	requests int
+	day      time.Time
+	tokens   int
+}
+
+func newAPIKeyLimits() *apiKeyLimits {
+	return &apiKeyLimits{usage: map[string]*apiKeyUsage{}, now: time.Now}
+}
+
+// get returns the usage of key in the current windows
+func (l *apiKeyLimits) get(key string) *apiKeyUsage {
+	now := l.now().UTC()
+	usage, exists := l.usage[key]
+	if !exists {
+		usage = &apiKeyUsage{}
+		l.usage[key] = usage
+	}
+	if minute := now.Truncate(time.Minute); !usage.minute.Equal(minute) {
+		usage.minute, usage.requests = minute, 0
+	}
+	if day := now.Truncate(24 * time.Hour); !usage.day.Equal(day) {
+		usage.day, usage.tokens = day, 0
+	}
+	return usage
+}
+
+// allow counts a request of key. If the key exceeded one of its limits, the request is not counted and allow returns
+// an error with the time to wait until the limit is reset.
+func (l *apiKeyLimits) allow(key config.APIKey) (time.Duration, error) {
+	if key.RequestsPerMinute == 0 && key.TokensPerDay == 0 {
+		return 0, nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+	usage := l.get(key.Key)
+	now := l.now().UTC()
+	if key.TokensPerDay > 0 && usage.tokens >= key.TokensPerDay {
+		return usage.day.Add(24 * time.Hour).Sub(now), fiber.NewError(fiber.StatusTooManyRequests, "the API key used all its tokens of the day")
+	}
+	if key.RequestsPerMinute > 0 && usage.requests >= key.RequestsPerMinute {
+		return usage.minute.Add(time.Minute).Sub(now), fiber.NewError(fiber.StatusTooManyRequests, "the API key exceeded its requests per minute")
+	}
+	usage.requests++
+	return 0, nil
+}
+
+// addTokens counts the tokens used by a request of key
+func (l *apiKeyLimits) addTokens(key string, tokens int) {
+	l.Lock()
+	defer l.Unlock()
+	l.get(key).tokens += tokens
+}
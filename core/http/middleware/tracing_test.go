@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"bufio"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingStreamedResponse(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	sent := make(chan struct{})
+	app := fiber.New()
+	app.Use(Tracing())
+	app.Get("/stream", func(c *fiber.Ctx) error {
+		endSpan := fiberContext.StreamSpan(c)
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			defer endSpan()
+			<-sent
+			w.WriteString("data: done\n\n")
+			w.Flush()
+		}))
+		return nil
+	})
+	app.Get("/plain", func(c *fiber.Ctx) error {
+		return c.SendString("done")
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/plain", nil))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Len(t, recorder.Ended(), 1)
+	assert.Equal(t, "GET /plain", recorder.Ended()[0].Name())
+
+	go func() {
+		// The span of the streamed request is still running once the handler returned, until the body is sent
+		assert.Eventually(t, func() bool { return len(recorder.Started()) == 2 }, time.Second, 10*time.Millisecond)
+		assert.Never(t, func() bool { return len(recorder.Ended()) == 2 }, 100*time.Millisecond, 10*time.Millisecond)
+		close(sent)
+	}()
+	resp, err = app.Test(httptest.NewRequest("GET", "/stream", nil))
+	assert.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, "data: done\n\n", string(body))
+	assert.Eventually(t, func() bool { return len(recorder.Ended()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "GET /stream", recorder.Ended()[1].Name())
+}
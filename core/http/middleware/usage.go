@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+)
+
+// Usage sets the recorder in which the endpoints record the resources used by the requests, and records the requests
+// once handled, with their API key and their model
+func Usage(recorder fiberContext.UsageRecorder) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		fiberContext.SetUsageRecorder(c, recorder)
+		err := c.Next()
+		fiberContext.RecordRequest(c)
+		return err
+	}
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dave-gray101/v2keyauth"
+	"github.com/gofiber/fiber/v2"
+	"github.com/mudler/LocalAI/core/config"
+	fiberContext "github.com/mudler/LocalAI/core/http/ctx"
+	"github.com/mudler/LocalAI/core/http/endpoints/localai"
+	"github.com/mudler/LocalAI/core/services"
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUsage(t *testing.T) {
+	appConfig := config.NewApplicationConfig(
+		config.WithApiKeyIdentity(config.APIKey{Key: "admin-key", Name: "admin"}),
+		config.WithApiKeyIdentity(config.APIKey{Key: "team-key", Name: "team", AccessPolicy: config.AccessPolicy{Scopes: []config.APIKeyScope{config.APIKeyScopeInference}}}),
+		// The usage of the keys with the same name is not shared
+		config.WithApiKeyIdentity(config.APIKey{Key: "other-team-key", Name: "team", AccessPolicy: config.AccessPolicy{Scopes: []config.APIKeyScope{config.APIKeyScopeInference}}}),
+	)
+	kaConfig, err := GetKeyAuthConfig(appConfig)
+	assert.NoError(t, err)
+	usage, err := services.NewUsageService(kvstore.NewMemoryStore(), 0)
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(v2keyauth.New(*kaConfig))
+	app.Use(Usage(usage))
+	app.Post("/v1/chat/completions", func(c *fiber.Ctx) error {
+		fiberContext.SetModel(c, c.Query("model"))
+		fiberContext.RecordUsage(fiberContext.WithUsage(c.Context(), fiberContext.UsageFromContext(c)), c.Query("model"), services.Usage{PromptTokens: 10, CompletionTokens: 5})
+		return nil
+	})
+	app.Post("/v1/images/generations", func(c *fiber.Ctx) error {
+		fiberContext.SetModel(c, "sd")
+		fiberContext.RecordUsage(fiberContext.WithUsage(c.Context(), fiberContext.UsageFromContext(c)), "sd", services.Usage{Images: 2})
+		return nil
+	})
+	app.Get("/v1/usage", localai.UsageEndpoint(usage))
+
+	request := func(key, method, url string, out any) int {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		if out != nil {
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(out))
+		}
+		return resp.StatusCode
+	}
+
+	request("admin-key", http.MethodPost, "/v1/chat/completions?model=phi", nil)
+	request("team-key", http.MethodPost, "/v1/chat/completions?model=phi", nil)
+	request("team-key", http.MethodPost, "/v1/chat/completions?model=llama", nil)
+	request("team-key", http.MethodPost, "/v1/images/generations", nil)
+	request("other-team-key", http.MethodPost, "/v1/chat/completions?model=phi", nil)
+
+	keyID := func(key string) string {
+		return fiberContext.NewIdentity(config.APIKey{Key: key}, nil).ID()
+	}
+	var report localai.UsageResponse
+	assert.Equal(t, http.StatusOK, request("admin-key", http.MethodGet, "/v1/usage?group_by=key,model", &report))
+	assert.ElementsMatch(t, []services.UsageGroup{
+		{KeyID: keyID("admin-key"), Key: "admin", Model: "phi", Usage: services.Usage{Requests: 1, PromptTokens: 10, CompletionTokens: 5}},
+		{KeyID: keyID("team-key"), Key: "team", Model: "llama", Usage: services.Usage{Requests: 1, PromptTokens: 10, CompletionTokens: 5}},
+		{KeyID: keyID("team-key"), Key: "team", Model: "phi", Usage: services.Usage{Requests: 1, PromptTokens: 10, CompletionTokens: 5}},
+		{KeyID: keyID("team-key"), Key: "team", Model: "sd", Usage: services.Usage{Requests: 1, Images: 2}},
+		{KeyID: keyID("other-team-key"), Key: "team", Model: "phi", Usage: services.Usage{Requests: 1, PromptTokens: 10, CompletionTokens: 5}},
+	}, report.Data)
+
+	// The keys without the admin scope only get their own usage
+	report = localai.UsageResponse{}
+	assert.Equal(t, http.StatusOK, request("team-key", http.MethodGet, "/v1/usage?group_by=endpoint", &report))
+	assert.Equal(t, []services.UsageGroup{
+		{Endpoint: "/v1/chat/completions", Usage: services.Usage{Requests: 2, PromptTokens: 20, CompletionTokens: 10}},
+		{Endpoint: "/v1/images/generations", Usage: services.Usage{Requests: 1, Images: 2}},
+	}, report.Data)
+
+	// The usage of the previous days is not reported
+	report = localai.UsageResponse{}
+	assert.Equal(t, http.StatusOK, request("admin-key", http.MethodGet, "/v1/usage?to=2020-01-01", &report))
+	assert.Empty(t, report.Data)
+
+	assert.Equal(t, http.StatusBadRequest, request("admin-key", http.MethodGet, "/v1/usage?group_by=team", nil))
+	assert.Equal(t, http.StatusBadRequest, request("admin-key", http.MethodGet, "/v1/usage?from=yesterday", nil))
+}
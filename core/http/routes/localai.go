@@ -15,7 +15,10 @@ func RegisterLocalAIRoutes(router *fiber.App,
 	cl *config.BackendConfigLoader,
 	ml *model.ModelLoader,
 	appConfig *config.ApplicationConfig,
-	galleryService *services.GalleryService) {
+	galleryService *services.GalleryService,
+	sl *model.ModelLoader,
+	collectionsService *services.CollectionsService,
+	usageService *services.UsageService) {
 
 	router.Get("/swagger/*", swagger.HandlerDefault) // default
 
@@ -37,11 +40,22 @@ func RegisterLocalAIRoutes(router *fiber.App,
 	router.Post("/vad", localai.VADEndpoint(cl, ml, appConfig))
 
 	// Stores
-	sl := model.NewModelLoader("")
 	router.Post("/stores/set", localai.StoresSetEndpoint(sl, appConfig))
 	router.Post("/stores/delete", localai.StoresDeleteEndpoint(sl, appConfig))
 	router.Post("/stores/get", localai.StoresGetEndpoint(sl, appConfig))
 	router.Post("/stores/find", localai.StoresFindEndpoint(sl, appConfig))
+	router.Post("/stores/list", localai.StoresListEndpoint(sl, appConfig))
+	router.Post("/stores/count", localai.StoresCountEndpoint(sl, appConfig))
+	router.Post("/stores/drop", localai.StoresDropEndpoint(sl, appConfig))
+
+	// Collections: text-in/text-out retrieval on top of the stores
+	router.Post("/v1/collections", localai.CreateCollectionEndpoint(collectionsService))
+	router.Get("/v1/collections", localai.ListCollectionsEndpoint(collectionsService))
+	router.Get("/v1/collections/:name", localai.GetCollectionEndpoint(collectionsService))
+	router.Delete("/v1/collections/:name", localai.DeleteCollectionEndpoint(collectionsService))
+	router.Post("/v1/collections/:name/documents", localai.AddCollectionDocumentsEndpoint(collectionsService))
+	router.Delete("/v1/collections/:name/documents/:id", localai.DeleteCollectionDocumentEndpoint(collectionsService))
+	router.Post("/v1/collections/:name/query", localai.QueryCollectionEndpoint(collectionsService))
 
 	if !appConfig.DisableMetrics {
 		router.Get("/metrics", localai.LocalAIMetricsEndpoint())
@@ -68,5 +82,6 @@ func RegisterLocalAIRoutes(router *fiber.App,
 
 	// misc
 	router.Post("/v1/tokenize", localai.TokenizeEndpoint(cl, ml, appConfig))
+	router.Get("/v1/usage", localai.UsageEndpoint(usageService))
 
 }
@@ -17,6 +17,8 @@ func RegisterOpenAIRoutes(app *fiber.App,
 			application.BackendLoader(),
 			application.ModelLoader(),
 			application.TemplatesEvaluator(),
+			application.CollectionsService(),
+			application.MetadataStore(),
 			application.ApplicationConfig(),
 		),
 	)
@@ -26,6 +28,8 @@ func RegisterOpenAIRoutes(app *fiber.App,
 			application.BackendLoader(),
 			application.ModelLoader(),
 			application.TemplatesEvaluator(),
+			application.CollectionsService(),
+			application.MetadataStore(),
 			application.ApplicationConfig(),
 		),
 	)
@@ -50,36 +54,74 @@ func RegisterOpenAIRoutes(app *fiber.App,
 	)
 
 	// assistant
-	app.Get("/v1/assistants", openai.ListAssistantsEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Get("/assistants", openai.ListAssistantsEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Post("/v1/assistants", openai.CreateAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Post("/assistants", openai.CreateAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Delete("/v1/assistants/:assistant_id", openai.DeleteAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Delete("/assistants/:assistant_id", openai.DeleteAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Get("/v1/assistants/:assistant_id", openai.GetAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Get("/assistants/:assistant_id", openai.GetAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Post("/v1/assistants/:assistant_id", openai.ModifyAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Post("/assistants/:assistant_id", openai.ModifyAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Get("/v1/assistants/:assistant_id/files", openai.ListAssistantFilesEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Get("/assistants/:assistant_id/files", openai.ListAssistantFilesEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Post("/v1/assistants/:assistant_id/files", openai.CreateAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Post("/assistants/:assistant_id/files", openai.CreateAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Delete("/v1/assistants/:assistant_id/files/:file_id", openai.DeleteAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Delete("/assistants/:assistant_id/files/:file_id", openai.DeleteAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Get("/v1/assistants/:assistant_id/files/:file_id", openai.GetAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
-	app.Get("/assistants/:assistant_id/files/:file_id", openai.GetAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
+	app.Get("/v1/assistants", openai.ListAssistantsEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/assistants", openai.ListAssistantsEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/v1/assistants", openai.CreateAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/assistants", openai.CreateAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Delete("/v1/assistants/:assistant_id", openai.DeleteAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Delete("/assistants/:assistant_id", openai.DeleteAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/assistants/:assistant_id", openai.GetAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/assistants/:assistant_id", openai.GetAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/v1/assistants/:assistant_id", openai.ModifyAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/assistants/:assistant_id", openai.ModifyAssistantEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/assistants/:assistant_id/files", openai.ListAssistantFilesEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/assistants/:assistant_id/files", openai.ListAssistantFilesEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/v1/assistants/:assistant_id/files", openai.CreateAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/assistants/:assistant_id/files", openai.CreateAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Delete("/v1/assistants/:assistant_id/files/:file_id", openai.DeleteAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Delete("/assistants/:assistant_id/files/:file_id", openai.DeleteAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/assistants/:assistant_id/files/:file_id", openai.GetAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/assistants/:assistant_id/files/:file_id", openai.GetAssistantFileEndpoint(application.BackendLoader(), application.ModelLoader(), application.MetadataStore(), application.ApplicationConfig()))
+
+	// threads
+	app.Post("/v1/threads", openai.CreateThreadEndpoint(application.MetadataStore()))
+	app.Post("/threads", openai.CreateThreadEndpoint(application.MetadataStore()))
+	app.Post("/v1/threads/runs", openai.CreateThreadAndRunEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.CollectionsService(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/threads/runs", openai.CreateThreadAndRunEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.CollectionsService(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/threads/:thread_id", openai.GetThreadEndpoint(application.MetadataStore()))
+	app.Get("/threads/:thread_id", openai.GetThreadEndpoint(application.MetadataStore()))
+	app.Post("/v1/threads/:thread_id", openai.ModifyThreadEndpoint(application.MetadataStore()))
+	app.Post("/threads/:thread_id", openai.ModifyThreadEndpoint(application.MetadataStore()))
+	app.Delete("/v1/threads/:thread_id", openai.DeleteThreadEndpoint(application.MetadataStore()))
+	app.Delete("/threads/:thread_id", openai.DeleteThreadEndpoint(application.MetadataStore()))
+	app.Get("/v1/threads/:thread_id/messages", openai.ListMessagesEndpoint(application.MetadataStore()))
+	app.Get("/threads/:thread_id/messages", openai.ListMessagesEndpoint(application.MetadataStore()))
+	app.Post("/v1/threads/:thread_id/messages", openai.CreateMessageEndpoint(application.MetadataStore()))
+	app.Post("/threads/:thread_id/messages", openai.CreateMessageEndpoint(application.MetadataStore()))
+	app.Get("/v1/threads/:thread_id/messages/:message_id", openai.GetMessageEndpoint(application.MetadataStore()))
+	app.Get("/threads/:thread_id/messages/:message_id", openai.GetMessageEndpoint(application.MetadataStore()))
+
+	// runs
+	app.Get("/v1/threads/:thread_id/runs", openai.ListRunsEndpoint(application.MetadataStore()))
+	app.Get("/threads/:thread_id/runs", openai.ListRunsEndpoint(application.MetadataStore()))
+	app.Post("/v1/threads/:thread_id/runs", openai.CreateRunEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.CollectionsService(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/threads/:thread_id/runs", openai.CreateRunEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.CollectionsService(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/threads/:thread_id/runs/:run_id", openai.GetRunEndpoint(application.MetadataStore()))
+	app.Get("/threads/:thread_id/runs/:run_id", openai.GetRunEndpoint(application.MetadataStore()))
+	app.Post("/v1/threads/:thread_id/runs/:run_id/submit_tool_outputs", openai.SubmitToolOutputsEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.CollectionsService(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/threads/:thread_id/runs/:run_id/submit_tool_outputs", openai.SubmitToolOutputsEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.CollectionsService(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/v1/threads/:thread_id/runs/:run_id/cancel", openai.CancelRunEndpoint(application.MetadataStore()))
+	app.Post("/threads/:thread_id/runs/:run_id/cancel", openai.CancelRunEndpoint(application.MetadataStore()))
+
+	// responses
+	app.Post("/v1/responses", openai.CreateResponseEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/responses", openai.CreateResponseEndpoint(application.BackendLoader(), application.ModelLoader(), application.TemplatesEvaluator(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/responses/:response_id", openai.GetResponseEndpoint(application.MetadataStore()))
+	app.Get("/responses/:response_id", openai.GetResponseEndpoint(application.MetadataStore()))
+	app.Delete("/v1/responses/:response_id", openai.DeleteResponseEndpoint(application.MetadataStore()))
+	app.Delete("/responses/:response_id", openai.DeleteResponseEndpoint(application.MetadataStore()))
 
 	// files
-	app.Post("/v1/files", openai.UploadFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Post("/files", openai.UploadFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Get("/v1/files", openai.ListFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Get("/files", openai.ListFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Get("/v1/files/:file_id", openai.GetFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Get("/files/:file_id", openai.GetFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Delete("/v1/files/:file_id", openai.DeleteFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Delete("/files/:file_id", openai.DeleteFilesEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Get("/v1/files/:file_id/content", openai.GetFilesContentsEndpoint(application.BackendLoader(), application.ApplicationConfig()))
-	app.Get("/files/:file_id/content", openai.GetFilesContentsEndpoint(application.BackendLoader(), application.ApplicationConfig()))
+	app.Post("/v1/files", openai.UploadFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/files", openai.UploadFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/files", openai.ListFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/files", openai.ListFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/files/:file_id", openai.GetFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/files/:file_id", openai.GetFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Delete("/v1/files/:file_id", openai.DeleteFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Delete("/files/:file_id", openai.DeleteFilesEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/files/:file_id/content", openai.GetFilesContentsEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/files/:file_id/content", openai.GetFilesContentsEndpoint(application.BackendLoader(), application.MetadataStore(), application.ApplicationConfig()))
 
 	// completion
 	app.Post("/v1/completions",
@@ -114,6 +156,33 @@ func RegisterOpenAIRoutes(app *fiber.App,
 	app.Post("/embeddings", openai.EmbeddingsEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
 	app.Post("/v1/engines/:model/embeddings", openai.EmbeddingsEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
 
+	// batches, processed by the same handlers as the requests received by the API
+	batchHandlers := map[string]fiber.Handler{
+		"/v1/chat/completions": openai.ChatEndpoint(
+			application.BackendLoader(),
+			application.ModelLoader(),
+			application.TemplatesEvaluator(),
+			application.CollectionsService(),
+			application.MetadataStore(),
+			application.ApplicationConfig(),
+		),
+		"/v1/completions": openai.CompletionEndpoint(
+			application.BackendLoader(),
+			application.ModelLoader(),
+			application.TemplatesEvaluator(),
+			application.ApplicationConfig(),
+		),
+		"/v1/embeddings": openai.EmbeddingsEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()),
+	}
+	app.Post("/v1/batches", openai.CreateBatchEndpoint(app, batchHandlers, application.MetadataStore(), application.ApplicationConfig()))
+	app.Post("/batches", openai.CreateBatchEndpoint(app, batchHandlers, application.MetadataStore(), application.ApplicationConfig()))
+	app.Get("/v1/batches", openai.ListBatchesEndpoint(application.MetadataStore()))
+	app.Get("/batches", openai.ListBatchesEndpoint(application.MetadataStore()))
+	app.Get("/v1/batches/:batch_id", openai.GetBatchEndpoint(application.MetadataStore()))
+	app.Get("/batches/:batch_id", openai.GetBatchEndpoint(application.MetadataStore()))
+	app.Post("/v1/batches/:batch_id/cancel", openai.CancelBatchEndpoint(application.MetadataStore()))
+	app.Post("/batches/:batch_id/cancel", openai.CancelBatchEndpoint(application.MetadataStore()))
+
 	// audio
 	app.Post("/v1/audio/transcriptions", openai.TranscriptEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
 	app.Post("/v1/audio/speech", localai.TTSEndpoint(application.BackendLoader(), application.ModelLoader(), application.ApplicationConfig()))
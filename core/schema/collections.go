@@ -0,0 +1,57 @@
+package schema
+
+// Collection is a named set of documents that are chunked, embedded and stored in a local store
+type Collection struct {
+	Name string `json:"name" yaml:"name"`
+	// Model is the embedding model used for both the documents and the queries
+	Model        string `json:"model" yaml:"model"`
+	ChunkSize    int    `json:"chunk_size,omitempty" yaml:"chunk_size,omitempty"`
+	ChunkOverlap int    `json:"chunk_overlap,omitempty" yaml:"chunk_overlap,omitempty"`
+	CreatedAt    int64  `json:"created_at" yaml:"created_at"`
+}
+
+type CollectionListResponse struct {
+	Collections []Collection `json:"collections" yaml:"collections"`
+}
+
+type CollectionDocument struct {
+	// ID of the document, generated when empty. Adding a document with an existing ID adds more chunks to it.
+	ID       string         `json:"id,omitempty" yaml:"id,omitempty"`
+	Text     string         `json:"text" yaml:"text"`
+	Metadata map[string]any `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+type CollectionAddDocumentsRequest struct {
+	Documents []CollectionDocument `json:"documents" yaml:"documents"`
+}
+
+type CollectionAddDocumentsResponse struct {
+	IDs    []string `json:"ids" yaml:"ids"`
+	Chunks int      `json:"chunks" yaml:"chunks"`
+}
+
+type CollectionDeleteDocumentResponse struct {
+	ID     string `json:"id" yaml:"id"`
+	Chunks int    `json:"chunks" yaml:"chunks"`
+}
+
+type CollectionQueryRequest struct {
+	Query string `json:"query" yaml:"query"`
+	TopK  int    `json:"top_k,omitempty" yaml:"top_k,omitempty"`
+	// Only return the chunks whose metadata matches the filter, see the stores API
+	Filter map[string]any `json:"filter,omitempty" yaml:"filter,omitempty"`
+	// RerankModel optionally reranks the chunks found by similarity, the score is then the relevance score
+	RerankModel string `json:"rerank_model,omitempty" yaml:"rerank_model,omitempty"`
+}
+
+type CollectionQueryResult struct {
+	DocumentID string         `json:"document_id" yaml:"document_id"`
+	Chunk      int            `json:"chunk" yaml:"chunk"`
+	Text       string         `json:"text" yaml:"text"`
+	Score      float32        `json:"score" yaml:"score"`
+	Metadata   map[string]any `json:"metadata,omitempty" yaml:"metadata,omitempty"`
+}
+
+type CollectionQueryResponse struct {
+	Results []CollectionQueryResult `json:"results" yaml:"results"`
+}
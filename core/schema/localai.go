@@ -45,6 +45,8 @@ type StoresSet struct {
 
 	Keys   [][]float32 `json:"keys" yaml:"keys"`
 	Values []string    `json:"values" yaml:"values"`
+	// Optional metadata for each key, which can be used to filter find and list
+	Metadata []map[string]any `json:"metadata,omitempty" yaml:"metadata,omitempty"`
 }
 
 type StoresDelete struct {
@@ -60,8 +62,9 @@ type StoresGet struct {
 }
 
 type StoresGetResponse struct {
-	Keys   [][]float32 `json:"keys" yaml:"keys"`
-	Values []string    `json:"values" yaml:"values"`
+	Keys     [][]float32      `json:"keys" yaml:"keys"`
+	Values   []string         `json:"values" yaml:"values"`
+	Metadata []map[string]any `json:"metadata" yaml:"metadata"`
 }
 
 type StoresFind struct {
@@ -69,12 +72,55 @@ type StoresFind struct {
 
 	Key  []float32 `json:"key" yaml:"key"`
 	Topk int       `json:"topk" yaml:"topk"`
+
+	// Index to search with: "exact" (default) or "hnsw" for an approximate search
+	Index string `json:"index,omitempty" yaml:"index,omitempty"`
+	// HNSW parameters: M is the number of neighbours per node, EfConstruction and Ef
+	// the size of the candidate lists used when building the index and searching it
+	M              int `json:"m,omitempty" yaml:"m,omitempty"`
+	EfConstruction int `json:"ef_construction,omitempty" yaml:"ef_construction,omitempty"`
+	Ef             int `json:"ef,omitempty" yaml:"ef,omitempty"`
+
+	// Only return the entries whose metadata matches the filter, e.g. {"tenant": "acme", "year": {"$gte": 2020}}
+	Filter map[string]any `json:"filter,omitempty" yaml:"filter,omitempty"`
 }
 
 type StoresFindResponse struct {
-	Keys         [][]float32 `json:"keys" yaml:"keys"`
-	Values       []string    `json:"values" yaml:"values"`
-	Similarities []float32   `json:"similarities" yaml:"similarities"`
+	Keys         [][]float32      `json:"keys" yaml:"keys"`
+	Values       []string         `json:"values" yaml:"values"`
+	Metadata     []map[string]any `json:"metadata" yaml:"metadata"`
+	Similarities []float32        `json:"similarities" yaml:"similarities"`
+}
+
+type StoresList struct {
+	Store string `json:"store,omitempty" yaml:"store,omitempty"`
+
+	Filter map[string]any `json:"filter,omitempty" yaml:"filter,omitempty"`
+	Offset int            `json:"offset,omitempty" yaml:"offset,omitempty"`
+	// Maximum number of entries to return, all of them when 0
+	Limit int `json:"limit,omitempty" yaml:"limit,omitempty"`
+}
+
+type StoresListResponse struct {
+	Keys     [][]float32      `json:"keys" yaml:"keys"`
+	Values   []string         `json:"values" yaml:"values"`
+	Metadata []map[string]any `json:"metadata" yaml:"metadata"`
+	// Total number of entries matching the filter, regardless of offset and limit
+	Total int `json:"total" yaml:"total"`
+}
+
+type StoresCount struct {
+	Store string `json:"store,omitempty" yaml:"store,omitempty"`
+
+	Filter map[string]any `json:"filter,omitempty" yaml:"filter,omitempty"`
+}
+
+type StoresCountResponse struct {
+	Count int `json:"count" yaml:"count"`
+}
+
+type StoresDrop struct {
+	Store string `json:"store,omitempty" yaml:"store,omitempty"`
 }
 
 type P2PNodesResponse struct {
@@ -2,6 +2,8 @@ package schema
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	functions "github.com/mudler/LocalAI/pkg/functions"
@@ -23,6 +25,14 @@ type OpenAIUsage struct {
 	PromptTokens     int `json:"prompt_tokens"`
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
+
+	// PromptTokensDetails is set when the backend reused the cache of a prompt prefix
+	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+}
+
+type PromptTokensDetails struct {
+	// CachedTokens are the tokens of the prompt which were reused from the cache of the previous requests
+	CachedTokens int `json:"cached_tokens"`
 }
 
 type Item struct {
@@ -52,6 +62,66 @@ type Choice struct {
 	Message      *Message `json:"message,omitempty"`
 	Delta        *Message `json:"delta,omitempty"`
 	Text         string   `json:"text,omitempty"`
+
+	// Logprobs are the log probabilities of the tokens of the choice, if requested
+	Logprobs *Logprobs `json:"logprobs,omitempty"`
+}
+
+// Logprobs are the log probabilities of the tokens of a choice: Content in the chat completions, and the other
+// fields in the completions
+type Logprobs struct {
+	Content []LogprobContent `json:"content,omitempty"`
+
+	Tokens        []string             `json:"tokens,omitempty"`
+	TokenLogprobs []float64            `json:"token_logprobs,omitempty"`
+	TopLogprobs   []map[string]float64 `json:"top_logprobs,omitempty"`
+	TextOffset    []int                `json:"text_offset,omitempty"`
+}
+
+// LogprobContent is the log probability of a generated token, with the most likely tokens at its position
+type LogprobContent struct {
+	Token       string       `json:"token"`
+	Logprob     float64      `json:"logprob"`
+	Bytes       []int        `json:"bytes"`
+	TopLogprobs []TopLogprob `json:"top_logprobs"`
+}
+
+type TopLogprob struct {
+	Token   string  `json:"token"`
+	Logprob float64 `json:"logprob"`
+	Bytes   []int   `json:"bytes"`
+}
+
+// LogprobsRequest is the logprobs of a request: a boolean in the chat completions, or the number of the most likely
+// tokens to return at each position in the completions
+type LogprobsRequest struct {
+	Enabled bool
+	Top     int
+}
+
+func (l *LogprobsRequest) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case nil:
+		*l = LogprobsRequest{}
+	case bool:
+		*l = LogprobsRequest{Enabled: v}
+	case float64:
+		*l = LogprobsRequest{Enabled: true, Top: int(v)}
+	default:
+		return fmt.Errorf("logprobs must be a boolean or a number")
+	}
+	return nil
+}
+
+func (l LogprobsRequest) MarshalJSON() ([]byte, error) {
+	if l.Top > 0 {
+		return json.Marshal(l.Top)
+	}
+	return json.Marshal(l.Enabled)
 }
 
 type Content struct {
@@ -76,6 +146,9 @@ type Message struct {
 	// The message content
 	Content interface{} `json:"content" yaml:"content"`
 
+	// Refusal is the reason why the model didn't reply with the requested format
+	Refusal string `json:"refusal,omitempty" yaml:"refusal,omitempty"`
+
 	StringContent string   `json:"string_content,omitempty" yaml:"string_content,omitempty"`
 	StringImages  []string `json:"string_images,omitempty" yaml:"string_images,omitempty"`
 	StringVideos  []string `json:"string_videos,omitempty" yaml:"string_videos,omitempty"`
@@ -135,6 +208,18 @@ type DeleteAssistantFileResponse struct {
 	Deleted bool   `json:"deleted"`
 }
 
+type DeleteThreadResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
+type DeleteResponseResponse struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Deleted bool   `json:"deleted"`
+}
+
 type ImageGenerationResponseFormat string
 
 type ChatCompletionResponseFormatType string
@@ -149,9 +234,9 @@ type JsonSchemaRequest struct {
 }
 
 type JsonSchema struct {
-	Name   string         `json:"name"`
-	Strict bool           `json:"strict"`
-	Schema functions.Item `json:"schema"`
+	Name   string                 `json:"name"`
+	Strict bool                   `json:"strict"`
+	Schema map[string]interface{} `json:"schema"`
 }
 
 type OpenAIRequest struct {
@@ -187,6 +272,11 @@ type OpenAIRequest struct {
 
 	Stream bool `json:"stream"`
 
+	// Return the log probabilities of the generated tokens
+	Logprobs LogprobsRequest `json:"logprobs"`
+	// Number of the most likely tokens to return at each position in the chat completions, with logprobs
+	TopLogprobs *int `json:"top_logprobs,omitempty"`
+
 	// Image (not supported by OpenAI)
 	Mode int `json:"mode"`
 	Step int `json:"step"`
@@ -200,6 +290,10 @@ type OpenAIRequest struct {
 
 	// AutoGPTQ
 	ModelBaseName string `json:"model_base_name" yaml:"model_base_name"`
+
+	// Chat with an assistant (not supported by OpenAI): its instructions are added to the messages,
+	// along with the relevant excerpts of its files when the retrieval tool is enabled
+	AssistantID string `json:"assistant_id,omitempty" yaml:"assistant_id,omitempty"`
 }
 
 type ModelsDataResponse struct {
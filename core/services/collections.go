@@ -0,0 +1,527 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/mudler/LocalAI/core/backend"
+	"github.com/mudler/LocalAI/core/config"
+	"github.com/mudler/LocalAI/core/schema"
+	"github.com/mudler/LocalAI/pkg/grpc"
+	"github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/model"
+	"github.com/mudler/LocalAI/pkg/store"
+	"github.com/mudler/LocalAI/pkg/utils"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultChunkSize    = 1000
+	defaultChunkOverlap = 200
+	defaultQueryTopK    = 5
+
+	// When reranking, this many more chunks than requested are fetched from the store
+	rerankCandidatesFactor = 4
+
+	// Metadata fields set on every chunk, they override the metadata of the document with the same name
+	collectionDocumentIDField = "document_id"
+	collectionChunkField      = "chunk"
+
+	collectionsFile = "collections.json"
+)
+
+var (
+	ErrCollectionNotFound = errors.New("collection not found")
+	ErrCollectionExists   = errors.New("collection already exists")
+
+	collectionNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// CollectionsService implements a text-in/text-out retrieval API on top of the stores: documents are chunked,
+// embedded with the model of their collection and stored in a local store named after it.
+type CollectionsService struct {
+	storeLoader         *model.ModelLoader
+	modelLoader         *model.ModelLoader
+	backendConfigLoader *config.BackendConfigLoader
+	appConfig           *config.ApplicationConfig
+
+	sync.Mutex
+	collections map[string]schema.Collection
+}
+
+func NewCollectionsService(storeLoader, modelLoader *model.ModelLoader, configLoader *config.BackendConfigLoader, appConfig *config.ApplicationConfig) *CollectionsService {
+	cs := &CollectionsService{
+		storeLoader:         storeLoader,
+		modelLoader:         modelLoader,
+		backendConfigLoader: configLoader,
+		appConfig:           appConfig,
+		collections:         map[string]schema.Collection{},
+	}
+
+	if err := cs.load(); err != nil {
+		log.Error().Err(err).Msg("failed loading collections")
+	}
+
+	return cs
+}
+
+// The collections are saved next to the stores, so they are only persisted when the stores are
+func (cs *CollectionsService) path() string {
+	if cs.appConfig.StoresDir == "" {
+		return ""
+	}
+	return filepath.Join(cs.appConfig.StoresDir, collectionsFile)
+}
+
+func (cs *CollectionsService) load() error {
+	path := cs.path()
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var collections []schema.Collection
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return fmt.Errorf("failed parsing %s: %w", path, err)
+	}
+
+	for _, c := range collections {
+		cs.collections[c.Name] = c
+	}
+
+	return nil
+}
+
+// save must be called with the lock held
+func (cs *CollectionsService) save() error {
+	path := cs.path()
+	if path == "" {
+		return nil
+	}
+
+	data, err := json.Marshal(cs.list())
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func (cs *CollectionsService) list() []schema.Collection {
+	collections := make([]schema.Collection, 0, len(cs.collections))
+	for _, c := range cs.collections {
+		collections = append(collections, c)
+	}
+	slices.SortFunc(collections, func(a, b schema.Collection) int {
+		if a.Name < b.Name {
+			return -1
+		}
+		if a.Name > b.Name {
+			return 1
+		}
+		return 0
+	})
+
+	return collections
+}
+
+func (cs *CollectionsService) List() []schema.Collection {
+	cs.Lock()
+	defer cs.Unlock()
+
+	return cs.list()
+}
+
+func (cs *CollectionsService) Get(name string) (schema.Collection, error) {
+	cs.Lock()
+	defer cs.Unlock()
+
+	c, exists := cs.collections[name]
+	if !exists {
+		return c, fmt.Errorf("%w: %s", ErrCollectionNotFound, name)
+	}
+
+	return c, nil
+}
+
+func (cs *CollectionsService) Create(c schema.Collection) (schema.Collection, error) {
+	if !collectionNameRegexp.MatchString(c.Name) {
+		return c, fmt.Errorf("invalid collection name %q, only letters, digits, '-' and '_' are allowed", c.Name)
+	}
+	if c.Model == "" {
+		return c, fmt.Errorf("an embedding model is required")
+	}
+	if c.ChunkSize <= 0 {
+		c.ChunkSize = defaultChunkSize
+	}
+	if c.ChunkOverlap < 0 || c.ChunkOverlap >= c.ChunkSize {
+		c.ChunkOverlap = min(defaultChunkOverlap, c.ChunkSize/2)
+	}
+	c.CreatedAt = time.Now().Unix()
+
+	cs.Lock()
+	defer cs.Unlock()
+
+	if _, exists := cs.collections[c.Name]; exists {
+		return c, fmt.Errorf("%w: %s", ErrCollectionExists, c.Name)
+	}
+
+	cs.collections[c.Name] = c
+	if err := cs.save(); err != nil {
+		delete(cs.collections, c.Name)
+		return c, fmt.Errorf("failed saving collections: %w", err)
+	}
+
+	return c, nil
+}
+
+// Delete removes a collection and all of its documents
+func (cs *CollectionsService) Delete(ctx context.Context, name string) error {
+	c, err := cs.Get(name)
+	if err != nil {
+		return err
+	}
+
+	sb, err := cs.store(c)
+	if err != nil {
+		return err
+	}
+
+	if err := store.Drop(ctx, sb); err != nil {
+		return err
+	}
+
+	cs.Lock()
+	defer cs.Unlock()
+
+	delete(cs.collections, name)
+
+	return cs.save()
+}
+
+func (cs *CollectionsService) store(c schema.Collection) (grpc.Backend, error) {
+	return backend.StoreBackend(cs.storeLoader, cs.appConfig, "collection-"+c.Name)
+}
+
+func (cs *CollectionsService) loadBackendConfig(modelName string) (*config.BackendConfig, error) {
+	return cs.backendConfigLoader.LoadBackendConfigFileByName(modelName, cs.appConfig.ModelPath,
+		config.LoadOptionDebug(cs.appConfig.Debug),
+		config.LoadOptionThreads(cs.appConfig.Threads),
+		config.LoadOptionContextSize(cs.appConfig.ContextSize),
+		config.LoadOptionF16(cs.appConfig.F16),
+	)
+}
+
+func (cs *CollectionsService) embed(ctx context.Context, cfg *config.BackendConfig, text string) ([]float32, error) {
+	embedFn, err := backend.ModelEmbedding(ctx, text, []int{}, cs.modelLoader, *cfg, cs.appConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return embedFn()
+}
+
+// AddDocuments chunks and embeds the documents, then stores the chunks in the collection.
+// The chunks are keyed by their embedding, so a chunk identical to one already in the collection, or to an earlier
+// chunk of the documents, is skipped: it stays with the document which added it first.
+// Returns the IDs of the documents and the number of chunks stored.
+func (cs *CollectionsService) AddDocuments(ctx context.Context, name string, documents []schema.CollectionDocument) ([]string, int, error) {
+	c, err := cs.Get(name)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cfg, err := cs.loadBackendConfig(c.Model)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed loading the embedding model config: %w", err)
+	}
+
+	ids := make([]string, len(documents))
+	keys := [][]float32{}
+	values := [][]byte{}
+	metadata := []map[string]any{}
+	seen := map[string]bool{}
+	skipped := 0
+
+	for i, d := range documents {
+		ids[i] = d.ID
+		if ids[i] == "" {
+			ids[i] = uuid.New().String()
+		}
+
+		for j, chunk := range utils.ChunkText(d.Text, c.ChunkSize, c.ChunkOverlap) {
+			embedding, err := cs.embed(ctx, cfg, chunk)
+			if err != nil {
+				return nil, 0, fmt.Errorf("failed embedding chunk %d of document %s: %w", j, ids[i], err)
+			}
+
+			key := fmt.Sprint(embedding)
+			if seen[key] {
+				skipped++
+				continue
+			}
+			seen[key] = true
+
+			m := make(map[string]any, len(d.Metadata)+2)
+			for k, v := range d.Metadata {
+				m[k] = v
+			}
+			m[collectionDocumentIDField] = ids[i]
+			m[collectionChunkField] = j
+
+			keys = append(keys, embedding)
+			values = append(values, []byte(chunk))
+			metadata = append(metadata, m)
+		}
+	}
+
+	if len(keys) == 0 {
+		return ids, 0, nil
+	}
+
+	sb, err := cs.store(c)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	existing, _, err := store.GetCols(ctx, sb, keys)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(existing) > 0 {
+		stored := make(map[string]bool, len(existing))
+		for _, k := range existing {
+			stored[fmt.Sprint(k)] = true
+		}
+
+		n := 0
+		for i := range keys {
+			if stored[fmt.Sprint(keys[i])] {
+				continue
+			}
+			keys[n], values[n], metadata[n] = keys[i], values[i], metadata[i]
+			n++
+		}
+		skipped += len(keys) - n
+		keys, values, metadata = keys[:n], values[:n], metadata[:n]
+	}
+
+	if skipped > 0 {
+		log.Debug().Msgf("Skipped %d chunks already in the collection %s", skipped, c.Name)
+	}
+
+	if len(keys) == 0 {
+		return ids, 0, nil
+	}
+
+	if err := store.SetColsWithMetadata(ctx, sb, keys, values, metadata); err != nil {
+		return nil, 0, err
+	}
+
+	return ids, len(keys), nil
+}
+
+// DeleteDocument removes all the chunks of a document, returning how many were removed
+func (cs *CollectionsService) DeleteDocument(ctx context.Context, name, id string) (int, error) {
+	c, err := cs.Get(name)
+	if err != nil {
+		return 0, err
+	}
+
+	sb, err := cs.store(c)
+	if err != nil {
+		return 0, err
+	}
+
+	keys, _, _, _, err := store.List(ctx, sb, map[string]any{collectionDocumentIDField: id}, 0, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	if err := store.DeleteCols(ctx, sb, keys); err != nil {
+		return 0, err
+	}
+
+	return len(keys), nil
+}
+
+// DocumentIDs returns the IDs of the documents that have chunks in the collection
+func (cs *CollectionsService) DocumentIDs(ctx context.Context, name string) ([]string, error) {
+	c, err := cs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	sb, err := cs.store(c)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, metadata, _, err := store.List(ctx, sb, nil, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, m := range metadata {
+		if id, ok := m[collectionDocumentIDField].(string); ok && !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// Query returns the chunks most similar to the query, optionally reranked
+func (cs *CollectionsService) Query(ctx context.Context, name string, req schema.CollectionQueryRequest) ([]schema.CollectionQueryResult, error) {
+	c, err := cs.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	topK := req.TopK
+	if topK <= 0 {
+		topK = defaultQueryTopK
+	}
+
+	cfg, err := cs.loadBackendConfig(c.Model)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading the embedding model config: %w", err)
+	}
+
+	embedding, err := cs.embed(ctx, cfg, req.Query)
+	if err != nil {
+		return nil, fmt.Errorf("failed embedding the query: %w", err)
+	}
+
+	sb, err := cs.store(c)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := topK
+	if req.RerankModel != "" {
+		candidates = topK * rerankCandidatesFactor
+	}
+
+	_, values, metadata, similarities, err := store.FindWithOptions(ctx, sb, embedding, candidates, store.FindOptions{
+		Filter: req.Filter,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]schema.CollectionQueryResult, len(values))
+	for i, v := range values {
+		results[i] = newCollectionQueryResult(string(v), similarities[i], metadata[i])
+	}
+
+	if req.RerankModel == "" || len(results) == 0 {
+		return results, nil
+	}
+
+	return cs.rerank(ctx, req.Query, req.RerankModel, topK, results)
+}
+
+func (cs *CollectionsService) rerank(ctx context.Context, query, rerankModel string, topK int, results []schema.CollectionQueryResult) ([]schema.CollectionQueryResult, error) {
+	cfg, err := cs.loadBackendConfig(rerankModel)
+	if err != nil {
+		return nil, fmt.Errorf("failed loading the rerank model config: %w", err)
+	}
+
+	documents := make([]string, len(results))
+	for i, r := range results {
+		documents[i] = r.Text
+	}
+
+	res, err := backend.Rerank(ctx, cfg.Model, &proto.RerankRequest{
+		Query:     query,
+		TopN:      int32(topK),
+		Documents: documents,
+	}, cs.modelLoader, cs.appConfig, *cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed reranking: %w", err)
+	}
+
+	reranked := make([]schema.CollectionQueryResult, 0, len(res.Results))
+	for _, r := range res.Results {
+		if int(r.Index) < 0 || int(r.Index) >= len(results) {
+			continue
+		}
+		result := results[r.Index]
+		result.Score = r.RelevanceScore
+		reranked = append(reranked, result)
+	}
+
+	slices.SortStableFunc(reranked, func(a, b schema.CollectionQueryResult) int {
+		if a.Score > b.Score {
+			return -1
+		}
+		if a.Score < b.Score {
+			return 1
+		}
+		return 0
+	})
+
+	if len(reranked) > topK {
+		reranked = reranked[:topK]
+	}
+
+	return reranked, nil
+}
+
+// newCollectionQueryResult splits the fields set by AddDocuments from the metadata of the document
+func newCollectionQueryResult(text string, score float32, metadata map[string]any) schema.CollectionQueryResult {
+	result := schema.CollectionQueryResult{
+		Text:  text,
+		Score: score,
+	}
+
+	if id, ok := metadata[collectionDocumentIDField].(string); ok {
+		result.DocumentID = id
+	}
+	if chunk, ok := metadata[collectionChunkField].(float64); ok {
+		result.Chunk = int(chunk)
+	}
+
+	for k, v := range metadata {
+		if k == collectionDocumentIDField || k == collectionChunkField {
+			continue
+		}
+		if result.Metadata == nil {
+			result.Metadata = map[string]any{}
+		}
+		result.Metadata[k] = v
+	}
+
+	return result
+}
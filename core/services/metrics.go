@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
@@ -31,6 +32,8 @@ func NewLocalAIMetricsService() (*LocalAIMetricsService, error) {
 		return nil, err
 	}
 	provider := metricApi.NewMeterProvider(metricApi.WithReader(exporter))
+	// The backends, the model loader and the usage service record their metrics with the global meter provider
+	otel.SetMeterProvider(provider)
 	meter := provider.Meter("github.com/mudler/LocalAI")
 
 	apiTimeMetric, err := meter.Float64Histogram("api_call", metric.WithDescription("api calls"))
@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mudler/LocalAI/pkg/kvstore"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Usage are the resources used by requests
+type Usage struct {
+	Requests         int     `json:"requests"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	Images           int     `json:"images"`
+	AudioSeconds     float64 `json:"audio_seconds"`
+}
+
+func (u *Usage) add(o Usage) {
+	u.Requests += o.Requests
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.Images += o.Images
+	u.AudioSeconds += o.AudioSeconds
+}
+
+// UsageRecord is the usage of an API key on a model and an endpoint during an hour
+type UsageRecord struct {
+	Hour time.Time `json:"hour"`
+	// KeyID identifies the API key, Key is its name, which several keys can have
+	KeyID    string `json:"key_id"`
+	Key      string `json:"key"`
+	Model    string `json:"model"`
+	Endpoint string `json:"endpoint"`
+	Usage
+}
+
+// UsageGroup is the usage of the records with the same values of the fields of a report, the other fields are empty
+type UsageGroup struct {
+	// Period is the start of the hour or of the day of the records, in RFC 3339
+	Period   string `json:"period,omitempty"`
+	KeyID    string `json:"key_id,omitempty"`
+	Key      string `json:"key,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Usage
+}
+
+// UsageGroupBy are the fields by which the usage can be grouped in a report
+var UsageGroupBy = []string{"hour", "day", "key", "model", "endpoint"}
+
+const usageBucket = "usage"
+
+const (
+	// usageFlushInterval is the interval between the writes of the usage recorded in memory to the metadata store
+	usageFlushInterval = 10 * time.Second
+	// usagePruneInterval is the interval between the deletions of the records older than the retention
+	usagePruneInterval = time.Hour
+)
+
+// usageID returns the ID of the record of the usage of a key on a model and an endpoint during an hour, from which the
+// reports read the hour and the key without decoding the record
+func usageID(hour time.Time, keyID, model, endpoint string) string {
+	id, _ := json.Marshal([]any{hour.Unix(), keyID, model, endpoint})
+	return string(id)
+}
+
+// parseUsageID returns the hour and the key of the ID of a record
+func parseUsageID(id string) (time.Time, string, bool) {
+	var fields []any
+	if err := json.Unmarshal([]byte(id), &fields); err != nil || len(fields) != 4 {
+		return time.Time{}, "", false
+	}
+	hour, ok := fields[0].(float64)
+	keyID, ok2 := fields[1].(string)
+	if !ok || !ok2 {
+		return time.Time{}, "", false
+	}
+	return time.Unix(int64(hour), 0).UTC(), keyID, true
+}
+
+// UsageService records the usage of the API keys, aggregated per hour, and in Prometheus counters. The usage is
+// aggregated in memory and written to the metadata store by Run, every usageFlushInterval, or by Flush. The records
+// older than the retention are deleted, none if it is 0.
+type UsageService struct {
+	store     kvstore.Store
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]*UsageRecord
+	// flushMu serializes the flushes, so that a report waits for the records being written
+	flushMu sync.Mutex
+
+	requests, promptTokens, completionTokens, images metric.Int64Counter
+	audioSeconds                                     metric.Float64Counter
+}
+
+// NewUsageService returns the usage service of store. The counters are recorded with the global meter provider,
+// which exports them on /metrics once the metrics service of the API is started, and discards them otherwise.
+func NewUsageService(store kvstore.Store, retention time.Duration) (*UsageService, error) {
+	u := &UsageService{store: store, retention: retention, now: time.Now, pending: map[string]*UsageRecord{}}
+	meter := otel.Meter("github.com/mudler/LocalAI/core/services")
+	var err error
+	if u.requests, err = meter.Int64Counter("usage_requests", metric.WithDescription("requests per API key and model")); err != nil {
+		return nil, err
+	}
+	if u.promptTokens, err = meter.Int64Counter("usage_prompt_tokens", metric.WithDescription("prompt tokens per API key and model")); err != nil {
+		return nil, err
+	}
+	if u.completionTokens, err = meter.Int64Counter("usage_completion_tokens", metric.WithDescription("completion tokens per API key and model")); err != nil {
+		return nil, err
+	}
+	if u.images, err = meter.Int64Counter("usage_images", metric.WithDescription("generated images per API key and model")); err != nil {
+		return nil, err
+	}
+	if u.audioSeconds, err = meter.Float64Counter("usage_audio_seconds", metric.WithDescription("seconds of transcribed or generated audio per API key and model")); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// Record adds the usage of a request of the key with the ID keyID and the name key on model and endpoint
+func (u *UsageService) Record(keyID, key, model, endpoint string, usage Usage) {
+	opts := metric.WithAttributes(
+		attribute.String("key", key),
+		attribute.String("model", model),
+	)
+	ctx := context.Background()
+	add := func(counter metric.Int64Counter, value int) {
+		if value > 0 {
+			counter.Add(ctx, int64(value), opts)
+		}
+	}
+	add(u.requests, usage.Requests)
+	add(u.promptTokens, usage.PromptTokens)
+	add(u.completionTokens, usage.CompletionTokens)
+	add(u.images, usage.Images)
+	if usage.AudioSeconds > 0 {
+		u.audioSeconds.Add(ctx, usage.AudioSeconds, opts)
+	}
+
+	hour := u.now().UTC().Truncate(time.Hour)
+	id := usageID(hour, keyID, model, endpoint)
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	record, ok := u.pending[id]
+	if !ok {
+		// The strings of a request can be reused by fiber once it is handled
+		record = &UsageRecord{Hour: hour, KeyID: strings.Clone(keyID), Key: strings.Clone(key), Model: strings.Clone(model), Endpoint: strings.Clone(endpoint)}
+		u.pending[id] = record
+	}
+	record.add(usage)
+}
+
+// Flush writes the usage recorded in memory to the metadata store, in a single transaction. The usage is kept in
+// memory if it can't be written.
+func (u *UsageService) Flush() error {
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	u.mu.Lock()
+	pending := u.pending
+	u.pending = map[string]*UsageRecord{}
+	u.mu.Unlock()
+	if len(pending) == 0 {
+		return nil
+	}
+
+	err := u.store.Update(func(tx kvstore.Tx) error {
+		for id, usage := range pending {
+			record, err := kvstore.Get[UsageRecord](tx, usageBucket, id)
+			if errors.Is(err, kvstore.ErrNotFound) {
+				record, err = UsageRecord{Hour: usage.Hour, KeyID: usage.KeyID, Key: usage.Key, Model: usage.Model, Endpoint: usage.Endpoint}, nil
+			}
+			if err != nil {
+				return err
+			}
+			record.add(usage.Usage)
+			if err := kvstore.Put(tx, usageBucket, id, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		u.mu.Lock()
+		for id, usage := range pending {
+			if record, ok := u.pending[id]; ok {
+				usage.add(record.Usage)
+			}
+			u.pending[id] = usage
+		}
+		u.mu.Unlock()
+	}
+	return err
+}
+
+// Prune deletes the records of the hours older than the retention
+func (u *UsageService) Prune() error {
+	if u.retention == 0 {
+		return nil
+	}
+	u.flushMu.Lock()
+	defer u.flushMu.Unlock()
+
+	oldest := u.now().UTC().Add(-u.retention).Truncate(time.Hour)
+	return u.store.Update(func(tx kvstore.Tx) error {
+		for _, id := range tx.Keys(usageBucket) {
+			if hour, _, ok := parseUsageID(id); ok && hour.Before(oldest) {
+				if err := tx.Delete(usageBucket, id); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Run flushes the usage every usageFlushInterval and prunes the records every usagePruneInterval, until ctx is done.
+// The usage recorded since the last flush is written by a call to Flush, once the requests are handled.
+func (u *UsageService) Run(ctx context.Context) {
+	flush := time.NewTicker(usageFlushInterval)
+	defer flush.Stop()
+	prune := time.NewTicker(usagePruneInterval)
+	defer prune.Stop()
+
+	if err := u.Prune(); err != nil {
+		log.Error().Err(err).Msg("Unable to delete the usage older than the retention")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-flush.C:
+			if err := u.Flush(); err != nil {
+				log.Error().Err(err).Msg("Unable to write the usage of the requests")
+			}
+		case <-prune.C:
+			if err := u.Prune(); err != nil {
+				log.Error().Err(err).Msg("Unable to delete the usage older than the retention")
+			}
+		}
+	}
+}
+
+// Report returns the usage of the hours from the one of from until the one before to, grouped by the fields of
+// groupBy, and optionally of the key with the ID keyID only. The groups are sorted by their fields.
+func (u *UsageService) Report(from, to time.Time, groupBy []string, keyID *string) ([]UsageGroup, error) {
+	for _, field := range groupBy {
+		if !slices.Contains(UsageGroupBy, field) {
+			return nil, fmt.Errorf("unknown group_by field %q, must be one of %v", field, UsageGroupBy)
+		}
+	}
+	if slices.Contains(groupBy, "hour") && slices.Contains(groupBy, "day") {
+		return nil, fmt.Errorf("the usage can't be grouped by hour and by day")
+	}
+	from = from.UTC().Truncate(time.Hour)
+
+	if err := u.Flush(); err != nil {
+		return nil, err
+	}
+
+	// Only the records of the period and of the key are decoded
+	var records []UsageRecord
+	err := u.store.View(func(tx kvstore.Tx) error {
+		for _, id := range tx.Keys(usageBucket) {
+			hour, recordKeyID, ok := parseUsageID(id)
+			if !ok || hour.Before(from) || !hour.Before(to) || (keyID != nil && recordKeyID != *keyID) {
+				continue
+			}
+			record, err := kvstore.Get[UsageRecord](tx, usageBucket, id)
+			if err != nil {
+				return err
+			}
+			records = append(records, record)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[UsageGroup]*Usage{}
+	for _, r := range records {
+		var g UsageGroup
+		for _, field := range groupBy {
+			switch field {
+			case "hour":
+				g.Period = r.Hour.Format(time.RFC3339)
+			case "day":
+				g.Period = r.Hour.Truncate(24 * time.Hour).Format(time.RFC3339)
+			case "key":
+				g.KeyID, g.Key = r.KeyID, r.Key
+			case "model":
+				g.Model = r.Model
+			case "endpoint":
+				g.Endpoint = r.Endpoint
+			}
+		}
+		if groups[g] == nil {
+			groups[g] = &Usage{}
+		}
+		groups[g].add(r.Usage)
+	}
+
+	report := []UsageGroup{}
+	for g, usage := range groups {
+		g.Usage = *usage
+		report = append(report, g)
+	}
+	sort.Slice(report, func(i, j int) bool {
+		a, b := report[i], report[j]
+		if a.Period != b.Period {
+			return a.Period < b.Period
+		}
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.KeyID != b.KeyID {
+			return a.KeyID < b.KeyID
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		return a.Endpoint < b.Endpoint
+	})
+	return report, nil
+}
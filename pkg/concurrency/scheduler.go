@@ -0,0 +1,235 @@
+package concurrency
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Priority is the class of a request waiting in a Scheduler: the requests with a higher priority are started first
+type Priority int
+
+const (
+	PriorityLow Priority = iota - 1
+	PriorityNormal
+	PriorityHigh
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// ParsePriority returns the priority class named s: low, normal or high
+func ParsePriority(s string) (Priority, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "low":
+		return PriorityLow, nil
+	case "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	}
+	return PriorityNormal, fmt.Errorf("invalid priority %q, expected low, normal or high", s)
+}
+
+type priorityKey struct{}
+
+// WithPriority returns a copy of ctx with the priority of the request
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFromContext returns the priority of the request, PriorityNormal if ctx has none
+func PriorityFromContext(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityNormal
+}
+
+// QueueFullError is returned by the Scheduler when a request can't be queued, RetryAfter is an estimation of when
+// a slot will be available again
+type QueueFullError struct {
+	Key        string
+	RetryAfter time.Duration
+}
+
+func (e *QueueFullError) Error() string {
+	return fmt.Sprintf("too many requests for %s, retry after %s", e.Key, e.RetryAfter)
+}
+
+type waiter struct {
+	result *WritableJobResult[Priority, struct{}]
+	seq    uint64
+	index  int
+}
+
+// waiters is a heap of the requests waiting for a slot, by priority and then by order of arrival
+type waiters []*waiter
+
+func (w waiters) Len() int { return len(w) }
+
+func (w waiters) Less(i, j int) bool {
+	pi, pj := *w[i].result.Request(), *w[j].result.Request()
+	if pi != pj {
+		return pi > pj
+	}
+	return w[i].seq < w[j].seq
+}
+
+func (w waiters) Swap(i, j int) {
+	w[i], w[j] = w[j], w[i]
+	w[i].index = i
+	w[j].index = j
+}
+
+func (w *waiters) Push(x any) {
+	item := x.(*waiter)
+	item.index = len(*w)
+	*w = append(*w, item)
+}
+
+func (w *waiters) Pop() any {
+	old := *w
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.index = -1
+	*w = old[:len(old)-1]
+	return item
+}
+
+type schedulerQueue struct {
+	limit   int
+	running int
+	waiting waiters
+	// holdTime is the moving average of the time a slot is held, to estimate when a slot is available again
+	holdTime time.Duration
+}
+
+// dispatch hands the free slots to the waiting requests
+func (q *schedulerQueue) dispatch() {
+	for q.running < q.limit && q.waiting.Len() > 0 {
+		w := heap.Pop(&q.waiting).(*waiter)
+		q.running++
+		w.result.SetResult(struct{}{}, nil)
+	}
+}
+
+func (q *schedulerQueue) retryAfter() time.Duration {
+	estimate := time.Duration(float64(q.holdTime) * float64(q.waiting.Len()+1) / float64(q.limit))
+	return max(time.Second, time.Duration(math.Ceil(estimate.Seconds()))*time.Second)
+}
+
+// Scheduler limits the number of requests executed at the same time for a key, e.g. a model. The requests over the
+// limit wait in a bounded queue and are started by priority.
+type Scheduler struct {
+	mu     sync.Mutex
+	seq    uint64
+	queues map[string]*schedulerQueue
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{queues: map[string]*schedulerQueue{}}
+}
+
+func (s *Scheduler) queue(key string, maxConcurrency int) *schedulerQueue {
+	q, exists := s.queues[key]
+	if !exists {
+		q = &schedulerQueue{}
+		s.queues[key] = q
+	}
+	// The limit may have changed with the configuration of the model
+	q.limit = maxConcurrency
+	q.dispatch()
+	return q
+}
+
+// Acquire waits for one of the maxConcurrency slots of key, with the priority of ctx, and returns the function to
+// release it. No more than maxQueue requests wait at the same time, the next ones get a *QueueFullError. A
+// maxConcurrency <= 0 disables the limit, a maxQueue <= 0 the bound of the queue.
+func (s *Scheduler) Acquire(ctx context.Context, key string, maxConcurrency, maxQueue int) (func(), error) {
+	if maxConcurrency <= 0 {
+		return func() {}, nil
+	}
+
+	s.mu.Lock()
+	q := s.queue(key, maxConcurrency)
+	if q.running < q.limit {
+		q.running++
+		s.mu.Unlock()
+		return s.releaseFunc(q), nil
+	}
+	if maxQueue > 0 && q.waiting.Len() >= maxQueue {
+		err := &QueueFullError{Key: key, RetryAfter: q.retryAfter()}
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	jr, wjr := NewJobResult[Priority, struct{}](PriorityFromContext(ctx))
+	s.seq++
+	w := &waiter{result: wjr, seq: s.seq}
+	heap.Push(&q.waiting, w)
+	s.mu.Unlock()
+
+	if _, err := jr.Wait(ctx); err != nil {
+		s.mu.Lock()
+		granted := w.index < 0
+		if !granted {
+			heap.Remove(&q.waiting, w.index)
+		}
+		s.mu.Unlock()
+		// The slot may have been handed over at the same time
+		if granted {
+			s.releaseFunc(q)()
+		}
+		return nil, err
+	}
+	return s.releaseFunc(q), nil
+}
+
+// Check returns a *QueueFullError if a request for key would be rejected by Acquire now
+func (s *Scheduler) Check(key string, maxConcurrency, maxQueue int) error {
+	if maxConcurrency <= 0 || maxQueue <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q := s.queue(key, maxConcurrency)
+	if q.running >= q.limit && q.waiting.Len() >= maxQueue {
+		return &QueueFullError{Key: key, RetryAfter: q.retryAfter()}
+	}
+	return nil
+}
+
+func (s *Scheduler) releaseFunc(q *schedulerQueue) func() {
+	start := time.Now()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			held := time.Since(start)
+			if q.holdTime == 0 {
+				q.holdTime = held
+			} else {
+				q.holdTime = (4*q.holdTime + held) / 5
+			}
+			q.running--
+			q.dispatch()
+		})
+	}
+}
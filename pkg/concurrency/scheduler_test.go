@@ -0,0 +1,121 @@
+package concurrency_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	. "github.com/mudler/LocalAI/pkg/concurrency"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Scheduler", func() {
+	var scheduler *Scheduler
+
+	BeforeEach(func() {
+		scheduler = NewScheduler()
+	})
+
+	// acquire calls Acquire in a goroutine and sends the release function once the slot is granted
+	acquire := func(ctx context.Context, p Priority, limit, queue int) (chan func(), chan error) {
+		granted, failed := make(chan func(), 1), make(chan error, 1)
+		go func() {
+			release, err := scheduler.Acquire(WithPriority(ctx, p), "model", limit, queue)
+			if err != nil {
+				failed <- err
+				return
+			}
+			granted <- release
+		}()
+		return granted, failed
+	}
+
+	It("doesn't limit when max concurrency is not set", func() {
+		for i := 0; i < 10; i++ {
+			_, err := scheduler.Acquire(context.Background(), "model", 0, 1)
+			Expect(err).ToNot(HaveOccurred())
+		}
+	})
+
+	It("starts the waiting requests by priority", func() {
+		release, err := scheduler.Acquire(context.Background(), "model", 1, 10)
+		Expect(err).ToNot(HaveOccurred())
+
+		low, _ := acquire(context.Background(), PriorityLow, 1, 10)
+		Eventually(func() error { return scheduler.Check("model", 1, 1) }).Should(HaveOccurred())
+		normal, _ := acquire(context.Background(), PriorityNormal, 1, 10)
+		Eventually(func() error { return scheduler.Check("model", 1, 2) }).Should(HaveOccurred())
+		high, _ := acquire(context.Background(), PriorityHigh, 1, 10)
+		Eventually(func() error { return scheduler.Check("model", 1, 3) }).Should(HaveOccurred())
+		Consistently(low, "100ms").ShouldNot(Receive())
+
+		release()
+		var next func()
+		Eventually(high).Should(Receive(&next))
+		Expect(normal).ToNot(Receive())
+		next()
+		Eventually(normal).Should(Receive(&next))
+		Expect(low).ToNot(Receive())
+		next()
+		Eventually(low).Should(Receive(&next))
+		next()
+
+		// Releasing twice doesn't free another slot
+		next()
+		_, err = scheduler.Acquire(context.Background(), "model", 1, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(scheduler.Check("model", 1, 0)).To(Succeed())
+		Expect(scheduler.Check("model", 1, 1)).To(Succeed())
+	})
+
+	It("rejects the requests when the queue is full", func() {
+		_, err := scheduler.Acquire(context.Background(), "model", 1, 1)
+		Expect(err).ToNot(HaveOccurred())
+		acquire(context.Background(), PriorityNormal, 1, 1)
+		Eventually(func() error { return scheduler.Check("model", 1, 1) }).Should(HaveOccurred())
+
+		_, err = scheduler.Acquire(context.Background(), "model", 1, 1)
+		var queueFull *QueueFullError
+		Expect(errors.As(err, &queueFull)).To(BeTrue())
+		Expect(queueFull.Key).To(Equal("model"))
+		Expect(queueFull.RetryAfter).To(BeNumerically(">=", time.Second))
+
+		// Other keys have their own queue
+		_, err = scheduler.Acquire(context.Background(), "other", 1, 1)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("removes the requests from the queue when their context is done", func() {
+		release, err := scheduler.Acquire(context.Background(), "model", 1, 1)
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		_, failed := acquire(ctx, PriorityNormal, 1, 1)
+		Eventually(func() error { return scheduler.Check("model", 1, 1) }).Should(HaveOccurred())
+		cancel()
+		Eventually(failed).Should(Receive(MatchError(context.Canceled)))
+		Expect(scheduler.Check("model", 1, 1)).To(Succeed())
+
+		granted, _ := acquire(context.Background(), PriorityNormal, 1, 1)
+		release()
+		Eventually(granted).Should(Receive())
+	})
+})
+
+var _ = Describe("Priority", func() {
+	It("is parsed from its name", func() {
+		p, err := ParsePriority("High")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(p).To(Equal(PriorityHigh))
+		Expect(p.String()).To(Equal("high"))
+
+		_, err = ParsePriority("urgent")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("defaults to normal", func() {
+		Expect(PriorityFromContext(context.Background())).To(Equal(PriorityNormal))
+		Expect(PriorityFromContext(WithPriority(context.Background(), PriorityLow))).To(Equal(PriorityLow))
+	})
+})
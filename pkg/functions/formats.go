@@ -0,0 +1,176 @@
+package functions
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/mudler/LocalAI/pkg/utils"
+)
+
+// The formats of the function calls of the model families, which are parsed without regexes
+const (
+	// FormatHermes is <tool_call>{"name": "function_name", "arguments": {...}}</tool_call>
+	FormatHermes = "hermes"
+	// FormatLLama31 is <|python_tag|>{"name": "function_name", "parameters": {...}}, or
+	// <function=function_name>{...}</function>
+	FormatLLama31 = "llama3.1"
+	// FormatMistral is [TOOL_CALLS] [{"name": "function_name", "arguments": {...}}], or
+	// [TOOL_CALLS]function_name[ARGS]{...}
+	FormatMistral = "mistral"
+	// FormatQwen is the format of Hermes, or ✿FUNCTION✿: function_name\n✿ARGS✿: {...}
+	FormatQwen = "qwen"
+)
+
+// toolCallFormats parse the function calls of a format. They return the function calls, the text out of them, and
+// false if the result has no function call in the format.
+var toolCallFormats = map[string]func(string) ([]FuncCallResults, string, bool){
+	FormatHermes:  parseHermes,
+	FormatLLama31: parseLLama31,
+	FormatMistral: parseMistral,
+	FormatQwen:    parseQwen,
+}
+
+// IsToolCallFormat returns true if format is the name of a format of function calls
+func IsToolCallFormat(format string) bool {
+	_, exists := toolCallFormats[format]
+	return exists
+}
+
+// parseToolCallFormat parses the function calls in the format of the configuration, if it has one. It returns false
+// if it has no format or if the result has no function call in the format, e.g. with a grammar.
+func parseToolCallFormat(llmresult string, functionConfig FunctionsConfig) ([]FuncCallResults, string, bool) {
+	parse, exists := toolCallFormats[functionConfig.Format]
+	if !exists {
+		return nil, "", false
+	}
+	return parse(llmresult)
+}
+
+func parseHermes(s string) ([]FuncCallResults, string, bool) {
+	return taggedCalls(s, "<tool_call>", []string{"</tool_call>"}, func(body string) []FuncCallResults {
+		return jsonCalls(body)
+	})
+}
+
+func parseLLama31(s string) ([]FuncCallResults, string, bool) {
+	if strings.Contains(s, "<function=") {
+		return taggedCalls(s, "<function=", []string{"</function>"}, func(body string) []FuncCallResults {
+			name, arguments, found := strings.Cut(body, ">")
+			if !found {
+				return nil
+			}
+			return []FuncCallResults{{Name: strings.TrimSpace(name), Arguments: strings.TrimSpace(arguments)}}
+		})
+	}
+	if strings.Contains(s, "<|python_tag|>") {
+		return taggedCalls(s, "<|python_tag|>", []string{"<|eom_id|>", "<|eot_id|>"}, func(body string) []FuncCallResults {
+			// The calls may be separated by semicolons
+			return jsonCalls(strings.ReplaceAll(body, "};", "}"))
+		})
+	}
+	// Without the built-in tools, the model replies with the JSON of the call only
+	calls := jsonCalls(s)
+	return calls, "", len(calls) > 0
+}
+
+func parseMistral(s string) ([]FuncCallResults, string, bool) {
+	return taggedCalls(s, "[TOOL_CALLS]", []string{"</s>"}, func(body string) []FuncCallResults {
+		body = strings.TrimSpace(body)
+		if strings.HasPrefix(body, "[") || strings.HasPrefix(body, "{") {
+			return jsonCalls(body)
+		}
+		name, arguments, found := strings.Cut(body, "[ARGS]")
+		if !found {
+			return nil
+		}
+		return []FuncCallResults{{Name: strings.TrimSpace(name), Arguments: strings.TrimSpace(arguments)}}
+	})
+}
+
+func parseQwen(s string) ([]FuncCallResults, string, bool) {
+	if !strings.Contains(s, "✿FUNCTION✿") {
+		return parseHermes(s)
+	}
+	return taggedCalls(s, "✿FUNCTION✿", []string{"✿RESULT✿", "✿RETURN✿"}, func(body string) []FuncCallResults {
+		name, arguments, found := strings.Cut(body, "✿ARGS✿")
+		if !found {
+			return nil
+		}
+		name = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(name), ":"))
+		arguments = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(arguments), ":"))
+		return []FuncCallResults{{Name: name, Arguments: arguments}}
+	})
+}
+
+// taggedCalls parses the function calls which start with open and end with one of closes, the next open or the end
+// of s, and returns them with the text around them
+func taggedCalls(s, open string, closes []string, parse func(string) []FuncCallResults) ([]FuncCallResults, string, bool) {
+	if !strings.Contains(s, open) {
+		return nil, "", false
+	}
+
+	var calls []FuncCallResults
+	var text strings.Builder
+	for {
+		start := strings.Index(s, open)
+		if start < 0 {
+			text.WriteString(s)
+			break
+		}
+		text.WriteString(s[:start])
+		s = s[start+len(open):]
+
+		end, next := len(s), len(s)
+		if i := strings.Index(s, open); i >= 0 {
+			end, next = i, i
+		}
+		for _, c := range closes {
+			if i := strings.Index(s, c); i >= 0 && i < end {
+				end, next = i, i+len(c)
+			}
+		}
+		calls = append(calls, parse(s[:end])...)
+		s = s[next:]
+	}
+	return calls, strings.TrimSpace(text.String()), true
+}
+
+// jsonCalls parses the JSON objects, or the arrays of JSON objects, with the name and the arguments of functions
+func jsonCalls(s string) []FuncCallResults {
+	var objects []map[string]any
+	s = utils.EscapeNewLines(strings.TrimSpace(s))
+	if strings.HasPrefix(s, "[") {
+		if err := json.NewDecoder(strings.NewReader(s)).Decode(&objects); err != nil {
+			objects = nil
+		}
+	}
+	if objects == nil {
+		objects, _ = ParseJSON(s)
+	}
+
+	var calls []FuncCallResults
+	for _, o := range objects {
+		name, ok := o["name"].(string)
+		if !ok {
+			continue
+		}
+		arguments, ok := o["arguments"]
+		if !ok {
+			arguments = o["parameters"]
+		}
+		calls = append(calls, FuncCallResults{Name: name, Arguments: argumentsString(arguments)})
+	}
+	return calls
+}
+
+// argumentsString returns the JSON of the arguments, which some models already encode as a string
+func argumentsString(arguments any) string {
+	if s, ok := arguments.(string); ok && json.Valid([]byte(s)) {
+		return s
+	}
+	if arguments == nil {
+		arguments = map[string]any{}
+	}
+	d, _ := json.Marshal(arguments)
+	return string(d)
+}
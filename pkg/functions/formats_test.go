@@ -0,0 +1,95 @@
+package functions_test
+
+import (
+	. "github.com/mudler/LocalAI/pkg/functions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalAI function call format tests", func() {
+	parse := func(format, llmresult string) ([]FuncCallResults, string) {
+		functionConfig := FunctionsConfig{Format: format}
+		return ParseFunctionCall(llmresult, functionConfig), ParseTextContent(llmresult, functionConfig)
+	}
+
+	Context("with the hermes format", func() {
+		It("parses the tool calls and the text around them", func() {
+			results, text := parse(FormatHermes, `Let me check.
+<tool_call>
+{"name": "get_weather", "arguments": {"city": "Rome"}}
+</tool_call>
+<tool_call>
+{"name": "get_time", "arguments": {"timezone": "Europe/Rome"}}`)
+			Expect(results).To(Equal([]FuncCallResults{
+				{Name: "get_weather", Arguments: `{"city":"Rome"}`},
+				{Name: "get_time", Arguments: `{"timezone":"Europe/Rome"}`},
+			}))
+			Expect(text).To(Equal("Let me check."))
+		})
+
+		It("parses the results without tags as usual", func() {
+			results, text := parse(FormatHermes, `{"name": "get_weather", "arguments": {"city": "Rome"}}`)
+			Expect(results).To(Equal([]FuncCallResults{{Name: "get_weather", Arguments: `{"city":"Rome"}`}}))
+			Expect(text).To(BeEmpty())
+		})
+	})
+
+	Context("with the llama3.1 format", func() {
+		It("parses the calls after the python tag", func() {
+			results, _ := parse(FormatLLama31, `<|python_tag|>{"name": "get_weather", "parameters": {"city": "Rome"}}; {"name": "get_time", "parameters": {}}<|eom_id|>`)
+			Expect(results).To(Equal([]FuncCallResults{
+				{Name: "get_weather", Arguments: `{"city":"Rome"}`},
+				{Name: "get_time", Arguments: `{}`},
+			}))
+		})
+
+		It("parses the function tags", func() {
+			results, text := parse(FormatLLama31, `Searching. <function=search>{"query": "LocalAI"}</function>`)
+			Expect(results).To(Equal([]FuncCallResults{{Name: "search", Arguments: `{"query": "LocalAI"}`}}))
+			Expect(text).To(Equal("Searching."))
+		})
+
+		It("parses the JSON calls", func() {
+			results, _ := parse(FormatLLama31, `{"name": "search", "parameters": {"query": "LocalAI"}}`)
+			Expect(results).To(Equal([]FuncCallResults{{Name: "search", Arguments: `{"query":"LocalAI"}`}}))
+		})
+	})
+
+	Context("with the mistral format", func() {
+		It("parses the array of calls", func() {
+			results, _ := parse(FormatMistral, `[TOOL_CALLS] [{"name": "get_weather", "arguments": {"city": "Rome"}, "id": "abc123def"}, {"name": "get_time", "arguments": "{\"timezone\": \"UTC\"}"}]</s>`)
+			Expect(results).To(Equal([]FuncCallResults{
+				{Name: "get_weather", Arguments: `{"city":"Rome"}`},
+				{Name: "get_time", Arguments: `{"timezone": "UTC"}`},
+			}))
+		})
+
+		It("parses the calls with their name before the arguments", func() {
+			results, _ := parse(FormatMistral, `[TOOL_CALLS]get_weather[ARGS]{"city": "Rome"}[TOOL_CALLS]get_time[ARGS]{}`)
+			Expect(results).To(Equal([]FuncCallResults{
+				{Name: "get_weather", Arguments: `{"city": "Rome"}`},
+				{Name: "get_time", Arguments: `{}`},
+			}))
+		})
+	})
+
+	Context("with the qwen format", func() {
+		It("parses the function calls of Qwen-Agent", func() {
+			results, text := parse(FormatQwen, "I'll look it up.\n✿FUNCTION✿: get_weather\n✿ARGS✿: {\"city\": \"Rome\"}\n✿RESULT✿")
+			Expect(results).To(Equal([]FuncCallResults{{Name: "get_weather", Arguments: `{"city": "Rome"}`}}))
+			Expect(text).To(Equal("I'll look it up."))
+		})
+
+		It("parses the tool calls", func() {
+			results, _ := parse(FormatQwen, `<tool_call>{"name": "get_weather", "arguments": {"city": "Rome"}}</tool_call>`)
+			Expect(results).To(Equal([]FuncCallResults{{Name: "get_weather", Arguments: `{"city":"Rome"}`}}))
+		})
+	})
+
+	It("knows the formats", func() {
+		for _, format := range []string{FormatHermes, FormatLLama31, FormatMistral, FormatQwen} {
+			Expect(IsToolCallFormat(format)).To(BeTrue())
+		}
+		Expect(IsToolCallFormat("unknown")).To(BeFalse())
+	})
+})
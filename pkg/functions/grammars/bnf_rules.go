@@ -24,6 +24,24 @@ var (
 		"null": `"null" space`,
 	}
 
+	// GENERIC_VALUE_RULES are the rules of any JSON value, for the schemas which don't restrict it
+	GENERIC_VALUE_RULES = map[string]string{
+		"value":  `object | array | string | number | boolean | null`,
+		"object": `"{" space (string ":" space value ("," space string ":" space value)*)? "}" space`,
+		"array":  `"[" space (value ("," space value)*)? "]" space`,
+	}
+
+	// STRING_FORMAT_RULES are the rules of the content of the strings with a format
+	STRING_FORMAT_RULES = map[string]string{
+		"date":      `[0-9] [0-9] [0-9] [0-9] "-" ( "0" [1-9] | "1" [0-2] ) "-" ( "0" [1-9] | [1-2] [0-9] | "3" [0-1] )`,
+		"time":      `( [01] [0-9] | "2" [0-3] ) ":" [0-5] [0-9] ":" [0-5] [0-9] ( "." [0-9] [0-9] [0-9] )? ( "Z" | ( "+" | "-" ) ( [01] [0-9] | "2" [0-3] ) ":" [0-5] [0-9] )`,
+		"date-time": `date "T" time`,
+		"uuid":      `[0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] "-" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] "-" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] "-" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] "-" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F]`,
+	}
+
+	// STRING_CHAR_RULE is the rule of a character of a string
+	STRING_CHAR_RULE = `[^"\\] | "\\" (["\\/bfnrt] | "u" [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F] [0-9a-fA-F])`
+
 	INVALID_RULE_CHARS_RE     = regexp.MustCompile(`[^a-zA-Z0-9-]+`)
 	GRAMMAR_LITERAL_ESCAPE_RE = regexp.MustCompile(`[\r\n"]`)
 	GRAMMAR_LITERAL_ESCAPES   = map[string]string{
@@ -62,7 +62,14 @@ func (sc *JSONSchemaConverter) visit(schema map[string]interface{}, name string,
 	st, existType := schema["type"]
 	var schemaType string
 	if existType {
-		schemaType = st.(string)
+		switch t := st.(type) {
+		case string:
+			schemaType = t
+		case []interface{}:
+			return sc.visitTypes(schema, t, name, rootSchema)
+		default:
+			return "", fmt.Errorf("invalid type in schema: %v", st)
+		}
 	}
 	ruleName := name
 	if name == "" {
@@ -141,10 +148,17 @@ func (sc *JSONSchemaConverter) visit(schema map[string]interface{}, name string,
 			return propPairs[i].propName < propPairs[j].propName
 		})
 
-		var rule strings.Builder
-		rule.WriteString(`"{" space`)
+		// Without a list of the required properties, all the properties are required
+		required := map[string]bool{}
+		requiredList, hasRequired := schema["required"].([]interface{})
+		for _, r := range requiredList {
+			if r, ok := r.(string); ok {
+				required[r] = true
+			}
+		}
 
-		for i, propPair := range propPairs {
+		var requiredProps, optionalProps []string
+		for _, propPair := range propPairs {
 			propName := propPair.propName
 			propSchema := propPair.propSchema
 			propRuleName, err := sc.visit(propSchema, fmt.Sprintf("%s-%s", ruleName, propName), rootSchema)
@@ -155,23 +169,80 @@ func (sc *JSONSchemaConverter) visit(schema map[string]interface{}, name string,
 			if err != nil {
 				return "", err
 			}
+
+			kv := fmt.Sprintf(`%s space ":" space %s`, lPropName, propRuleName)
+			if !hasRequired || required[propName] {
+				requiredProps = append(requiredProps, kv)
+			} else {
+				optionalProps = append(optionalProps, sc.addRule(fmt.Sprintf("%s-%s-kv", ruleName, propName), kv))
+			}
+		}
+
+		var rule strings.Builder
+		rule.WriteString(`"{" space`)
+		for i, kv := range requiredProps {
 			if i > 0 {
 				rule.WriteString(` "," space`)
 			}
-
-			rule.WriteString(fmt.Sprintf(` %s space ":" space %s`, lPropName, propRuleName))
+			rule.WriteString(" " + kv)
+		}
+		if len(optionalProps) > 0 {
+			rule.WriteString(" (")
+			if len(requiredProps) > 0 {
+				rule.WriteString(` "," space (`)
+			}
+			var alternatives []string
+			for i := range optionalProps {
+				alternatives = append(alternatives, sc.optionalProperties(optionalProps[i:], false))
+			}
+			rule.WriteString(" " + strings.Join(alternatives, " | "))
+			if len(requiredProps) > 0 {
+				rule.WriteString(" )")
+			}
+			rule.WriteString(" )?")
 		}
 
 		rule.WriteString(` "}" space`)
 		return sc.addRule(ruleName, rule.String()), nil
+	} else if additional, exists := schema["additionalProperties"].(map[string]interface{}); schemaType == "object" && exists {
+		valueRuleName, err := sc.visit(additional, fmt.Sprintf("%s-additional", ruleName), rootSchema)
+		if err != nil {
+			return "", err
+		}
+		sc.addPrimitive("string")
+		kv := fmt.Sprintf(`string ":" space %s`, valueRuleName)
+		rule := fmt.Sprintf(`"{" space (%s ("," space %s)*)? "}" space`, kv, kv)
+		return sc.addRule(ruleName, rule), nil
 	} else if items, exists := schema["items"].(map[string]interface{}); schemaType == "array" && exists {
 		itemRuleName, err := sc.visit(items, fmt.Sprintf("%s-item", ruleName), rootSchema)
 		if err != nil {
 			return "", err
 		}
-		rule := fmt.Sprintf(`"[" space (%s ("," space %s)*)? "]" space`, itemRuleName, itemRuleName)
+		minItems, hasMin := intValue(schema["minItems"])
+		maxItems, hasMax := intValue(schema["maxItems"])
+		if !hasMin && !hasMax {
+			rule := fmt.Sprintf(`"[" space (%s ("," space %s)*)? "]" space`, itemRuleName, itemRuleName)
+			return sc.addRule(ruleName, rule), nil
+		}
+		if !hasMax {
+			maxItems = -1
+		}
+		rule := fmt.Sprintf(`"[" space %s "]" space`, repeatSeparated(itemRuleName, `"," space`, minItems, maxItems))
 		return sc.addRule(ruleName, rule), nil
+	} else if schemaType == "string" && sc.hasStringConstraints(schema) {
+		return sc.visitString(schema, ruleName)
 	} else {
+		if schemaType == "object" || schemaType == "array" || schemaType == "" {
+			// Any object, array or value
+			if schemaType == "" {
+				schemaType = "value"
+			}
+			sc.addGenericValue()
+			if ruleName == "root" {
+				return sc.addRule("root", schemaType), nil
+			}
+			return schemaType, nil
+		}
 		primitiveRule, exists := PRIMITIVE_RULES[schemaType]
 		if !exists {
 			return "", fmt.Errorf("unrecognized schema: %v", schema)
@@ -182,13 +253,77 @@ func (sc *JSONSchemaConverter) visit(schema map[string]interface{}, name string,
 		return sc.addRule(schemaType, primitiveRule), nil
 	}
 }
+
+// visitTypes returns the rule of a schema with several types, e.g. ["string", "null"]
+func (sc *JSONSchemaConverter) visitTypes(schema map[string]interface{}, types []interface{}, name string, rootSchema map[string]interface{}) (string, error) {
+	ruleName := name
+	if name == "" {
+		ruleName = "root"
+	}
+	var alternatives []string
+	for i, t := range types {
+		typed := make(map[string]interface{}, len(schema))
+		for k, v := range schema {
+			typed[k] = v
+		}
+		typed["type"] = t
+		alternative, err := sc.visit(typed, fmt.Sprintf("%s-%d", ruleName, i), rootSchema)
+		if err != nil {
+			return "", err
+		}
+		alternatives = append(alternatives, alternative)
+	}
+	return sc.addRule(ruleName, strings.Join(alternatives, " | ")), nil
+}
+
+// optionalProperties returns the rule of the optional properties of an object, in order, any of which can be
+// omitted
+func (sc *JSONSchemaConverter) optionalProperties(kvs []string, firstIsOptional bool) string {
+	rule := kvs[0]
+	if firstIsOptional {
+		rule = fmt.Sprintf(`( "," space %s )?`, kvs[0])
+	}
+	if len(kvs) > 1 {
+		rule += " " + sc.addRule(fmt.Sprintf("%s-rest", kvs[0]), sc.optionalProperties(kvs[1:], true))
+	}
+	return rule
+}
+
+func (sc *JSONSchemaConverter) addPrimitive(name string) {
+	sc.addRule(name, PRIMITIVE_RULES[name])
+}
+
+// addGenericValue adds the rules of any JSON value: value, object and array
+func (sc *JSONSchemaConverter) addGenericValue() {
+	for _, name := range []string{"string", "number", "boolean", "null"} {
+		sc.addPrimitive(name)
+	}
+	for name, rule := range GENERIC_VALUE_RULES {
+		sc.addRule(name, rule)
+	}
+}
+
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int(n), true
+	case int:
+		return n, true
+	}
+	return 0, false
+}
+
 func (sc *JSONSchemaConverter) resolveReference(ref string, rootSchema map[string]interface{}) (map[string]interface{}, error) {
-	if !strings.HasPrefix(ref, "#/$defs/") {
+	defsKey := "$defs"
+	if strings.HasPrefix(ref, "#/definitions/") {
+		defsKey = "definitions"
+	}
+	if !strings.HasPrefix(ref, "#/"+defsKey+"/") {
 		return nil, fmt.Errorf("invalid reference format: %s", ref)
 	}
 
-	defKey := strings.TrimPrefix(ref, "#/$defs/")
-	definitions, exists := rootSchema["$defs"].(map[string]interface{})
+	defKey := strings.TrimPrefix(ref, "#/"+defsKey+"/")
+	definitions, exists := rootSchema[defsKey].(map[string]interface{})
 	if !exists {
 		return nil, fmt.Errorf("no definitions found in the schema: %s", rootSchema)
 	}
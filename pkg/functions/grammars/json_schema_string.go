@@ -0,0 +1,342 @@
+package grammars
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func (sc *JSONSchemaConverter) hasStringConstraints(schema map[string]interface{}) bool {
+	if _, exists := schema["pattern"].(string); exists {
+		return true
+	}
+	if format, exists := schema["format"].(string); exists {
+		if _, known := STRING_FORMAT_RULES[format]; known {
+			return true
+		}
+	}
+	_, hasMin := intValue(schema["minLength"])
+	_, hasMax := intValue(schema["maxLength"])
+	return hasMin || hasMax
+}
+
+// visitString returns the rule of a string with a format, a pattern or a length. A pattern which can't be converted
+// to a grammar, e.g. with a lookahead, only constrains the output to be a string.
+func (sc *JSONSchemaConverter) visitString(schema map[string]interface{}, ruleName string) (string, error) {
+	if format, exists := schema["format"].(string); exists {
+		if rule, known := STRING_FORMAT_RULES[format]; known {
+			if format == "date-time" {
+				sc.addRule("date", STRING_FORMAT_RULES["date"])
+				sc.addRule("time", STRING_FORMAT_RULES["time"])
+			}
+			formatRule := sc.addRule(format, rule)
+			return sc.addRule(ruleName, fmt.Sprintf(`"\"" %s "\"" space`, formatRule)), nil
+		}
+	}
+
+	if pattern, exists := schema["pattern"].(string); exists {
+		p := &patternParser{pattern: []rune(pattern)}
+		rule, err := p.parse()
+		if err != nil {
+			sc.addPrimitive("string")
+			return sc.addRule(ruleName, "string"), nil
+		}
+		return sc.addRule(ruleName, fmt.Sprintf(`"\"" %s "\"" space`, rule)), nil
+	}
+
+	minLength, _ := intValue(schema["minLength"])
+	maxLength, hasMax := intValue(schema["maxLength"])
+	if !hasMax {
+		maxLength = -1
+	}
+	char := sc.addRule("char", STRING_CHAR_RULE)
+	return sc.addRule(ruleName, fmt.Sprintf(`"\"" %s "\"" space`, repeat(char, minLength, maxLength))), nil
+}
+
+// repeat returns the rule repeating item from min to max times, any number of times over min if max is negative
+func repeat(item string, min, max int) string {
+	if max >= 0 && max < min {
+		max = min
+	}
+	parts := make([]string, 0, min+1)
+	for i := 0; i < min; i++ {
+		parts = append(parts, item)
+	}
+	switch {
+	case max < 0:
+		parts = append(parts, item+"*")
+	case max > min:
+		// Nested optionals, e.g. (x (x)?)?, instead of x? x? which is ambiguous
+		optional := ""
+		for i := 0; i < max-min; i++ {
+			if optional == "" {
+				optional = fmt.Sprintf("(%s)?", item)
+			} else {
+				optional = fmt.Sprintf("(%s %s)?", item, optional)
+			}
+		}
+		parts = append(parts, optional)
+	}
+	if len(parts) == 0 {
+		return `""`
+	}
+	return strings.Join(parts, " ")
+}
+
+// repeatSeparated returns the rule repeating item with separator from min to max times, any number of times over min
+// if max is negative
+func repeatSeparated(item, separator string, min, max int) string {
+	if max == 0 {
+		return `""`
+	}
+	nextMax := max - 1
+	if max < 0 {
+		nextMax = -1
+	}
+	rule := fmt.Sprintf("%s %s", item, repeat(fmt.Sprintf("(%s %s)", separator, item), max0(min-1), nextMax))
+	if min == 0 {
+		return fmt.Sprintf("(%s)?", rule)
+	}
+	return rule
+}
+
+func max0(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// patternParser converts a regular expression to the rule of the content of a string. It supports the literals,
+// the character classes, the groups, the alternatives and the quantifiers, but not e.g. the lookarounds or the
+// backreferences.
+type patternParser struct {
+	pattern []rune
+	pos     int
+}
+
+func (p *patternParser) parse() (string, error) {
+	// The pattern must match the whole string
+	if p.pos < len(p.pattern) && p.pattern[p.pos] == '^' {
+		p.pos++
+	}
+	if n := len(p.pattern); n > 0 && p.pattern[n-1] == '$' && (n < 2 || p.pattern[n-2] != '\\') {
+		p.pattern = p.pattern[:n-1]
+	}
+	rule, err := p.alternatives()
+	if err != nil {
+		return "", err
+	}
+	if p.pos < len(p.pattern) {
+		return "", fmt.Errorf("unexpected %q at %d in pattern", p.pattern[p.pos], p.pos)
+	}
+	return rule, nil
+}
+
+func (p *patternParser) peek() (rune, bool) {
+	if p.pos >= len(p.pattern) {
+		return 0, false
+	}
+	return p.pattern[p.pos], true
+}
+
+func (p *patternParser) alternatives() (string, error) {
+	var alternatives []string
+	for {
+		sequence, err := p.sequence()
+		if err != nil {
+			return "", err
+		}
+		alternatives = append(alternatives, sequence)
+		if c, ok := p.peek(); !ok || c != '|' {
+			break
+		}
+		p.pos++
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return "(" + strings.Join(alternatives, " | ") + ")", nil
+}
+
+func (p *patternParser) sequence() (string, error) {
+	var items []string
+	for {
+		c, ok := p.peek()
+		if !ok || c == '|' || c == ')' {
+			break
+		}
+		atom, err := p.atom()
+		if err != nil {
+			return "", err
+		}
+		atom, err = p.quantifier(atom)
+		if err != nil {
+			return "", err
+		}
+		items = append(items, atom)
+	}
+	if len(items) == 0 {
+		return `""`, nil
+	}
+	return strings.Join(items, " "), nil
+}
+
+func (p *patternParser) atom() (string, error) {
+	c := p.pattern[p.pos]
+	p.pos++
+	switch c {
+	case '(':
+		if c, ok := p.peek(); ok && c == '?' {
+			if p.pos+1 >= len(p.pattern) || p.pattern[p.pos+1] != ':' {
+				return "", fmt.Errorf("unsupported group at %d in pattern", p.pos)
+			}
+			p.pos += 2
+		}
+		rule, err := p.alternatives()
+		if err != nil {
+			return "", err
+		}
+		if c, ok := p.peek(); !ok || c != ')' {
+			return "", fmt.Errorf("unclosed group in pattern")
+		}
+		p.pos++
+		return "(" + rule + ")", nil
+	case '[':
+		return p.class()
+	case '.':
+		return `[^"\\]`, nil
+	case '\\':
+		if p.pos >= len(p.pattern) {
+			return "", fmt.Errorf("trailing backslash in pattern")
+		}
+		e := p.pattern[p.pos]
+		p.pos++
+		if class, exists := patternClassEscapes[e]; exists {
+			return "[" + class + "]", nil
+		}
+		if e >= '0' && e <= '9' || e == 'b' || e == 'B' {
+			return "", fmt.Errorf("unsupported escape \\%c in pattern", e)
+		}
+		if c, exists := patternControlEscapes[e]; exists {
+			e = c
+		}
+		return literal(e), nil
+	case '*', '+', '?', '{', ')':
+		return "", fmt.Errorf("unexpected %q at %d in pattern", c, p.pos-1)
+	}
+	return literal(c), nil
+}
+
+var patternControlEscapes = map[rune]rune{
+	'n': '\n',
+	'r': '\r',
+	't': '\t',
+}
+
+var patternClassEscapes = map[rune]string{
+	'd': `0-9`,
+	'D': `^0-9"\\`,
+	'w': `a-zA-Z0-9_`,
+	'W': `^a-zA-Z0-9_"\\`,
+	's': ` \t`,
+	'S': `^ \t"\\`,
+}
+
+func (p *patternParser) class() (string, error) {
+	var class strings.Builder
+	if c, ok := p.peek(); ok && c == '^' {
+		class.WriteRune('^')
+		p.pos++
+	}
+	for {
+		c, ok := p.peek()
+		if !ok {
+			return "", fmt.Errorf("unclosed character class in pattern")
+		}
+		p.pos++
+		switch {
+		case c == ']':
+			return "[" + class.String() + "]", nil
+		case c == '\\' && p.pos < len(p.pattern):
+			e := p.pattern[p.pos]
+			p.pos++
+			if escape, exists := patternClassEscapes[e]; exists && escape[0] != '^' {
+				class.WriteString(escape)
+			} else if exists {
+				return "", fmt.Errorf("unsupported escape \\%c in character class", e)
+			} else if _, exists := patternControlEscapes[e]; exists || strings.ContainsRune(`\[]"`, e) {
+				class.WriteString(`\` + string(e))
+			} else {
+				class.WriteString(fmt.Sprintf(`\x%02X`, e))
+			}
+		default:
+			class.WriteRune(c)
+		}
+	}
+}
+
+func (p *patternParser) quantifier(atom string) (string, error) {
+	c, ok := p.peek()
+	if !ok {
+		return atom, nil
+	}
+	var rule string
+	switch c {
+	case '*', '+', '?':
+		p.pos++
+		rule = atom + string(c)
+	case '{':
+		end := p.pos
+		for end < len(p.pattern) && p.pattern[end] != '}' {
+			end++
+		}
+		if end == len(p.pattern) {
+			return "", fmt.Errorf("unclosed quantifier in pattern")
+		}
+		bounds := strings.Split(string(p.pattern[p.pos+1:end]), ",")
+		min, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+		if err != nil || len(bounds) > 2 {
+			return "", fmt.Errorf("invalid quantifier in pattern")
+		}
+		max := min
+		if len(bounds) == 2 {
+			if strings.TrimSpace(bounds[1]) == "" {
+				max = -1
+			} else if max, err = strconv.Atoi(strings.TrimSpace(bounds[1])); err != nil {
+				return "", fmt.Errorf("invalid quantifier in pattern")
+			}
+		}
+		p.pos = end + 1
+		rule = "(" + repeat(atom, min, max) + ")"
+	default:
+		return atom, nil
+	}
+	// Lazy quantifiers match the same strings
+	if c, ok := p.peek(); ok && c == '?' {
+		p.pos++
+	}
+	return rule, nil
+}
+
+// literal returns the rule of a character of the pattern, as it is written in a JSON string
+func literal(c rune) string {
+	var escaped string
+	switch {
+	case c == '\n':
+		escaped = `\\n`
+	case c == '\r':
+		escaped = `\\r`
+	case c == '\t':
+		escaped = `\\t`
+	case c == '"':
+		escaped = `\\\"`
+	case c == '\\':
+		escaped = `\\\\`
+	case c < 0x20:
+		escaped = fmt.Sprintf(`\\u%04x`, c)
+	default:
+		escaped = string(c)
+	}
+	return `"` + escaped + `"`
+}
@@ -443,4 +443,51 @@ realvalue
 			}
 		})
 	})
+
+	Context("JSON schema constructs", func() {
+		grammarOf := func(schema string) string {
+			grammar, err := NewJSONSchemaConverter("").GrammarFromBytes([]byte(schema))
+			Expect(err).ToNot(HaveOccurred())
+			return grammar
+		}
+
+		It("makes the properties which are not required optional", func() {
+			grammar := grammarOf(`{"type":"object","properties":{"name":{"type":"string"},"age":{"type":"integer"},"email":{"type":"string"}},"required":["name"]}`)
+			Expect(grammar).To(ContainSubstring(`root ::= "{" space "\"name\"" space ":" space string ( "," space ( root-age-kv root-age-kv-rest | root-email-kv ) )? "}" space`))
+			Expect(grammar).To(ContainSubstring(`root-age-kv-rest ::= ( "," space root-email-kv )?`))
+		})
+
+		It("limits the number of items of arrays", func() {
+			grammar := grammarOf(`{"type":"array","items":{"type":"number"},"minItems":1,"maxItems":3}`)
+			Expect(grammar).To(ContainSubstring(`root ::= "[" space number (("," space number) (("," space number))?)? "]" space`))
+		})
+
+		It("converts the patterns of strings", func() {
+			grammar := grammarOf(`{"type":"string","pattern":"^[a-z]{2,3}-\\d+$"}`)
+			Expect(grammar).To(ContainSubstring(`root ::= "\"" ([a-z] [a-z] ([a-z])?) "-" [0-9]+ "\"" space`))
+
+			grammar = grammarOf(`{"type":"string","pattern":"^(?=a).*$"}`)
+			Expect(grammar).To(ContainSubstring("root ::= string"))
+		})
+
+		It("converts the formats of strings", func() {
+			grammar := grammarOf(`{"type":"string","format":"date"}`)
+			Expect(grammar).To(ContainSubstring(`root ::= "\"" date "\"" space`))
+			Expect(grammar).To(ContainSubstring(`date ::= [0-9] [0-9] [0-9] [0-9] "-"`))
+		})
+
+		It("allows any of the types of a type array", func() {
+			grammar := grammarOf(`{"type":["string","null"]}`)
+			Expect(grammar).To(ContainSubstring("root ::= string | null"))
+		})
+
+		It("allows any value in objects without properties", func() {
+			grammar := grammarOf(`{"type":"object"}`)
+			Expect(grammar).To(ContainSubstring("root ::= object"))
+			Expect(grammar).To(ContainSubstring("value ::= object | array | string | number | boolean | null"))
+
+			grammar = grammarOf(`{"type":"object","additionalProperties":{"type":"integer"}}`)
+			Expect(grammar).To(ContainSubstring(`root ::= "{" space (string ":" space integer ("," space string ":" space integer)*)? "}" space`))
+		})
+	})
 })
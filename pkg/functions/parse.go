@@ -87,6 +87,10 @@ type FunctionsConfig struct {
 	// This might be useful for certain models trained with the function name as the first token.
 	FunctionNameKey      string `yaml:"function_name_key"`
 	FunctionArgumentsKey string `yaml:"function_arguments_key"`
+
+	// Format is the format of the function calls of the model family, parsed without regexes
+	// available: hermes, llama3.1, mistral, qwen
+	Format string `yaml:"format"`
 }
 
 type ReplaceResult struct {
@@ -160,6 +164,11 @@ func ParseTextContent(llmresult string, functionConfig FunctionsConfig) string {
 		}
 	}
 
+	// The text around the function calls of the format of the model family
+	if _, text, ok := parseToolCallFormat(llmresult, functionConfig); ok {
+		return text
+	}
+
 	return ""
 }
 
@@ -216,6 +225,11 @@ func ParseFunctionCall(llmresult string, functionConfig FunctionsConfig) []FuncC
 	}
 	log.Debug().Msgf("LLM result(function cleanup): %s", llmresult)
 
+	if results, _, ok := parseToolCallFormat(llmresult, functionConfig); ok {
+		log.Debug().Msgf("Function calls in the %s format: %+v", functionConfig.Format, results)
+		return results
+	}
+
 	functionNameKey := defaultFunctionNameKey
 	functionArgumentsKey := defaultFunctionArgumentsKey
 	if functionConfig.FunctionNameKey != "" {
@@ -0,0 +1,237 @@
+package functions
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+)
+
+// ToolCallDelta is a part of a function call, as it is generated by the LLM
+type ToolCallDelta struct {
+	// Index is the position of the function call in the reply
+	Index int
+	// Name is the name of the function, set only in the first delta of the function call
+	Name string
+	// Arguments is the next part of the JSON arguments of the function
+	Arguments string
+}
+
+// CanStreamFunctionCalls returns true if the function calls can be parsed while they are generated. The results
+// which have to be changed or matched with regexes before being parsed can only be parsed once complete.
+func (g FunctionsConfig) CanStreamFunctionCalls() bool {
+	return len(g.ResponseRegex) == 0 &&
+		len(g.JSONRegexMatch) == 0 &&
+		len(g.ReplaceFunctionResults) == 0 &&
+		len(g.ReplaceLLMResult) == 0 &&
+		g.GrammarConfig.SchemaType != "llama3.1" &&
+		(g.Format == "" || g.Format == FormatHermes || g.Format == FormatMistral)
+}
+
+// FunctionCallStream parses the function calls of the LLM token by token. The function calls are the JSON objects
+// in the reply, or in a JSON array of the reply, as { "name": "function_name", "arguments": { "arg1": "value1" } }.
+// The text around them is ignored.
+type FunctionCallStream struct {
+	nameKey, argumentsKey string
+	noAction              string
+
+	// stack holds the JSON objects and arrays being generated
+	stack             []byte
+	inString, escaped bool
+
+	// The function call being generated
+	inCall        bool
+	expectKey     bool
+	key           string
+	str           strings.Builder
+	readingString bool
+	name          string
+	capturing     bool
+	arguments     strings.Builder
+	started       bool
+	index         int
+}
+
+// NewFunctionCallStream returns a parser of the function calls. The calls of the noAction function are not returned,
+// as they are answers to the user.
+func NewFunctionCallStream(functionConfig FunctionsConfig, noAction string) *FunctionCallStream {
+	s := &FunctionCallStream{
+		nameKey:      defaultFunctionNameKey,
+		argumentsKey: defaultFunctionArgumentsKey,
+		noAction:     noAction,
+	}
+	if functionConfig.FunctionNameKey != "" {
+		s.nameKey = functionConfig.FunctionNameKey
+	}
+	if functionConfig.FunctionArgumentsKey != "" {
+		s.argumentsKey = functionConfig.FunctionArgumentsKey
+	}
+	return s
+}
+
+// Calls returns the number of function calls returned so far
+func (s *FunctionCallStream) Calls() int {
+	if s.started {
+		return s.index + 1
+	}
+	return s.index
+}
+
+// Write parses the next token of the LLM and returns the parts of the function calls which are complete. The name
+// of a function is returned once the whole name is generated, with the arguments generated before it.
+func (s *FunctionCallStream) Write(token string) []ToolCallDelta {
+	var deltas []ToolCallDelta
+	for i := 0; i < len(token); i++ {
+		if delta, ok := s.next(token[i]); ok {
+			deltas = append(deltas, delta)
+		}
+	}
+	if delta, ok := s.flush(); ok {
+		deltas = append(deltas, delta)
+	}
+	return deltas
+}
+
+func (s *FunctionCallStream) next(c byte) (ToolCallDelta, bool) {
+	callLevel := s.atCallLevel()
+
+	if s.inString {
+		switch {
+		case s.escaped:
+			s.escaped = false
+		case c == '\\':
+			s.escaped = true
+		case c == '"':
+			s.inString = false
+		}
+		if s.capturing {
+			s.arguments.WriteByte(c)
+		}
+		if s.readingString {
+			s.str.WriteByte(c)
+			if !s.inString {
+				s.readingString = false
+				s.readString()
+			}
+		}
+		return ToolCallDelta{}, false
+	}
+
+	if s.capturing && callLevel && (c == ',' || c == '}') {
+		s.capturing = false
+	}
+	if s.capturing {
+		if !callLevel || !isSpace(c) {
+			s.arguments.WriteByte(c)
+		}
+	} else if callLevel && !s.expectKey && s.key == s.argumentsKey && c != ':' && c != ',' && c != '}' && !isSpace(c) {
+		s.capturing = true
+		s.arguments.WriteByte(c)
+	}
+
+	switch c {
+	case '"':
+		// The text out of the JSON documents may have any quote
+		if len(s.stack) > 0 {
+			s.inString = true
+		}
+		if callLevel {
+			s.readingString = true
+			s.str.Reset()
+			s.str.WriteByte(c)
+		}
+	case '{':
+		if len(s.stack) == 0 || len(s.stack) == 1 && s.stack[0] == '[' {
+			s.inCall = true
+			s.expectKey = true
+		}
+		s.stack = append(s.stack, c)
+	case '[':
+		s.stack = append(s.stack, c)
+	case '}', ']':
+		if len(s.stack) == 0 {
+			return ToolCallDelta{}, false
+		}
+		s.stack = s.stack[:len(s.stack)-1]
+		if callLevel && c == '}' {
+			delta, ok := s.flush()
+			s.endCall()
+			return delta, ok
+		}
+	case ',':
+		if callLevel {
+			s.expectKey = true
+		}
+	case ':':
+		if callLevel {
+			s.expectKey = false
+		}
+	}
+	return ToolCallDelta{}, false
+}
+
+// atCallLevel returns true if the parser is in the object of the function call, out of its values
+func (s *FunctionCallStream) atCallLevel() bool {
+	if !s.inCall {
+		return false
+	}
+	return len(s.stack) == 1 || len(s.stack) == 2 && s.stack[0] == '['
+}
+
+func (s *FunctionCallStream) readString() {
+	var value string
+	if err := json.Unmarshal([]byte(s.str.String()), &value); err != nil {
+		return
+	}
+	switch {
+	case s.expectKey:
+		s.key = value
+	case s.key == s.nameKey:
+		s.name = value
+	}
+}
+
+// flush returns the part of the current function call which was not returned yet
+func (s *FunctionCallStream) flush() (ToolCallDelta, bool) {
+	if !s.inCall || s.name == "" || s.name == s.noAction {
+		return ToolCallDelta{}, false
+	}
+	// A character may be split between tokens, keep its first bytes until it is complete
+	arguments := s.arguments.String()
+	n := completeRunes(arguments)
+	delta := ToolCallDelta{Index: s.index, Arguments: arguments[:n]}
+	s.arguments.Reset()
+	s.arguments.WriteString(arguments[n:])
+	if !s.started {
+		s.started = true
+		delta.Name = s.name
+	} else if delta.Arguments == "" {
+		return ToolCallDelta{}, false
+	}
+	return delta, true
+}
+
+func (s *FunctionCallStream) endCall() {
+	if s.started {
+		s.index++
+	}
+	s.inCall, s.expectKey, s.capturing, s.started = false, false, false, false
+	s.key, s.name = "", ""
+	s.arguments.Reset()
+}
+
+// completeRunes returns the length of the prefix of s which doesn't end with an incomplete UTF-8 character
+func completeRunes(s string) int {
+	for i := len(s) - 1; i >= 0 && i >= len(s)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(s[i]) {
+			if !utf8.FullRuneInString(s[i:]) {
+				return i
+			}
+			break
+		}
+	}
+	return len(s)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t'
+}
@@ -0,0 +1,88 @@
+package functions_test
+
+import (
+	"unicode/utf8"
+
+	. "github.com/mudler/LocalAI/pkg/functions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalAI function call stream tests", func() {
+	// streamTokens writes the reply to the stream in tokens of size characters
+	streamTokens := func(stream *FunctionCallStream, reply string, size int) []ToolCallDelta {
+		var deltas []ToolCallDelta
+		for i := 0; i < len(reply); i += size {
+			deltas = append(deltas, stream.Write(reply[i:min(i+size, len(reply))])...)
+		}
+		return deltas
+	}
+
+	// merge returns the name and the arguments of each function call, as a client of the stream would do
+	merge := func(deltas []ToolCallDelta) []FuncCallResults {
+		var calls []FuncCallResults
+		for _, d := range deltas {
+			if d.Name != "" {
+				Expect(d.Index).To(Equal(len(calls)))
+				calls = append(calls, FuncCallResults{Name: d.Name})
+			}
+			Expect(d.Index).To(Equal(len(calls) - 1))
+			calls[d.Index].Arguments += d.Arguments
+		}
+		return calls
+	}
+
+	It("streams the arguments of a function call as they are generated", func() {
+		stream := NewFunctionCallStream(FunctionsConfig{}, "answer")
+		deltas := streamTokens(stream, `{"name": "get_weather", "arguments": {"city": "Rome", "unit": "celsius"}}`, 3)
+		Expect(len(deltas)).To(BeNumerically(">", 2))
+		Expect(deltas[0].Name).To(Equal("get_weather"))
+		Expect(merge(deltas)).To(Equal([]FuncCallResults{
+			{Name: "get_weather", Arguments: `{"city": "Rome", "unit": "celsius"}`},
+		}))
+		Expect(stream.Calls()).To(Equal(1))
+	})
+
+	It("streams parallel function calls", func() {
+		stream := NewFunctionCallStream(FunctionsConfig{}, "answer")
+		reply := `[{"name": "add", "arguments": {"a": [1, 2]}},
+{"name": "subtract", "arguments": {"a": "}\"{"}}]`
+		Expect(merge(streamTokens(stream, reply, 2))).To(Equal([]FuncCallResults{
+			{Name: "add", Arguments: `{"a": [1, 2]}`},
+			{Name: "subtract", Arguments: `{"a": "}\"{"}`},
+		}))
+
+		stream = NewFunctionCallStream(FunctionsConfig{}, "answer")
+		reply = `{"name": "add", "arguments": {"a": 1}} {"name": "add", "arguments": {"a": 2}}`
+		Expect(merge(streamTokens(stream, reply, 5))).To(Equal([]FuncCallResults{
+			{Name: "add", Arguments: `{"a": 1}`},
+			{Name: "add", Arguments: `{"a": 2}`},
+		}))
+	})
+
+	It("returns the name with the arguments generated before it", func() {
+		stream := NewFunctionCallStream(FunctionsConfig{FunctionNameKey: "function", FunctionArgumentsKey: "args"}, "answer")
+		deltas := streamTokens(stream, `Sure: {"args": {"query": "LocalAI"}, "function": "search"}`, 4)
+		Expect(deltas).To(Equal([]ToolCallDelta{{Index: 0, Name: "search", Arguments: `{"query": "LocalAI"}`}}))
+	})
+
+	It("doesn't return the answers to the user", func() {
+		stream := NewFunctionCallStream(FunctionsConfig{}, "answer")
+		deltas := streamTokens(stream, `{"name": "answer", "arguments": {"message": "Hello"}}`, 1)
+		Expect(deltas).To(BeEmpty())
+		Expect(stream.Calls()).To(Equal(0))
+	})
+
+	It("doesn't split the characters between deltas", func() {
+		stream := NewFunctionCallStream(FunctionsConfig{}, "answer")
+		for _, d := range streamTokens(stream, `{"name": "say", "arguments": {"text": "città"}}`, 1) {
+			Expect(utf8.ValidString(d.Arguments)).To(BeTrue(), d.Arguments)
+		}
+	})
+
+	It("can't stream the results which are changed before being parsed", func() {
+		Expect(FunctionsConfig{}.CanStreamFunctionCalls()).To(BeTrue())
+		Expect(FunctionsConfig{ResponseRegex: []string{`(?P<name>\w+)`}}.CanStreamFunctionCalls()).To(BeFalse())
+		Expect(FunctionsConfig{ReplaceFunctionResults: []ReplaceResult{{Key: "a", Value: "b"}}}.CanStreamFunctionCalls()).To(BeFalse())
+	})
+})
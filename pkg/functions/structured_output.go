@@ -0,0 +1,73 @@
+package functions
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+// ValidateJSONSchema returns an error describing the differences between output and the JSON schema, nil if output
+// is a JSON document matching it
+func ValidateJSONSchema(schema map[string]interface{}, output string) error {
+	if !json.Valid([]byte(output)) {
+		return fmt.Errorf("the output is not valid JSON")
+	}
+	result, err := gojsonschema.Validate(gojsonschema.NewGoLoader(schema), gojsonschema.NewStringLoader(output))
+	if err != nil {
+		return fmt.Errorf("cannot validate the output: %w", err)
+	}
+	if result.Valid() {
+		return nil
+	}
+	var errs []string
+	for _, e := range result.Errors() {
+		errs = append(errs, e.String())
+	}
+	return fmt.Errorf("the output doesn't match the JSON schema: %s", strings.Join(errs, "; "))
+}
+
+// RepairJSON returns the JSON document in output without the text around it, e.g. a markdown code block or an
+// introduction, or output if it contains no JSON document
+func RepairJSON(output string) string {
+	trimmed := strings.TrimSpace(output)
+	if json.Valid([]byte(trimmed)) {
+		return trimmed
+	}
+
+	start := strings.IndexAny(trimmed, "{[")
+	if start < 0 {
+		return output
+	}
+	if end := matchingBracket(trimmed, start); end > 0 && json.Valid([]byte(trimmed[start:end+1])) {
+		return trimmed[start : end+1]
+	}
+	return output
+}
+
+// matchingBracket returns the index of the bracket closing the one at start, -1 if it is not closed
+func matchingBracket(s string, start int) int {
+	depth := 0
+	inString, escaped := false, false
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case escaped:
+			escaped = false
+		case inString && c == '\\':
+			escaped = true
+		case c == '"':
+			inString = !inString
+		case inString:
+		case c == '{' || c == '[':
+			depth++
+		case c == '}' || c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
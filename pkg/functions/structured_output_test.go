@@ -0,0 +1,55 @@
+package functions_test
+
+import (
+	. "github.com/mudler/LocalAI/pkg/functions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalAI structured output tests", func() {
+	jsonSchema := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"name": map[string]interface{}{"type": "string"},
+			"tags": map[string]interface{}{
+				"type":     "array",
+				"items":    map[string]interface{}{"type": "string"},
+				"minItems": 1,
+			},
+		},
+		"required":             []interface{}{"name"},
+		"additionalProperties": false,
+	}
+
+	Context("when validating the output", func() {
+		It("accepts the output matching the JSON schema", func() {
+			Expect(ValidateJSONSchema(jsonSchema, `{"name": "LocalAI", "tags": ["ai"]}`)).To(Succeed())
+			Expect(ValidateJSONSchema(jsonSchema, `{"name": "LocalAI"}`)).To(Succeed())
+		})
+
+		It("describes the differences with the JSON schema", func() {
+			err := ValidateJSONSchema(jsonSchema, `{"tags": [], "extra": 1}`)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring("name is required"))
+			Expect(err.Error()).To(ContainSubstring("Additional property extra is not allowed"))
+			Expect(err.Error()).To(ContainSubstring("Array must have at least 1 items"))
+		})
+
+		It("rejects the output which is not JSON", func() {
+			Expect(ValidateJSONSchema(jsonSchema, `I can't help with that`)).To(MatchError("the output is not valid JSON"))
+		})
+	})
+
+	Context("when repairing the output", func() {
+		It("extracts the JSON document from the text around it", func() {
+			Expect(RepairJSON("```json\n{\"name\": \"a}\"}\n```")).To(Equal(`{"name": "a}"}`))
+			Expect(RepairJSON(`Here it is: [1, [2]] done`)).To(Equal(`[1, [2]]`))
+			Expect(RepairJSON(` {"name": "LocalAI"} `)).To(Equal(`{"name": "LocalAI"}`))
+		})
+
+		It("returns the output without a JSON document", func() {
+			Expect(RepairJSON(`I can't help with that`)).To(Equal(`I can't help with that`))
+			Expect(RepairJSON(`{"name": `)).To(Equal(`{"name": `))
+		})
+	})
+})
@@ -0,0 +1,74 @@
+package functions
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+const (
+	// ToolChoiceAuto lets the model choose between calling functions and replying
+	ToolChoiceAuto = "auto"
+	// ToolChoiceNone disables the functions
+	ToolChoiceNone = "none"
+	// ToolChoiceRequired forces the model to call at least one function
+	ToolChoiceRequired = "required"
+)
+
+// ToolChoice is how the model uses the functions of the request, as set by tool_choice or by the legacy
+// function_call
+type ToolChoice struct {
+	// Mode is ToolChoiceAuto, ToolChoiceNone or ToolChoiceRequired
+	Mode string
+	// Function is the name of the function the model has to call, empty if it can call any function
+	Function string
+}
+
+// ParseToolChoice parses the tool_choice or the function_call of a request: "auto", "none", "required", the name of
+// a function, {"type": "function", "function": {"name": "my_function"}} or {"name": "my_function"}. It defaults to
+// "auto".
+func ParseToolChoice(choice interface{}) ToolChoice {
+	switch c := choice.(type) {
+	case string:
+		c = strings.TrimSpace(c)
+		switch c {
+		case "", ToolChoiceAuto:
+			return ToolChoice{Mode: ToolChoiceAuto}
+		case ToolChoiceNone, ToolChoiceRequired:
+			return ToolChoice{Mode: c}
+		}
+		// The object may be sent as a JSON string
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(c), &object); err == nil {
+			return ParseToolChoice(object)
+		}
+		return ToolChoice{Mode: ToolChoiceRequired, Function: c}
+	case map[string]interface{}:
+		name, _ := c["name"].(string)
+		if function, ok := c["function"].(map[string]interface{}); ok {
+			name, _ = function["name"].(string)
+		}
+		if name != "" {
+			return ToolChoice{Mode: ToolChoiceRequired, Function: name}
+		}
+	}
+	return ToolChoice{Mode: ToolChoiceAuto}
+}
+
+// Enabled returns true if the model can call functions
+func (t ToolChoice) Enabled() bool {
+	return t.Mode != ToolChoiceNone
+}
+
+// Functions returns the functions the model can choose from: only the function it has to call if any, otherwise
+// the functions of the request, with noAction to reply without calling functions unless a call is required.
+// It returns no function if the function to call is not in funcs.
+func (t ToolChoice) Functions(funcs Functions, noAction *Function) Functions {
+	if t.Function != "" {
+		return funcs.Select(t.Function)
+	}
+	if t.Mode == ToolChoiceRequired || noAction == nil {
+		return funcs
+	}
+	return append(slices.Clone(funcs), *noAction)
+}
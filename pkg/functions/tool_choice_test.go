@@ -0,0 +1,72 @@
+package functions_test
+
+import (
+	. "github.com/mudler/LocalAI/pkg/functions"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LocalAI tool choice tests", func() {
+	funcs := Functions{{Name: "get_weather"}, {Name: "search"}}
+	noAction := &Function{Name: "answer"}
+
+	names := func(funcs Functions) []string {
+		names := []string{}
+		for _, f := range funcs {
+			names = append(names, f.Name)
+		}
+		return names
+	}
+
+	Context("when the model chooses", func() {
+		It("lets the model call any function or reply", func() {
+			for _, choice := range []interface{}{nil, "", "auto", map[string]interface{}{"type": "auto"}} {
+				toolChoice := ParseToolChoice(choice)
+				Expect(toolChoice).To(Equal(ToolChoice{Mode: ToolChoiceAuto}))
+				Expect(toolChoice.Enabled()).To(BeTrue())
+				Expect(names(toolChoice.Functions(funcs, noAction))).To(Equal([]string{"get_weather", "search", "answer"}))
+			}
+		})
+
+		It("doesn't add the no action function when it is disabled", func() {
+			Expect(names(ParseToolChoice("auto").Functions(funcs, nil))).To(Equal([]string{"get_weather", "search"}))
+		})
+	})
+
+	Context("when the functions are disabled", func() {
+		It("doesn't use the functions", func() {
+			toolChoice := ParseToolChoice("none")
+			Expect(toolChoice.Mode).To(Equal(ToolChoiceNone))
+			Expect(toolChoice.Enabled()).To(BeFalse())
+		})
+	})
+
+	Context("when a function call is required", func() {
+		It("removes the no action function", func() {
+			toolChoice := ParseToolChoice("required")
+			Expect(toolChoice).To(Equal(ToolChoice{Mode: ToolChoiceRequired}))
+			Expect(toolChoice.Enabled()).To(BeTrue())
+			Expect(names(toolChoice.Functions(funcs, noAction))).To(Equal([]string{"get_weather", "search"}))
+		})
+	})
+
+	Context("when a function is named", func() {
+		It("forces calling exactly that function", func() {
+			for _, choice := range []interface{}{
+				map[string]interface{}{"type": "function", "function": map[string]interface{}{"name": "search"}},
+				`{"type": "function", "function": {"name": "search"}}`,
+				map[string]interface{}{"name": "search"},
+				"search",
+			} {
+				toolChoice := ParseToolChoice(choice)
+				Expect(toolChoice).To(Equal(ToolChoice{Mode: ToolChoiceRequired, Function: "search"}))
+				Expect(toolChoice.Enabled()).To(BeTrue())
+				Expect(names(toolChoice.Functions(funcs, noAction))).To(Equal([]string{"search"}))
+			}
+		})
+
+		It("returns no function if the function is not in the request", func() {
+			Expect(ParseToolChoice("missing").Functions(funcs, noAction)).To(BeEmpty())
+		})
+	})
+})
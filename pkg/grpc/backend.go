@@ -13,21 +13,24 @@ func Provide(addr string, llm LLM) {
 	embeds[addr] = &embedBackend{s: &server{llm: llm}}
 }
 
-func NewClient(address string, parallel bool, wd WatchDog, enableWatchDog bool) Backend {
+// NewClient returns the client of the backend at address. The dial options are added to the connections of the
+// client, e.g. to intercept its calls.
+func NewClient(address string, parallel bool, wd WatchDog, enableWatchDog bool, dialOptions ...grpc.DialOption) Backend {
 	if bc, ok := embeds[address]; ok {
 		return bc
 	}
-	return buildClient(address, parallel, wd, enableWatchDog)
+	return buildClient(address, parallel, wd, enableWatchDog, dialOptions)
 }
 
-func buildClient(address string, parallel bool, wd WatchDog, enableWatchDog bool) Backend {
+func buildClient(address string, parallel bool, wd WatchDog, enableWatchDog bool, dialOptions []grpc.DialOption) Backend {
 	if !enableWatchDog {
 		wd = nil
 	}
 	return &Client{
-		address:  address,
-		parallel: parallel,
-		wd:       wd,
+		address:     address,
+		parallel:    parallel,
+		wd:          wd,
+		dialOptions: dialOptions,
 	}
 }
 
@@ -49,6 +52,9 @@ type Backend interface {
 	StoresDelete(ctx context.Context, in *pb.StoresDeleteOptions, opts ...grpc.CallOption) (*pb.Result, error)
 	StoresGet(ctx context.Context, in *pb.StoresGetOptions, opts ...grpc.CallOption) (*pb.StoresGetResult, error)
 	StoresFind(ctx context.Context, in *pb.StoresFindOptions, opts ...grpc.CallOption) (*pb.StoresFindResult, error)
+	StoresList(ctx context.Context, in *pb.StoresListOptions, opts ...grpc.CallOption) (*pb.StoresListResult, error)
+	StoresCount(ctx context.Context, in *pb.StoresCountOptions, opts ...grpc.CallOption) (*pb.StoresCountResult, error)
+	StoresDrop(ctx context.Context, in *pb.StoresDropOptions, opts ...grpc.CallOption) (*pb.Result, error)
 
 	Rerank(ctx context.Context, in *pb.RerankRequest, opts ...grpc.CallOption) (*pb.RerankResult, error)
 
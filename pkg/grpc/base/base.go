@@ -92,6 +92,18 @@ func (llm *Base) StoresFind(*pb.StoresFindOptions) (pb.StoresFindResult, error)
 	return pb.StoresFindResult{}, fmt.Errorf("unimplemented")
 }
 
+func (llm *Base) StoresList(*pb.StoresListOptions) (pb.StoresListResult, error) {
+	return pb.StoresListResult{}, fmt.Errorf("unimplemented")
+}
+
+func (llm *Base) StoresCount(*pb.StoresCountOptions) (pb.StoresCountResult, error) {
+	return pb.StoresCountResult{}, fmt.Errorf("unimplemented")
+}
+
+func (llm *Base) StoresDrop(*pb.StoresDropOptions) error {
+	return fmt.Errorf("unimplemented")
+}
+
 func (llm *Base) VAD(*pb.VADRequest) (pb.VADResponse, error) {
 	return pb.VADResponse{}, fmt.Errorf("unimplemented")
 }
@@ -2,6 +2,7 @@ package base
 
 import (
 	"sync"
+	"sync/atomic"
 
 	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
 )
@@ -13,6 +14,7 @@ import (
 type SingleThread struct {
 	Base
 	backendBusy sync.Mutex
+	canceled    atomic.Bool
 }
 
 // Locking returns true if the backend needs to lock resources
@@ -22,12 +24,23 @@ func (llm *SingleThread) Locking() bool {
 
 func (llm *SingleThread) Lock() {
 	llm.backendBusy.Lock()
+	llm.canceled.Store(false)
 }
 
 func (llm *SingleThread) Unlock() {
 	llm.backendBusy.Unlock()
 }
 
+// Cancel asks the backend to stop the request being served, the backends check Canceled while they generate
+func (llm *SingleThread) Cancel() {
+	llm.canceled.Store(true)
+}
+
+// Canceled returns true if the request being served was cancelled by its client
+func (llm *SingleThread) Canceled() bool {
+	return llm.canceled.Load()
+}
+
 func (llm *SingleThread) Busy() bool {
 	r := llm.backendBusy.TryLock()
 	if r {
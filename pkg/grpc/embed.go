@@ -83,6 +83,18 @@ func (e *embedBackend) StoresFind(ctx context.Context, in *pb.StoresFindOptions,
 	return e.s.StoresFind(ctx, in)
 }
 
+func (e *embedBackend) StoresList(ctx context.Context, in *pb.StoresListOptions, opts ...grpc.CallOption) (*pb.StoresListResult, error) {
+	return e.s.StoresList(ctx, in)
+}
+
+func (e *embedBackend) StoresCount(ctx context.Context, in *pb.StoresCountOptions, opts ...grpc.CallOption) (*pb.StoresCountResult, error) {
+	return e.s.StoresCount(ctx, in)
+}
+
+func (e *embedBackend) StoresDrop(ctx context.Context, in *pb.StoresDropOptions, opts ...grpc.CallOption) (*pb.Result, error) {
+	return e.s.StoresDrop(ctx, in)
+}
+
 func (e *embedBackend) Rerank(ctx context.Context, in *pb.RerankRequest, opts ...grpc.CallOption) (*pb.RerankResult, error) {
 	return e.s.Rerank(ctx, in)
 }
@@ -101,6 +113,9 @@ type embedBackendServerStream struct {
 }
 
 func (e *embedBackendServerStream) Send(reply *pb.Reply) error {
+	if err := e.ctx.Err(); err != nil {
+		return err
+	}
 	e.fn(reply)
 	return nil
 }
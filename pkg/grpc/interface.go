@@ -24,10 +24,26 @@ type LLM interface {
 	StoresDelete(*pb.StoresDeleteOptions) error
 	StoresGet(*pb.StoresGetOptions) (pb.StoresGetResult, error)
 	StoresFind(*pb.StoresFindOptions) (pb.StoresFindResult, error)
+	StoresList(*pb.StoresListOptions) (pb.StoresListResult, error)
+	StoresCount(*pb.StoresCountOptions) (pb.StoresCountResult, error)
+	StoresDrop(*pb.StoresDropOptions) error
 
 	VAD(*pb.VADRequest) (pb.VADResponse, error)
 }
 
+// LogprobsLLM is implemented by the LLMs which can return the log probabilities of the tokens they generate. It is
+// used instead of Predict and PredictStream when the request asks for the log probabilities.
+type LogprobsLLM interface {
+	PredictLogprobs(*pb.PredictOptions) (*pb.Reply, error)
+	PredictStreamLogprobs(*pb.PredictOptions, chan *pb.Reply) error
+}
+
+// CancelableLLM is implemented by the LLMs which can stop the request they are serving, when its client cancels it.
+// The locking LLMs serve a request at a time, the request being served is the one holding the lock.
+type CancelableLLM interface {
+	Cancel()
+}
+
 func newReply(s string) *pb.Reply {
 	return &pb.Reply{Message: []byte(s)}
 }
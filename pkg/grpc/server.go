@@ -5,11 +5,20 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"path/filepath"
 
 	pb "github.com/mudler/LocalAI/pkg/grpc/proto"
+	"github.com/mudler/LocalAI/pkg/tracing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// errLogprobsUnimplemented is returned when the log probabilities of the tokens are requested from an LLM which can't
+// return them
+var errLogprobsUnimplemented = status.Error(codes.Unimplemented, "the backend can't return the log probabilities of the tokens")
+
 // A GRPC Server that allows to run LLM inference.
 // It is used by the LLMServices to expose the LLM functionalities that are called by the client.
 // The GRPC Service is general, trying to encompass all the possible LLM options models.
@@ -54,11 +63,42 @@ func (s *server) LoadModel(ctx context.Context, in *pb.ModelOptions) (*pb.Result
 	return &pb.Result{Message: "Loading succeeded", Success: true}, nil
 }
 
+// watchCancel cancels the request being served by the LLM when ctx is done, until the returned function is called
+func (s *server) watchCancel(ctx context.Context) func() {
+	llm, ok := s.llm.(CancelableLLM)
+	if !ok || !s.llm.Locking() {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			llm.Cancel()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
 func (s *server) Predict(ctx context.Context, in *pb.PredictOptions) (*pb.Reply, error) {
 	if s.llm.Locking() {
 		s.llm.Lock()
 		defer s.llm.Unlock()
 	}
+	// The request is cancelled before the lock is released
+	defer s.watchCancel(ctx)()
+	if in.Logprobs {
+		llm, ok := s.llm.(LogprobsLLM)
+		if !ok {
+			return nil, errLogprobsUnimplemented
+		}
+		return llm.PredictLogprobs(in)
+	}
 	result, err := s.llm.Predict(in)
 	return newReply(result), err
 }
@@ -133,10 +173,36 @@ func (s *server) PredictStream(in *pb.PredictOptions, stream pb.Backend_PredictS
 		s.llm.Lock()
 		defer s.llm.Unlock()
 	}
+	// The request is cancelled before the lock is released
+	defer s.watchCancel(stream.Context())()
+
+	if in.Logprobs {
+		llm, ok := s.llm.(LogprobsLLM)
+		if !ok {
+			return errLogprobsUnimplemented
+		}
+		replyChan := make(chan *pb.Reply)
+
+		done := make(chan bool)
+		go func() {
+			// The replies are read until the LLM stops, even if the client is gone
+			for reply := range replyChan {
+				stream.Send(reply)
+			}
+			done <- true
+		}()
+
+		err := llm.PredictStreamLogprobs(in, replyChan)
+		<-done
+
+		return streamErr(stream, err)
+	}
+
 	resultChan := make(chan string)
 
 	done := make(chan bool)
 	go func() {
+		// The results are read until the LLM stops, even if the client is gone
 		for result := range resultChan {
 			stream.Send(newReply(result))
 		}
@@ -146,7 +212,15 @@ func (s *server) PredictStream(in *pb.PredictOptions, stream pb.Backend_PredictS
 	err := s.llm.PredictStream(in, resultChan)
 	<-done
 
-	return err
+	return streamErr(stream, err)
+}
+
+// streamErr returns the error of the LLM, or the error of the stream context if the client cancelled the request
+func streamErr(stream pb.Backend_PredictStreamServer, err error) error {
+	if err != nil {
+		return err
+	}
+	return stream.Context().Err()
 }
 
 func (s *server) TokenizeString(ctx context.Context, in *pb.PredictOptions) (*pb.TokenizationResponse, error) {
@@ -227,6 +301,42 @@ func (s *server) StoresFind(ctx context.Context, in *pb.StoresFindOptions) (*pb.
 	return &res, nil
 }
 
+func (s *server) StoresList(ctx context.Context, in *pb.StoresListOptions) (*pb.StoresListResult, error) {
+	if s.llm.Locking() {
+		s.llm.Lock()
+		defer s.llm.Unlock()
+	}
+	res, err := s.llm.StoresList(in)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (s *server) StoresCount(ctx context.Context, in *pb.StoresCountOptions) (*pb.StoresCountResult, error) {
+	if s.llm.Locking() {
+		s.llm.Lock()
+		defer s.llm.Unlock()
+	}
+	res, err := s.llm.StoresCount(in)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (s *server) StoresDrop(ctx context.Context, in *pb.StoresDropOptions) (*pb.Result, error) {
+	if s.llm.Locking() {
+		s.llm.Lock()
+		defer s.llm.Unlock()
+	}
+	err := s.llm.StoresDrop(in)
+	if err != nil {
+		return &pb.Result{Message: fmt.Sprintf("Error dropping store: %s", err.Error()), Success: false}, err
+	}
+	return &pb.Result{Message: "Dropped store", Success: true}, nil
+}
+
 func (s *server) VAD(ctx context.Context, in *pb.VADRequest) (*pb.VADResponse, error) {
 	if s.llm.Locking() {
 		s.llm.Lock()
@@ -239,12 +349,23 @@ func (s *server) VAD(ctx context.Context, in *pb.VADRequest) (*pb.VADResponse, e
 	return &res, nil
 }
 
+// newServer returns the gRPC server of the backend. It continues the traces of the calls of LocalAI, which passes
+// the configuration of the tracing to the backends in their environment.
+func newServer() *grpc.Server {
+	if c := tracing.ConfigFromEnv(); c.Enabled() {
+		if _, err := tracing.Setup(c, filepath.Base(os.Args[0])); err != nil {
+			log.Printf("unable to set up the tracing: %v", err)
+		}
+	}
+	return grpc.NewServer(tracing.ServerOptions()...)
+}
+
 func StartServer(address string, model LLM) error {
 	lis, err := net.Listen("tcp", address)
 	if err != nil {
 		return err
 	}
-	s := grpc.NewServer()
+	s := newServer()
 	pb.RegisterBackendServer(s, &server{llm: model})
 	log.Printf("gRPC Server listening at %v", lis.Addr())
 	if err := s.Serve(lis); err != nil {
@@ -259,7 +380,7 @@ func RunServer(address string, model LLM) (func() error, error) {
 	if err != nil {
 		return nil, err
 	}
-	s := grpc.NewServer()
+	s := newServer()
 	pb.RegisterBackendServer(s, &server{llm: model})
 	log.Printf("gRPC Server listening at %v", lis.Addr())
 	if err = s.Serve(lis); err != nil {
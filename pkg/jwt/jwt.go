@@ -0,0 +1,230 @@
+// Package jwt verifies the JSON Web Tokens signed by the keys of a JSON Web Key Set (JWKS), e.g. the ID and access
+// tokens of an OpenID Connect provider. The signatures are verified with go-jose. Only the asymmetric algorithms are
+// supported: RS*, PS*, ES* and EdDSA.
+package jwt
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	jose "github.com/go-jose/go-jose/v4"
+	josejwt "github.com/go-jose/go-jose/v4/jwt"
+)
+
+var (
+	ErrMalformed     = errors.New("malformed token")
+	ErrSignature     = errors.New("invalid token signature")
+	ErrUnknownKey    = errors.New("token signed by an unknown key")
+	ErrNoExpiry      = errors.New("token has no expiry")
+	ErrExpired       = errors.New("token is expired")
+	ErrNotValidYet   = errors.New("token is not valid yet")
+	ErrWrongIssuer   = errors.New("token has the wrong issuer")
+	ErrWrongAudience = errors.New("token has the wrong audience")
+)
+
+// Leeway is the time by which the clocks of the issuer and of LocalAI can be off. The tokens are accepted until
+// Leeway after their expiry.
+const Leeway = time.Minute
+
+// signatureAlgorithms are the algorithms of the tokens which are accepted
+var signatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// IsToken returns true if s has the form of a JWT, three base64url parts separated by dots
+func IsToken(s string) bool {
+	parts := strings.Split(s, ".")
+	if len(parts) != 3 {
+		return false
+	}
+	for _, p := range parts[:2] {
+		if p == "" || strings.Trim(p, "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Key is a public key of a key set
+type Key struct {
+	ID        string
+	Algorithm string // Empty if the key can be used with all the algorithms of its type
+	Public    crypto.PublicKey
+}
+
+type KeySet struct {
+	Keys []Key
+}
+
+// ParseKeySet parses a JWKS document. The keys which are not used to sign, or of an unsupported type, are skipped.
+func ParseKeySet(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	set := &KeySet{}
+	for _, data := range doc.Keys {
+		var k jose.JSONWebKey
+		if err := k.UnmarshalJSON(data); err != nil || !k.Valid() {
+			continue
+		}
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		public := k.Public()
+		switch public.Key.(type) {
+		case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+			set.Keys = append(set.Keys, Key{ID: k.KeyID, Algorithm: k.Algorithm, Public: public.Key})
+		}
+	}
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("the JWKS has no supported signing key")
+	}
+	return set, nil
+}
+
+// key returns the key with which the token with the header kid and alg was signed
+func (s *KeySet) key(kid, alg string) (crypto.PublicKey, bool) {
+	for _, k := range s.Keys {
+		if (kid == "" || k.ID == kid) && (k.Algorithm == "" || k.Algorithm == alg) && keyFits(k.Public, alg) {
+			return k.Public, true
+		}
+	}
+	return nil, false
+}
+
+// keyFits returns true if key can verify the signatures of alg. The ECDSA keys are bound to the curve of the
+// algorithm, e.g. a P-384 key can't verify the ES256 signatures.
+func keyFits(key crypto.PublicKey, alg string) bool {
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		switch jose.SignatureAlgorithm(alg) {
+		case jose.ES256:
+			return key.Curve == elliptic.P256()
+		case jose.ES384:
+			return key.Curve == elliptic.P384()
+		case jose.ES512:
+			return key.Curve == elliptic.P521()
+		}
+	case ed25519.PublicKey:
+		return alg == string(jose.EdDSA)
+	}
+	return false
+}
+
+// Claims are the claims of a token
+type Claims map[string]any
+
+// String returns the string claim at path, the names of the nested claims being separated by dots
+func (c Claims) String(path string) string {
+	s, _ := c.value(path).(string)
+	return s
+}
+
+// Strings returns the claim at path as a list of strings, e.g. the groups of the user. A string claim is split by
+// spaces, like the scopes.
+func (c Claims) Strings(path string) []string {
+	switch v := c.value(path).(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Time returns the time of the numeric date claim name, the zero time if the token has no such claim
+func (c Claims) Time(name string) time.Time {
+	if v, ok := c[name].(float64); ok {
+		return time.Unix(int64(v), 0)
+	}
+	return time.Time{}
+}
+
+func (c Claims) value(path string) any {
+	var v any = map[string]any(c)
+	for _, name := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[name]
+	}
+	return v
+}
+
+// Parse verifies the signature of token with the keys of set and returns its claims, without validating them
+func Parse(token string, set *KeySet) (Claims, error) {
+	if !IsToken(token) {
+		return nil, ErrMalformed
+	}
+	parsed, err := josejwt.ParseSigned(token, signatureAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrMalformed, err)
+	}
+	header := parsed.Headers[0]
+
+	key, found := set.key(header.KeyID, header.Algorithm)
+	if !found {
+		return nil, ErrUnknownKey
+	}
+	var payload json.RawMessage
+	if err := parsed.Claims(key, &payload); err != nil {
+		return nil, ErrSignature
+	}
+	claims := Claims{}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	return claims, nil
+}
+
+// Validate checks the time, the issuer and the audience of the claims. The tokens must expire. The issuer and the
+// audience are not checked when they are empty.
+func (c Claims) Validate(now time.Time, issuer, audience string) error {
+	exp := c.Time("exp")
+	if exp.IsZero() {
+		return ErrNoExpiry
+	}
+	if !now.Before(exp.Add(Leeway)) {
+		return ErrExpired
+	}
+	if nbf := c.Time("nbf"); !nbf.IsZero() && now.Add(Leeway).Before(nbf) {
+		return ErrNotValidYet
+	}
+	if issuer != "" && strings.TrimSuffix(c.String("iss"), "/") != strings.TrimSuffix(issuer, "/") {
+		return ErrWrongIssuer
+	}
+	if audience != "" {
+		audiences := c.Strings("aud")
+		for _, a := range audiences {
+			if a == audience {
+				return nil
+			}
+		}
+		return ErrWrongAudience
+	}
+	return nil
+}
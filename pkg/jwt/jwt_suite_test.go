@@ -0,0 +1,13 @@
+package jwt_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestJWT(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LocalAI jwt test")
+}
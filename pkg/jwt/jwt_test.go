@@ -0,0 +1,224 @@
+package jwt_test
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/mudler/LocalAI/pkg/jwt"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var b64 = base64.RawURLEncoding
+
+func encode(v any) string {
+	data, err := json.Marshal(v)
+	Expect(err).ToNot(HaveOccurred())
+	return b64.EncodeToString(data)
+}
+
+// sign returns a token of claims signed by key
+func sign(key crypto.Signer, kid, alg string, claims map[string]any) string {
+	signed := encode(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encode(claims)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	var err error
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		if alg == "PS256" {
+			signature, err = rsa.SignPSS(rand.Reader, key, crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, key, digest[:])
+		size := (key.Curve.Params().BitSize + 7) / 8
+		signature = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+	case ed25519.PrivateKey:
+		signature = ed25519.Sign(key, []byte(signed))
+	}
+	Expect(err).ToNot(HaveOccurred())
+	return signed + "." + b64.EncodeToString(signature)
+}
+
+// jwk returns the public key of key in a JWKS
+func jwk(key crypto.Signer, kid string) map[string]string {
+	switch public := key.Public().(type) {
+	case *rsa.PublicKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "n": b64.EncodeToString(public.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(public.E)).Bytes())}
+	case *ecdsa.PublicKey:
+		size := (public.Curve.Params().BitSize + 7) / 8
+		return map[string]string{"kty": "EC", "kid": kid, "crv": public.Curve.Params().Name, "x": b64.EncodeToString(public.X.FillBytes(make([]byte, size))), "y": b64.EncodeToString(public.Y.FillBytes(make([]byte, size)))}
+	case ed25519.PublicKey:
+		return map[string]string{"kty": "OKP", "kid": kid, "crv": "Ed25519", "x": b64.EncodeToString(public)}
+	}
+	return nil
+}
+
+func jwks(keys ...map[string]string) []byte {
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	Expect(err).ToNot(HaveOccurred())
+	return data
+}
+
+var _ = Describe("JWT", func() {
+	var rsaKey *rsa.PrivateKey
+	var ecKey *ecdsa.PrivateKey
+	var edKey ed25519.PrivateKey
+	var keys *KeySet
+
+	BeforeEach(func() {
+		var err error
+		rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		Expect(err).ToNot(HaveOccurred())
+		ecKey, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		_, edKey, err = ed25519.GenerateKey(rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+
+		keys, err = ParseKeySet(jwks(jwk(rsaKey, "rsa"), jwk(ecKey, "ec"), jwk(edKey, "ed"), map[string]string{"kty": "oct", "k": "c2VjcmV0"}))
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	Context("Parse", func() {
+		It("verifies the signatures of all the key types", func() {
+			claims := map[string]any{"sub": "alice"}
+			for _, token := range []string{
+				sign(rsaKey, "rsa", "RS256", claims),
+				sign(rsaKey, "rsa", "PS256", claims),
+				sign(ecKey, "ec", "ES256", claims),
+				sign(edKey, "ed", "EdDSA", claims),
+				sign(edKey, "", "EdDSA", claims),
+			} {
+				Expect(IsToken(token)).To(BeTrue())
+				parsed, err := Parse(token, keys)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(parsed.String("sub")).To(Equal("alice"))
+			}
+		})
+
+		It("rejects the tokens with an invalid signature or of an unknown key", func() {
+			token := sign(edKey, "ed", "EdDSA", map[string]any{"sub": "alice"})
+			forged := encode(map[string]string{"alg": "EdDSA", "kid": "ed"}) + "." + encode(map[string]any{"sub": "admin"}) + token[len(token)-87:]
+			_, err := Parse(forged, keys)
+			Expect(err).To(MatchError(ErrSignature))
+
+			_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+			_, err = Parse(sign(otherKey, "other", "EdDSA", map[string]any{}), keys)
+			Expect(err).To(MatchError(ErrUnknownKey))
+
+			// The key of a type can't verify the signatures of the algorithms of another
+			_, err = Parse(sign(edKey, "rsa", "EdDSA", map[string]any{}), keys)
+			Expect(err).To(MatchError(ErrUnknownKey))
+
+			// The ECDSA keys verify the signatures of the algorithm of their curve only
+			p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+			Expect(err).ToNot(HaveOccurred())
+			p384Keys, err := ParseKeySet(jwks(jwk(p384Key, "p384")))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = Parse(sign(p384Key, "p384", "ES256", map[string]any{}), p384Keys)
+			Expect(err).To(MatchError(ErrUnknownKey))
+
+			_, err = Parse(encode(map[string]string{"alg": "none"})+"."+encode(map[string]any{})+".", keys)
+			Expect(err).To(HaveOccurred())
+			_, err = Parse("not-a-token", keys)
+			Expect(err).To(MatchError(ErrMalformed))
+			Expect(IsToken("sk-static-key")).To(BeFalse())
+		})
+	})
+
+	Context("Claims", func() {
+		claims := Claims{
+			"iss":    "https://sso.example.com/",
+			"aud":    []any{"localai", "other"},
+			"scope":  "openid profile",
+			"groups": []any{"ml", "ops"},
+			"realm":  map[string]any{"roles": []any{"admin"}},
+			"exp":    float64(time.Now().Add(time.Hour).Unix()),
+		}
+
+		It("returns the nested claims and the lists", func() {
+			Expect(claims.Strings("groups")).To(Equal([]string{"ml", "ops"}))
+			Expect(claims.Strings("scope")).To(Equal([]string{"openid", "profile"}))
+			Expect(claims.Strings("realm.roles")).To(Equal([]string{"admin"}))
+			Expect(claims.Strings("realm.missing")).To(BeEmpty())
+			Expect(claims.String("iss")).To(Equal("https://sso.example.com/"))
+		})
+
+		It("validates the time, the issuer and the audience", func() {
+			now := time.Now()
+			Expect(claims.Validate(now, "https://sso.example.com", "localai")).To(Succeed())
+			Expect(claims.Validate(now, "", "")).To(Succeed())
+			Expect(claims.Validate(now, "https://other.example.com", "")).To(MatchError(ErrWrongIssuer))
+			Expect(claims.Validate(now, "", "chat")).To(MatchError(ErrWrongAudience))
+			Expect(claims.Validate(now.Add(2*time.Hour), "", "")).To(MatchError(ErrExpired))
+			Expect(claims.Validate(now.Add(time.Hour).Add(Leeway/2), "", "")).To(Succeed())
+			Expect(Claims{"sub": "alice"}.Validate(now, "", "")).To(MatchError(ErrNoExpiry))
+			Expect(Claims{"exp": claims["exp"], "nbf": float64(now.Add(time.Hour).Unix())}.Validate(now, "", "")).To(MatchError(ErrNotValidYet))
+		})
+	})
+
+	Context("Verifier", func() {
+		It("reads the keys of a JWKS file again when a token is signed by a new key", func() {
+			path := filepath.Join(GinkgoT().TempDir(), "jwks.json")
+			Expect(os.WriteFile(path, jwks(jwk(edKey, "ed")), 0600)).To(Succeed())
+			verifier := NewFileVerifier(path, "", "")
+
+			exp := float64(time.Now().Add(time.Hour).Unix())
+			claims, err := verifier.Verify(sign(edKey, "ed", "EdDSA", map[string]any{"sub": "alice", "exp": exp}))
+			Expect(err).ToNot(HaveOccurred())
+			Expect(claims.String("sub")).To(Equal("alice"))
+
+			Expect(os.WriteFile(path, jwks(jwk(edKey, "ed"), jwk(ecKey, "ec")), 0600)).To(Succeed())
+			_, err = verifier.Verify(sign(ecKey, "ec", "ES256", map[string]any{"sub": "bob", "exp": exp}))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, err = verifier.Verify(sign(edKey, "ed", "EdDSA", map[string]any{"sub": "alice"}))
+			Expect(err).To(MatchError(ErrNoExpiry))
+
+			_, err = verifier.Verify(sign(edKey, "ed", "EdDSA", map[string]any{"exp": float64(time.Now().Add(-time.Hour).Unix())}))
+			Expect(err).To(MatchError(ErrExpired))
+		})
+
+		It("discovers the keys of an OpenID Connect issuer", func() {
+			mux := http.NewServeMux()
+			server := httptest.NewServer(mux)
+			defer server.Close()
+			mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintf(w, `{"issuer": %q, "jwks_uri": %q}`, server.URL, server.URL+"/keys")
+			})
+			mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+				w.Write(jwks(jwk(rsaKey, "rsa")))
+			})
+
+			_, err := NewIssuerVerifier(server.URL, "")
+			Expect(err).To(HaveOccurred())
+
+			verifier, err := NewIssuerVerifier(server.URL, "localai")
+			Expect(err).ToNot(HaveOccurred())
+			exp := float64(time.Now().Add(time.Hour).Unix())
+			_, err = verifier.Verify(sign(rsaKey, "rsa", "RS256", map[string]any{"iss": server.URL, "aud": "localai", "exp": exp}))
+			Expect(err).ToNot(HaveOccurred())
+			_, err = verifier.Verify(sign(rsaKey, "rsa", "RS256", map[string]any{"iss": "https://other.example.com", "aud": "localai", "exp": exp}))
+			Expect(err).To(MatchError(ErrWrongIssuer))
+			_, err = verifier.Verify(sign(rsaKey, "rsa", "RS256", map[string]any{"iss": server.URL, "aud": "other", "exp": exp}))
+			Expect(err).To(MatchError(ErrWrongAudience))
+		})
+	})
+})
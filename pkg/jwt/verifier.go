@@ -0,0 +1,158 @@
+package jwt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// issuerReloadInterval is the minimum time between two downloads of the keys of an issuer. The tokens signed by an
+// unknown key reload the keys, to get the new keys of a rotation.
+const issuerReloadInterval = time.Minute
+
+// Verifier verifies the tokens with the keys of a JWKS file or of an OpenID Connect issuer
+type Verifier struct {
+	Issuer   string
+	Audience string
+
+	load           func() ([]byte, error)
+	reloadInterval time.Duration
+
+	mu       sync.Mutex
+	keys     *KeySet
+	loadedAt time.Time
+	// loading is closed once the keys being loaded are loaded, nil when the keys are not being loaded
+	loading chan struct{}
+}
+
+// NewFileVerifier returns a verifier of the tokens signed by the keys of the JWKS file at path. The file is read again
+// when a token is signed by an unknown key. The issuer and the audience of the tokens are not checked when empty.
+func NewFileVerifier(path, issuer, audience string) *Verifier {
+	return &Verifier{
+		Issuer:   issuer,
+		Audience: audience,
+		load: func() ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}
+}
+
+// NewIssuerVerifier returns a verifier of the tokens of the OpenID Connect issuer, whose keys are found by the discovery
+// of /.well-known/openid-configuration. The audience is required: the issuer signs the tokens of all its clients.
+func NewIssuerVerifier(issuer, audience string) (*Verifier, error) {
+	if audience == "" {
+		return nil, fmt.Errorf("the tokens of the issuer %s need an audience", issuer)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	return &Verifier{
+		Issuer:         issuer,
+		Audience:       audience,
+		reloadInterval: issuerReloadInterval,
+		load: func() ([]byte, error) {
+			var discovery struct {
+				JWKSURI string `json:"jwks_uri"`
+			}
+			data, err := get(client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, &discovery); err != nil {
+				return nil, fmt.Errorf("invalid OpenID configuration: %w", err)
+			}
+			if discovery.JWKSURI == "" {
+				return nil, fmt.Errorf("the OpenID configuration of %s has no jwks_uri", issuer)
+			}
+			return get(client, discovery.JWKSURI)
+		},
+	}, nil
+}
+
+func get(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// keySet returns the keys, loading them if they were never loaded or if reload is set. The keys are loaded without
+// holding the lock, so that the download of the keys of an issuer doesn't block the tokens of the known keys. The
+// requests which need the keys being loaded wait for them.
+func (v *Verifier) keySet(reload bool) (*KeySet, error) {
+	v.mu.Lock()
+	if v.keys != nil && (!reload || time.Since(v.loadedAt) < v.reloadInterval) {
+		defer v.mu.Unlock()
+		return v.keys, nil
+	}
+	if loading := v.loading; loading != nil {
+		v.mu.Unlock()
+		<-loading
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if v.keys == nil {
+			return nil, fmt.Errorf("the keys are unavailable")
+		}
+		return v.keys, nil
+	}
+	if v.keys == nil && !v.loadedAt.IsZero() && time.Since(v.loadedAt) < time.Second {
+		// Don't load the keys on every request while the issuer is unreachable
+		v.mu.Unlock()
+		return nil, fmt.Errorf("the keys are unavailable")
+	}
+	v.loadedAt = time.Now()
+	loading := make(chan struct{})
+	v.loading = loading
+	v.mu.Unlock()
+
+	data, err := v.load()
+	var keys *KeySet
+	if err == nil {
+		keys, err = ParseKeySet(data)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.loading = nil
+	close(loading)
+	if err == nil {
+		v.keys = keys
+		return keys, nil
+	}
+	if v.keys != nil {
+		// Keep the previous keys
+		return v.keys, nil
+	}
+	return nil, fmt.Errorf("unable to load the keys: %w", err)
+}
+
+// Verify verifies the signature, the time, the issuer and the audience of token and returns its claims
+func (v *Verifier) Verify(token string) (Claims, error) {
+	keys, err := v.keySet(false)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := Parse(token, keys)
+	if errors.Is(err, ErrUnknownKey) {
+		if keys, err = v.keySet(true); err != nil {
+			return nil, err
+		}
+		claims, err = Parse(token, keys)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := claims.Validate(time.Now(), v.Issuer, v.Audience); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
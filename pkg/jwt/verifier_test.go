@@ -0,0 +1,45 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"sync/atomic"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Verifier keys", func() {
+	It("returns the known keys while the keys are loaded", func() {
+		public, _, err := ed25519.GenerateKey(rand.Reader)
+		Expect(err).ToNot(HaveOccurred())
+		jwks := fmt.Sprintf(`{"keys": [{"kty": "OKP", "crv": "Ed25519", "x": %q}]}`, base64.RawURLEncoding.EncodeToString(public))
+
+		release := make(chan struct{})
+		var loads atomic.Int32
+		verifier := &Verifier{load: func() ([]byte, error) {
+			if loads.Add(1) > 1 {
+				<-release
+			}
+			return []byte(jwks), nil
+		}}
+		keys, err := verifier.keySet(false)
+		Expect(err).ToNot(HaveOccurred())
+
+		reloaded := make(chan *KeySet)
+		go func() {
+			defer GinkgoRecover()
+			keys, err := verifier.keySet(true)
+			Expect(err).ToNot(HaveOccurred())
+			reloaded <- keys
+		}()
+		Eventually(loads.Load).Should(Equal(int32(2)))
+		Expect(verifier.keySet(false)).To(BeIdenticalTo(keys))
+		Consistently(reloaded).ShouldNot(Receive())
+
+		close(release)
+		Expect(<-reloaded).ToNot(BeIdenticalTo(keys))
+	})
+})
@@ -0,0 +1,374 @@
+package kvstore
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+)
+
+// The log is compacted when it holds more than compactRatio records per live key
+const (
+	compactMinRecords = 1024
+	compactRatio      = 2
+)
+
+type entry struct {
+	seq   uint64
+	value json.RawMessage
+}
+
+// record is a change in the log, each line of the log holds the records of a transaction
+type record struct {
+	Bucket string          `json:"bucket"`
+	Key    string          `json:"key,omitempty"` // Empty when the bucket is deleted
+	Seq    uint64          `json:"seq,omitempty"`
+	Value  json.RawMessage `json:"value,omitempty"`
+	Delete bool            `json:"delete,omitempty"`
+}
+
+type fileStore struct {
+	sync.RWMutex
+	buckets map[string]map[string]entry
+	seq     uint64
+
+	path    string
+	log     *os.File
+	records int
+}
+
+// NewMemoryStore returns a store which is not persisted
+func NewMemoryStore() Store {
+	return &fileStore{buckets: map[string]map[string]entry{}}
+}
+
+// Open loads the store persisted at path, creating it if it doesn't exist.
+// Every transaction is appended to the file, which is compacted when it grows.
+func Open(path string) (Store, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, err
+	}
+
+	s := &fileStore{buckets: map[string]map[string]entry{}, path: path}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.replay(f); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed loading %s: %w", path, err)
+	}
+	s.log = f
+
+	return s, nil
+}
+
+// replay applies the transactions of the log, dropping a transaction that was partially written
+func (s *fileStore) replay(f *os.File) error {
+	r := bufio.NewReader(f)
+	var offset int64
+
+	for {
+		line, err := r.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				if err := f.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		records := []record{}
+		if err := json.Unmarshal(line, &records); err != nil {
+			if err := f.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+
+		for _, rec := range records {
+			s.apply(s.buckets, rec)
+		}
+		s.records += len(records)
+		offset += int64(len(line))
+	}
+
+	_, err := f.Seek(offset, io.SeekStart)
+	return err
+}
+
+func (s *fileStore) apply(buckets map[string]map[string]entry, rec record) {
+	if rec.Seq > s.seq {
+		s.seq = rec.Seq
+	}
+
+	switch {
+	case rec.Key == "":
+		delete(buckets, rec.Bucket)
+	case rec.Delete:
+		delete(buckets[rec.Bucket], rec.Key)
+	default:
+		if buckets[rec.Bucket] == nil {
+			buckets[rec.Bucket] = map[string]entry{}
+		}
+		buckets[rec.Bucket][rec.Key] = entry{seq: rec.Seq, value: rec.Value}
+	}
+}
+
+func (s *fileStore) View(fn func(tx Tx) error) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	return fn(&tx{s: s})
+}
+
+func (s *fileStore) Update(fn func(tx Tx) error) error {
+	s.Lock()
+	defer s.Unlock()
+
+	t := &tx{s: s, writable: true, seq: s.seq, buckets: map[string]map[string]entry{}}
+	if err := fn(t); err != nil {
+		return err
+	}
+
+	if len(t.records) == 0 {
+		return nil
+	}
+
+	if s.log != nil {
+		if err := s.write(s.log, t.records); err != nil {
+			return err
+		}
+		s.records += len(t.records)
+	}
+
+	s.seq = t.seq
+	for name, b := range t.buckets {
+		if len(b) == 0 {
+			delete(s.buckets, name)
+		} else {
+			s.buckets[name] = b
+		}
+	}
+
+	if s.log != nil && s.records > compactMinRecords && s.records > compactRatio*s.size() {
+		if err := s.compact(); err != nil {
+			return fmt.Errorf("failed compacting %s: %w", s.path, err)
+		}
+	}
+
+	return nil
+}
+
+func (s *fileStore) write(f *os.File, records []record) error {
+	data, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		// Don't leave a partial transaction before the next ones
+		_ = f.Truncate(offset)
+		_, _ = f.Seek(offset, io.SeekStart)
+		return err
+	}
+
+	return f.Sync()
+}
+
+func (s *fileStore) size() int {
+	n := 0
+	for _, b := range s.buckets {
+		n += len(b)
+	}
+	return n
+}
+
+// compact rewrites the log with a record for each live key
+func (s *fileStore) compact() error {
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	records := 0
+	for name, b := range s.buckets {
+		for key, e := range b {
+			rec := record{Bucket: name, Key: key, Seq: e.seq, Value: e.value}
+			data, err := json.Marshal([]record{rec})
+			if err != nil {
+				f.Close()
+				return err
+			}
+			if _, err := f.Write(append(data, '\n')); err != nil {
+				f.Close()
+				return err
+			}
+			records++
+		}
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	f, err = os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+
+	s.log.Close()
+	s.log = f
+	s.records = records
+
+	return nil
+}
+
+func (s *fileStore) Close() error {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.log == nil {
+		return nil
+	}
+
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
+
+type tx struct {
+	s        *fileStore
+	writable bool
+	seq      uint64
+	records  []record
+	// The buckets changed by the transaction
+	buckets map[string]map[string]entry
+}
+
+func (t *tx) bucket(name string) map[string]entry {
+	if b, exists := t.buckets[name]; exists {
+		return b
+	}
+	return t.s.buckets[name]
+}
+
+// writableBucket copies the bucket on the first change
+func (t *tx) writableBucket(name string) (map[string]entry, error) {
+	if !t.writable {
+		return nil, errors.New("read-only transaction")
+	}
+
+	if b, exists := t.buckets[name]; exists {
+		return b, nil
+	}
+
+	b := maps.Clone(t.s.buckets[name])
+	if b == nil {
+		b = map[string]entry{}
+	}
+	t.buckets[name] = b
+
+	return b, nil
+}
+
+func (t *tx) Get(bucket, key string) (json.RawMessage, error) {
+	e, exists := t.bucket(bucket)[key]
+	if !exists {
+		return nil, ErrNotFound
+	}
+	return e.value, nil
+}
+
+func (t *tx) Put(bucket, key string, value json.RawMessage) error {
+	if key == "" {
+		return errors.New("empty key")
+	}
+
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	e, exists := b[key]
+	if !exists {
+		t.seq++
+		e.seq = t.seq
+	}
+	e.value = slices.Clone(value)
+	b[key] = e
+
+	t.records = append(t.records, record{Bucket: bucket, Key: key, Seq: e.seq, Value: e.value})
+
+	return nil
+}
+
+func (t *tx) Delete(bucket, key string) error {
+	b, err := t.writableBucket(bucket)
+	if err != nil {
+		return err
+	}
+
+	if _, exists := b[key]; !exists {
+		return ErrNotFound
+	}
+	delete(b, key)
+
+	t.records = append(t.records, record{Bucket: bucket, Key: key, Delete: true})
+
+	return nil
+}
+
+func (t *tx) DeleteBucket(bucket string) error {
+	if !t.writable {
+		return errors.New("read-only transaction")
+	}
+
+	t.buckets[bucket] = map[string]entry{}
+	t.records = append(t.records, record{Bucket: bucket, Delete: true})
+
+	return nil
+}
+
+func (t *tx) Keys(bucket string) []string {
+	b := t.bucket(bucket)
+
+	keys := make([]string, 0, len(b))
+	for k := range b {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, c string) int {
+		return cmp.Compare(b[a].seq, b[c].seq)
+	})
+
+	return keys
+}
@@ -0,0 +1,128 @@
+// Package kvstore is a small transactional key-value store for the metadata of the API objects
+// (assistants, files, threads, ...). Values are JSON documents grouped in buckets, which keep
+// the insertion order of their keys so that they can be paginated with stable cursors.
+package kvstore
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// Tx is a transaction, the changes made in Update are applied (and persisted) together when it returns without error
+type Tx interface {
+	// Get returns the value of the key, or ErrNotFound
+	Get(bucket, key string) (json.RawMessage, error)
+	// Put sets the value of the key, the key keeps its position if it exists already
+	Put(bucket, key string, value json.RawMessage) error
+	// Delete removes the key, or returns ErrNotFound
+	Delete(bucket, key string) error
+	// DeleteBucket removes all the keys of the bucket
+	DeleteBucket(bucket string) error
+	// Keys returns the keys of the bucket in insertion order
+	Keys(bucket string) []string
+}
+
+type Store interface {
+	// View runs fn in a read-only transaction
+	View(fn func(tx Tx) error) error
+	// Update runs fn in a read-write transaction, which is discarded if fn returns an error
+	Update(fn func(tx Tx) error) error
+	Close() error
+}
+
+// NewID returns a unique ID with the given prefix, e.g. "asst_"
+func NewID(prefix string) string {
+	return prefix + strings.ReplaceAll(uuid.New().String(), "-", "")
+}
+
+// Get decodes the value of the key in v
+func Get[T any](tx Tx, bucket, key string) (T, error) {
+	var v T
+	data, err := tx.Get(bucket, key)
+	if err != nil {
+		return v, err
+	}
+
+	err = json.Unmarshal(data, &v)
+	return v, err
+}
+
+// Put encodes v as the value of the key
+func Put(tx Tx, bucket, key string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	return tx.Put(bucket, key, data)
+}
+
+type ListOptions struct {
+	// Maximum number of items, 0 means no limit
+	Limit int
+	// Only return the items after (or before) the given key, in the order of the list
+	After, Before string
+	// Return the newest items first
+	Descending bool
+}
+
+// List decodes the values of the bucket, in insertion order unless Descending is set.
+// hasMore is true when there are more items past the page returned, which are before
+// the first one when paging with only Before set, and after the last one otherwise.
+func List[T any](tx Tx, bucket string, opts ListOptions) (items []T, hasMore bool, err error) {
+	return ListFunc[T](tx, bucket, opts, nil)
+}
+
+// ListFunc is like List, but only returns the values for which keep returns true
+func ListFunc[T any](tx Tx, bucket string, opts ListOptions, keep func(T) bool) (items []T, hasMore bool, err error) {
+	keys := tx.Keys(bucket)
+	if opts.Descending {
+		slices.Reverse(keys)
+	}
+
+	// A cursor which is not in the bucket (anymore) ends the pagination
+	if opts.After != "" {
+		if i := slices.Index(keys, opts.After); i >= 0 {
+			keys = keys[i+1:]
+		} else {
+			keys = nil
+		}
+	}
+	if opts.Before != "" {
+		i := slices.Index(keys, opts.Before)
+		if i < 0 {
+			i = 0
+		}
+		keys = keys[:i]
+	}
+
+	// Paging backwards returns the items right before the cursor
+	backwards := opts.Before != "" && opts.After == ""
+
+	items = []T{}
+	for _, k := range keys {
+		v, err := Get[T](tx, bucket, k)
+		if err != nil {
+			return nil, false, err
+		}
+		if keep != nil && !keep(v) {
+			continue
+		}
+		if !backwards && opts.Limit > 0 && len(items) == opts.Limit {
+			return items, true, nil
+		}
+		items = append(items, v)
+	}
+
+	if backwards && opts.Limit > 0 && len(items) > opts.Limit {
+		return items[len(items)-opts.Limit:], true, nil
+	}
+
+	return items, false, nil
+}
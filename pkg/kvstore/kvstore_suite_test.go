@@ -0,0 +1,13 @@
+package kvstore_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestKVStore(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "LocalAI kvstore test")
+}
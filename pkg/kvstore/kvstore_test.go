@@ -0,0 +1,227 @@
+package kvstore_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/LocalAI/pkg/kvstore"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type item struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func put(s Store, bucket string, items ...item) {
+	Expect(s.Update(func(tx Tx) error {
+		for _, i := range items {
+			if err := Put(tx, bucket, i.ID, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	})).To(Succeed())
+}
+
+func list(s Store, bucket string, opts ListOptions) ([]string, bool) {
+	var items []item
+	var hasMore bool
+	Expect(s.View(func(tx Tx) error {
+		var err error
+		items, hasMore, err = List[item](tx, bucket, opts)
+		return err
+	})).To(Succeed())
+
+	ids := []string{}
+	for _, i := range items {
+		ids = append(ids, i.ID)
+	}
+	return ids, hasMore
+}
+
+var _ = Describe("kvstore", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "metadata.db")
+	})
+
+	It("gets, puts and deletes keys", func() {
+		s := NewMemoryStore()
+		put(s, "items", item{ID: "a", Name: "first"})
+
+		Expect(s.View(func(tx Tx) error {
+			i, err := Get[item](tx, "items", "a")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(i.Name).To(Equal("first"))
+
+			_, err = Get[item](tx, "items", "b")
+			Expect(err).To(MatchError(ErrNotFound))
+			_, err = Get[item](tx, "other", "a")
+			Expect(err).To(MatchError(ErrNotFound))
+			return nil
+		})).To(Succeed())
+
+		Expect(s.Update(func(tx Tx) error { return tx.Delete("items", "a") })).To(Succeed())
+		Expect(s.Update(func(tx Tx) error { return tx.Delete("items", "a") })).To(MatchError(ErrNotFound))
+	})
+
+	It("discards a transaction that fails", func() {
+		s := NewMemoryStore()
+		put(s, "items", item{ID: "a"})
+
+		err := s.Update(func(tx Tx) error {
+			Expect(Put(tx, "items", "b", item{ID: "b"})).To(Succeed())
+			Expect(tx.Delete("items", "a")).To(Succeed())
+			Expect(tx.Keys("items")).To(Equal([]string{"b"}))
+			return errors.New("rollback")
+		})
+		Expect(err).To(MatchError("rollback"))
+
+		ids, _ := list(s, "items", ListOptions{})
+		Expect(ids).To(Equal([]string{"a"}))
+	})
+
+	It("rejects writes in read-only transactions", func() {
+		s := NewMemoryStore()
+		Expect(s.View(func(tx Tx) error { return Put(tx, "items", "a", item{}) })).ToNot(Succeed())
+	})
+
+	It("keeps the insertion order and paginates", func() {
+		s := NewMemoryStore()
+		put(s, "items", item{ID: "c"}, item{ID: "a"}, item{ID: "d"}, item{ID: "b"})
+		// Updating a key doesn't move it
+		put(s, "items", item{ID: "a", Name: "updated"})
+
+		ids, hasMore := list(s, "items", ListOptions{})
+		Expect(ids).To(Equal([]string{"c", "a", "d", "b"}))
+		Expect(hasMore).To(BeFalse())
+
+		ids, hasMore = list(s, "items", ListOptions{Limit: 2, Descending: true})
+		Expect(ids).To(Equal([]string{"b", "d"}))
+		Expect(hasMore).To(BeTrue())
+
+		ids, hasMore = list(s, "items", ListOptions{Limit: 2, Descending: true, After: "d"})
+		Expect(ids).To(Equal([]string{"a", "c"}))
+		Expect(hasMore).To(BeFalse())
+
+		ids, _ = list(s, "items", ListOptions{Before: "d"})
+		Expect(ids).To(Equal([]string{"c", "a"}))
+
+		// Paging backwards returns the page right before the cursor
+		ids, hasMore = list(s, "items", ListOptions{Limit: 1, Before: "d"})
+		Expect(ids).To(Equal([]string{"a"}))
+		Expect(hasMore).To(BeTrue())
+
+		ids, hasMore = list(s, "items", ListOptions{After: "missing"})
+		Expect(ids).To(BeEmpty())
+		Expect(hasMore).To(BeFalse())
+	})
+
+	It("filters the listed values", func() {
+		s := NewMemoryStore()
+		put(s, "items", item{ID: "a", Name: "keep"}, item{ID: "b"}, item{ID: "c", Name: "keep"}, item{ID: "d", Name: "keep"})
+
+		Expect(s.View(func(tx Tx) error {
+			items, hasMore, err := ListFunc(tx, "items", ListOptions{Limit: 2}, func(i item) bool { return i.Name == "keep" })
+			Expect(err).ToNot(HaveOccurred())
+			Expect(items).To(Equal([]item{{ID: "a", Name: "keep"}, {ID: "c", Name: "keep"}}))
+			Expect(hasMore).To(BeTrue())
+			return nil
+		})).To(Succeed())
+	})
+
+	It("deletes buckets", func() {
+		s := NewMemoryStore()
+		put(s, "items", item{ID: "a"}, item{ID: "b"})
+		put(s, "others", item{ID: "a"})
+
+		Expect(s.Update(func(tx Tx) error { return tx.DeleteBucket("items") })).To(Succeed())
+
+		ids, _ := list(s, "items", ListOptions{})
+		Expect(ids).To(BeEmpty())
+		ids, _ = list(s, "others", ListOptions{})
+		Expect(ids).To(Equal([]string{"a"}))
+	})
+
+	It("persists the transactions", func() {
+		s, err := Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		put(s, "items", item{ID: "a", Name: "first"}, item{ID: "b"})
+		put(s, "items", item{ID: "a", Name: "updated"})
+		Expect(s.Update(func(tx Tx) error { return tx.Delete("items", "b") })).To(Succeed())
+		put(s, "items", item{ID: "c"})
+		Expect(s.Close()).To(Succeed())
+
+		s, err = Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Close()
+
+		ids, _ := list(s, "items", ListOptions{})
+		Expect(ids).To(Equal([]string{"a", "c"}))
+
+		// New keys are still added at the end
+		put(s, "items", item{ID: "0"})
+		ids, _ = list(s, "items", ListOptions{})
+		Expect(ids).To(Equal([]string{"a", "c", "0"}))
+	})
+
+	It("drops a transaction that was partially written", func() {
+		s, err := Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		put(s, "items", item{ID: "a"})
+		Expect(s.Close()).To(Succeed())
+
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = f.WriteString(`[{"bucket":"items","key":"b","se`)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(f.Close()).To(Succeed())
+
+		s, err = Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		put(s, "items", item{ID: "c"})
+		Expect(s.Close()).To(Succeed())
+
+		s, err = Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Close()
+
+		ids, _ := list(s, "items", ListOptions{})
+		Expect(ids).To(Equal([]string{"a", "c"}))
+	})
+
+	It("compacts the log", func() {
+		s, err := Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 2000; i++ {
+			put(s, "items", item{ID: "a", Name: fmt.Sprint(i)}, item{ID: "b"})
+		}
+		Expect(s.Close()).To(Succeed())
+
+		data, err := os.ReadFile(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(data)).To(BeNumerically("<", 100000))
+
+		s, err = Open(path)
+		Expect(err).ToNot(HaveOccurred())
+		defer s.Close()
+
+		Expect(s.View(func(tx Tx) error {
+			i, err := Get[item](tx, "items", "a")
+			Expect(i.Name).To(Equal("1999"))
+			return err
+		})).To(Succeed())
+		ids, _ := list(s, "items", ListOptions{})
+		Expect(ids).To(Equal([]string{"a", "b"}))
+	})
+
+	It("generates unique IDs", func() {
+		Expect(NewID("asst_")).To(HavePrefix("asst_"))
+		Expect(NewID("asst_")).ToNot(Equal(NewID("asst_")))
+	})
+})
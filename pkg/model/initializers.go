@@ -17,10 +17,16 @@ import (
 	"github.com/mudler/LocalAI/pkg/xsysinfo"
 	"github.com/phayes/freeport"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/elliotchance/orderedmap/v2"
 )
 
+var tracer = otel.Tracer("github.com/mudler/LocalAI/pkg/model")
+
 var Aliases map[string]string = map[string]string{
 	"go-llama":              LLamaCPP,
 	"llama":                 LLamaCPP,
@@ -54,6 +60,16 @@ const (
 	LocalStoreBackend = "local-store"
 )
 
+// SupportsLogprobs returns whether the backend can return the log probabilities of the tokens it generates: the
+// llama.cpp backends only
+func SupportsLogprobs(backend string) bool {
+	backend = strings.ToLower(backend)
+	if realBackend, exists := Aliases[backend]; exists {
+		backend = realBackend
+	}
+	return strings.HasPrefix(backend, LLamaCPP)
+}
+
 func backendPath(assetDir, backend string) string {
 	return filepath.Join(assetDir, "backend-assets", "grpc", backend)
 }
@@ -393,6 +409,8 @@ func (ml *ModelLoader) grpcModel(backend string, autodetect bool, o *Options) fu
 			client = NewModel(modelID, serverAddress, process)
 		}
 
+		client.backend = backend
+
 		log.Debug().Msgf("Wait for the service to start up")
 
 		// Wait for the service to start up
@@ -464,6 +482,21 @@ func (ml *ModelLoader) backendLoader(opts ...Option) (client grpc.Backend, err e
 
 	ml.stopActiveBackends(o.modelID, o.singleActiveBackend)
 
+	// The load is traced as a child of the span of the request loading the model, if any
+	ctx := o.context
+	if o.traceContext != nil {
+		ctx = trace.ContextWithSpan(ctx, trace.SpanFromContext(o.traceContext))
+	}
+	ctx, span := tracer.Start(ctx, "model.load", trace.WithAttributes(attribute.String("model", o.modelID), attribute.String("backend", backend)))
+	o.context = ctx
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
 	var backendToConsume string
 
 	switch backend {
@@ -481,6 +514,7 @@ func (ml *ModelLoader) backendLoader(opts ...Option) (client grpc.Backend, err e
 			return nil, err
 		}
 	}
+	model.SetMemoryEstimate(o.memory)
 
 	return model.GRPC(o.parallelRequests, ml.wd), nil
 }
@@ -509,6 +543,10 @@ func (ml *ModelLoader) Load(opts ...Option) (grpc.Backend, error) {
 
 	ml.stopActiveBackends(o.modelID, o.singleActiveBackend)
 
+	if err := ml.FreeMemory(o.modelID, o.memory); err != nil {
+		log.Warn().Err(err).Msgf("Loading model '%s' over the memory budget", o.modelID)
+	}
+
 	if o.backendString != "" {
 		return ml.backendLoader(opts...)
 	}
@@ -7,11 +7,13 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/mudler/LocalAI/pkg/utils"
 
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/metric"
 )
 
 // new idea: what if we declare a struct of these here, and use a loop to check?
@@ -22,6 +24,9 @@ type ModelLoader struct {
 	mu        sync.Mutex
 	models    map[string]*Model
 	wd        *WatchDog
+	budget    MemoryEstimate
+	loaded    atomic.Value        // The loaded models observed in the metrics
+	metrics   metric.Registration // The callback observing the loaded models
 }
 
 func NewModelLoader(modelPath string) *ModelLoader {
@@ -29,6 +34,7 @@ func NewModelLoader(modelPath string) *ModelLoader {
 		ModelPath: modelPath,
 		models:    make(map[string]*Model),
 	}
+	nml.registerMetrics()
 
 	return nml
 }
@@ -123,6 +129,7 @@ func (ml *ModelLoader) LoadModel(modelID, modelName string, loader func(string,
 
 	ml.mu.Lock()
 	defer ml.mu.Unlock()
+	start := time.Now()
 	model, err := loader(modelID, modelName, modelFile)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load model with internal loader: %s", err)
@@ -131,8 +138,11 @@ func (ml *ModelLoader) LoadModel(modelID, modelName string, loader func(string,
 	if model == nil {
 		return nil, fmt.Errorf("loader didn't return a model")
 	}
+	loadDuration.Record(context.Background(), time.Since(start).Seconds(), metric.WithAttributeSet(modelAttributes(modelID, model.backend)))
 
+	model.lastUsed = time.Now()
 	ml.models[modelID] = model
+	ml.updateLoadedModels()
 
 	return model, nil
 }
@@ -173,6 +183,7 @@ func (ml *ModelLoader) CheckIsLoaded(s string) *Model {
 	}
 
 	log.Debug().Msgf("Model already loaded in memory: %s", s)
+	m.lastUsed = time.Now()
 	client := m.GRPC(false, ml.wd)
 
 	log.Debug().Msgf("Checking model availability (%s)", s)
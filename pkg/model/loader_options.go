@@ -12,6 +12,7 @@ type Options struct {
 	modelID       string
 	assetDir      string
 	context       context.Context
+	traceContext  context.Context
 
 	gRPCOptions *pb.ModelOptions
 
@@ -21,6 +22,7 @@ type Options struct {
 	grpcAttemptsDelay   int
 	singleActiveBackend bool
 	parallelRequests    bool
+	memory              MemoryEstimate
 }
 
 type Option func(*Options)
@@ -80,12 +82,26 @@ func WithContext(ctx context.Context) Option {
 	}
 }
 
+// WithTraceContext sets the context of the request loading the model, whose span is the parent of the span of the
+// load and of the gRPC calls loading the model
+func WithTraceContext(ctx context.Context) Option {
+	return func(o *Options) {
+		o.traceContext = ctx
+	}
+}
+
 func WithSingleActiveBackend() Option {
 	return func(o *Options) {
 		o.singleActiveBackend = true
 	}
 }
 
+func WithMemoryEstimate(e MemoryEstimate) Option {
+	return func(o *Options) {
+		o.memory = e
+	}
+}
+
 func WithModelID(id string) Option {
 	return func(o *Options) {
 		o.modelID = id
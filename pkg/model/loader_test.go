@@ -1,6 +1,7 @@
 package model_test
 
 import (
+	"context"
 	"errors"
 	"os"
 	"path/filepath"
@@ -8,6 +9,9 @@ import (
 	"github.com/mudler/LocalAI/pkg/model"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 )
 
 var _ = Describe("ModelLoader", func() {
@@ -86,6 +90,43 @@ var _ = Describe("ModelLoader", func() {
 		})
 	})
 
+	Context("Metrics", func() {
+		It("records the load duration and observes the loaded models", func() {
+			reader := sdkmetric.NewManualReader()
+			otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+			_, err := modelLoader.LoadModel("metrics", "test.model", func(modelID, modelName, modelFile string) (*model.Model, error) {
+				return model.NewModel(modelID, "test.model", nil), nil
+			})
+			Expect(err).To(BeNil())
+
+			collected := metricdata.ResourceMetrics{}
+			Expect(reader.Collect(context.Background(), &collected)).To(Succeed())
+			observed := map[string]bool{}
+			for _, scope := range collected.ScopeMetrics {
+				for _, m := range scope.Metrics {
+					switch data := m.Data.(type) {
+					case metricdata.Histogram[float64]:
+						for _, p := range data.DataPoints {
+							if v, _ := p.Attributes.Value("model"); v.AsString() == "metrics" {
+								observed[m.Name] = true
+							}
+						}
+					case metricdata.Gauge[int64]:
+						for _, p := range data.DataPoints {
+							if v, _ := p.Attributes.Value("model"); v.AsString() == "metrics" {
+								observed[m.Name] = true
+							}
+						}
+					}
+				}
+			}
+			Expect(observed).To(HaveKey("model_load_duration"))
+			Expect(observed).To(HaveKey("loaded_models"))
+			Expect(observed).To(HaveKey("busy_backends"))
+		})
+	})
+
 	Context("ShutdownModel", func() {
 		It("should shutdown a loaded model", func() {
 			mockLoader := func(modelID, modelName, modelFile string) (*model.Model, error) {
@@ -100,4 +141,59 @@ var _ = Describe("ModelLoader", func() {
 			Expect(modelLoader.CheckIsLoaded("foo")).To(BeNil())
 		})
 	})
+
+	Context("FreeMemory", func() {
+		const gb = 1 << 30
+
+		load := func(id string, memory model.MemoryEstimate) {
+			_, err := modelLoader.LoadModel(id, "test.model", func(modelID, modelName, modelFile string) (*model.Model, error) {
+				m := model.NewModel(modelID, "test.model", nil)
+				m.SetMemoryEstimate(memory)
+				return m, nil
+			})
+			Expect(err).To(BeNil())
+		}
+
+		loaded := func() []string {
+			ids := []string{}
+			for _, m := range modelLoader.ListModels() {
+				ids = append(ids, m.ID)
+			}
+			return ids
+		}
+
+		BeforeEach(func() {
+			modelLoader.SetMemoryBudget(model.MemoryEstimate{RAM: 10 * gb})
+			load("a", model.MemoryEstimate{RAM: 4 * gb})
+			load("b", model.MemoryEstimate{RAM: 2 * gb, VRAM: 2 * gb})
+		})
+
+		It("keeps the models which fit in the budget", func() {
+			Expect(modelLoader.FreeMemory("c", model.MemoryEstimate{RAM: 2 * gb})).To(Succeed())
+			Expect(loaded()).To(ConsistOf("a", "b"))
+		})
+
+		It("shuts down the least recently used models", func() {
+			// Without a VRAM budget, the VRAM of b is counted in the RAM budget
+			Expect(modelLoader.FreeMemory("c", model.MemoryEstimate{RAM: 4 * gb})).To(Succeed())
+			Expect(loaded()).To(ConsistOf("b"))
+		})
+
+		It("tracks the usage of the loaded models", func() {
+			Expect(modelLoader.CheckIsLoaded("a")).ToNot(BeNil())
+			Expect(modelLoader.FreeMemory("c", model.MemoryEstimate{RAM: 4 * gb})).To(Succeed())
+			Expect(loaded()).To(ConsistOf("a"))
+		})
+
+		It("returns an error when the model doesn't fit", func() {
+			Expect(modelLoader.FreeMemory("c", model.MemoryEstimate{RAM: 12 * gb})).ToNot(Succeed())
+			Expect(loaded()).To(BeEmpty())
+		})
+
+		It("doesn't shut down the models without a budget", func() {
+			modelLoader.SetMemoryBudget(model.MemoryEstimate{})
+			Expect(modelLoader.FreeMemory("c", model.MemoryEstimate{RAM: 12 * gb})).To(Succeed())
+			Expect(loaded()).To(ConsistOf("a", "b"))
+		})
+	})
 })
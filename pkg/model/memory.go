@@ -0,0 +1,131 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	process "github.com/mudler/go-processmanager"
+	"github.com/rs/zerolog/log"
+	gopsutil "github.com/shirou/gopsutil/v3/process"
+)
+
+// MemoryEstimate is the memory used by a model once loaded, in bytes
+type MemoryEstimate struct {
+	RAM  uint64
+	VRAM uint64
+}
+
+func (e MemoryEstimate) String() string {
+	return fmt.Sprintf("%d MiB of RAM and %d MiB of VRAM", e.RAM>>20, e.VRAM>>20)
+}
+
+// SetMemoryBudget limits the memory used by the loaded models: before loading a model which would exceed the
+// budget, the least recently used idle models are shut down. A zero RAM or VRAM budget is not limited.
+func (ml *ModelLoader) SetMemoryBudget(budget MemoryEstimate) {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+	ml.budget = budget
+}
+
+// counted returns the memory of e counted in the budget: without a VRAM budget, the models are counted in the RAM
+// budget, as they may be loaded in RAM only
+func (ml *ModelLoader) counted(e MemoryEstimate) MemoryEstimate {
+	if ml.budget.VRAM == 0 {
+		return MemoryEstimate{RAM: e.RAM + e.VRAM}
+	}
+	return e
+}
+
+// memoryUsage returns the memory used by a loaded model, its estimate or the RSS of its process if larger. It queries
+// the process, so it is called without holding ml.mu.
+func memoryUsage(estimate MemoryEstimate, p *process.Process) MemoryEstimate {
+	if rss := processRSS(p); rss > estimate.RAM {
+		estimate.RAM = rss
+	}
+	return estimate
+}
+
+func processRSS(p *process.Process) uint64 {
+	if p == nil {
+		return 0
+	}
+	pid, err := strconv.Atoi(p.PID)
+	if err != nil {
+		return 0
+	}
+	// This doesn't create a new process, it looks up the existing one by PID
+	backendProcess, err := gopsutil.NewProcess(int32(pid))
+	if err != nil {
+		return 0
+	}
+	memInfo, err := backendProcess.MemoryInfo()
+	if err != nil {
+		return 0
+	}
+	return memInfo.RSS
+}
+
+func withinBudget(used, budget uint64) bool {
+	return budget == 0 || used <= budget
+}
+
+// FreeMemory shuts down the least recently used idle models, other than modelID, until the loaded models and the
+// required memory fit in the memory budget. It returns an error if the busy models don't leave enough memory.
+func (ml *ModelLoader) FreeMemory(modelID string, required MemoryEstimate) error {
+	type loaded struct {
+		id       string
+		estimate MemoryEstimate
+		process  *process.Process
+		idle     bool
+		lastUsed time.Time
+	}
+
+	for {
+		ml.mu.Lock()
+		if ml.budget == (MemoryEstimate{}) {
+			ml.mu.Unlock()
+			return nil
+		}
+
+		budget := ml.budget
+		used := ml.counted(required)
+		models := make([]loaded, 0, len(ml.models))
+		for id, m := range ml.models {
+			if id == modelID {
+				continue
+			}
+			models = append(models, loaded{
+				id:       id,
+				estimate: ml.counted(m.MemoryEstimate()),
+				process:  m.Process(),
+				idle:     !m.GRPC(false, ml.wd).IsBusy(),
+				lastUsed: m.lastUsed,
+			})
+		}
+		ml.mu.Unlock()
+
+		lru := -1
+		for i, m := range models {
+			usage := memoryUsage(m.estimate, m.process)
+			used.RAM += usage.RAM
+			used.VRAM += usage.VRAM
+			if m.idle && (lru == -1 || m.lastUsed.Before(models[lru].lastUsed)) {
+				lru = i
+			}
+		}
+
+		if withinBudget(used.RAM, budget.RAM) && withinBudget(used.VRAM, budget.VRAM) {
+			return nil
+		}
+		if lru == -1 {
+			return fmt.Errorf("the loaded models and %s would use %s, over the budget of %s, and no model is idle", modelID, used, budget)
+		}
+
+		log.Info().Msgf("Shutting down the least recently used model '%s' to load '%s' in the memory budget", models[lru].id, modelID)
+		if err := ml.ShutdownModel(models[lru].id); err != nil {
+			// The model is not loaded anymore in any case
+			log.Error().Err(err).Str("model", models[lru].id).Msg("error while shutting down the model")
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc"
+)
+
+// The metrics are recorded with the global meter provider, which exports them on /metrics once the metrics service
+// of the API is started, and discards them otherwise
+var meter = otel.Meter("github.com/mudler/LocalAI/pkg/model")
+
+var (
+	loadDuration = instrument(meter.Float64Histogram("model_load_duration",
+		metric.WithDescription("Time to start the backend of a model and to load the model"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300, 600)))
+	grpcDuration = instrument(meter.Float64Histogram("backend_grpc_duration",
+		metric.WithDescription("Latency of the gRPC calls to the backends, until the end of the stream for the streamed calls"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300)))
+	loadedModels = instrument(meter.Int64ObservableGauge("loaded_models",
+		metric.WithDescription("Models loaded in a backend, 1 for each loaded model")))
+	busyBackends = instrument(meter.Int64ObservableGauge("busy_backends",
+		metric.WithDescription("Backends processing a request, 1 for each busy backend")))
+	backendRSS = instrument(meter.Int64ObservableGauge("backend_memory_rss",
+		metric.WithDescription("Resident memory of the processes of the backends"),
+		metric.WithUnit("By")))
+)
+
+func instrument[T any](i T, err error) T {
+	if err != nil {
+		log.Error().Err(err).Msg("unable to create the metric")
+	}
+	return i
+}
+
+func modelAttributes(modelID, backend string) attribute.Set {
+	return attribute.NewSet(attribute.String("model", modelID), attribute.String("backend", backend))
+}
+
+// registerMetrics observes the models loaded by ml in the gauges, until unregisterMetrics is called
+func (ml *ModelLoader) registerMetrics() {
+	registration, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		for _, m := range ml.loadedModels() {
+			attributes := metric.WithAttributeSet(modelAttributes(m.ID, m.backend))
+			o.ObserveInt64(loadedModels, 1, attributes)
+
+			busy := int64(0)
+			if ml.wd != nil && m.address != "" {
+				if ml.wd.IsBusy(m.address) {
+					busy = 1
+				}
+			} else if m.GRPC(false, ml.wd).IsBusy() {
+				busy = 1
+			}
+			o.ObserveInt64(busyBackends, busy, attributes)
+
+			if rss := processRSS(m.Process()); rss > 0 {
+				o.ObserveInt64(backendRSS, int64(rss), attributes)
+			}
+		}
+		return nil
+	}, loadedModels, busyBackends, backendRSS)
+	if err != nil {
+		log.Error().Err(err).Msg("unable to register the metrics of the models")
+		return
+	}
+	ml.metrics = registration
+}
+
+// unregisterMetrics stops observing the models loaded by ml
+func (ml *ModelLoader) unregisterMetrics() {
+	ml.mu.Lock()
+	registration := ml.metrics
+	ml.metrics = nil
+	ml.mu.Unlock()
+
+	if registration == nil {
+		return
+	}
+	if err := registration.Unregister(); err != nil {
+		log.Error().Err(err).Msg("unable to unregister the metrics of the models")
+	}
+}
+
+// loadedModels returns the loaded models, without waiting for the models being loaded or health checked
+func (ml *ModelLoader) loadedModels() []*Model {
+	models, _ := ml.loaded.Load().([]*Model)
+	return models
+}
+
+// Backend returns the backend running the loaded model modelID, without waiting for the models being loaded. It
+// returns an empty string if the model is not loaded.
+func (ml *ModelLoader) Backend(modelID string) string {
+	for _, m := range ml.loadedModels() {
+		if m.ID == modelID {
+			return m.backend
+		}
+	}
+	return ""
+}
+
+// updateLoadedModels updates the loaded models observed in the metrics, it must be called with ml.mu held after
+// ml.models changed
+func (ml *ModelLoader) updateLoadedModels() {
+	models := make([]*Model, 0, len(ml.models))
+	for _, m := range ml.models {
+		models = append(models, m)
+	}
+	ml.loaded.Store(models)
+}
+
+// grpcMetrics returns the gRPC dial options recording the latency of the calls to the backend of the model, by RPC
+func grpcMetrics(modelID, backend string) []grpc.DialOption {
+	record := func(method string, start time.Time) {
+		rpc := method[strings.LastIndex(method, "/")+1:]
+		grpcDuration.Record(context.Background(), time.Since(start).Seconds(),
+			metric.WithAttributes(attribute.String("model", modelID), attribute.String("backend", backend), attribute.String("rpc", rpc)))
+	}
+
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			defer record(method, time.Now())
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			start := time.Now()
+			stream, err := streamer(ctx, desc, cc, method, opts...)
+			if err != nil {
+				record(method, start)
+				return nil, err
+			}
+			return &recordedStream{ClientStream: stream, done: func() { record(method, start) }}, nil
+		}),
+	}
+}
+
+// recordedStream calls done when the stream ends
+type recordedStream struct {
+	grpc.ClientStream
+	done func()
+}
+
+func (s *recordedStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil && s.done != nil {
+		s.done()
+		s.done = nil
+	}
+	return err
+}
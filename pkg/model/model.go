@@ -2,6 +2,7 @@ package model
 
 import (
 	"sync"
+	"time"
 
 	grpc "github.com/mudler/LocalAI/pkg/grpc"
 	process "github.com/mudler/go-processmanager"
@@ -10,9 +11,13 @@ import (
 type Model struct {
 	ID      string `json:"id"`
 	address string
+	backend string
 	client  grpc.Backend
 	process *process.Process
 	sync.Mutex
+
+	memory   MemoryEstimate
+	lastUsed time.Time
 }
 
 func NewModel(ID, address string, process *process.Process) *Model {
@@ -23,6 +28,11 @@ func NewModel(ID, address string, process *process.Process) *Model {
 	}
 }
 
+// Backend returns the backend running the model, empty if the model was not loaded by the ModelLoader
+func (m *Model) Backend() string {
+	return m.backend
+}
+
 func (m *Model) Process() *process.Process {
 	return m.process
 }
@@ -39,6 +49,19 @@ func (m *Model) GRPC(parallel bool, wd *WatchDog) grpc.Backend {
 
 	m.Lock()
 	defer m.Unlock()
-	m.client = grpc.NewClient(m.address, parallel, wd, enableWD)
+	m.client = grpc.NewClient(m.address, parallel, wd, enableWD, grpcMetrics(m.ID, m.backend)...)
 	return m.client
 }
+
+// SetMemoryEstimate sets the memory the model is expected to use, for the memory budget of the ModelLoader
+func (m *Model) SetMemoryEstimate(e MemoryEstimate) {
+	m.Lock()
+	defer m.Unlock()
+	m.memory = e
+}
+
+func (m *Model) MemoryEstimate() MemoryEstimate {
+	m.Lock()
+	defer m.Unlock()
+	return m.memory
+}
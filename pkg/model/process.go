@@ -16,6 +16,7 @@ import (
 )
 
 func (ml *ModelLoader) deleteProcess(s string) error {
+	defer ml.updateLoadedModels()
 	defer delete(ml.models, s)
 
 	log.Debug().Msgf("Deleting process %s", s)
@@ -53,7 +54,9 @@ func (ml *ModelLoader) StopGRPC(filter GRPCProcessFilter) error {
 	return err
 }
 
+// StopAllGRPC shuts down the loader: it stops all the models, and stops observing them in the metrics
 func (ml *ModelLoader) StopAllGRPC() error {
+	ml.unregisterMetrics()
 	return ml.StopGRPC(all)
 }
 
@@ -79,6 +79,14 @@ func (wd *WatchDog) UnMark(ModelAddress string) {
 	wd.idleTime[ModelAddress] = time.Now()
 }
 
+// IsBusy returns true if the backend at address is processing a request
+func (wd *WatchDog) IsBusy(address string) bool {
+	wd.Lock()
+	defer wd.Unlock()
+	_, busy := wd.timetable[address]
+	return busy
+}
+
 func (wd *WatchDog) Run() {
 	log.Info().Msg("[WatchDog] starting watchdog")
 
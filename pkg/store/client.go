@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 
 	grpc "github.com/mudler/LocalAI/pkg/grpc"
@@ -13,6 +14,17 @@ import (
 // SetCols sets multiple key-value pairs in the store
 // It's in columnar format so that keys[i] is associated with values[i]
 func SetCols(ctx context.Context, c grpc.Backend, keys [][]float32, values [][]byte) error {
+	return SetColsWithMetadata(ctx, c, keys, values, nil)
+}
+
+// SetColsWithMetadata is like SetCols, but also attaches metadata[i] to keys[i]
+// The metadata can be nil, or have nil entries for keys that have none
+func SetColsWithMetadata(ctx context.Context, c grpc.Backend, keys [][]float32, values [][]byte, metadata []map[string]any) error {
+	protoMetadata, err := encodeMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
 	protoKeys := make([]*proto.StoresKey, len(keys))
 	for i, k := range keys {
 		protoKeys[i] = &proto.StoresKey{
@@ -26,8 +38,9 @@ func SetCols(ctx context.Context, c grpc.Backend, keys [][]float32, values [][]b
 		}
 	}
 	setOpts := &proto.StoresSetOptions{
-		Keys:   protoKeys,
-		Values: protoValues,
+		Keys:     protoKeys,
+		Values:   protoValues,
+		Metadata: protoMetadata,
 	}
 
 	res, err := c.StoresSet(ctx, setOpts)
@@ -84,6 +97,12 @@ func DeleteSingle(ctx context.Context, c grpc.Backend, key []float32) error {
 // Be warned the keys are sorted and will be returned in a different order than they were input
 // There is no guarantee as to how the keys are sorted
 func GetCols(ctx context.Context, c grpc.Backend, keys [][]float32) ([][]float32, [][]byte, error) {
+	ks, vs, _, err := GetColsWithMetadata(ctx, c, keys)
+	return ks, vs, err
+}
+
+// GetColsWithMetadata is like GetCols, but also returns the metadata of each key
+func GetColsWithMetadata(ctx context.Context, c grpc.Backend, keys [][]float32) ([][]float32, [][]byte, []map[string]any, error) {
 	protoKeys := make([]*proto.StoresKey, len(keys))
 	for i, k := range keys {
 		protoKeys[i] = &proto.StoresKey{
@@ -96,7 +115,7 @@ func GetCols(ctx context.Context, c grpc.Backend, keys [][]float32) ([][]float32
 
 	res, err := c.StoresGet(ctx, getOpts)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	ks := make([][]float32, len(res.Keys))
@@ -107,8 +126,12 @@ func GetCols(ctx context.Context, c grpc.Backend, keys [][]float32) ([][]float32
 	for i, v := range res.Values {
 		vs[i] = v.Bytes
 	}
+	ms, err := decodeMetadata(res.Metadata, len(res.Keys))
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
-	return ks, vs, nil
+	return ks, vs, ms, nil
 }
 
 // GetSingle gets a single key-value pair from the store
@@ -126,18 +149,48 @@ func GetSingle(ctx context.Context, c grpc.Backend, key []float32) ([]byte, erro
 	return nil, fmt.Errorf("failed to get key")
 }
 
+// FindOptions selects the index used by FindWithOptions, the zero value does an exact search
+type FindOptions struct {
+	// Index is either "exact" or "hnsw"
+	Index string
+	// HNSW parameters, the backend defaults are used when zero
+	M              int
+	EfConstruction int
+	Ef             int
+
+	// Filter on the metadata of the entries, see Filter
+	Filter map[string]any
+}
+
 // Find similar keys to the given key. Returns the keys, values, and similarities
 func Find(ctx context.Context, c grpc.Backend, key []float32, topk int) ([][]float32, [][]byte, []float32, error) {
+	ks, vs, _, sims, err := FindWithOptions(ctx, c, key, topk, FindOptions{})
+	return ks, vs, sims, err
+}
+
+// FindWithOptions is like Find, but allows to choose the index used for the search and to filter
+// the entries on their metadata. Returns the keys, values, metadata and similarities
+func FindWithOptions(ctx context.Context, c grpc.Backend, key []float32, topk int, opts FindOptions) ([][]float32, [][]byte, []map[string]any, []float32, error) {
+	filter, err := encodeFilter(opts.Filter)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
 	findOpts := &proto.StoresFindOptions{
 		Key: &proto.StoresKey{
 			Floats: key,
 		},
-		TopK: int32(topk),
+		TopK:           int32(topk),
+		Index:          opts.Index,
+		M:              int32(opts.M),
+		EfConstruction: int32(opts.EfConstruction),
+		Ef:             int32(opts.Ef),
+		Filter:         filter,
 	}
 
 	res, err := c.StoresFind(ctx, findOpts)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
 	}
 
 	ks := make([][]float32, len(res.Keys))
@@ -151,5 +204,126 @@ func Find(ctx context.Context, c grpc.Backend, key []float32, topk int) ([][]flo
 		vs[i] = v.Bytes
 	}
 
-	return ks, vs, res.Similarities, nil
+	ms, err := decodeMetadata(res.Metadata, len(res.Keys))
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	return ks, vs, ms, res.Similarities, nil
+}
+
+// List returns the entries matching the filter (all of them if nil), skipping the first offset ones and
+// returning at most limit (0 for no limit). Returns the keys, values, metadata and the total number of matches
+func List(ctx context.Context, c grpc.Backend, filter map[string]any, offset, limit int) ([][]float32, [][]byte, []map[string]any, int, error) {
+	f, err := encodeFilter(filter)
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	res, err := c.StoresList(ctx, &proto.StoresListOptions{
+		Filter: f,
+		Offset: int32(offset),
+		Limit:  int32(limit),
+	})
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	ks := make([][]float32, len(res.Keys))
+	for i, k := range res.Keys {
+		ks[i] = k.Floats
+	}
+	vs := make([][]byte, len(res.Values))
+	for i, v := range res.Values {
+		vs[i] = v.Bytes
+	}
+	ms, err := decodeMetadata(res.Metadata, len(res.Keys))
+	if err != nil {
+		return nil, nil, nil, 0, err
+	}
+
+	return ks, vs, ms, int(res.Total), nil
+}
+
+// Count returns the number of entries matching the filter (all of them if nil)
+func Count(ctx context.Context, c grpc.Backend, filter map[string]any) (int, error) {
+	f, err := encodeFilter(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := c.StoresCount(ctx, &proto.StoresCountOptions{
+		Filter: f,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return int(res.Count), nil
+}
+
+// Drop removes all the entries of the store
+func Drop(ctx context.Context, c grpc.Backend) error {
+	res, err := c.StoresDrop(ctx, &proto.StoresDropOptions{})
+	if err != nil {
+		return err
+	}
+
+	if res.Success {
+		return nil
+	}
+
+	return fmt.Errorf("failed to drop store: %v", res.Message)
+}
+
+func encodeFilter(filter map[string]any) (string, error) {
+	if len(filter) == 0 {
+		return "", nil
+	}
+
+	b, err := json.Marshal(filter)
+	if err != nil {
+		return "", fmt.Errorf("failed encoding filter: %w", err)
+	}
+
+	// Validate it here, so the caller gets a clear error before hitting the backend
+	if _, err := ParseFilter(string(b)); err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
+
+func encodeMetadata(metadata []map[string]any) ([]string, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+
+	res := make([]string, len(metadata))
+	for i, m := range metadata {
+		if m == nil {
+			continue
+		}
+		b, err := json.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed encoding metadata %d: %w", i, err)
+		}
+		res[i] = string(b)
+	}
+
+	return res, nil
+}
+
+func decodeMetadata(metadata []string, n int) ([]map[string]any, error) {
+	res := make([]map[string]any, n)
+	for i, m := range metadata {
+		if m == "" || i >= n {
+			continue
+		}
+		if err := json.Unmarshal([]byte(m), &res[i]); err != nil {
+			return nil, fmt.Errorf("failed decoding metadata %d: %w", i, err)
+		}
+	}
+
+	return res, nil
 }
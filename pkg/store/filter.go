@@ -0,0 +1,185 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// Filter is a condition on the metadata of the entries in a store.
+//
+// It is expressed as a JSON object where every field must match. A field either holds a value,
+// which must be equal to the metadata field, or an object of operators:
+//
+//	{"tenant": "acme", "doc_type": {"$in": ["pdf", "docx"]}, "year": {"$gte": 2020, "$lt": 2024}}
+//
+// The supported operators are $eq, $ne, $in, $nin, $gt, $gte, $lt and $lte.
+// Nested metadata fields can be referenced with a dotted path, e.g. "author.name".
+// When the metadata field is an array, equality and $in match if any of its elements match.
+type Filter struct {
+	conditions []condition
+}
+
+type condition struct {
+	path  []string
+	op    string
+	value any
+}
+
+var filterOperators = []string{"$eq", "$ne", "$in", "$nin", "$gt", "$gte", "$lt", "$lte"}
+
+// ParseFilter parses a filter from its JSON representation. An empty string returns a nil filter,
+// which matches everything.
+func ParseFilter(filter string) (*Filter, error) {
+	if filter == "" {
+		return nil, nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(filter), &fields); err != nil {
+		return nil, fmt.Errorf("filter must be a JSON object: %w", err)
+	}
+
+	return NewFilter(fields)
+}
+
+// NewFilter builds a filter from an already decoded JSON object
+func NewFilter(fields map[string]any) (*Filter, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	f := &Filter{}
+	for field, v := range fields {
+		path := strings.Split(field, ".")
+
+		ops, isOps := v.(map[string]any)
+		if !isOps || !hasOperators(ops) {
+			f.conditions = append(f.conditions, condition{path: path, op: "$eq", value: v})
+			continue
+		}
+
+		for op, value := range ops {
+			if !slices.Contains(filterOperators, op) {
+				return nil, fmt.Errorf("unknown operator %q on field %q", op, field)
+			}
+
+			switch op {
+			case "$in", "$nin":
+				if _, ok := value.([]any); !ok {
+					return nil, fmt.Errorf("operator %q on field %q expects an array", op, field)
+				}
+			case "$gt", "$gte", "$lt", "$lte":
+				if _, ok := value.(float64); !ok {
+					return nil, fmt.Errorf("operator %q on field %q expects a number", op, field)
+				}
+			}
+
+			f.conditions = append(f.conditions, condition{path: path, op: op, value: value})
+		}
+	}
+
+	return f, nil
+}
+
+func hasOperators(m map[string]any) bool {
+	for k := range m {
+		if strings.HasPrefix(k, "$") {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns true if the metadata satisfies all the conditions of the filter
+func (f *Filter) Match(metadata map[string]any) bool {
+	if f == nil {
+		return true
+	}
+
+	for _, c := range f.conditions {
+		v, found := lookup(metadata, c.path)
+		if !c.match(v, found) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func lookup(metadata map[string]any, path []string) (any, bool) {
+	var v any = metadata
+	for _, p := range path {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		v, ok = m[p]
+		if !ok {
+			return nil, false
+		}
+	}
+
+	return v, true
+}
+
+func (c condition) match(v any, found bool) bool {
+	switch c.op {
+	case "$eq":
+		return found && equalsAny(v, c.value)
+	case "$ne":
+		return !found || !equalsAny(v, c.value)
+	case "$in":
+		return found && inList(v, c.value.([]any))
+	case "$nin":
+		return !found || !inList(v, c.value.([]any))
+	}
+
+	n, ok := v.(float64)
+	if !found || !ok {
+		return false
+	}
+	bound := c.value.(float64)
+
+	switch c.op {
+	case "$gt":
+		return n > bound
+	case "$gte":
+		return n >= bound
+	case "$lt":
+		return n < bound
+	case "$lte":
+		return n <= bound
+	}
+
+	return false
+}
+
+// equalsAny compares v with value, if v is an array it is enough for one of its elements to be equal
+func equalsAny(v, value any) bool {
+	if reflect.DeepEqual(v, value) {
+		return true
+	}
+
+	if arr, ok := v.([]any); ok {
+		for _, e := range arr {
+			if reflect.DeepEqual(e, value) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func inList(v any, list []any) bool {
+	for _, value := range list {
+		if equalsAny(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,68 @@
+package store_test
+
+import (
+	. "github.com/mudler/LocalAI/pkg/store"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Filter", func() {
+	metadata := map[string]any{
+		"tenant":   "acme",
+		"doc_type": "pdf",
+		"year":     float64(2022),
+		"tags":     []any{"finance", "q3"},
+		"author":   map[string]any{"name": "jane"},
+	}
+
+	match := func(filter string) bool {
+		f, err := ParseFilter(filter)
+		Expect(err).ToNot(HaveOccurred())
+		return f.Match(metadata)
+	}
+
+	It("matches everything when empty", func() {
+		Expect(match("")).To(BeTrue())
+		Expect(match("{}")).To(BeTrue())
+	})
+
+	It("matches on equality", func() {
+		Expect(match(`{"tenant": "acme", "doc_type": "pdf"}`)).To(BeTrue())
+		Expect(match(`{"tenant": "acme", "doc_type": "docx"}`)).To(BeFalse())
+		Expect(match(`{"year": 2022}`)).To(BeTrue())
+		Expect(match(`{"missing": "acme"}`)).To(BeFalse())
+		Expect(match(`{"tenant": {"$ne": "other"}}`)).To(BeTrue())
+	})
+
+	It("matches on in and not in", func() {
+		Expect(match(`{"doc_type": {"$in": ["pdf", "docx"]}}`)).To(BeTrue())
+		Expect(match(`{"doc_type": {"$in": ["md", "docx"]}}`)).To(BeFalse())
+		Expect(match(`{"doc_type": {"$nin": ["md", "docx"]}}`)).To(BeTrue())
+	})
+
+	It("matches on numeric ranges", func() {
+		Expect(match(`{"year": {"$gte": 2020, "$lt": 2024}}`)).To(BeTrue())
+		Expect(match(`{"year": {"$gt": 2022}}`)).To(BeFalse())
+		Expect(match(`{"year": {"$lte": 2022}}`)).To(BeTrue())
+		Expect(match(`{"tenant": {"$gt": 1}}`)).To(BeFalse())
+	})
+
+	It("matches arrays and nested fields", func() {
+		Expect(match(`{"tags": "q3"}`)).To(BeTrue())
+		Expect(match(`{"tags": {"$in": ["q4", "finance"]}}`)).To(BeTrue())
+		Expect(match(`{"author.name": "jane"}`)).To(BeTrue())
+		Expect(match(`{"author": {"name": "jane"}}`)).To(BeTrue())
+	})
+
+	It("rejects invalid filters", func() {
+		_, err := ParseFilter(`[1, 2]`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseFilter(`{"year": {"$between": [1, 2]}}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseFilter(`{"year": {"$gt": "2020"}}`)
+		Expect(err).To(HaveOccurred())
+		_, err = ParseFilter(`{"doc_type": {"$in": "pdf"}}`)
+		Expect(err).To(HaveOccurred())
+	})
+})
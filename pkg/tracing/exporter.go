@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// writerExporter writes the spans as JSON lines, e.g. to stdout or to a file
+type writerExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+	// closer closes the file of the file exporter on shutdown
+	closer io.Closer
+}
+
+func newWriterExporter(w io.Writer, closer io.Closer) *writerExporter {
+	return &writerExporter{w: w, closer: closer}
+}
+
+// Span is a span written by the stdout and file exporters
+type Span struct {
+	Name         string         `json:"name"`
+	Service      string         `json:"service,omitempty"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Kind         string         `json:"kind"`
+	Start        time.Time      `json:"start"`
+	End          time.Time      `json:"end"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Events       []SpanEvent    `json:"events,omitempty"`
+	Status       string         `json:"status,omitempty"`
+	Error        string         `json:"error,omitempty"`
+}
+
+type SpanEvent struct {
+	Name       string         `json:"name"`
+	Time       time.Time      `json:"time"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+func attributeMap(attributes []attribute.KeyValue) map[string]any {
+	if len(attributes) == 0 {
+		return nil
+	}
+	m := map[string]any{}
+	for _, a := range attributes {
+		m[string(a.Key)] = a.Value.AsInterface()
+	}
+	return m
+}
+
+func (e *writerExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, s := range spans {
+		span := Span{
+			Name:       s.Name(),
+			TraceID:    s.SpanContext().TraceID().String(),
+			SpanID:     s.SpanContext().SpanID().String(),
+			Kind:       s.SpanKind().String(),
+			Start:      s.StartTime(),
+			End:        s.EndTime(),
+			Attributes: attributeMap(s.Attributes()),
+		}
+		if s.Parent().IsValid() {
+			span.ParentSpanID = s.Parent().SpanID().String()
+		}
+		if service, ok := s.Resource().Set().Value("service.name"); ok {
+			span.Service = service.AsString()
+		}
+		for _, event := range s.Events() {
+			span.Events = append(span.Events, SpanEvent{Name: event.Name, Time: event.Time, Attributes: attributeMap(event.Attributes)})
+		}
+		if s.Status().Code != codes.Unset {
+			span.Status = s.Status().Code.String()
+			span.Error = s.Status().Description
+		}
+
+		// A line is written at once, the backends can append their spans to the same file
+		data, err := json.Marshal(span)
+		if err != nil {
+			return err
+		}
+		if _, err := e.w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *writerExporter) Shutdown(ctx context.Context) error {
+	if e.closer != nil {
+		return e.closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const scope = "github.com/mudler/LocalAI/pkg/tracing"
+
+// metadataCarrier carries the trace context in the metadata of the gRPC calls
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	values := metadata.MD(c).Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// startRPCSpan starts the span of the gRPC call of method, named after the service and the method as
+// backend.Backend/Predict
+func startRPCSpan(ctx context.Context, method string, kind trace.SpanKind) (context.Context, trace.Span) {
+	name := strings.TrimPrefix(method, "/")
+	service, rpc, _ := strings.Cut(name, "/")
+	// The tracer is looked up at each call, so that the calls are traced once Setup is called
+	return otel.Tracer(scope).Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(
+		attribute.String("rpc.system", "grpc"),
+		attribute.String("rpc.service", service),
+		attribute.String("rpc.method", rpc),
+	))
+}
+
+// endRPCSpan records the status of the gRPC call and ends its span
+func endRPCSpan(span trace.Span, err error) {
+	if err != nil {
+		s, _ := status.FromError(err)
+		span.SetAttributes(attribute.String("rpc.grpc.status_code", s.Code().String()))
+		span.SetStatus(codes.Error, s.Message())
+	}
+	span.End()
+}
+
+// inject injects the trace context of ctx in the outgoing metadata of the gRPC call
+func inject(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if ok {
+		md = md.Copy()
+	} else {
+		md = metadata.MD{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// extract returns ctx with the trace context of the incoming metadata of the gRPC call
+func extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, metadataCarrier(md))
+}
+
+// DialOptions returns the gRPC dial options which trace the calls of a client and propagate their trace context
+// to the server in the metadata of the calls
+func DialOptions() []grpc.DialOption {
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			ctx, span := startRPCSpan(ctx, method, trace.SpanKindClient)
+			err := invoker(inject(ctx), method, req, reply, cc, opts...)
+			endRPCSpan(span, err)
+			return err
+		}),
+		grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			ctx, span := startRPCSpan(ctx, method, trace.SpanKindClient)
+			stream, err := streamer(inject(ctx), desc, cc, method, opts...)
+			if err != nil {
+				endRPCSpan(span, err)
+				return nil, err
+			}
+			return &tracedClientStream{ClientStream: stream, span: span}, nil
+		}),
+	}
+}
+
+// tracedClientStream ends the span of the call when the stream ends
+type tracedClientStream struct {
+	grpc.ClientStream
+	span  trace.Span
+	ended bool
+}
+
+func (s *tracedClientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil && !s.ended {
+		s.ended = true
+		if errors.Is(err, io.EOF) {
+			endRPCSpan(s.span, nil)
+		} else {
+			endRPCSpan(s.span, err)
+		}
+	}
+	return err
+}
+
+// ServerOptions returns the gRPC server options which continue the traces propagated by the clients in the
+// metadata of the calls
+func ServerOptions() []grpc.ServerOption {
+	return []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+			ctx, span := startRPCSpan(extract(ctx), info.FullMethod, trace.SpanKindServer)
+			resp, err := handler(ctx, req)
+			endRPCSpan(span, err)
+			return resp, err
+		}),
+		grpc.ChainStreamInterceptor(func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			ctx, span := startRPCSpan(extract(ss.Context()), info.FullMethod, trace.SpanKindServer)
+			err := handler(srv, &tracedServerStream{ServerStream: ss, ctx: ctx})
+			endRPCSpan(span, err)
+			return err
+		}),
+	}
+}
+
+// tracedServerStream is a server stream whose context carries the span of the call
+type tracedServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *tracedServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,126 @@
+// Package tracing sets up the OpenTelemetry tracing of LocalAI and of its backends, which continue the traces of
+// the requests propagated in the metadata of the gRPC calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+const (
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+// The environment variables of the configuration, which the backends inherit from LocalAI
+const (
+	envExporter    = "LOCALAI_TRACING_EXPORTER"
+	envEndpoint    = "LOCALAI_TRACING_ENDPOINT"
+	envFile        = "LOCALAI_TRACING_FILE"
+	envSampleRatio = "LOCALAI_TRACING_SAMPLE_RATIO"
+)
+
+// Config is the configuration of the tracing
+type Config struct {
+	// Exporter exports the spans: otlp, stdout or file. The tracing is disabled when empty.
+	Exporter string
+	// Endpoint is the URL of the OTLP/HTTP collector. When empty, the exporter honors the OTEL_EXPORTER_OTLP_*
+	// environment variables, and sends the spans to http://localhost:4318 by default.
+	Endpoint string
+	// File is the file to which the file exporter appends the spans, as JSON lines
+	File string
+	// SampleRatio is the ratio of the traces started by LocalAI which are recorded, all of them when 0. The traces of
+	// the requests with a trace context are recorded if their parent span is.
+	SampleRatio float64
+}
+
+func (c Config) Enabled() bool {
+	return c.Exporter != ""
+}
+
+// ConfigFromEnv returns the configuration of the environment variables set by Setenv, e.g. in the backends
+func ConfigFromEnv() Config {
+	ratio, _ := strconv.ParseFloat(os.Getenv(envSampleRatio), 64)
+	return Config{
+		Exporter:    os.Getenv(envExporter),
+		Endpoint:    os.Getenv(envEndpoint),
+		File:        os.Getenv(envFile),
+		SampleRatio: ratio,
+	}
+}
+
+// Setenv sets the configuration in the environment variables, for the backends started by LocalAI
+func (c Config) Setenv() error {
+	for name, value := range map[string]string{
+		envExporter:    c.Exporter,
+		envEndpoint:    c.Endpoint,
+		envFile:        c.File,
+		envSampleRatio: strconv.FormatFloat(c.SampleRatio, 'f', -1, 64),
+	} {
+		if err := os.Setenv(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Setup sets the global tracer provider, which exports the spans of the service with the exporter of c, and the
+// propagation of the trace context and of the baggage. It returns the function flushing the spans and stopping the
+// exporter.
+func Setup(c Config, service string) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	switch c.Exporter {
+	case ExporterOTLP:
+		var opts []otlptracehttp.Option
+		if c.Endpoint != "" {
+			// The endpoint is the base URL of the collector, as OTEL_EXPORTER_OTLP_ENDPOINT
+			url := strings.TrimSuffix(c.Endpoint, "/")
+			if !strings.HasSuffix(url, "/v1/traces") {
+				url += "/v1/traces"
+			}
+			opts = append(opts, otlptracehttp.WithEndpointURL(url))
+		}
+		var err error
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, err
+		}
+	case ExporterStdout:
+		exporter = newWriterExporter(os.Stdout, nil)
+	case ExporterFile:
+		if c.File == "" {
+			return nil, fmt.Errorf("the file exporter needs a file")
+		}
+		f, err := os.OpenFile(c.File, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		exporter = newWriterExporter(f, f)
+	default:
+		return nil, fmt.Errorf("unknown tracing exporter %q, expected otlp, stdout or file", c.Exporter)
+	}
+
+	sampler := sdktrace.AlwaysSample()
+	if c.SampleRatio > 0 && c.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(c.SampleRatio)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", service))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
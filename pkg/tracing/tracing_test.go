@@ -0,0 +1,193 @@
+package tracing_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/LocalAI/pkg/tracing"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+)
+
+// tracer returns the tracer of the provider set by the last Setup
+func tracer() trace.Tracer {
+	return otel.Tracer("github.com/mudler/LocalAI/pkg/tracing_test")
+}
+
+// readSpans returns the spans written by the file exporter
+func readSpans(path string) []Span {
+	f, err := os.Open(path)
+	Expect(err).ToNot(HaveOccurred())
+	defer f.Close()
+
+	spans := []Span{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span Span
+		Expect(json.Unmarshal(scanner.Bytes(), &span)).To(Succeed())
+		spans = append(spans, span)
+	}
+	Expect(scanner.Err()).ToNot(HaveOccurred())
+	return spans
+}
+
+var _ = Describe("Tracing", func() {
+	var path string
+	var shutdown func(context.Context) error
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "spans.jsonl")
+		var err error
+		shutdown, err = Setup(Config{Exporter: ExporterFile, File: path}, "test")
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("writes the spans to the file", func() {
+		_, span := tracer().Start(context.Background(), "request")
+		span.SetStatus(codes.Error, "failed")
+		span.End()
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		spans := readSpans(path)
+		Expect(spans).To(HaveLen(1))
+		Expect(spans[0].Name).To(Equal("request"))
+		Expect(spans[0].Service).To(Equal("test"))
+		Expect(spans[0].Status).To(Equal("Error"))
+		Expect(spans[0].Error).To(Equal("failed"))
+		Expect(spans[0].ParentSpanID).To(BeEmpty())
+	})
+
+	It("rejects an unknown exporter", func() {
+		Expect(shutdown(context.Background())).To(Succeed())
+		_, err := Setup(Config{Exporter: "jaeger"}, "test")
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("continues the traces of the gRPC calls in the server", func() {
+		listener := bufconn.Listen(1 << 20)
+		server := grpc.NewServer(ServerOptions()...)
+		healthpb.RegisterHealthServer(server, health.NewServer())
+		go server.Serve(listener)
+		defer server.Stop()
+
+		conn, err := grpc.NewClient("passthrough:///bufnet", append(DialOptions(),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }))...)
+		Expect(err).ToNot(HaveOccurred())
+		defer conn.Close()
+		client := healthpb.NewHealthClient(conn)
+
+		ctx, request := tracer().Start(context.Background(), "request")
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{})
+		Expect(err).ToNot(HaveOccurred())
+		watchCtx, cancelWatch := context.WithCancel(ctx)
+		stream, err := client.Watch(watchCtx, &healthpb.HealthCheckRequest{Service: "unknown"})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = stream.Recv()
+		Expect(err).ToNot(HaveOccurred())
+		// The span of the stream ends with the stream
+		cancelWatch()
+		_, err = stream.Recv()
+		Expect(err).To(HaveOccurred())
+		_, err = client.Check(ctx, &healthpb.HealthCheckRequest{Service: "unknown"})
+		Expect(err).To(HaveOccurred())
+		request.End()
+
+		conn.Close()
+		server.GracefulStop()
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		spans := readSpans(path)
+		root := request.SpanContext()
+		byKind := func(kind string) []Span {
+			result := []Span{}
+			for _, s := range spans {
+				if s.Kind == kind {
+					result = append(result, s)
+				}
+			}
+			return result
+		}
+		clients, servers := byKind("client"), byKind("server")
+		Expect(clients).To(HaveLen(3))
+		Expect(servers).To(HaveLen(3))
+		for _, c := range clients {
+			Expect(c.TraceID).To(Equal(root.TraceID().String()))
+			Expect(c.ParentSpanID).To(Equal(root.SpanID().String()))
+			Expect(c.Attributes).To(HaveKeyWithValue("rpc.service", "grpc.health.v1.Health"))
+		}
+		for _, s := range servers {
+			Expect(s.TraceID).To(Equal(root.TraceID().String()))
+			Expect(clients).To(ContainElement(HaveField("SpanID", s.ParentSpanID)))
+		}
+
+		failed := 0
+		for _, c := range clients {
+			if c.Name == "grpc.health.v1.Health/Check" && c.Status == "Error" {
+				failed++
+				Expect(c.Attributes).To(HaveKeyWithValue("rpc.grpc.status_code", "NotFound"))
+			}
+		}
+		Expect(failed).To(Equal(1))
+	})
+
+	It("sends the spans to an OTLP collector", func() {
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		// The exporter honors the OTEL_EXPORTER_OTLP_* variables, e.g. the headers authenticating to the collector
+		GinkgoT().Setenv("OTEL_EXPORTER_OTLP_HEADERS", "authorization=Bearer secret")
+
+		requests := make(chan *collectortrace.ExportTraceServiceRequest, 1)
+		collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+			Expect(r.URL.Path).To(Equal("/v1/traces"))
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer secret"))
+			body, err := io.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			request := &collectortrace.ExportTraceServiceRequest{}
+			Expect(proto.Unmarshal(body, request)).To(Succeed())
+			requests <- request
+		}))
+		defer collector.Close()
+
+		shutdown, err := Setup(Config{Exporter: ExporterOTLP, Endpoint: collector.URL}, "test")
+		Expect(err).ToNot(HaveOccurred())
+		ctx, parent := tracer().Start(context.Background(), "request")
+		_, child := tracer().Start(ctx, "model.load")
+		child.End()
+		parent.End()
+		Expect(shutdown(context.Background())).To(Succeed())
+
+		var request *collectortrace.ExportTraceServiceRequest
+		Eventually(requests).Should(Receive(&request))
+		Expect(request.ResourceSpans).To(HaveLen(1))
+		resource := request.ResourceSpans[0]
+		Expect(resource.Resource.Attributes).To(ContainElement(And(
+			HaveField("Key", "service.name"),
+			HaveField("Value.GetStringValue()", "test"),
+		)))
+		spans := resource.ScopeSpans[0].Spans
+		Expect(spans).To(HaveLen(2))
+		Expect(spans[0].Name).To(Equal("model.load"))
+		traceID, spanID := parent.SpanContext().TraceID(), parent.SpanContext().SpanID()
+		Expect(spans[0].TraceId).To(Equal(traceID[:]))
+		Expect(spans[0].ParentSpanId).To(Equal(spanID[:]))
+	})
+})
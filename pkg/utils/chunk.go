@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ChunkText splits a text in chunks of at most size characters, breaking on whitespace.
+// Consecutive chunks share about overlap characters, so a sentence that is split between two
+// chunks can still be found in one of them. A single word longer than size is kept whole.
+func ChunkText(text string, size, overlap int) []string {
+	words := strings.FieldsFunc(text, unicode.IsSpace)
+	if len(words) == 0 {
+		return nil
+	}
+
+	if size <= 0 {
+		return []string{strings.Join(words, " ")}
+	}
+	if overlap < 0 || overlap >= size {
+		overlap = 0
+	}
+
+	chunks := []string{}
+	start := 0
+	for start < len(words) {
+		end := start
+		length := 0
+		for end < len(words) {
+			l := len(words[end])
+			if end > start {
+				l++ // the space before the word
+			}
+			if end > start && length+l > size {
+				break
+			}
+			length += l
+			end++
+		}
+
+		chunks = append(chunks, strings.Join(words[start:end], " "))
+		if end == len(words) {
+			break
+		}
+
+		// Step back over the last words of the chunk to overlap the next one, always moving forward
+		next := end
+		for back := 0; next-1 > start; next-- {
+			back += len(words[next-1]) + 1
+			if back > overlap {
+				break
+			}
+		}
+		start = next
+	}
+
+	return chunks
+}
@@ -0,0 +1,34 @@
+package utils_test
+
+import (
+	"strings"
+
+	. "github.com/mudler/LocalAI/pkg/utils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/chunk tests", func() {
+	It("returns nothing for an empty text", func() {
+		Expect(ChunkText("  \n ", 10, 2)).To(BeEmpty())
+	})
+	It("keeps a short text in one chunk", func() {
+		Expect(ChunkText("hello\n\nworld", 100, 10)).To(Equal([]string{"hello world"}))
+	})
+	It("splits on whitespace without exceeding the size", func() {
+		chunks := ChunkText("aaa bbb ccc ddd eee", 7, 0)
+		Expect(chunks).To(Equal([]string{"aaa bbb", "ccc ddd", "eee"}))
+	})
+	It("overlaps consecutive chunks", func() {
+		chunks := ChunkText("aaa bbb ccc ddd eee", 11, 4)
+		Expect(chunks).To(Equal([]string{"aaa bbb ccc", "ccc ddd eee"}))
+	})
+	It("keeps words longer than the size whole", func() {
+		chunks := ChunkText("a "+strings.Repeat("b", 20)+" c", 5, 2)
+		Expect(chunks).To(Equal([]string{"a", strings.Repeat("b", 20), "c"}))
+	})
+	It("always moves forward when the overlap covers the whole chunk", func() {
+		chunks := ChunkText("aaaa bbbb cccc", 9, 8)
+		Expect(chunks).To(Equal([]string{"aaaa bbbb", "bbbb cccc"}))
+	})
+})
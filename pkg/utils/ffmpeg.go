@@ -5,6 +5,9 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
+
+	"github.com/go-audio/wav"
 )
 
 func ffmpegCommand(args []string) (string, error) {
@@ -53,3 +56,13 @@ func AudioConvert(src string, format string) (string, error) {
 	}
 	return dst, nil
 }
+
+// WavDuration returns the duration of the audio of a wav file
+func WavDuration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return wav.NewDecoder(f).Duration()
+}
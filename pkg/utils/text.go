@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+func pdftotextCommand(args []string) (string, error) {
+	cmd := exec.Command("pdftotext", args...) // Constrain this to pdftotext to permit security scanner to see that the command is safe.
+	cmd.Env = os.Environ()
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// PDFToText extracts the text of a PDF file, it requires pdftotext (poppler-utils) to be installed.
+func PDFToText(src string) (string, error) {
+	out, err := pdftotextCommand([]string{"-layout", "-enc", "UTF-8", src, "-"})
+	if err != nil {
+		return "", fmt.Errorf("failed converting %s to text: %w", src, err)
+	}
+	return out, nil
+}
+
+// ExtractText returns the text content of a file. PDFs are converted to text,
+// any other file must be UTF-8 text (plain text, markdown, source code...).
+func ExtractText(path string) (string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return PDFToText(path)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	if !utf8.Valid(content) {
+		return "", fmt.Errorf("unsupported file %s: only text and PDF files can be indexed", filepath.Base(path))
+	}
+
+	return string(content), nil
+}
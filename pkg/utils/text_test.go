@@ -0,0 +1,34 @@
+package utils_test
+
+import (
+	"os"
+	"path/filepath"
+
+	. "github.com/mudler/LocalAI/pkg/utils"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/text tests", func() {
+	var dir string
+
+	BeforeEach(func() {
+		dir = GinkgoT().TempDir()
+	})
+
+	It("reads text and markdown files", func() {
+		path := filepath.Join(dir, "README.md")
+		Expect(os.WriteFile(path, []byte("# Title\n\nSome text"), 0600)).To(Succeed())
+
+		text, err := ExtractText(path)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(text).To(Equal("# Title\n\nSome text"))
+	})
+	It("rejects binary files", func() {
+		path := filepath.Join(dir, "image.png")
+		Expect(os.WriteFile(path, []byte{0x89, 0x50, 0x4e, 0x47, 0xff, 0xfe}, 0600)).To(Succeed())
+
+		_, err := ExtractText(path)
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -3,15 +3,19 @@ package integration_test
 import (
 	"context"
 	"embed"
+	"fmt"
 	"math"
+	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/mudler/LocalAI/core/backend"
 	"github.com/mudler/LocalAI/core/config"
 	"github.com/mudler/LocalAI/pkg/assets"
 	"github.com/mudler/LocalAI/pkg/grpc"
@@ -225,5 +229,244 @@ var _ = Describe("Integration tests for the stores backend(s) and internal APIs"
 			Expect(ks[1]).To(Equal(keys[1]))
 			Expect(vals[1]).To(Equal(vals[1]))
 		})
+
+		It("should find the same keys with the HNSW index as with an exact search", func() {
+			r := rand.New(rand.NewSource(1))
+			keys := make([][]float32, 2000)
+			vals := make([][]byte, len(keys))
+			for i := range keys {
+				keys[i] = make([]float32, 16)
+				for j := range keys[i] {
+					keys[i][j] = r.Float32()*2 - 1
+				}
+				vals[i] = []byte(fmt.Sprintf("test%d", i))
+			}
+
+			err := store.SetCols(context.Background(), sc, keys, vals)
+			Expect(err).ToNot(HaveOccurred())
+
+			hnsw := store.FindOptions{Index: "hnsw", M: 16, EfConstruction: 100, Ef: 100}
+
+			found, total := 0, 0
+			for _, q := range keys[:20] {
+				exactKeys, _, _, err := store.Find(context.Background(), sc, q, 10)
+				Expect(err).ToNot(HaveOccurred())
+
+				approxKeys, approxVals, _, sims, err := store.FindWithOptions(context.Background(), sc, q, 10, hnsw)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(approxKeys).To(HaveLen(10))
+				Expect(approxVals).To(HaveLen(10))
+				Expect(sims[0]).To(BeNumerically("~", 1, 0.0001))
+
+				for _, k := range exactKeys {
+					total++
+					for _, ak := range approxKeys {
+						if slices.Equal(k, ak) {
+							found++
+							break
+						}
+					}
+				}
+			}
+
+			Expect(float64(found) / float64(total)).To(BeNumerically(">=", 0.9))
+
+			// Deleted keys are not returned by the index
+			err = store.DeleteSingle(context.Background(), sc, keys[0])
+			Expect(err).ToNot(HaveOccurred())
+
+			approxKeys, _, _, _, err := store.FindWithOptions(context.Background(), sc, keys[0], 5, hnsw)
+			Expect(err).ToNot(HaveOccurred())
+			for _, k := range approxKeys {
+				Expect(k).ToNot(Equal(keys[0]))
+			}
+		})
+
+		It("should reject an unknown index", func() {
+			err := store.SetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3}, []byte("test"))
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, _, _, err = store.FindWithOptions(context.Background(), sc, []float32{0.1, 0.2, 0.3}, 1, store.FindOptions{Index: "ivf"})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should store and filter on metadata", func() {
+			keys := [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}, {0.1, 0.2, 0.4}}
+			vals := [][]byte{[]byte("test1"), []byte("test2"), []byte("test3"), []byte("test4")}
+			metadata := []map[string]any{
+				{"tenant": "acme", "year": 2021.0},
+				{"tenant": "acme", "year": 2019.0},
+				{"tenant": "other", "year": 2022.0},
+				nil,
+			}
+
+			err := store.SetColsWithMetadata(context.Background(), sc, keys, vals, metadata)
+			Expect(err).ToNot(HaveOccurred())
+
+			_, _, ms, err := store.GetColsWithMetadata(context.Background(), sc, keys[:1])
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ms).To(Equal(metadata[:1]))
+
+			for _, index := range []string{"exact", "hnsw"} {
+				ks, vs, ms, _, err := store.FindWithOptions(context.Background(), sc, keys[0], 4, store.FindOptions{
+					Index:  index,
+					Filter: map[string]any{"tenant": "acme", "year": map[string]any{"$gte": 2020}},
+				})
+				Expect(err).ToNot(HaveOccurred())
+				Expect(ks).To(Equal(keys[:1]))
+				Expect(vs).To(Equal(vals[:1]))
+				Expect(ms).To(Equal(metadata[:1]))
+			}
+
+			_, _, _, _, err = store.FindWithOptions(context.Background(), sc, keys[0], 4, store.FindOptions{
+				Filter: map[string]any{"tenant": map[string]any{"$regex": "a.*"}},
+			})
+			Expect(err).To(HaveOccurred())
+		})
+
+		It("should list, count and drop keys", func() {
+			keys := [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}}
+			vals := [][]byte{[]byte("test1"), []byte("test2"), []byte("test3")}
+			metadata := []map[string]any{{"tenant": "acme"}, {"tenant": "acme"}, {"tenant": "other"}}
+
+			err := store.SetColsWithMetadata(context.Background(), sc, keys, vals, metadata)
+			Expect(err).ToNot(HaveOccurred())
+
+			count, err := store.Count(context.Background(), sc, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(3))
+
+			count, err = store.Count(context.Background(), sc, map[string]any{"tenant": "acme"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(2))
+
+			ks, vs, ms, total, err := store.List(context.Background(), sc, map[string]any{"tenant": "acme"}, 1, 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(total).To(Equal(2))
+			Expect(ks).To(HaveLen(1))
+			Expect(vs).To(HaveLen(1))
+			Expect(ms).To(Equal(metadata[:1]))
+
+			ks, _, _, total, err = store.List(context.Background(), sc, nil, 0, 0)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(total).To(Equal(3))
+			Expect(ks).To(HaveLen(3))
+
+			err = store.Drop(context.Background(), sc)
+			Expect(err).ToNot(HaveOccurred())
+
+			count, err = store.Count(context.Background(), sc, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(0))
+		})
+	})
+
+	Context("Persistent Store", func() {
+		var sl *model.ModelLoader
+		var appConfig *config.ApplicationConfig
+		var tmpdir string
+
+		BeforeEach(func() {
+			var err error
+
+			tmpdir, err = os.MkdirTemp("", "")
+			Expect(err).ToNot(HaveOccurred())
+			backendAssetsDir := filepath.Join(tmpdir, "backend-assets")
+			err = os.Mkdir(backendAssetsDir, 0750)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = assets.ExtractFiles(backendAssets, backendAssetsDir)
+			Expect(err).ToNot(HaveOccurred())
+
+			appConfig = config.NewApplicationConfig(
+				config.WithBackendAssetsOutput(backendAssetsDir),
+				config.WithStoresDir(filepath.Join(tmpdir, "stores")),
+			)
+
+			sl = model.NewModelLoader("")
+		})
+
+		AfterEach(func() {
+			err := sl.StopAllGRPC()
+			Expect(err).ToNot(HaveOccurred())
+			err = os.RemoveAll(tmpdir)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("should keep keys across backend restarts", func() {
+			sc, err := backend.StoreBackend(sl, appConfig, "persistent")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = store.SetCols(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}, {0.4, 0.5, 0.6}, {0.7, 0.8, 0.9}}, [][]byte{[]byte("test1"), []byte("test2"), []byte("test3")})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = store.DeleteSingle(context.Background(), sc, []float32{0.4, 0.5, 0.6})
+			Expect(err).ToNot(HaveOccurred())
+
+			Expect(filepath.Join(tmpdir, "stores", "persistent")).To(BeADirectory())
+
+			// Kill the backend, the store is reloaded from disk on the next request
+			err = sl.StopAllGRPC()
+			Expect(err).ToNot(HaveOccurred())
+
+			sc, err = backend.StoreBackend(sl, appConfig, "persistent")
+			Expect(err).ToNot(HaveOccurred())
+
+			val, err := store.GetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(val).To(Equal([]byte("test1")))
+
+			val, err = store.GetSingle(context.Background(), sc, []float32{0.7, 0.8, 0.9})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(val).To(Equal([]byte("test3")))
+
+			val, _ = store.GetSingle(context.Background(), sc, []float32{0.4, 0.5, 0.6})
+			Expect(val).To(BeNil())
+		})
+
+		It("should keep metadata and drops across backend restarts", func() {
+			sc, err := backend.StoreBackend(sl, appConfig, "persistent")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = store.SetColsWithMetadata(context.Background(), sc, [][]float32{{0.1, 0.2, 0.3}}, [][]byte{[]byte("test1")}, []map[string]any{{"tenant": "acme"}})
+			Expect(err).ToNot(HaveOccurred())
+
+			err = sl.StopAllGRPC()
+			Expect(err).ToNot(HaveOccurred())
+
+			sc, err = backend.StoreBackend(sl, appConfig, "persistent")
+			Expect(err).ToNot(HaveOccurred())
+
+			count, err := store.Count(context.Background(), sc, map[string]any{"tenant": "acme"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(1))
+
+			err = store.Drop(context.Background(), sc)
+			Expect(err).ToNot(HaveOccurred())
+
+			err = sl.StopAllGRPC()
+			Expect(err).ToNot(HaveOccurred())
+
+			sc, err = backend.StoreBackend(sl, appConfig, "persistent")
+			Expect(err).ToNot(HaveOccurred())
+
+			count, err = store.Count(context.Background(), sc, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(count).To(Equal(0))
+		})
+
+		It("should not share data between stores", func() {
+			sc, err := backend.StoreBackend(sl, appConfig, "first")
+			Expect(err).ToNot(HaveOccurred())
+
+			err = store.SetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3}, []byte("test"))
+			Expect(err).ToNot(HaveOccurred())
+
+			sc, err = backend.StoreBackend(sl, appConfig, "second")
+			Expect(err).ToNot(HaveOccurred())
+
+			val, _ := store.GetSingle(context.Background(), sc, []float32{0.1, 0.2, 0.3})
+			Expect(val).To(BeNil())
+		})
 	})
 })